@@ -22,6 +22,7 @@ import (
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
 	"github.com/wangxu0213/esnote-kernel/model"
+	"github.com/wangxu0213/esnote-kernel/sql"
 	"github.com/wangxu0213/esnote-kernel/treenode"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -110,3 +111,84 @@ func resetBlockAttrs(c *gin.Context) {
 		return
 	}
 }
+
+// queryBlocksByAttrs 查询满足所有属性条件的块，条件支持 =、!=、in、like、exists 和按照数字、日期或者布尔值进行的范围比较。
+func queryBlocksByAttrs(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	data, err := gulu.JSON.MarshalJSON(arg["conds"])
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	var conds []*sql.AttrCondition
+	if err = gulu.JSON.UnmarshalJSON(data, &conds); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	page, pageSize := 1, 64
+	if pageArg := arg["page"]; nil != pageArg {
+		page = int(pageArg.(float64))
+	}
+	if pageSizeArg := arg["pageSize"]; nil != pageSizeArg {
+		pageSize = int(pageSizeArg.(float64))
+	}
+	if 1 > pageSize {
+		pageSize = 64
+	} else if 1024 < pageSize {
+		pageSize = 1024
+	}
+
+	blocks, total, err := sql.QueryBlocksByAttrs(conds, page, pageSize)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	if nil == blocks {
+		blocks = []*sql.Block{}
+	}
+	ret.Data = map[string]interface{}{
+		"blocks":    blocks,
+		"total":     total,
+		"pageCount": (total + pageSize - 1) / pageSize,
+	}
+}
+
+func getAttrSchema(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	ret.Data = model.GetAttrSchema()
+}
+
+func setAttrSchema(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	schema := map[string]string{}
+	if schemaArg, ok := arg["schema"].(map[string]interface{}); ok {
+		for name, valueType := range schemaArg {
+			schema[name], _ = valueType.(string)
+		}
+	}
+	if err := model.SetAttrSchema(schema); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
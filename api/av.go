@@ -17,10 +17,15 @@
 package api
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
+	"github.com/wangxu0213/esnote-kernel/av"
+	"github.com/wangxu0213/esnote-kernel/logging"
 	"github.com/wangxu0213/esnote-kernel/model"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -35,7 +40,31 @@ func renderAttributeView(c *gin.Context) {
 	}
 
 	id := arg["id"].(string)
-	data, err := model.RenderAttributeView(id)
+	page, pageSize := 1, 0
+	if pageArg := arg["page"]; nil != pageArg {
+		page = int(pageArg.(float64))
+	}
+	if pageSizeArg := arg["pageSize"]; nil != pageSizeArg {
+		pageSize = int(pageSizeArg.(float64))
+	}
+	viewID := ""
+	if viewIDArg := arg["viewID"]; nil != viewIDArg {
+		viewID = viewIDArg.(string)
+	}
+	var start, end int64
+	var err error
+	if start, err = calendarTimeArg(arg["start"]); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	if end, err = calendarTimeArg(arg["end"]); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	data, err := model.RenderAttributeView(id, viewID, page, pageSize, start, end)
 	if nil != err {
 		ret.Code = -1
 		ret.Msg = err.Error()
@@ -43,3 +72,112 @@ func renderAttributeView(c *gin.Context) {
 	}
 	ret.Data = data
 }
+
+// calendarTimeArg 解析日历时间范围参数，支持毫秒时间戳数字和日期字符串。
+func calendarTimeArg(arg interface{}) (ret int64, err error) {
+	switch v := arg.(type) {
+	case float64:
+		ret = int64(v)
+	case string:
+		ret, err = av.ParseCalendarTime(v)
+	}
+	return
+}
+
+func exportAttributeView(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	format := "csv"
+	if formatArg := arg["format"]; nil != formatArg {
+		format = formatArg.(string)
+	}
+	viewID := ""
+	if viewIDArg := arg["viewID"]; nil != viewIDArg {
+		viewID = viewIDArg.(string)
+	}
+	name, exportPath, err := model.ExportAttributeView(id, viewID, format)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = map[string]interface{}{
+		"name": name,
+		"path": exportPath,
+	}
+}
+
+func importCSV(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	form, err := c.MultipartForm()
+	if nil != err {
+		logging.LogErrorf("parse import CSV failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	files := form.File["file"]
+	if 1 > len(files) || 1 > len(form.Value["notebook"]) {
+		logging.LogErrorf("parse import CSV failed, no file found")
+		ret.Code = -1
+		ret.Msg = "no file found"
+		return
+	}
+	asDocs := 0 < len(form.Value["asDocs"]) && "true" == form.Value["asDocs"][0]
+
+	file := files[0]
+	reader, err := file.Open()
+	if nil != err {
+		logging.LogErrorf("read import CSV failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	defer reader.Close()
+
+	importDir := filepath.Join(util.TempDir, "import")
+	if err = os.MkdirAll(importDir, 0755); nil != err {
+		logging.LogErrorf("make import dir [%s] failed: %s", importDir, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	writePath := filepath.Join(importDir, filepath.Base(file.Filename))
+	defer os.RemoveAll(writePath)
+	writer, err := os.OpenFile(writePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if nil != err {
+		logging.LogErrorf("open import CSV [%s] failed: %s", writePath, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	_, err = io.Copy(writer, reader)
+	writer.Close()
+	if nil != err {
+		logging.LogErrorf("write import CSV failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	avID, docID, err := model.ImportAttributeViewCSV(writePath, form.Value["notebook"][0], asDocs)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = map[string]interface{}{
+		"avID":  avID,
+		"docID": docID,
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
+	"github.com/wangxu0213/esnote-kernel/conf"
 	"github.com/wangxu0213/esnote-kernel/model"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -119,6 +120,38 @@ func checkoutRepo(c *gin.Context) {
 	model.CheckoutRepo(id)
 }
 
+func restoreSnapshotPaths(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	tag := ""
+	if tagArg := arg["tag"]; nil != tagArg {
+		tag = tagArg.(string)
+	}
+	var paths []string
+	for _, p := range arg["paths"].([]interface{}) {
+		paths = append(paths, p.(string))
+	}
+
+	restored, err := model.RestoreSnapshotPaths(tag, id, paths)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"paths": restored,
+	}
+}
+
 func downloadCloudSnapshot(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -348,6 +381,36 @@ func initRepoKeyFromPassphrase(c *gin.Context) {
 	}
 }
 
+func rotateRepoKey(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	pass := ""
+	if passArg := arg["pass"]; nil != passArg {
+		pass = passArg.(string)
+	}
+	withCloud := false
+	if cloudArg := arg["cloud"]; nil != cloudArg {
+		withCloud = cloudArg.(bool)
+	}
+
+	if err := model.RotateRepoKey(pass, withCloud); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"key": model.Conf.Repo.Key,
+	}
+}
+
 func initRepoKey(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -376,6 +439,111 @@ func resetRepo(c *gin.Context) {
 	}
 }
 
+func setRepoRetention(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	retentionArg := arg["retention"].(interface{})
+	data, err := gulu.JSON.MarshalJSON(retentionArg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	retention := &conf.RepoRetention{}
+	if err = gulu.JSON.UnmarshalJSON(data, retention); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	if err = model.SetRepoRetention(retention); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
+func forgetRepoSnapshots(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	dryRun := false
+	if dryRunArg := arg["dryRun"]; nil != dryRunArg {
+		dryRun = dryRunArg.(bool)
+	}
+
+	result, err := model.ForgetRepoSnapshots(dryRun)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = fmt.Sprintf(model.Conf.Language(201), err.Error())
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"keeps":   result.Keeps,
+		"removes": result.Removes,
+		"purge":   result.Purge,
+	}
+}
+
+func checkRepo(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	full := false
+	if fullArg := arg["full"]; nil != fullArg {
+		full = fullArg.(bool)
+	}
+
+	result, err := model.CheckRepo(full)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = fmt.Sprintf(model.Conf.Language(201), err.Error())
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = result
+}
+
+func packCloudRepo(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	count, err := model.PackCloudRepo()
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"count": count,
+	}
+}
+
 func purgeRepo(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -17,11 +17,15 @@
 package api
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
+	"github.com/wangxu0213/esnote-kernel/logging"
 	"github.com/wangxu0213/esnote-kernel/model"
 	"github.com/wangxu0213/esnote-kernel/riff"
 	"github.com/wangxu0213/esnote-kernel/util"
@@ -97,12 +101,101 @@ func reviewRiffCard(c *gin.Context) {
 	cardID := arg["cardID"].(string)
 	rating := int(arg["rating"].(float64))
 	reviewedCardIDs := getReviewedCards(arg)
-	err := model.ReviewFlashcard(deckID, cardID, riff.Rating(rating), reviewedCardIDs)
+	leech, err := model.ReviewFlashcard(deckID, cardID, riff.Rating(rating), reviewedCardIDs)
 	if nil != err {
 		ret.Code = -1
 		ret.Msg = err.Error()
 		return
 	}
+	ret.Data = map[string]interface{}{
+		"leech": leech,
+	}
+}
+
+func suspendRiffCards(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	cardIDs := getCardIDs(arg)
+	suspend := arg["suspend"].(bool)
+	if err := model.SuspendFlashcards(deckID, cardIDs, suspend); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func buryRiffCards(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	cardIDs := getCardIDs(arg)
+	bury := arg["bury"].(bool)
+	if err := model.BuryFlashcards(deckID, cardIDs, bury); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func getRiffLeechCards(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	page := 1
+	if nil != arg["page"] {
+		page = int(arg["page"].(float64))
+	}
+	blocks, total, pageCount := model.GetLeechFlashcards(deckID, page)
+	ret.Data = map[string]interface{}{
+		"blocks":    blocks,
+		"total":     total,
+		"pageCount": pageCount,
+	}
+}
+
+func setRiffDeckLifecycle(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	burySiblings := arg["burySiblings"].(bool)
+	leechLapses := int(arg["leechLapses"].(float64))
+	if err := model.SetDeckLifecycle(deckID, burySiblings, leechLapses); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func getCardIDs(arg map[string]interface{}) (ret []string) {
+	for _, cardID := range arg["cardIDs"].([]interface{}) {
+		ret = append(ret, cardID.(string))
+	}
+	return
 }
 
 func skipReviewRiffCard(c *gin.Context) {
@@ -330,7 +423,11 @@ func createRiffDeck(c *gin.Context) {
 	}
 
 	name := arg["name"].(string)
-	deck, err := model.CreateDeck(name)
+	var algo riff.Algo
+	if nil != arg["algo"] {
+		algo = riff.Algo(arg["algo"].(string))
+	}
+	deck, err := model.CreateDeck(name, algo)
 	if nil != err {
 		ret.Code = -1
 		ret.Msg = err.Error()
@@ -339,6 +436,207 @@ func createRiffDeck(c *gin.Context) {
 	ret.Data = deckData(deck)
 }
 
+func convertRiffDeck(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	algo := riff.Algo(arg["algo"].(string))
+	err := model.ConvertDeck(deckID, algo)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func setRiffDeckConf(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	var params *riff.FSRSParams
+	if nil != arg["fsrsParams"] {
+		data, err := gulu.JSON.MarshalJSON(arg["fsrsParams"])
+		if nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+
+		params = riff.DefaultFSRSParams()
+		if err = gulu.JSON.UnmarshalJSON(data, params); nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+	}
+
+	if err := model.SetDeckConf(deckID, params); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func optimizeRiffDeck(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	apply := false
+	if nil != arg["apply"] {
+		apply = arg["apply"].(bool)
+	}
+
+	result, err := model.OptimizeDeck(deckID, apply)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = result
+}
+
+func importAnkiDeck(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	form, err := c.MultipartForm()
+	if nil != err {
+		logging.LogErrorf("parse import Anki package failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	files := form.File["file"]
+	if 1 > len(files) || 1 > len(form.Value["notebook"]) {
+		logging.LogErrorf("parse import Anki package failed, no file found")
+		ret.Code = -1
+		ret.Msg = "no file found"
+		return
+	}
+	file := files[0]
+	reader, err := file.Open()
+	if nil != err {
+		logging.LogErrorf("read import Anki package failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	defer reader.Close()
+
+	importDir := filepath.Join(util.TempDir, "import")
+	if err = os.MkdirAll(importDir, 0755); nil != err {
+		logging.LogErrorf("make import dir [%s] failed: %s", importDir, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	writePath := filepath.Join(importDir, filepath.Base(file.Filename))
+	defer os.RemoveAll(writePath)
+	writer, err := os.OpenFile(writePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if nil != err {
+		logging.LogErrorf("open import Anki package [%s] failed: %s", writePath, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	_, err = io.Copy(writer, reader)
+	writer.Close()
+	if nil != err {
+		logging.LogErrorf("write import Anki package failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	deck, err := model.ImportAnkiDeck(writePath, form.Value["notebook"][0])
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = deckData(deck)
+}
+
+func exportAnkiDeck(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	deckID := arg["deckID"].(string)
+	zipPath, err := model.ExportAnkiDeck(deckID)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = map[string]interface{}{
+		"zip": zipPath,
+	}
+}
+
+func getRiffStats(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	var deckID, cardID string
+	if nil != arg["deckID"] {
+		deckID = arg["deckID"].(string)
+	}
+	if nil != arg["cardID"] {
+		cardID = arg["cardID"].(string)
+	}
+	days := 30
+	if nil != arg["days"] {
+		days = int(arg["days"].(float64))
+	}
+	if 1 > days {
+		days = 1
+	} else if 365 < days {
+		days = 365
+	}
+
+	stats, cardLogs, err := model.GetRiffStats(deckID, cardID, days)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = map[string]interface{}{
+		"reviews":   stats.Reviews,
+		"retention": stats.Retention,
+		"forecast":  stats.Forecast,
+		"cardLogs":  cardLogs,
+	}
+}
+
 func getRiffDecks(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -356,10 +654,14 @@ func getRiffDecks(c *gin.Context) {
 
 func deckData(deck *riff.Deck) map[string]interface{} {
 	return map[string]interface{}{
-		"id":      deck.ID,
-		"name":    deck.Name,
-		"size":    deck.CountCards(),
-		"created": time.UnixMilli(deck.Created).Format("2006-01-02 15:04:05"),
-		"updated": time.UnixMilli(deck.Updated).Format("2006-01-02 15:04:05"),
+		"id":           deck.ID,
+		"name":         deck.Name,
+		"algo":         deck.Algo,
+		"fsrs":         deck.FSRSParams,
+		"burySiblings": deck.BurySiblings,
+		"leechLapses":  deck.LeechLapses,
+		"size":         deck.CountCards(),
+		"created":      time.UnixMilli(deck.Created).Format("2006-01-02 15:04:05"),
+		"updated":      time.UnixMilli(deck.Updated).Format("2006-01-02 15:04:05"),
 	}
 }
@@ -133,6 +133,7 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/lute/copyStdMarkdown", model.CheckAuth, copyStdMarkdown)
 
 	ginServer.Handle("POST", "/api/query/sql", model.CheckAuth, SQL)
+	ginServer.Handle("POST", "/api/query/select", model.CheckAuth, selectSQL)
 
 	ginServer.Handle("POST", "/api/search/searchTag", model.CheckAuth, searchTag)
 	ginServer.Handle("POST", "/api/search/searchTemplate", model.CheckAuth, searchTemplate)
@@ -190,15 +191,23 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/attr/resetBlockAttrs", model.CheckAuth, model.CheckReadonly, resetBlockAttrs)
 	ginServer.Handle("POST", "/api/attr/setBlockAttrs", model.CheckAuth, setBlockAttrs)
 	ginServer.Handle("POST", "/api/attr/getBlockAttrs", model.CheckAuth, getBlockAttrs)
+	ginServer.Handle("POST", "/api/task/queryTasks", model.CheckAuth, queryTasks)
+
+	ginServer.Handle("POST", "/api/attr/queryBlocksByAttrs", model.CheckAuth, queryBlocksByAttrs)
+	ginServer.Handle("POST", "/api/attr/getAttrSchema", model.CheckAuth, getAttrSchema)
+	ginServer.Handle("POST", "/api/attr/setAttrSchema", model.CheckAuth, model.CheckReadonly, setAttrSchema)
 
 	ginServer.Handle("POST", "/api/cloud/getCloudSpace", model.CheckAuth, getCloudSpace)
 
 	ginServer.Handle("POST", "/api/sync/setSyncEnable", model.CheckAuth, model.CheckReadonly, setSyncEnable)
 	ginServer.Handle("POST", "/api/sync/setSyncGenerateConflictDoc", model.CheckAuth, model.CheckReadonly, setSyncGenerateConflictDoc)
+	ginServer.Handle("POST", "/api/sync/setSyncPack", model.CheckAuth, model.CheckReadonly, setSyncPack)
+	ginServer.Handle("POST", "/api/sync/setSyncTransfer", model.CheckAuth, model.CheckReadonly, setSyncTransfer)
 	ginServer.Handle("POST", "/api/sync/setSyncMode", model.CheckAuth, model.CheckReadonly, setSyncMode)
 	ginServer.Handle("POST", "/api/sync/setSyncProvider", model.CheckAuth, model.CheckReadonly, setSyncProvider)
 	ginServer.Handle("POST", "/api/sync/setSyncProviderS3", model.CheckAuth, model.CheckReadonly, setSyncProviderS3)
 	ginServer.Handle("POST", "/api/sync/setSyncProviderWebDAV", model.CheckAuth, model.CheckReadonly, setSyncProviderWebDAV)
+	ginServer.Handle("POST", "/api/sync/setSyncProviderLocal", model.CheckAuth, model.CheckReadonly, setSyncProviderLocal)
 	ginServer.Handle("POST", "/api/sync/setCloudSyncDir", model.CheckAuth, model.CheckReadonly, setCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/createCloudSyncDir", model.CheckAuth, model.CheckReadonly, createCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/removeCloudSyncDir", model.CheckAuth, model.CheckReadonly, removeCloudSyncDir)
@@ -295,12 +304,18 @@ func ServeAPI(ginServer *gin.Engine) {
 
 	ginServer.Handle("POST", "/api/repo/initRepoKey", model.CheckAuth, model.CheckReadonly, initRepoKey)
 	ginServer.Handle("POST", "/api/repo/initRepoKeyFromPassphrase", model.CheckAuth, model.CheckReadonly, initRepoKeyFromPassphrase)
+	ginServer.Handle("POST", "/api/repo/rotateRepoKey", model.CheckAuth, model.CheckReadonly, rotateRepoKey)
 	ginServer.Handle("POST", "/api/repo/resetRepo", model.CheckAuth, model.CheckReadonly, resetRepo)
 	ginServer.Handle("POST", "/api/repo/purgeRepo", model.CheckAuth, model.CheckReadonly, purgeRepo)
+	ginServer.Handle("POST", "/api/repo/setRepoRetention", model.CheckAuth, model.CheckReadonly, setRepoRetention)
+	ginServer.Handle("POST", "/api/repo/forgetRepoSnapshots", model.CheckAuth, model.CheckReadonly, forgetRepoSnapshots)
+	ginServer.Handle("POST", "/api/repo/checkRepo", model.CheckAuth, checkRepo)
+	ginServer.Handle("POST", "/api/repo/packCloudRepo", model.CheckAuth, model.CheckReadonly, packCloudRepo)
 	ginServer.Handle("POST", "/api/repo/importRepoKey", model.CheckAuth, model.CheckReadonly, importRepoKey)
 	ginServer.Handle("POST", "/api/repo/createSnapshot", model.CheckAuth, model.CheckReadonly, createSnapshot)
 	ginServer.Handle("POST", "/api/repo/tagSnapshot", model.CheckAuth, model.CheckReadonly, tagSnapshot)
 	ginServer.Handle("POST", "/api/repo/checkoutRepo", model.CheckAuth, model.CheckReadonly, checkoutRepo)
+	ginServer.Handle("POST", "/api/repo/restoreSnapshotPaths", model.CheckAuth, model.CheckReadonly, restoreSnapshotPaths)
 	ginServer.Handle("POST", "/api/repo/getRepoSnapshots", model.CheckAuth, getRepoSnapshots)
 	ginServer.Handle("POST", "/api/repo/getRepoTagSnapshots", model.CheckAuth, getRepoTagSnapshots)
 	ginServer.Handle("POST", "/api/repo/removeRepoTagSnapshot", model.CheckAuth, model.CheckReadonly, removeRepoTagSnapshot)
@@ -315,7 +330,14 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/riff/createRiffDeck", model.CheckAuth, model.CheckReadonly, createRiffDeck)
 	ginServer.Handle("POST", "/api/riff/renameRiffDeck", model.CheckAuth, model.CheckReadonly, renameRiffDeck)
 	ginServer.Handle("POST", "/api/riff/removeRiffDeck", model.CheckAuth, model.CheckReadonly, removeRiffDeck)
+	ginServer.Handle("POST", "/api/riff/convertRiffDeck", model.CheckAuth, model.CheckReadonly, convertRiffDeck)
+	ginServer.Handle("POST", "/api/riff/setRiffDeckConf", model.CheckAuth, model.CheckReadonly, setRiffDeckConf)
+	ginServer.Handle("POST", "/api/riff/optimizeRiffDeck", model.CheckAuth, model.CheckReadonly, optimizeRiffDeck)
+	ginServer.Handle("POST", "/api/riff/setRiffDeckLifecycle", model.CheckAuth, model.CheckReadonly, setRiffDeckLifecycle)
+	ginServer.Handle("POST", "/api/riff/importAnkiDeck", model.CheckAuth, model.CheckReadonly, importAnkiDeck)
+	ginServer.Handle("POST", "/api/riff/exportAnkiDeck", model.CheckAuth, exportAnkiDeck)
 	ginServer.Handle("POST", "/api/riff/getRiffDecks", model.CheckAuth, getRiffDecks)
+	ginServer.Handle("POST", "/api/riff/getRiffStats", model.CheckAuth, getRiffStats)
 	ginServer.Handle("POST", "/api/riff/addRiffCards", model.CheckAuth, model.CheckReadonly, addRiffCards)
 	ginServer.Handle("POST", "/api/riff/removeRiffCards", model.CheckAuth, model.CheckReadonly, removeRiffCards)
 	ginServer.Handle("POST", "/api/riff/getRiffDueCards", model.CheckAuth, getRiffDueCards)
@@ -323,6 +345,9 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/riff/getNotebookRiffDueCards", model.CheckAuth, getNotebookRiffDueCards)
 	ginServer.Handle("POST", "/api/riff/reviewRiffCard", model.CheckAuth, model.CheckReadonly, reviewRiffCard)
 	ginServer.Handle("POST", "/api/riff/skipReviewRiffCard", model.CheckAuth, model.CheckReadonly, skipReviewRiffCard)
+	ginServer.Handle("POST", "/api/riff/suspendRiffCards", model.CheckAuth, model.CheckReadonly, suspendRiffCards)
+	ginServer.Handle("POST", "/api/riff/buryRiffCards", model.CheckAuth, model.CheckReadonly, buryRiffCards)
+	ginServer.Handle("POST", "/api/riff/getRiffLeechCards", model.CheckAuth, getRiffLeechCards)
 	ginServer.Handle("POST", "/api/riff/getRiffCards", model.CheckAuth, getRiffCards)
 	ginServer.Handle("POST", "/api/riff/getTreeRiffCards", model.CheckAuth, getTreeRiffCards)
 	ginServer.Handle("POST", "/api/riff/getNotebookRiffCards", model.CheckAuth, getNotebookRiffCards)
@@ -336,6 +361,8 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("GET", "/snippets/*filepath", serveSnippets)
 
 	ginServer.Handle("POST", "/api/av/renderAttributeView", model.CheckAuth, renderAttributeView)
+	ginServer.Handle("POST", "/api/av/exportAttributeView", model.CheckAuth, exportAttributeView)
+	ginServer.Handle("POST", "/api/av/importCSV", model.CheckAuth, model.CheckReadonly, importCSV)
 
 	ginServer.Handle("POST", "/api/ai/chatGPT", model.CheckAuth, model.CheckReadonly, chatGPT)
 	ginServer.Handle("POST", "/api/ai/chatGPTWithAction", model.CheckAuth, model.CheckReadonly, chatGPTWithAction)
@@ -253,7 +253,7 @@ func fullTextSearchBlock(c *gin.Context) {
 		}
 	}
 	methodArg := arg["method"]
-	var method int // 0：关键字，1：查询语法，2：SQL，3：正则表达式
+	var method int // 0：关键字，1：查询语法，2：SQL，3：正则表达式，4：语义，5：混合，6：模糊
 	if nil != methodArg {
 		method = int(methodArg.(float64))
 	}
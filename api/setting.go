@@ -66,8 +66,19 @@ func setAI(c *gin.Context) {
 		ai.OpenAI.APIMaxTokens = 4096
 	}
 
+	if nil == ai.Embedding {
+		ai.Embedding = conf.NewEmbedding()
+	}
+	if 5 > ai.Embedding.APITimeout {
+		ai.Embedding.APITimeout = 5
+	}
+	if 600 < ai.Embedding.APITimeout {
+		ai.Embedding.APITimeout = 600
+	}
+
 	model.Conf.AI = ai
 	model.Conf.Save()
+	model.InitEmbedder()
 
 	ret.Data = ai
 }
@@ -17,10 +17,13 @@
 package api
 
 import (
+	gosql "database/sql"
 	"net/http"
+	"time"
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
+	"github.com/wangxu0213/esnote-kernel/model"
 	"github.com/wangxu0213/esnote-kernel/sql"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -44,3 +47,50 @@ func SQL(c *gin.Context) {
 
 	ret.Data = result
 }
+
+// selectSQL 使用绑定参数只读分页执行 SELECT 或者 WITH 查询语句。
+//
+// args 为数组时按照位置绑定 ? 参数，为对象时按照名称绑定 :name 参数；pageSize 默认为 64，最大为 1024。
+func selectSQL(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	stmt, _ := arg["stmt"].(string)
+	var args []interface{}
+	switch argsArg := arg["args"].(type) {
+	case []interface{}:
+		args = argsArg
+	case map[string]interface{}:
+		for name, value := range argsArg {
+			args = append(args, gosql.Named(name, value))
+		}
+	}
+
+	page, pageSize := 1, 64
+	if pageArg := arg["page"]; nil != pageArg {
+		page = int(pageArg.(float64))
+	}
+	if pageSizeArg := arg["pageSize"]; nil != pageSizeArg {
+		pageSize = int(pageSizeArg.(float64))
+	}
+	if 1 > pageSize {
+		pageSize = 64
+	} else if 1024 < pageSize {
+		pageSize = 1024
+	}
+
+	timeout := time.Duration(model.Conf.Api.SQLTimeout) * time.Second
+	result, err := sql.QueryReadonly(stmt, args, page, pageSize, timeout)
+	if nil != err {
+		ret.Code = 1
+		ret.Msg = err.Error()
+		return
+	}
+
+	ret.Data = result
+}
@@ -156,6 +156,40 @@ func setSyncGenerateConflictDoc(c *gin.Context) {
 	model.SetSyncGenerateConflictDoc(enabled)
 }
 
+func setSyncPack(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	enabled := arg["enabled"].(bool)
+	model.SetSyncPack(enabled)
+}
+
+func setSyncTransfer(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	uploadLimit := int64(arg["uploadLimit"].(float64))
+	downloadLimit := int64(arg["downloadLimit"].(float64))
+	concurrency := int(arg["concurrency"].(float64))
+	err := model.SetSyncTransfer(uploadLimit, downloadLimit, concurrency)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
 func setSyncEnable(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -277,6 +311,41 @@ func setSyncProviderWebDAV(c *gin.Context) {
 	}
 }
 
+func setSyncProviderLocal(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	localArg := arg["local"].(interface{})
+	data, err := gulu.JSON.MarshalJSON(localArg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	local := &conf.Local{}
+	if err = gulu.JSON.UnmarshalJSON(data, local); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	err = model.SetSyncProviderLocal(local)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
 func setCloudSyncDir(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -287,5 +356,11 @@ func setCloudSyncDir(c *gin.Context) {
 	}
 
 	name := arg["name"].(string)
-	model.SetCloudSyncDir(name)
+	err := model.SetCloudSyncDir(name)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
 }
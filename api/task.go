@@ -0,0 +1,88 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/88250/gulu"
+	"github.com/gin-gonic/gin"
+	"github.com/wangxu0213/esnote-kernel/sql"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func queryTasks(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	// 截止时间范围可以是毫秒时间戳或者日期字符串
+	dues := map[string]int64{}
+	for _, name := range []string{"dueAfter", "dueBefore"} {
+		due, err := calendarTimeArg(arg[name])
+		if nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+		dues[name] = due
+		delete(arg, name)
+	}
+
+	data, err := gulu.JSON.MarshalJSON(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	q := &sql.TaskQuery{}
+	if err = gulu.JSON.UnmarshalJSON(data, q); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	q.DueAfter, q.DueBefore = dues["dueAfter"], dues["dueBefore"]
+
+	page, pageSize := 1, 64
+	if pageArg := arg["page"]; nil != pageArg {
+		page = int(pageArg.(float64))
+	}
+	if pageSizeArg := arg["pageSize"]; nil != pageSizeArg {
+		pageSize = int(pageSizeArg.(float64))
+	}
+	if 1 > pageSize {
+		pageSize = 64
+	} else if 1024 < pageSize {
+		pageSize = 1024
+	}
+
+	tasks, total, err := sql.QueryTasks(q, page, pageSize)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = map[string]interface{}{
+		"tasks":     tasks,
+		"total":     total,
+		"pageCount": (total + pageSize - 1) / pageSize,
+	}
+}
@@ -42,13 +42,17 @@ type AttributeView struct {
 	Projections []string               `json:"projections"` // 显示的列名，SELECT *
 	Filters     []*AttributeViewFilter `json:"filters"`     // 过滤规则，WHERE ...
 	Sorts       []*AttributeViewSort   `json:"sorts"`       // 排序规则，ORDER BY ...
+	Views       []*View                `json:"views"`       // 其他视图，上面的字段为默认视图
 }
 
 // AttributeViewType 描述了属性视图的类型。
 type AttributeViewType string
 
 const (
-	AttributeViewTypeTable AttributeViewType = "table" // 属性视图类型 - 表格
+	AttributeViewTypeTable    AttributeViewType = "table"    // 属性视图类型 - 表格
+	AttributeViewTypeBoard    AttributeViewType = "board"    // 属性视图类型 - 看板
+	AttributeViewTypeGallery  AttributeViewType = "gallery"  // 属性视图类型 - 画廊
+	AttributeViewTypeCalendar AttributeViewType = "calendar" // 属性视图类型 - 日历
 )
 
 func NewAttributeView(id string) *AttributeView {
@@ -61,6 +65,7 @@ func NewAttributeView(id string) *AttributeView {
 		Projections: []string{},
 		Filters:     []*AttributeViewFilter{},
 		Sorts:       []*AttributeViewSort{},
+		Views:       []*View{},
 	}
 }
 
@@ -151,6 +156,11 @@ func SaveAttributeView(av *AttributeView) (err error) {
 	return
 }
 
+// IsAttributeViewExist 判断属性视图 avID 的数据文件是否存在。
+func IsAttributeViewExist(avID string) bool {
+	return gulu.File.IsExist(getAttributeViewDataPath(avID))
+}
+
 func getAttributeViewDataPath(avID string) (ret string) {
 	av := filepath.Join(util.DataDir, "storage", "av")
 	ret = filepath.Join(av, avID+".json")
@@ -167,7 +177,7 @@ func RebuildAttributeViewTable(tx *sql.Tx, av *AttributeView) (err error) {
 	avID := av.ID
 	var columns []string
 	for _, c := range av.Columns {
-		columns = append(columns, "`"+c.ID+"`")
+		columns = append(columns, "`"+c.ID+"` "+sqlColumnType(c.ValueType()))
 	}
 
 	_, err = tx.Exec("DROP TABLE IF EXISTS `av_" + avID + "`")
@@ -184,16 +194,19 @@ func RebuildAttributeViewTable(tx *sql.Tx, av *AttributeView) (err error) {
 
 	for _, r := range av.Rows {
 		buf := bytes.Buffer{}
-		for i, _ := range r.Cells {
+		var values []interface{}
+		for i, c := range av.Columns {
 			buf.WriteString("?")
-			if i < len(r.Cells)-1 {
+			if i < len(av.Columns)-1 {
 				buf.WriteString(", ")
 			}
-		}
 
-		var values []interface{}
-		for _, c := range r.Cells {
-			values = append(values, c.Value)
+			// 行的单元格可能少于列数，缺少的单元格保存为 NULL
+			var value interface{}
+			if i < len(r.Cells) && nil != r.Cells[i] {
+				value = sqlValue(c.ValueType(), r.Cells[i].Value)
+			}
+			values = append(values, value)
 		}
 
 		_, err = tx.Exec("INSERT INTO `av_"+avID+"` VALUES ("+buf.String()+")", values...)
@@ -16,7 +16,305 @@
 
 package av
 
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/gulu"
+)
+
 type Cell struct {
-	ID    string `json:"id"`
-	Value string `json:"value"`
+	ID    string    `json:"id"`
+	Value string    `json:"value"`
+	Date  *CellDate `json:"date,omitempty"` // 日期列的结束时间和时区
+}
+
+// CellDate 描述了日期单元格的结束时间和时区，开始时间以毫秒时间戳的形式保存在 Cell.Value 中。
+type CellDate struct {
+	End      int64  `json:"end"`      // 结束时间，毫秒时间戳，0 表示没有结束时间
+	Timezone string `json:"timezone"` // 时区，比如 Asia/Shanghai，为空时使用本地时区
+}
+
+// NumberFormat 描述了数字列的显示格式。
+type NumberFormat string
+
+const (
+	NumberFormatNone     NumberFormat = ""         // 原样显示
+	NumberFormatCommas   NumberFormat = "commas"   // 千分位，比如 1,234.5
+	NumberFormatPercent  NumberFormat = "percent"  // 百分比，比如 12.5%
+	NumberFormatUSDollar NumberFormat = "usDollar" // 美元，比如 $1,234.50
+	NumberFormatYuan     NumberFormat = "yuan"     // 人民币，比如 ¥1,234.50
+)
+
+// optionSeparator 为多选单元格中选项的分隔符，选项名称中不能包含该分隔符。
+const optionSeparator = ","
+
+// SetCellValue 校验并设置单元格 cell 的值 value，校验失败时返回错误并且不修改单元格。
+//
+//   - 数字列的值必须为数字
+//   - 日期列的值为日期、日期范围 2023-01-01 → 2023-01-05 或者 JSON 对象 {"start": "2023-01-01", "end": "2023-01-05", "timezone": "Asia/Shanghai"}，开始时间保存为毫秒时间戳
+//   - 单选列的值必须为已有选项，多选列的值为逗号分隔的已有选项
+//   - 空值表示清空单元格
+func (column *Column) SetCellValue(cell *Cell, value string) (err error) {
+	value = strings.TrimSpace(value)
+	var date *CellDate
+	if "" != value {
+		switch column.Type {
+		case ColumnTypeNumber:
+			var number float64
+			if number, err = strconv.ParseFloat(value, 64); nil != err || math.IsNaN(number) || math.IsInf(number, 0) {
+				err = errors.New(fmt.Sprintf("invalid number [%s] of column [%s]", value, column.Name))
+				return
+			}
+			value = strconv.FormatFloat(number, 'f', -1, 64)
+		case ColumnTypeDate:
+			var start string
+			if start, date, err = parseDateValue(value); nil != err {
+				err = errors.New(fmt.Sprintf("invalid date [%s] of column [%s]: %s", value, column.Name, err))
+				return
+			}
+			value = start
+		case ColumnTypeSelect:
+			if nil == column.GetOption(value) {
+				err = errors.New(fmt.Sprintf("option [%s] not found in column [%s]", value, column.Name))
+				return
+			}
+		case ColumnTypeMSelect:
+			var options []string
+			for _, option := range splitOptions(value) {
+				if nil == column.GetOption(option) {
+					err = errors.New(fmt.Sprintf("option [%s] not found in column [%s]", option, column.Name))
+					return
+				}
+				if !gulu.Str.Contains(option, options) {
+					options = append(options, option)
+				}
+			}
+			value = strings.Join(options, optionSeparator)
+		}
+	}
+
+	cell.Value = value
+	cell.Date = date
+	return
+}
+
+// FormatCellValue 返回单元格 cell 用于显示的内容，数字列按照数字格式显示，日期列按照时区显示开始时间和结束时间。
+func (column *Column) FormatCellValue(cell *Cell) string {
+	if nil == cell || "" == cell.Value {
+		return ""
+	}
+
+	switch column.Type {
+	case ColumnTypeNumber:
+		number, err := strconv.ParseFloat(cell.Value, 64)
+		if nil != err {
+			return cell.Value
+		}
+		return FormatNumber(column.NumberFormat, number)
+	case ColumnTypeDate:
+		start, ok := parseDate(cell.Value)
+		if !ok {
+			return cell.Value
+		}
+		loc := time.Local
+		if nil != cell.Date && "" != cell.Date.Timezone {
+			if l, err := time.LoadLocation(cell.Date.Timezone); nil == err {
+				loc = l
+			}
+		}
+		ret := formatDate(start.In(loc))
+		if nil != cell.Date && 0 < cell.Date.End {
+			ret += DateRangeSeparator + formatDate(time.UnixMilli(cell.Date.End).In(loc))
+		}
+		return ret
+	}
+	return cell.Value
+}
+
+// FormatNumber 按照数字格式 format 格式化数字 number。
+func FormatNumber(format NumberFormat, number float64) string {
+	switch format {
+	case NumberFormatCommas:
+		return formatWithCommas(strconv.FormatFloat(number, 'f', -1, 64))
+	case NumberFormatPercent:
+		return strconv.FormatFloat(number*100, 'f', -1, 64) + "%"
+	case NumberFormatUSDollar:
+		return signed(number, "$"+formatWithCommas(strconv.FormatFloat(math.Abs(number), 'f', 2, 64)))
+	case NumberFormatYuan:
+		return signed(number, "¥"+formatWithCommas(strconv.FormatFloat(math.Abs(number), 'f', 2, 64)))
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// IsValidNumberFormat 判断 format 是否为支持的数字格式。
+func IsValidNumberFormat(format NumberFormat) bool {
+	switch format {
+	case NumberFormatNone, NumberFormatCommas, NumberFormatPercent, NumberFormatUSDollar, NumberFormatYuan:
+		return true
+	}
+	return false
+}
+
+func signed(number float64, abs string) string {
+	if 0 > number {
+		return "-" + abs
+	}
+	return abs
+}
+
+// formatWithCommas 为数字字符串 number 的整数部分添加千分位分隔符。
+func formatWithCommas(number string) string {
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign, number = "-", number[1:]
+	}
+	integer, fraction := number, ""
+	if i := strings.Index(number, "."); 0 <= i {
+		integer, fraction = number[:i], number[i:]
+	}
+
+	buf := strings.Builder{}
+	for i, r := range integer {
+		if 0 < i && 0 == (len(integer)-i)%3 {
+			buf.WriteByte(',')
+		}
+		buf.WriteRune(r)
+	}
+	return sign + buf.String() + fraction
+}
+
+func formatDate(t time.Time) string {
+	if 0 == t.Hour() && 0 == t.Minute() && 0 == t.Second() {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// DateRangeSeparator 为日期列显示内容中开始时间和结束时间的分隔符。
+const DateRangeSeparator = " → "
+
+// parseDateValue 解析日期列的输入值，返回开始时间的毫秒时间戳和结束时间及时区。
+func parseDateValue(value string) (start string, date *CellDate, err error) {
+	start = value
+	loc := time.Local
+	var end string
+	if parts := strings.Split(value, DateRangeSeparator); 2 == len(parts) {
+		start, end = parts[0], parts[1]
+	} else if strings.HasPrefix(value, "{") {
+		arg := map[string]string{}
+		if err = gulu.JSON.UnmarshalJSON([]byte(value), &arg); nil != err {
+			return
+		}
+		start, end = arg["start"], arg["end"]
+		if timezone := arg["timezone"]; "" != timezone {
+			if loc, err = time.LoadLocation(timezone); nil != err {
+				return
+			}
+			date = &CellDate{Timezone: timezone}
+		}
+	}
+
+	startTime, ok := parseDateInLocation(start, loc)
+	if !ok {
+		err = errors.New("unrecognized start date")
+		return
+	}
+	start = strconv.FormatInt(startTime.UnixMilli(), 10)
+
+	if "" != strings.TrimSpace(end) {
+		endTime, ok := parseDateInLocation(end, loc)
+		if !ok {
+			err = errors.New("unrecognized end date")
+			return
+		}
+		if endTime.Before(startTime) {
+			err = errors.New("end date is before start date")
+			return
+		}
+		if nil == date {
+			date = &CellDate{}
+		}
+		date.End = endTime.UnixMilli()
+	}
+	return
+}
+
+// splitOptions 拆分多选单元格的值 value 为选项列表。
+func splitOptions(value string) (ret []string) {
+	for _, option := range strings.Split(value, optionSeparator) {
+		if option = strings.TrimSpace(option); "" != option {
+			ret = append(ret, option)
+		}
+	}
+	return
+}
+
+// sqlValue 返回单元格的值 value 在属性视图表中按照列类型 columnType 保存的值，空值保存为 NULL。
+func sqlValue(columnType ColumnType, value string) interface{} {
+	if "" == value {
+		return nil
+	}
+
+	switch columnType {
+	case ColumnTypeNumber:
+		if number, err := strconv.ParseFloat(value, 64); nil == err {
+			return number
+		}
+	case ColumnTypeDate:
+		if t, ok := parseDate(value); ok {
+			return t.UnixMilli()
+		}
+	}
+	return value
+}
+
+// sqlColumnType 返回列类型 columnType 在属性视图表中的字段类型。
+func sqlColumnType(columnType ColumnType) string {
+	switch columnType {
+	case ColumnTypeNumber:
+		return "REAL"
+	case ColumnTypeDate:
+		return "INTEGER"
+	}
+	return "TEXT"
+}
+
+// InferColumnType 根据一列的值 values 推断列类型：所有非空值都是数字时为数字列，都是日期时为日期列，
+// 不同的值较少并且有重复时为单选列，否则为文本列。
+func InferColumnType(values []string) ColumnType {
+	numbers, dates := true, true
+	distinct := map[string]bool{}
+	count := 0
+	for _, value := range values {
+		if value = strings.TrimSpace(value); "" == value {
+			continue
+		}
+
+		count++
+		distinct[value] = true
+		if _, err := strconv.ParseFloat(value, 64); nil != err {
+			numbers = false
+		}
+		if _, _, err := parseDateValue(value); nil != err || !strings.ContainsAny(value, "-/") {
+			// 不包含日期分隔符的纯数字不作为日期
+			dates = false
+		}
+	}
+
+	switch {
+	case 1 > count:
+		return ColumnTypeText
+	case numbers:
+		return ColumnTypeNumber
+	case dates:
+		return ColumnTypeDate
+	case len(distinct) <= 16 && len(distinct) < count && !strings.Contains(strings.Join(values, ""), optionSeparator):
+		return ColumnTypeSelect
+	}
+	return ColumnTypeText
 }
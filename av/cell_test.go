@@ -0,0 +1,149 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetCellValue(t *testing.T) {
+	ms := func(value string, loc *time.Location) string {
+		ret, _ := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		return strconv.FormatInt(ret.UnixMilli(), 10)
+	}
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if nil != err {
+		t.Skipf("time zone database is not available: %s", err)
+	}
+	end, _ := strconv.ParseInt(ms("2023-01-05 00:00", time.Local), 10, 64)
+	shanghaiEnd, _ := strconv.ParseInt(ms("2023-01-03 12:00", shanghai), 10, 64)
+
+	number := &Column{Name: "Number", Type: ColumnTypeNumber}
+	date := &Column{Name: "Date", Type: ColumnTypeDate}
+	single := &Column{Name: "Select", Type: ColumnTypeSelect}
+	multi := &Column{Name: "MSelect", Type: ColumnTypeMSelect}
+	for _, option := range []string{"x", "y"} {
+		single.AddOption(option, "")
+		multi.AddOption(option, "")
+	}
+
+	cases := []struct {
+		column       *Column
+		value        string
+		expected     string
+		expectedDate *CellDate
+		invalid      bool
+	}{
+		{number, " 2.50 ", "2.5", nil, false},
+		{number, "1e3", "1000", nil, false},
+		{number, "-0.1", "-0.1", nil, false},
+		{number, "abc", "", nil, true},
+		{number, "NaN", "", nil, true},
+		{number, "Inf", "", nil, true},
+		{number, "", "", nil, false},
+		{date, "2023-01-02", ms("2023-01-02 00:00", time.Local), nil, false},
+		{date, "2023/01/02 08:30", ms("2023-01-02 08:30", time.Local), nil, false},
+		{date, "2023-01-02" + DateRangeSeparator + "2023-01-05", ms("2023-01-02 00:00", time.Local), &CellDate{End: end}, false},
+		{date, `{"start": "2023-01-02 08:00", "end": "2023-01-03 12:00", "timezone": "Asia/Shanghai"}`, ms("2023-01-02 08:00", shanghai), &CellDate{End: shanghaiEnd, Timezone: "Asia/Shanghai"}, false},
+		{date, "2023-01-05" + DateRangeSeparator + "2023-01-02", "", nil, true},
+		{date, `{"start": "2023-01-02", "timezone": "Mars/Base"}`, "", nil, true},
+		{date, "someday", "", nil, true},
+		{single, "x", "x", nil, false},
+		{single, "z", "", nil, true},
+		{multi, "y, x, y", "y,x", nil, false},
+		{multi, "x,z", "", nil, true},
+		{&Column{Name: "Text", Type: ColumnTypeText}, " any, text ", "any, text", nil, false},
+	}
+
+	for _, c := range cases {
+		cell := &Cell{Value: "keep"}
+		err := c.column.SetCellValue(cell, c.value)
+		if c.invalid {
+			if nil == err || "keep" != cell.Value {
+				t.Fatalf("invalid value [%s] of column [%s] should be rejected without changing the cell", c.value, c.column.Name)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.expected != cell.Value {
+			t.Fatalf("value [%s] of column [%s] expected [%s], got [%s]", c.value, c.column.Name, c.expected, cell.Value)
+		}
+		if (nil == c.expectedDate) != (nil == cell.Date) || (nil != cell.Date && *c.expectedDate != *cell.Date) {
+			t.Fatalf("date of value [%s] expected %v, got %v", c.value, c.expectedDate, cell.Date)
+		}
+	}
+}
+
+func TestFormatCellValue(t *testing.T) {
+	cases := []struct {
+		format   NumberFormat
+		number   float64
+		expected string
+	}{
+		{NumberFormatNone, 1234.5, "1234.5"},
+		{NumberFormatCommas, 1234567.25, "1,234,567.25"},
+		{NumberFormatCommas, -1234, "-1,234"},
+		{NumberFormatCommas, 123, "123"},
+		{NumberFormatPercent, 0.125, "12.5%"},
+		{NumberFormatUSDollar, 1234.5, "$1,234.50"},
+		{NumberFormatUSDollar, -0.5, "-$0.50"},
+		{NumberFormatYuan, 1000000, "¥1,000,000.00"},
+	}
+	for _, c := range cases {
+		if got := FormatNumber(c.format, c.number); c.expected != got {
+			t.Fatalf("format [%v] as [%s] expected [%s], got [%s]", c.number, c.format, c.expected, got)
+		}
+	}
+
+	column := &Column{Type: ColumnTypeDate}
+	cell := &Cell{}
+	if err := column.SetCellValue(cell, `{"start": "2023-01-02 08:00", "end": "2023-01-03", "timezone": "Asia/Shanghai"}`); nil != err {
+		t.Skipf("time zone database is not available: %s", err)
+	}
+	if got := column.FormatCellValue(cell); "2023-01-02 08:00"+DateRangeSeparator+"2023-01-03" != got {
+		t.Fatalf("format date [%s] not match", got)
+	}
+	if got := (&Column{Type: ColumnTypeNumber}).FormatCellValue(&Cell{Value: "n/a"}); "n/a" != got {
+		t.Fatalf("format unparseable number [%s] not match", got)
+	}
+}
+
+func TestInferColumnType(t *testing.T) {
+	cases := []struct {
+		values   []string
+		expected ColumnType
+	}{
+		{nil, ColumnTypeText},
+		{[]string{"", " "}, ColumnTypeText},
+		{[]string{"1", "2.5", "", "-3"}, ColumnTypeNumber},
+		{[]string{"20230101", "20230102"}, ColumnTypeNumber},
+		{[]string{"2023-01-01", "2023/01/02 08:30", ""}, ColumnTypeDate},
+		{[]string{"2023-01-01", "tomorrow"}, ColumnTypeText},
+		{[]string{"Todo", "Done", "Todo"}, ColumnTypeSelect},
+		{[]string{"Todo", "Done"}, ColumnTypeText},
+		{[]string{"a, b", "a, b"}, ColumnTypeText},
+	}
+	for _, c := range cases {
+		if got := InferColumnType(c.values); c.expected != got {
+			t.Fatalf("infer %v expected [%s], got [%s]", c.values, c.expected, got)
+		}
+	}
+}
@@ -16,7 +16,13 @@
 
 package av
 
-import "github.com/88250/lute/ast"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/88250/lute/ast"
+)
 
 type ColumnType string
 
@@ -27,6 +33,7 @@ const (
 	ColumnTypeRelation ColumnType = "relation"
 	ColumnTypeRollup   ColumnType = "rollup"
 	ColumnTypeSelect   ColumnType = "select"
+	ColumnTypeMSelect  ColumnType = "mSelect"
 	ColumnTypeText     ColumnType = "text"
 )
 
@@ -39,6 +46,9 @@ type Column struct {
 	AttributeViewID  string                `json:"attributeViewId"`  // 关联的属性视图 ID
 	RelationColumnID string                `json:"relationColumnId"` // 目标关联列 ID
 	Options          []*ColumnSelectOption `json:"options"`          // 选项列表
+	NumberFormat     NumberFormat          `json:"numberFormat"`     // 数字格式
+	Rollup           *ColumnRollup         `json:"rollup,omitempty"` // 汇总方式
+	Hidden           bool                  `json:"hidden"`           // 是否隐藏
 }
 
 type ColumnSelectOption struct {
@@ -53,3 +63,92 @@ func NewColumn(name string, columnType ColumnType) *Column {
 		Type: columnType,
 	}
 }
+
+// GetOption 返回名称为 name 的选项，找不到时返回 nil。
+func (column *Column) GetOption(name string) *ColumnSelectOption {
+	for _, option := range column.Options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+// AddOption 为单选或者多选列添加选项。
+func (column *Column) AddOption(name, color string) (err error) {
+	if err = column.checkOptionName(name); nil != err {
+		return
+	}
+	if nil != column.GetOption(name) {
+		err = errors.New(fmt.Sprintf("option [%s] already exists", name))
+		return
+	}
+
+	column.Options = append(column.Options, &ColumnSelectOption{Name: name, Color: color})
+	return
+}
+
+// UpdateOption 将选项 oldName 重命名为 newName 并修改颜色为 color，需要调用 RenameOptionInCell 同步单元格中的选项。
+func (column *Column) UpdateOption(oldName, newName, color string) (err error) {
+	option := column.GetOption(oldName)
+	if nil == option {
+		err = errors.New(fmt.Sprintf("option [%s] not found", oldName))
+		return
+	}
+	if oldName != newName {
+		if err = column.checkOptionName(newName); nil != err {
+			return
+		}
+		if nil != column.GetOption(newName) {
+			err = errors.New(fmt.Sprintf("option [%s] already exists", newName))
+			return
+		}
+	}
+
+	option.Name = newName
+	option.Color = color
+	return
+}
+
+// RemoveOption 删除选项 name，需要调用 RenameOptionInCell 从单元格中移除该选项。
+func (column *Column) RemoveOption(name string) (err error) {
+	for i, option := range column.Options {
+		if option.Name == name {
+			column.Options = append(column.Options[:i], column.Options[i+1:]...)
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("option [%s] not found", name))
+	return
+}
+
+// RenameOptionInCell 将单元格 cell 中的选项 oldName 改为 newName，newName 为空时移除该选项。
+func (column *Column) RenameOptionInCell(cell *Cell, oldName, newName string) {
+	if nil == cell {
+		return
+	}
+
+	var options []string
+	for _, option := range splitOptions(cell.Value) {
+		if option == oldName {
+			if "" == newName {
+				continue
+			}
+			option = newName
+		}
+		options = append(options, option)
+	}
+	cell.Value = strings.Join(options, optionSeparator)
+}
+
+func (column *Column) checkOptionName(name string) (err error) {
+	if ColumnTypeSelect != column.Type && ColumnTypeMSelect != column.Type {
+		err = errors.New(fmt.Sprintf("column [%s] is not a select column", column.Name))
+		return
+	}
+	if "" == strings.TrimSpace(name) || strings.Contains(name, optionSeparator) {
+		err = errors.New(fmt.Sprintf("invalid option name [%s]", name))
+		return
+	}
+	return
+}
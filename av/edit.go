@@ -0,0 +1,377 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MoveColumn 将列 columnID 移动到列 previousID 之后，previousID 为空时移动到块列之后，块列总是第一列。
+func (av *AttributeView) MoveColumn(columnID, previousID string) (err error) {
+	column, index := av.GetColumn(columnID)
+	if nil == column {
+		err = errors.New(fmt.Sprintf("column [%s] not found", columnID))
+		return
+	}
+	if 0 == index {
+		err = errors.New("block column can not be moved")
+		return
+	}
+	if columnID == previousID {
+		return
+	}
+
+	target := 1
+	if "" != previousID {
+		_, previousIndex := av.GetColumn(previousID)
+		if 0 > previousIndex {
+			err = errors.New(fmt.Sprintf("column [%s] not found", previousID))
+			return
+		}
+		target = previousIndex + 1
+	}
+	if target > index {
+		target-- // 移除当前列后目标位置前移
+	}
+
+	av.Columns = append(av.Columns[:index], av.Columns[index+1:]...)
+	av.Columns = append(av.Columns[:target], append([]*Column{column}, av.Columns[target:]...)...)
+	for _, row := range av.Rows {
+		// 单元格按照列的下标对应，需要补齐后同步移动
+		row.GetCell(len(av.Columns) - 1)
+		cell := row.Cells[index]
+		row.Cells = append(row.Cells[:index], row.Cells[index+1:]...)
+		row.Cells = append(row.Cells[:target], append([]*Cell{cell}, row.Cells[target:]...)...)
+	}
+	return
+}
+
+// RenameColumn 将列 columnID 重命名为 name，视图中按照旧列名引用该列的地方改为使用列 ID，避免重命名后找不到该列。
+func (av *AttributeView) RenameColumn(columnID, name string) (err error) {
+	column, index := av.GetColumn(columnID)
+	if nil == column {
+		err = errors.New(fmt.Sprintf("column [%s] not found", columnID))
+		return
+	}
+
+	av.updateColumnRefs(func(ref string) string {
+		if ref == column.Name && index == av.columnIndex(ref) {
+			return column.ID
+		}
+		return ref
+	})
+	column.Name = name
+	return
+}
+
+// RemoveColumnRefs 移除默认视图和所有视图中对列 columnID 的引用，需要在移除列之前调用。
+//
+// 看板的分组列或者日历的日期列被移除后视图改为表格布局，画廊的封面列被移除后使用块中的第一张图片作为封面。
+func (av *AttributeView) RemoveColumnRefs(columnID string) {
+	_, index := av.GetColumn(columnID)
+	if 0 > index {
+		return
+	}
+
+	av.updateColumnRefs(func(ref string) string {
+		if index == av.columnIndex(ref) {
+			return ""
+		}
+		return ref
+	})
+	av.downgradeViews()
+}
+
+// downgradeViews 将没有分组列的看板和没有日期列的日历改为表格布局。
+func (av *AttributeView) downgradeViews() {
+	for _, view := range av.Views {
+		if (AttributeViewTypeBoard == view.Type && "" == view.GroupColumn) || (AttributeViewTypeCalendar == view.Type && "" == view.DateColumn) {
+			view.Type = AttributeViewTypeTable
+		}
+	}
+}
+
+// updateColumnRefs 使用 update 改写默认视图和所有视图中的列引用，update 返回空字符串时移除该引用。
+func (av *AttributeView) updateColumnRefs(update func(ref string) string) {
+	updateRef := func(ref string) string {
+		if "" == ref {
+			return ref
+		}
+		return update(ref)
+	}
+
+	views := append([]*View{av.GetView("")}, av.Views...)
+	for _, view := range views {
+		projections := []string{}
+		for _, projection := range view.Projections {
+			if projection = updateRef(projection); "" != projection {
+				projections = append(projections, projection)
+			}
+		}
+		filters := []*AttributeViewFilter{}
+		for _, filter := range view.Filters {
+			if filter.Column = updateRef(filter.Column); "" != filter.Column {
+				filters = append(filters, filter)
+			}
+		}
+		sorts := []*AttributeViewSort{}
+		for _, s := range view.Sorts {
+			if s.Column = updateRef(s.Column); "" != s.Column {
+				sorts = append(sorts, s)
+			}
+		}
+		view.Projections, view.Filters, view.Sorts = projections, filters, sorts
+		view.GroupColumn = updateRef(view.GroupColumn)
+		view.CoverColumn = updateRef(view.CoverColumn)
+		view.DateColumn = updateRef(view.DateColumn)
+	}
+	av.Projections, av.Filters, av.Sorts = views[0].Projections, views[0].Filters, views[0].Sorts
+}
+
+// MoveRow 将行 rowID 移动到行 previousID 之后，previousID 为空时移动到第一行。
+func (av *AttributeView) MoveRow(rowID, previousID string) (err error) {
+	index := -1
+	for i, row := range av.Rows {
+		if row.ID == rowID {
+			index = i
+			break
+		}
+	}
+	if 0 > index {
+		err = errors.New(fmt.Sprintf("row [%s] not found", rowID))
+		return
+	}
+	if rowID == previousID {
+		return
+	}
+
+	row := av.Rows[index]
+	av.Rows = append(av.Rows[:index], av.Rows[index+1:]...)
+	target := 0
+	if "" != previousID {
+		target = -1
+		for i, r := range av.Rows {
+			if r.ID == previousID {
+				target = i + 1
+				break
+			}
+		}
+		if 0 > target {
+			av.Rows = append(av.Rows[:index], append([]*Row{row}, av.Rows[index:]...)...)
+			err = errors.New(fmt.Sprintf("row [%s] not found", previousID))
+			return
+		}
+	}
+	av.Rows = append(av.Rows[:target], append([]*Row{row}, av.Rows[target:]...)...)
+	return
+}
+
+// SetFilters 校验并设置视图 viewID 的过滤规则 filters，viewID 为空时设置默认视图。
+func (av *AttributeView) SetFilters(viewID string, filters []*AttributeViewFilter) (err error) {
+	view, err := av.getViewOrErr(viewID)
+	if nil != err {
+		return
+	}
+
+	filtered := *view
+	filtered.Filters = filters
+	return av.SetView(&filtered)
+}
+
+// SetSorts 校验并设置视图 viewID 的排序规则 sorts，viewID 为空时设置默认视图。
+func (av *AttributeView) SetSorts(viewID string, sorts []*AttributeViewSort) (err error) {
+	view, err := av.getViewOrErr(viewID)
+	if nil != err {
+		return
+	}
+
+	sorted := *view
+	sorted.Sorts = sorts
+	return av.SetView(&sorted)
+}
+
+// ConvertColumnType 将列 columnID 的类型修改为 typ，并按照新的列类型转换已有单元格的值。
+//
+// 转换为单选或者多选列时已有的值会被添加为选项，无法转换的值会被清空。块列、关联列和汇总列不能修改类型。
+// 使用该列作为分组列、封面列或者日期列的视图在新类型不再适用时按照 RemoveColumnRefs 的方式处理。
+func (av *AttributeView) ConvertColumnType(columnID string, typ ColumnType) (err error) {
+	column, index := av.GetColumn(columnID)
+	if nil == column {
+		err = errors.New(fmt.Sprintf("column [%s] not found", columnID))
+		return
+	}
+	if column.Type == typ {
+		return
+	}
+
+	switch column.Type {
+	case ColumnTypeBlock, ColumnTypeRelation, ColumnTypeRollup:
+		err = errors.New(fmt.Sprintf("type of column [%s] can not be changed", column.Name))
+		return
+	}
+	switch typ {
+	case ColumnTypeText, ColumnTypeNumber, ColumnTypeDate, ColumnTypeSelect, ColumnTypeMSelect:
+	default:
+		err = errors.New(fmt.Sprintf("invalid column type [%s]", typ))
+		return
+	}
+
+	from := *column
+	column.Type = typ
+	if ColumnTypeNumber != typ {
+		column.NumberFormat = NumberFormatNone
+	}
+	if ColumnTypeSelect != typ && ColumnTypeMSelect != typ {
+		column.Options = nil
+	}
+
+	for _, row := range av.Rows {
+		if index >= len(row.Cells) || nil == row.Cells[index] || "" == row.Cells[index].Value {
+			continue
+		}
+
+		cell := row.Cells[index]
+		value := cell.Value
+		switch from.Type {
+		case ColumnTypeDate:
+			if ColumnTypeText == typ || ColumnTypeSelect == typ || ColumnTypeMSelect == typ {
+				value = from.FormatCellValue(cell)
+			}
+		case ColumnTypeMSelect:
+			if ColumnTypeSelect == typ {
+				if options := splitOptions(value); 0 < len(options) {
+					value = options[0]
+				}
+			}
+		}
+
+		var values []string
+		switch typ {
+		case ColumnTypeSelect:
+			values = []string{value}
+		case ColumnTypeMSelect:
+			values = splitOptions(value)
+		}
+		for _, v := range values {
+			if nil == column.GetOption(v) {
+				column.AddOption(v, "")
+			}
+		}
+
+		if setErr := column.SetCellValue(cell, value); nil != setErr {
+			cell.Value = ""
+			cell.Date = nil
+		}
+	}
+
+	// 转换后不能再作为看板分组列、画廊封面列或者日历日期列时，和移除该列一样处理使用该列的视图
+	invalid := func(ref, usage string, types ...ColumnType) bool {
+		return "" != ref && index == av.columnIndex(ref) && nil != av.checkViewColumn(ref, usage, types...)
+	}
+	for _, view := range av.Views {
+		if invalid(view.GroupColumn, "group", ColumnTypeSelect, ColumnTypeMSelect) {
+			view.GroupColumn = ""
+		}
+		if invalid(view.CoverColumn, "cover", ColumnTypeText) {
+			view.CoverColumn = ""
+		}
+		if invalid(view.DateColumn, "date", ColumnTypeDate) {
+			view.DateColumn = ""
+		}
+	}
+	av.downgradeViews()
+	return
+}
+
+// ColumnSnapshot 记录了列及其单元格在某一时刻的状态，用于撤销会丢失数据的列操作，比如修改列类型。
+type ColumnSnapshot struct {
+	Column *Column          `json:"column"`
+	Cells  map[string]*Cell `json:"cells"` // 行 ID 到单元格的映射
+	Views  []*View          `json:"views"` // 使用该列作为分组列、封面列或者日期列的视图，恢复时仅恢复布局设置
+}
+
+// SnapshotColumn 返回列 columnID 及其每行单元格的副本。
+func (av *AttributeView) SnapshotColumn(columnID string) (ret *ColumnSnapshot, err error) {
+	column, index := av.GetColumn(columnID)
+	if nil == column {
+		err = errors.New(fmt.Sprintf("column [%s] not found", columnID))
+		return
+	}
+
+	c := *column
+	c.Options = nil
+	for _, option := range column.Options {
+		o := *option
+		c.Options = append(c.Options, &o)
+	}
+	ret = &ColumnSnapshot{Column: &c, Cells: map[string]*Cell{}}
+	for _, row := range av.Rows {
+		cell := &Cell{}
+		if index < len(row.Cells) && nil != row.Cells[index] {
+			*cell = *row.Cells[index]
+			if nil != cell.Date {
+				date := *cell.Date
+				cell.Date = &date
+			}
+		}
+		ret.Cells[row.ID] = cell
+	}
+	for _, view := range av.Views {
+		for _, ref := range []string{view.GroupColumn, view.CoverColumn, view.DateColumn} {
+			if "" != ref && index == av.columnIndex(ref) {
+				v := *view
+				ret.Views = append(ret.Views, &v)
+				break
+			}
+		}
+	}
+	return
+}
+
+// RestoreColumn 将列恢复为快照 snapshot 记录的状态，列的位置保持不变，快照之后删除的行和视图会被忽略。
+func (av *AttributeView) RestoreColumn(snapshot *ColumnSnapshot) (err error) {
+	if nil == snapshot || nil == snapshot.Column {
+		err = errors.New("column snapshot is empty")
+		return
+	}
+	column, index := av.GetColumn(snapshot.Column.ID)
+	if nil == column {
+		err = errors.New(fmt.Sprintf("column [%s] not found", snapshot.Column.ID))
+		return
+	}
+
+	*column = *snapshot.Column
+	for rowID, c := range snapshot.Cells {
+		row := av.GetRow(rowID)
+		if nil == row || nil == c {
+			continue
+		}
+		cell := row.GetCell(index)
+		cell.Value = c.Value
+		cell.Date = c.Date
+	}
+	for _, v := range snapshot.Views {
+		if "" == v.ID {
+			continue
+		}
+		if view := av.GetView(v.ID); nil != view {
+			view.Type, view.GroupColumn, view.CoverColumn, view.DateColumn = v.Type, v.GroupColumn, v.CoverColumn, v.DateColumn
+		}
+	}
+	return
+}
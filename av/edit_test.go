@@ -0,0 +1,286 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/88250/gulu"
+)
+
+func TestMoveColumn(t *testing.T) {
+	cases := []struct {
+		column, previous string
+		expected         string
+		invalid          bool
+	}{
+		{"tags", "", "block,tags,name,score,due,status", false},
+		{"name", "status", "block,score,due,status,name,tags", false},
+		{"status", "name", "block,name,status,score,due,tags", false},
+		{"score", "score", "block,name,score,due,status,tags", false},
+		{"block", "name", "", true},
+		{"missing", "", "", true},
+		{"name", "missing", "", true},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		attrView.Rows[2].Cells = attrView.Rows[2].Cells[:2] // 单元格不足的行
+		err := attrView.MoveColumn(c.column, c.previous)
+		if c.invalid {
+			if nil == err {
+				t.Fatalf("move column [%s] after [%s] should fail", c.column, c.previous)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, column := range attrView.Columns {
+			ids = append(ids, column.ID)
+		}
+		if got := strings.Join(ids, ","); c.expected != got {
+			t.Fatalf("move column [%s] after [%s] expected [%s], got [%s]", c.column, c.previous, c.expected, got)
+		}
+		// 单元格随列移动
+		for _, row := range attrView.Rows {
+			for i, cell := range row.Cells {
+				if "" != cell.Value && row.ID+"-"+attrView.Columns[i].ID != cell.ID {
+					t.Fatalf("cell [%s] of row [%s] not moved with column [%s]", cell.ID, row.ID, attrView.Columns[i].ID)
+				}
+			}
+		}
+	}
+}
+
+func TestMoveRow(t *testing.T) {
+	cases := []struct {
+		row, previous string
+		expected      string
+		invalid       bool
+	}{
+		{"r3", "", "r3,r1,r2,r4", false},
+		{"r1", "r4", "r2,r3,r4,r1", false},
+		{"r4", "r1", "r1,r4,r2,r3", false},
+		{"r2", "r2", "r1,r2,r3,r4", false},
+		{"missing", "", "r1,r2,r3,r4", true},
+		{"r2", "missing", "r1,r2,r3,r4", true},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		err := attrView.MoveRow(c.row, c.previous)
+		if c.invalid != (nil != err) {
+			t.Fatalf("move row [%s] after [%s] got error [%v]", c.row, c.previous, err)
+		}
+		// 移动失败时行的顺序不变
+		if got := queryRowIDs(t, attrView); c.expected != got {
+			t.Fatalf("move row [%s] after [%s] expected [%s], got [%s]", c.row, c.previous, c.expected, got)
+		}
+	}
+}
+
+func TestConvertColumnType(t *testing.T) {
+	cases := []struct {
+		column   string
+		typ      ColumnType
+		expected string // 转换后每行的值
+		options  string
+		invalid  bool
+	}{
+		{"score", ColumnTypeText, "10|2.5||n/a", "", false},
+		{"name", ColumnTypeNumber, "|||", "", false},
+		{"due", ColumnTypeText, "2023-01-01|2023-03-01||someday", "", false},
+		{"status", ColumnTypeMSelect, "Todo|Done||Todo", "Todo,Done", false},
+		{"tags", ColumnTypeSelect, "x|y||", "x,y,z", false},
+		{"tags", ColumnTypeText, "x,y|y||", "", false},
+		{"score", ColumnTypeSelect, "10|2.5||n/a", "10,2.5,n/a", false},
+		{"block", ColumnTypeText, "", "", true},
+		{"name", ColumnTypeRollup, "", "", true},
+		{"missing", ColumnTypeText, "", "", true},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		attrView.Columns[2].NumberFormat = NumberFormatCommas
+		err := attrView.ConvertColumnType(c.column, c.typ)
+		if c.invalid {
+			if nil == err {
+				t.Fatalf("convert column [%s] to [%s] should fail", c.column, c.typ)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		column, index := attrView.GetColumn(c.column)
+		var values, options []string
+		for _, row := range attrView.Rows {
+			values = append(values, row.Cells[index].Value)
+		}
+		for _, option := range column.Options {
+			options = append(options, option.Name)
+		}
+		if got := strings.Join(values, "|"); c.typ != column.Type || c.expected != got {
+			t.Fatalf("convert column [%s] to [%s] expected [%s], got [%s]", c.column, c.typ, c.expected, got)
+		}
+		if got := strings.Join(options, ","); c.options != got {
+			t.Fatalf("options of column [%s] converted to [%s] expected [%s], got [%s]", c.column, c.typ, c.options, got)
+		}
+		if ColumnTypeNumber != column.Type && NumberFormatNone != column.NumberFormat {
+			t.Fatalf("number format should be reset")
+		}
+	}
+}
+
+func TestRestoreColumn(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	board, calendar := NewView("Board", AttributeViewTypeBoard), NewView("Calendar", AttributeViewTypeCalendar)
+	board.GroupColumn, calendar.DateColumn = "Status", "due"
+	for _, view := range []*View{board, calendar} {
+		if err := attrView.SetView(view); nil != err {
+			t.Fatal(err)
+		}
+	}
+	snapshot, err := attrView.SnapshotColumn("status")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = attrView.ConvertColumnType("status", ColumnTypeNumber); nil != err {
+		t.Fatal(err)
+	}
+
+	// 分组列不再是单选列后看板改为表格，视图仍然有效
+	board = attrView.GetView(board.ID)
+	if AttributeViewTypeTable != board.Type || "" != board.GroupColumn {
+		t.Fatalf("board grouped by converted column should be a table")
+	}
+	if err = attrView.checkView(board); nil != err {
+		t.Fatal(err)
+	}
+
+	// 撤销操作的快照会经过 JSON 序列化
+	data, err := gulu.JSON.MarshalJSON(snapshot)
+	if nil != err {
+		t.Fatal(err)
+	}
+	snapshot = &ColumnSnapshot{}
+	if err = gulu.JSON.UnmarshalJSON(data, snapshot); nil != err {
+		t.Fatal(err)
+	}
+	attrView.Rows = attrView.Rows[1:] // 快照之后删除的行不影响恢复
+	if err = attrView.RestoreColumn(snapshot); nil != err {
+		t.Fatal(err)
+	}
+
+	column, index := attrView.GetColumn("status")
+	var values, options []string
+	for _, row := range attrView.Rows {
+		values = append(values, row.Cells[index].Value)
+	}
+	for _, option := range column.Options {
+		options = append(options, option.Name)
+	}
+	if got := strings.Join(values, "|"); ColumnTypeSelect != column.Type || "Done||Todo" != got {
+		t.Fatalf("restore column expected [Done||Todo], got [%s] of type [%s]", got, column.Type)
+	}
+	if got := strings.Join(options, ","); "Todo,Done" != got {
+		t.Fatalf("restore column options expected [Todo,Done], got [%s]", got)
+	}
+	if board = attrView.GetView(board.ID); AttributeViewTypeBoard != board.Type || "Status" != board.GroupColumn {
+		t.Fatalf("board should be restored")
+	}
+
+	// 日期列转换为文本列后日历改为表格，撤销后恢复
+	if snapshot, err = attrView.SnapshotColumn("due"); nil != err {
+		t.Fatal(err)
+	}
+	if err = attrView.ConvertColumnType("due", ColumnTypeText); nil != err {
+		t.Fatal(err)
+	}
+	if calendar = attrView.GetView(calendar.ID); AttributeViewTypeTable != calendar.Type {
+		t.Fatalf("calendar on converted column should be a table")
+	}
+	if err = attrView.RestoreColumn(snapshot); nil != err {
+		t.Fatal(err)
+	}
+	if calendar = attrView.GetView(calendar.ID); AttributeViewTypeCalendar != calendar.Type || "due" != calendar.DateColumn {
+		t.Fatalf("calendar should be restored")
+	}
+
+	if err = attrView.RestoreColumn(&ColumnSnapshot{Column: &Column{ID: "missing"}}); nil == err {
+		t.Fatalf("restore missing column should fail")
+	}
+}
+
+func TestColumnRefs(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	attrView.Projections = []string{"Name", "Status", "score"}
+	attrView.Filters = []*AttributeViewFilter{{Column: "Status", Operator: FilterOperatorEq, Value: "Todo"}}
+	attrView.Sorts = []*AttributeViewSort{{Column: "Status", Order: SortOrderAsc}, {Column: "Name", Order: SortOrderDesc}}
+	board := NewView("Board", AttributeViewTypeBoard)
+	board.GroupColumn = "Status"
+	calendar := NewView("Calendar", AttributeViewTypeCalendar)
+	calendar.DateColumn = "Due"
+	calendar.Filters = []*AttributeViewFilter{{Column: "Status", Operator: FilterOperatorEq, Value: "Todo"}}
+	attrView.Views = []*View{board, calendar}
+
+	// 重命名后按照旧列名引用的地方仍然引用该列
+	if err := attrView.RenameColumn("status", "State"); nil != err {
+		t.Fatal(err)
+	}
+	if got := queryRowIDs(t, attrView); "r4,r1" != got {
+		t.Fatalf("query after renaming column got [%s]", got)
+	}
+	if _, err := attrView.QueryBoard(board.ID, nil); nil != err {
+		t.Fatalf("query board after renaming column failed: %s", err)
+	}
+	if err := attrView.RenameColumn("missing", "Missing"); nil == err {
+		t.Fatalf("rename missing column should fail")
+	}
+
+	// 移除列后视图中对该列的引用被移除，依赖该列的布局改为表格
+	for _, id := range []string{"status", "due"} {
+		attrView.RemoveColumnRefs(id)
+		_, index := attrView.GetColumn(id)
+		attrView.Columns = append(attrView.Columns[:index], attrView.Columns[index+1:]...)
+		for _, row := range attrView.Rows {
+			row.Cells = append(row.Cells[:index], row.Cells[index+1:]...)
+		}
+	}
+	if got := strings.Join(attrView.Projections, ","); "Name,score" != got {
+		t.Fatalf("projections after removing column got [%s]", got)
+	}
+	if 0 != len(attrView.Filters) || 1 != len(attrView.Sorts) || "Name" != attrView.Sorts[0].Column {
+		t.Fatalf("filters and sorts after removing column not match")
+	}
+	if got := queryRowIDs(t, attrView); "r2,r4,r3,r1" != got {
+		t.Fatalf("query after removing column got [%s]", got)
+	}
+	for _, view := range attrView.Views {
+		if AttributeViewTypeTable != view.Type || "" != view.GroupColumn || "" != view.DateColumn || 0 != len(view.Filters) {
+			t.Fatalf("view [%s] after removing column not match", view.Name)
+		}
+		if _, err := attrView.Query(view.ID, 0, 0, nil); nil != err {
+			t.Fatalf("query view [%s] after removing column failed: %s", view.Name, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/gulu"
+)
+
+// dateLayouts 为日期列支持的日期格式。
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"20060102150405",
+	time.RFC3339,
+}
+
+// parseDate 解析日期列的值，支持 dateLayouts 中的格式和毫秒时间戳。
+func parseDate(value string) (ret time.Time, ok bool) {
+	return parseDateInLocation(value, time.Local)
+}
+
+// parseDateInLocation 在时区 loc 中解析日期列的值。
+func parseDateInLocation(value string, loc *time.Location) (ret time.Time, ok bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); nil == err {
+			return t, true
+		}
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); nil == err {
+		return time.UnixMilli(ms), true
+	}
+	return
+}
+
+// compareValues 按照列类型 columnType 比较 a 和 b，无法按照列类型解析时 ok 为 false。
+//
+// 数字列按照数值比较，日期列按照时间比较，其他列按照字符串比较。
+func compareValues(columnType ColumnType, a, b string) (ret int, ok bool) {
+	switch columnType {
+	case ColumnTypeNumber:
+		x, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		y, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if nil != errA || nil != errB {
+			return
+		}
+		switch {
+		case x < y:
+			ret = -1
+		case x > y:
+			ret = 1
+		}
+		return ret, true
+	case ColumnTypeDate:
+		x, okA := parseDate(a)
+		y, okB := parseDate(b)
+		if !okA || !okB {
+			return
+		}
+		switch {
+		case x.Before(y):
+			ret = -1
+		case x.After(y):
+			ret = 1
+		}
+		return ret, true
+	default:
+		return strings.Compare(a, b), true
+	}
+}
+
+// equalValues 判断 a 和 b 按照列类型 columnType 是否相等，无法按照列类型解析时比较原始字符串。
+func equalValues(columnType ColumnType, a, b string) bool {
+	if result, ok := compareValues(columnType, a, b); ok {
+		return 0 == result
+	}
+	return a == b
+}
+
+// parseFilterValues 解析 IN 和 NOT IN 的过滤值，支持 JSON 数组和逗号分隔的列表。
+func parseFilterValues(value string) (ret []string) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var values []interface{}
+		if err := gulu.JSON.UnmarshalJSON([]byte(value), &values); nil == err {
+			for _, v := range values {
+				ret = append(ret, fmt.Sprint(v))
+			}
+			return
+		}
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		ret = append(ret, strings.TrimSpace(v))
+	}
+	return
+}
+
+// likeRegexp 将 SQL LIKE 模式 pattern 转换为正则表达式，% 匹配任意个字符，_ 匹配一个字符，不区分大小写。
+func likeRegexp(pattern string) (*regexp.Regexp, error) {
+	buf := strings.Builder{}
+	buf.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			buf.WriteString(".*")
+		case '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+// rowFilter 为预处理后的过滤规则。
+type rowFilter struct {
+	column *Column
+	index  int
+	filter *AttributeViewFilter
+	values []string       // IN 和 NOT IN 的过滤值
+	like   *regexp.Regexp // LIKE 和 NOT LIKE 的匹配模式
+}
+
+func newRowFilter(column *Column, index int, filter *AttributeViewFilter) (ret *rowFilter, err error) {
+	ret = &rowFilter{column: column, index: index, filter: filter}
+	switch filter.Operator {
+	case FilterOperatorEq, FilterOperatorNe, FilterOperatorGt, FilterOperatorGe, FilterOperatorLt, FilterOperatorLe:
+	case FilterOperatorIn, FilterOperatorNotIn:
+		ret.values = parseFilterValues(filter.Value)
+	case FilterOperatorLike, FilterOperatorNotLike:
+		ret.like, err = likeRegexp(filter.Value)
+	default:
+		err = errors.New(fmt.Sprintf("invalid filter operator [%s]", filter.Operator))
+	}
+	return
+}
+
+// match 判断单元格的值 value 是否满足过滤规则。
+//
+// 大小比较时无法按照列类型解析的值（比如空值或者非数字）总是不满足条件。
+func (f *rowFilter) match(value string) bool {
+	columnType := f.column.ValueType()
+	if ColumnTypeMSelect == columnType {
+		return f.matchOptions(splitOptions(value))
+	}
+
+	switch f.filter.Operator {
+	case FilterOperatorEq:
+		return equalValues(columnType, value, f.filter.Value)
+	case FilterOperatorNe:
+		return !equalValues(columnType, value, f.filter.Value)
+	case FilterOperatorGt, FilterOperatorGe, FilterOperatorLt, FilterOperatorLe:
+		result, ok := compareValues(columnType, value, f.filter.Value)
+		if !ok {
+			return false
+		}
+		switch f.filter.Operator {
+		case FilterOperatorGt:
+			return 0 < result
+		case FilterOperatorGe:
+			return 0 <= result
+		case FilterOperatorLt:
+			return 0 > result
+		default:
+			return 0 >= result
+		}
+	case FilterOperatorIn, FilterOperatorNotIn:
+		in := false
+		for _, v := range f.values {
+			if equalValues(columnType, value, v) {
+				in = true
+				break
+			}
+		}
+		return in == (FilterOperatorIn == f.filter.Operator)
+	case FilterOperatorLike:
+		return f.like.MatchString(value)
+	case FilterOperatorNotLike:
+		return !f.like.MatchString(value)
+	}
+	return false
+}
+
+// matchOptions 判断多选单元格的选项 options 是否满足过滤规则。
+//
+// 等于和 IN 表示包含任一过滤值，不等于和 NOT IN 表示不包含任何过滤值，LIKE 和 NOT LIKE 匹配任一选项，大小比较总是不满足条件。
+func (f *rowFilter) matchOptions(options []string) bool {
+	var values []string
+	switch f.filter.Operator {
+	case FilterOperatorEq, FilterOperatorNe:
+		values = []string{f.filter.Value}
+	case FilterOperatorIn, FilterOperatorNotIn:
+		values = f.values
+	case FilterOperatorLike, FilterOperatorNotLike:
+		matched := false
+		for _, option := range options {
+			if f.like.MatchString(option) {
+				matched = true
+				break
+			}
+		}
+		return matched == (FilterOperatorLike == f.filter.Operator)
+	default:
+		return false
+	}
+
+	contained := false
+	for _, option := range options {
+		for _, v := range values {
+			if option == v {
+				contained = true
+				break
+			}
+		}
+	}
+	return contained == (FilterOperatorEq == f.filter.Operator || FilterOperatorIn == f.filter.Operator)
+}
@@ -0,0 +1,211 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestAttributeView 创建用于测试的属性视图，列依次为块、名称（文本）、分数（数字）、截止日期（日期）、状态（单选）和标签（多选）。
+//
+// 第 4 行的分数和截止日期为无法解析的值。
+func newTestAttributeView(t *testing.T) *AttributeView {
+	ret := NewAttributeView("20230101000000-avavava")
+	ret.Columns[0].ID = "block"
+	ret.Columns = append(ret.Columns,
+		&Column{ID: "name", Name: "Name", Type: ColumnTypeText},
+		&Column{ID: "score", Name: "Score", Type: ColumnTypeNumber},
+		&Column{ID: "due", Name: "Due", Type: ColumnTypeDate},
+		&Column{ID: "status", Name: "Status", Type: ColumnTypeSelect},
+		&Column{ID: "tags", Name: "Tags", Type: ColumnTypeMSelect},
+	)
+	for _, option := range []string{"Todo", "Done"} {
+		ret.Columns[4].AddOption(option, "")
+	}
+	for _, option := range []string{"x", "y", "z"} {
+		ret.Columns[5].AddOption(option, "")
+	}
+
+	addTestRow(t, ret, "r1", "a", "Apple", "10", "2023-01-01", "Todo", "x,y")
+	addTestRow(t, ret, "r2", "b", "banana", "2.5", "2023-03-01", "Done", "y")
+	addTestRow(t, ret, "r3", "c", "Cherry", "", "", "", "")
+	addTestRow(t, ret, "r4", "d", "Durian", "", "", "Todo", "")
+	ret.Rows[3].Cells[2].Value = "n/a"
+	ret.Rows[3].Cells[3].Value = "someday"
+	return ret
+}
+
+func addTestRow(t *testing.T, attrView *AttributeView, id string, values ...string) {
+	row := &Row{ID: id}
+	for i, value := range values {
+		cell := &Cell{ID: id + "-" + attrView.Columns[i].ID}
+		if err := attrView.Columns[i].SetCellValue(cell, value); nil != err {
+			t.Fatal(err)
+		}
+		row.Cells = append(row.Cells, cell)
+	}
+	attrView.Rows = append(attrView.Rows, row)
+}
+
+func queryRowIDs(t *testing.T, attrView *AttributeView) string {
+	table, err := attrView.Query("", 0, 0, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var ret []string
+	for _, row := range table.Rows {
+		ret = append(ret, row.ID)
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestFilter(t *testing.T) {
+	cases := []struct {
+		column   string
+		operator FilterOperator
+		value    string
+		expected string
+	}{
+		// 文本列
+		{"Name", FilterOperatorEq, "Apple", "r1"},
+		{"Name", FilterOperatorNe, "Apple", "r2,r3,r4"},
+		{"Name", FilterOperatorIn, "Apple, Cherry", "r1,r3"},
+		{"Name", FilterOperatorNotIn, `["Apple", "Cherry"]`, "r2,r4"},
+		{"Name", FilterOperatorLike, "%an%", "r2,r4"},
+		{"Name", FilterOperatorLike, "apple", "r1"},
+		{"Name", FilterOperatorLike, "_herry", "r3"},
+		{"Name", FilterOperatorNotLike, "%an%", "r1,r3"},
+		{"Name", FilterOperatorGt, "Cherry", "r2,r4"},
+		// 数字列，空值和无法解析的值不满足大小比较
+		{"Score", FilterOperatorEq, "10.0", "r1"},
+		{"Score", FilterOperatorNe, "10", "r2,r3,r4"},
+		{"Score", FilterOperatorGt, "5", "r1"},
+		{"Score", FilterOperatorGe, "2.5", "r1,r2"},
+		{"Score", FilterOperatorLt, "10", "r2"},
+		{"Score", FilterOperatorLe, "10", "r1,r2"},
+		{"Score", FilterOperatorIn, "[2.5, 10]", "r1,r2"},
+		{"Score", FilterOperatorNotIn, "2.5", "r1,r3,r4"},
+		{"Score", FilterOperatorEq, "n/a", "r4"},
+		{"Score", FilterOperatorGt, "abc", ""},
+		// 日期列
+		{"Due", FilterOperatorGt, "2023-02-01", "r2"},
+		{"Due", FilterOperatorLe, "2023-01-01", "r1"},
+		{"Due", FilterOperatorLt, "2023/12/31", "r1,r2"},
+		{"Due", FilterOperatorEq, "2023-03-01 00:00", "r2"},
+		{"Due", FilterOperatorGe, "someday", ""},
+		// 单选列
+		{"Status", FilterOperatorEq, "Todo", "r1,r4"},
+		{"Status", FilterOperatorIn, "Todo,Done", "r1,r2,r4"},
+		{"Status", FilterOperatorEq, "", "r3"},
+		// 多选列
+		{"Tags", FilterOperatorEq, "y", "r1,r2"},
+		{"Tags", FilterOperatorNe, "y", "r3,r4"},
+		{"Tags", FilterOperatorIn, "x,z", "r1"},
+		{"Tags", FilterOperatorNotIn, "x,z", "r2,r3,r4"},
+		{"Tags", FilterOperatorLike, "X%", "r1"},
+		{"Tags", FilterOperatorNotLike, "x", "r2,r3,r4"},
+		{"Tags", FilterOperatorGt, "a", ""},
+		// 块列没有显示内容时基于值
+		{"block", FilterOperatorIn, "a,d", "r1,r4"},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		if err := attrView.SetFilters("", []*AttributeViewFilter{{Column: c.column, Operator: c.operator, Value: c.value}}); nil != err {
+			t.Fatal(err)
+		}
+		if got := queryRowIDs(t, attrView); c.expected != got {
+			t.Fatalf("filter [%s %s %s] expected [%s], got [%s]", c.column, c.operator, c.value, c.expected, got)
+		}
+	}
+}
+
+func TestFilterMultiple(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	if err := attrView.SetFilters("", []*AttributeViewFilter{
+		{Column: "Status", Operator: FilterOperatorEq, Value: "Todo"},
+		{Column: "Tags", Operator: FilterOperatorEq, Value: "x"},
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if got := queryRowIDs(t, attrView); "r1" != got {
+		t.Fatalf("multiple filters [%s] not match", got)
+	}
+}
+
+func TestFilterContent(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	attrView.Filters = []*AttributeViewFilter{{Column: "block", Operator: FilterOperatorLike, Value: "%content b%"}}
+	table, err := attrView.Query("", 0, 0, func(column *Column, value string) string { return "content " + value })
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(table.Rows) || "r2" != table.Rows[0].ID || "content b" != table.Rows[0].Cells[0].Content {
+		t.Fatalf("filter by content not match")
+	}
+}
+
+func TestInvalidFilter(t *testing.T) {
+	cases := []*AttributeViewFilter{
+		{Column: "Name", Operator: "~", Value: "a"},
+		{Column: "Missing", Operator: FilterOperatorEq, Value: "a"},
+	}
+	for _, filter := range cases {
+		attrView := newTestAttributeView(t)
+		if err := attrView.SetFilters("", []*AttributeViewFilter{filter}); nil == err {
+			t.Fatalf("invalid filter [%s %s] should be rejected", filter.Column, filter.Operator)
+		}
+		attrView.Filters = []*AttributeViewFilter{filter}
+		if _, err := attrView.Query("", 0, 0, nil); nil == err {
+			t.Fatalf("query with invalid filter [%s %s] should fail", filter.Column, filter.Operator)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	cases := []struct {
+		sorts    []*AttributeViewSort
+		expected string
+	}{
+		// 无法解析的值和空值总是排在最后，并保持原有顺序
+		{[]*AttributeViewSort{{Column: "Score", Order: SortOrderAsc}}, "r2,r1,r3,r4"},
+		{[]*AttributeViewSort{{Column: "Score", Order: SortOrderDesc}}, "r1,r2,r3,r4"},
+		{[]*AttributeViewSort{{Column: "Due", Order: SortOrderDesc}}, "r2,r1,r3,r4"},
+		{[]*AttributeViewSort{{Column: "Name", Order: SortOrderAsc}}, "r1,r3,r4,r2"},
+		// 多个排序规则依次比较，全部相等时保持原有顺序
+		{[]*AttributeViewSort{{Column: "Status", Order: SortOrderDesc}}, "r1,r4,r2,r3"},
+		{[]*AttributeViewSort{{Column: "Status", Order: SortOrderDesc}, {Column: "Name", Order: SortOrderDesc}}, "r4,r1,r2,r3"},
+		{[]*AttributeViewSort{{Column: "Tags", Order: SortOrderAsc}, {Column: "Name", Order: SortOrderDesc}}, "r4,r3,r1,r2"},
+		{[]*AttributeViewSort{{Column: "Tags", Order: SortOrderAsc}, {Column: "Score", Order: SortOrderDesc}}, "r3,r4,r1,r2"},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		if err := attrView.SetSorts("", c.sorts); nil != err {
+			t.Fatal(err)
+		}
+		if got := queryRowIDs(t, attrView); c.expected != got {
+			t.Fatalf("sort %s %s expected [%s], got [%s]", c.sorts[0].Column, c.sorts[0].Order, c.expected, got)
+		}
+	}
+
+	attrView := newTestAttributeView(t)
+	if err := attrView.SetSorts("", []*AttributeViewSort{{Column: "Name", Order: "RANDOM"}}); nil == err {
+		t.Fatalf("invalid sort order should be rejected")
+	}
+}
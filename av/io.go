@@ -0,0 +1,199 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+const csvBOM = "\xEF\xBB\xBF"
+
+// CSV 导出 CSV，第一行为列名，块列和关联列导出显示内容，数字导出原始值，其他列导出格式化后的值。
+func (table *Table) CSV() (ret []byte, err error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(csvBOM) // 写入 BOM，避免表格软件打开时乱码
+	writer := csv.NewWriter(buf)
+
+	var header []string
+	for _, column := range table.Columns {
+		header = append(header, column.Name)
+	}
+	if err = writer.Write(header); nil != err {
+		return
+	}
+
+	for _, row := range table.Rows {
+		var record []string
+		for i, cell := range row.Cells {
+			column := table.Columns[i]
+			value := cell.Value
+			switch {
+			case ColumnTypeBlock == column.Type || ColumnTypeRelation == column.Type:
+				value = cell.Content
+			case ColumnTypeNumber == column.ValueType():
+			case "" != cell.Content:
+				value = cell.Content
+			}
+			record = append(record, value)
+		}
+		if err = writer.Write(record); nil != err {
+			return
+		}
+	}
+
+	writer.Flush()
+	ret, err = buf.Bytes(), writer.Error()
+	return
+}
+
+// JSON 导出 JSON，包括列定义和按照列名组织的带类型的行数据。
+func (table *Table) JSON() (ret []byte, err error) {
+	var rows []map[string]interface{}
+	for _, row := range table.Rows {
+		record := map[string]interface{}{}
+		for i, cell := range row.Cells {
+			record[table.Columns[i].Name] = jsonValue(table.Columns[i], cell)
+		}
+		rows = append(rows, record)
+	}
+
+	ret, err = gulu.JSON.MarshalIndentJSON(map[string]interface{}{
+		"id":      table.ID,
+		"columns": table.Columns,
+		"rows":    rows,
+	}, "", "\t")
+	return
+}
+
+// jsonValue 返回单元格 cell 按照列 column 的值类型转换后的 JSON 值，空单元格为 null。
+func jsonValue(column *Column, cell *TableCell) interface{} {
+	if "" == cell.Value {
+		return nil
+	}
+
+	switch column.Type {
+	case ColumnTypeBlock:
+		return cell.Content
+	case ColumnTypeRelation:
+		var ret []string
+		for _, content := range strings.Split(cell.Content, ", ") {
+			if "" != content {
+				ret = append(ret, content)
+			}
+		}
+		return ret
+	case ColumnTypeMSelect:
+		return strings.Split(cell.Value, optionSeparator)
+	}
+
+	switch column.ValueType() {
+	case ColumnTypeNumber:
+		if number, err := strconv.ParseFloat(cell.Value, 64); nil == err {
+			return number
+		}
+	case ColumnTypeDate:
+		start, err := strconv.ParseInt(cell.Value, 10, 64)
+		if nil != err {
+			return cell.Value
+		}
+		loc := time.Local
+		ret := map[string]interface{}{}
+		if nil != cell.Date && "" != cell.Date.Timezone {
+			if l, loadErr := time.LoadLocation(cell.Date.Timezone); nil == loadErr {
+				loc = l
+				ret["timezone"] = cell.Date.Timezone
+			}
+		}
+		ret["start"] = time.UnixMilli(start).In(loc).Format(time.RFC3339)
+		if nil != cell.Date && 0 < cell.Date.End {
+			ret["end"] = time.UnixMilli(cell.Date.End).In(loc).Format(time.RFC3339)
+		}
+		return ret
+	}
+	return cell.Value
+}
+
+// ImportCSV 使用 CSV 数据 data 创建属性视图 avID，返回属性视图和每行块列的内容（与 Rows 一一对应）。
+//
+// CSV 第一行为列名，第一列作为块列，其他列根据值推断为数字、日期、单选或者文本列，第一列为空的行会被忽略。
+// 块列的值为新生成的块 ID，调用方需要使用对应的内容创建块。
+func ImportCSV(avID string, data []byte) (ret *AttributeView, contents []string, err error) {
+	data = bytes.TrimPrefix(data, []byte(csvBOM))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if nil != err {
+		return
+	}
+	if 1 > len(records) || 1 > len(records[0]) {
+		err = errors.New("empty CSV")
+		return
+	}
+
+	header, records := records[0], records[1:]
+	ret = NewAttributeView(avID)
+	ret.Columns[0].Name = strings.TrimSpace(header[0])
+	for i, name := range header[1:] {
+		var values []string
+		for _, record := range records {
+			if i+1 < len(record) {
+				values = append(values, record[i+1])
+			}
+		}
+
+		column := &Column{ID: "av" + ast.NewNodeID(), Name: strings.TrimSpace(name), Type: InferColumnType(values)}
+		if ColumnTypeSelect == column.Type {
+			for _, value := range values {
+				if value = strings.TrimSpace(value); "" != value && nil == column.GetOption(value) {
+					column.AddOption(value, "")
+				}
+			}
+		}
+		ret.Columns = append(ret.Columns, column)
+	}
+
+	for _, record := range records {
+		if 1 > len(record) || "" == strings.TrimSpace(record[0]) {
+			continue
+		}
+
+		row := NewRow()
+		row.Cells = append(row.Cells, &Cell{ID: ast.NewNodeID(), Value: ast.NewNodeID()})
+		for i, column := range ret.Columns[1:] {
+			cell := &Cell{ID: ast.NewNodeID()}
+			if i+1 < len(record) {
+				if setErr := column.SetCellValue(cell, record[i+1]); nil != setErr {
+					logging.LogWarnf("import CSV value of column [%s] failed: %s", column.Name, setErr)
+				}
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		ret.Rows = append(ret.Rows, row)
+		contents = append(contents, strings.TrimSpace(record[0]))
+	}
+	return
+}
@@ -0,0 +1,107 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"testing"
+)
+
+// exportTestCSV 使用导入时的块内容 contents 导出属性视图 attrView 的 CSV。
+func exportTestCSV(t *testing.T, attrView *AttributeView, contents []string) string {
+	blockContents := map[string]string{}
+	for i, row := range attrView.Rows {
+		blockContents[row.Cells[0].Value] = contents[i]
+	}
+	table, err := attrView.Query("", 0, 0, func(column *Column, value string) string { return blockContents[value] })
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, err := table.CSV()
+	if nil != err {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	data := csvBOM + "Name,Score,Due,Status,Notes\n" +
+		"Apple,10,2023-01-01,Todo,\"red, sweet\"\n" +
+		"Banana,2.50,2023-03-01 08:30,Done,\n" +
+		",3,2023-01-02,Todo,skipped\n" +
+		" Cherry ,,2023/01/05,Todo,\"say \"\"hi\"\"\"\n"
+	attrView, contents, err := ImportCSV("20230101000000-avavava", []byte(data))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	expectedTypes := []ColumnType{ColumnTypeBlock, ColumnTypeNumber, ColumnTypeDate, ColumnTypeSelect, ColumnTypeText}
+	if len(expectedTypes) != len(attrView.Columns) {
+		t.Fatalf("columns %v not match", attrView.GetColumnNames())
+	}
+	for i, typ := range expectedTypes {
+		if typ != attrView.Columns[i].Type {
+			t.Fatalf("type of column [%s] expected [%s], got [%s]", attrView.Columns[i].Name, typ, attrView.Columns[i].Type)
+		}
+	}
+	if 2 != len(attrView.Columns[3].Options) {
+		t.Fatalf("options of select column not match")
+	}
+	if 3 != len(attrView.Rows) || 3 != len(contents) || "Cherry" != contents[2] {
+		t.Fatalf("rows %v not match", contents)
+	}
+
+	expected := csvBOM + "Name,Score,Due,Status,Notes\n" +
+		"Apple,10,2023-01-01,Todo,\"red, sweet\"\n" +
+		"Banana,2.5,2023-03-01 08:30,Done,\n" +
+		"Cherry,,2023-01-05,Todo,\"say \"\"hi\"\"\"\n"
+	exported := exportTestCSV(t, attrView, contents)
+	if expected != exported {
+		t.Fatalf("exported CSV not match:\n%s", exported)
+	}
+
+	// 再次导入导出的 CSV 后结果不变
+	reimported, contents, err := ImportCSV("20230101000000-avavavb", []byte(exported))
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i, row := range reimported.Rows {
+		for j := 1; j < len(row.Cells); j++ {
+			if row.Cells[j].Value != attrView.Rows[i].Cells[j].Value {
+				t.Fatalf("reimported cell [%d, %d] expected [%s], got [%s]", i, j, attrView.Rows[i].Cells[j].Value, row.Cells[j].Value)
+			}
+		}
+	}
+	if exported != exportTestCSV(t, reimported, contents) {
+		t.Fatalf("exported CSV changed after round trip")
+	}
+}
+
+func TestImportEmptyCSV(t *testing.T) {
+	for _, data := range []string{"", csvBOM} {
+		if _, _, err := ImportCSV("20230101000000-avavava", []byte(data)); nil == err {
+			t.Fatalf("import empty CSV should fail")
+		}
+	}
+
+	attrView, contents, err := ImportCSV("20230101000000-avavava", []byte("Name,Count\nApple,1,extra\nBanana\n"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(attrView.Rows) || 2 != len(contents) || "1" != attrView.Rows[0].Cells[1].Value || "" != attrView.Rows[1].Cells[1].Value {
+		t.Fatalf("import ragged CSV not match")
+	}
+}
@@ -0,0 +1,279 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+)
+
+// ColumnRollup 描述了汇总列的汇总方式。
+type ColumnRollup struct {
+	RelationColumnID string     `json:"relationColumnId"` // 本属性视图中的关联列 ID
+	TargetColumnID   string     `json:"targetColumnId"`   // 关联属性视图中被汇总的列 ID
+	Calc             RollupCalc `json:"calc"`             // 汇总方式
+}
+
+// RollupCalc 描述了汇总列的汇总方式。
+type RollupCalc string
+
+const (
+	RollupCalcCount    RollupCalc = "count"    // 关联行数
+	RollupCalcSum      RollupCalc = "sum"      // 求和
+	RollupCalcAvg      RollupCalc = "avg"      // 平均值
+	RollupCalcMin      RollupCalc = "min"      // 最小值
+	RollupCalcMax      RollupCalc = "max"      // 最大值
+	RollupCalcEarliest RollupCalc = "earliest" // 最早日期
+	RollupCalcLatest   RollupCalc = "latest"   // 最晚日期
+	RollupCalcUnique   RollupCalc = "unique"   // 去重后的值
+)
+
+// IsValidRollupCalc 判断 calc 是否为支持的汇总方式。
+func IsValidRollupCalc(calc RollupCalc) bool {
+	switch calc {
+	case RollupCalcCount, RollupCalcSum, RollupCalcAvg, RollupCalcMin, RollupCalcMax, RollupCalcEarliest, RollupCalcLatest, RollupCalcUnique:
+		return true
+	}
+	return false
+}
+
+// ValueType 返回列的值类型，汇总列的值类型取决于汇总方式，其他列的值类型为列类型。
+func (column *Column) ValueType() ColumnType {
+	if ColumnTypeRollup != column.Type || nil == column.Rollup {
+		return column.Type
+	}
+
+	switch column.Rollup.Calc {
+	case RollupCalcCount, RollupCalcSum, RollupCalcAvg, RollupCalcMin, RollupCalcMax:
+		return ColumnTypeNumber
+	case RollupCalcEarliest, RollupCalcLatest:
+		return ColumnTypeDate
+	}
+	return ColumnTypeText
+}
+
+// GetColumn 返回 ID 为 columnID 的列及其下标，找不到时返回 nil 和 -1。
+func (av *AttributeView) GetColumn(columnID string) (ret *Column, index int) {
+	for i, column := range av.Columns {
+		if column.ID == columnID {
+			return column, i
+		}
+	}
+	return nil, -1
+}
+
+// GetRow 返回 ID 为 rowID 的行，找不到时返回 nil。
+func (av *AttributeView) GetRow(rowID string) *Row {
+	for _, row := range av.Rows {
+		if row.ID == rowID {
+			return row
+		}
+	}
+	return nil
+}
+
+// GetCell 返回行 row 中第 index 列的单元格，行的单元格不足时补齐空单元格。
+func (row *Row) GetCell(index int) *Cell {
+	for len(row.Cells) <= index {
+		row.Cells = append(row.Cells, &Cell{ID: ast.NewNodeID()})
+	}
+	if nil == row.Cells[index] {
+		row.Cells[index] = &Cell{ID: ast.NewNodeID()}
+	}
+	return row.Cells[index]
+}
+
+// GetRelatedRowIDs 返回关联单元格 cell 关联的行 ID。
+func GetRelatedRowIDs(cell *Cell) []string {
+	if nil == cell {
+		return nil
+	}
+	return splitOptions(cell.Value)
+}
+
+// SetRelatedRowIDs 设置关联单元格 cell 关联的行 ID，重复的行 ID 会被去掉。
+func SetRelatedRowIDs(cell *Cell, rowIDs []string) {
+	var ids []string
+	for _, id := range rowIDs {
+		if id = strings.TrimSpace(id); "" != id && !gulu.Str.Contains(id, ids) {
+			ids = append(ids, id)
+		}
+	}
+	cell.Value = strings.Join(ids, optionSeparator)
+}
+
+// SetRelation 将行 row 的关联列（下标为 index）设置为关联 target 中的行 relatedRowIDs，
+// 并在 target 的反向关联列（下标为 backIndex）中同步添加或者移除对行 row 的关联，backIndex 小于 0 时不更新反向关联。
+func (av *AttributeView) SetRelation(row *Row, index int, relatedRowIDs []string, target *AttributeView, backIndex int) {
+	cell := row.GetCell(index)
+	oldRowIDs := GetRelatedRowIDs(cell)
+	SetRelatedRowIDs(cell, relatedRowIDs)
+	newRowIDs := GetRelatedRowIDs(cell)
+	if 0 > backIndex {
+		return
+	}
+
+	for _, oldRowID := range oldRowIDs {
+		if !gulu.Str.Contains(oldRowID, newRowIDs) {
+			target.RelateRow(backIndex, oldRowID, row.ID, false)
+		}
+	}
+	for _, newRowID := range newRowIDs {
+		if !gulu.Str.Contains(newRowID, oldRowIDs) {
+			target.RelateRow(backIndex, newRowID, row.ID, true)
+		}
+	}
+}
+
+// RelateRow 在行 rowID 的关联列（下标为 index）中添加或者移除对行 relatedRowID 的关联。
+func (av *AttributeView) RelateRow(index int, rowID, relatedRowID string, relate bool) {
+	row := av.GetRow(rowID)
+	if nil == row {
+		return
+	}
+
+	cell := row.GetCell(index)
+	var relatedRowIDs []string
+	for _, id := range GetRelatedRowIDs(cell) {
+		if id != relatedRowID {
+			relatedRowIDs = append(relatedRowIDs, id)
+		}
+	}
+	if relate {
+		relatedRowIDs = append(relatedRowIDs, relatedRowID)
+	}
+	SetRelatedRowIDs(cell, relatedRowIDs)
+}
+
+// CalcRollups 计算所有汇总列的值。
+//
+// getAttributeView 用于获取关联的属性视图，content 用于获取关联属性视图中块列和关联列的显示内容。
+func (av *AttributeView) CalcRollups(getAttributeView func(avID string) *AttributeView, content func(column *Column, value string) string) {
+	for index, column := range av.Columns {
+		if ColumnTypeRollup != column.Type || nil == column.Rollup {
+			continue
+		}
+
+		relationColumn, relationIndex := av.GetColumn(column.Rollup.RelationColumnID)
+		if nil == relationColumn || ColumnTypeRelation != relationColumn.Type {
+			continue
+		}
+		target := getAttributeView(relationColumn.AttributeViewID)
+		if nil == target {
+			continue
+		}
+		targetColumn, targetIndex := target.GetColumn(column.Rollup.TargetColumnID)
+
+		for _, row := range av.Rows {
+			var relatedRowIDs []string
+			if relationIndex < len(row.Cells) {
+				relatedRowIDs = GetRelatedRowIDs(row.Cells[relationIndex])
+			}
+
+			var values []string
+			for _, relatedRowID := range relatedRowIDs {
+				relatedRow := target.GetRow(relatedRowID)
+				if nil == relatedRow || nil == targetColumn || targetIndex >= len(relatedRow.Cells) || nil == relatedRow.Cells[targetIndex] {
+					values = append(values, "")
+					continue
+				}
+
+				value := relatedRow.Cells[targetIndex].Value
+				switch targetColumn.Type {
+				case ColumnTypeBlock, ColumnTypeRelation:
+					if nil != content {
+						value = content(targetColumn, value)
+					}
+				}
+				values = append(values, value)
+			}
+			row.GetCell(index).Value = Rollup(column.Rollup.Calc, targetColumn, values)
+		}
+	}
+}
+
+// Rollup 按照汇总方式 calc 汇总关联行中列 column 的值 values。
+func Rollup(calc RollupCalc, column *Column, values []string) string {
+	switch calc {
+	case RollupCalcCount:
+		return strconv.Itoa(len(values))
+	case RollupCalcSum, RollupCalcAvg, RollupCalcMin, RollupCalcMax:
+		var numbers []float64
+		for _, value := range values {
+			if number, err := strconv.ParseFloat(strings.TrimSpace(value), 64); nil == err {
+				numbers = append(numbers, number)
+			}
+		}
+		if 1 > len(numbers) {
+			return ""
+		}
+
+		ret := numbers[0]
+		sum := 0.0
+		for _, number := range numbers {
+			sum += number
+			if (RollupCalcMin == calc && number < ret) || (RollupCalcMax == calc && number > ret) {
+				ret = number
+			}
+		}
+		switch calc {
+		case RollupCalcSum:
+			ret = sum
+		case RollupCalcAvg:
+			ret = sum / float64(len(numbers))
+		}
+		return strconv.FormatFloat(ret, 'f', -1, 64)
+	case RollupCalcEarliest, RollupCalcLatest:
+		var ret int64
+		found := false
+		for _, value := range values {
+			t, ok := parseDate(value)
+			if !ok {
+				continue
+			}
+			ms := t.UnixMilli()
+			if !found || (RollupCalcEarliest == calc && ms < ret) || (RollupCalcLatest == calc && ms > ret) {
+				ret = ms
+				found = true
+			}
+		}
+		if !found {
+			return ""
+		}
+		return strconv.FormatInt(ret, 10)
+	case RollupCalcUnique:
+		var ret []string
+		for _, value := range values {
+			items := []string{value}
+			if nil != column && ColumnTypeMSelect == column.Type {
+				items = splitOptions(value)
+			} else if nil != column && ColumnTypeDate == column.Type {
+				items = []string{column.FormatCellValue(&Cell{Value: value})}
+			}
+			for _, item := range items {
+				if "" != item && !gulu.Str.Contains(item, ret) {
+					ret = append(ret, item)
+				}
+			}
+		}
+		return strings.Join(ret, optionSeparator)
+	}
+	return ""
+}
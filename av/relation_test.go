@@ -0,0 +1,158 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRollup(t *testing.T) {
+	date := func(value string) string {
+		ret, _ := time.ParseInLocation("2006-01-02", value, time.Local)
+		return strconv.FormatInt(ret.UnixMilli(), 10)
+	}
+	text := &Column{Type: ColumnTypeText}
+	number := &Column{Type: ColumnTypeNumber}
+	dateColumn := &Column{Type: ColumnTypeDate}
+	mSelect := &Column{Type: ColumnTypeMSelect}
+
+	cases := []struct {
+		calc     RollupCalc
+		column   *Column
+		values   []string
+		expected string
+	}{
+		{RollupCalcCount, number, []string{"1", "", "x"}, "3"},
+		{RollupCalcCount, number, nil, "0"},
+		{RollupCalcSum, number, []string{"1", "2.5", "x", ""}, "3.5"},
+		{RollupCalcSum, number, []string{"x", ""}, ""},
+		{RollupCalcAvg, number, []string{"1", "2.5", "x", ""}, "1.75"},
+		{RollupCalcAvg, number, nil, ""},
+		{RollupCalcMin, number, []string{"3", "-1", "2"}, "-1"},
+		{RollupCalcMax, number, []string{"3", "-1", "12"}, "12"},
+		{RollupCalcMax, text, []string{" 7 ", "abc"}, "7"},
+		{RollupCalcEarliest, dateColumn, []string{date("2023-01-02"), "2023-01-01", "bad", ""}, date("2023-01-01")},
+		{RollupCalcLatest, dateColumn, []string{date("2023-01-02"), "2023-01-01", "bad"}, date("2023-01-02")},
+		{RollupCalcLatest, dateColumn, []string{"bad", ""}, ""},
+		{RollupCalcUnique, text, []string{"a", "b", "a", ""}, "a,b"},
+		{RollupCalcUnique, mSelect, []string{"x,y", "y,z", ""}, "x,y,z"},
+		{RollupCalcUnique, dateColumn, []string{date("2023-01-02"), "2023-01-02"}, "2023-01-02"},
+		{RollupCalcUnique, nil, []string{"a", "a"}, "a"},
+		{"median", number, []string{"1", "2"}, ""},
+	}
+
+	for _, c := range cases {
+		if got := Rollup(c.calc, c.column, c.values); c.expected != got {
+			t.Fatalf("rollup [%s] of %v expected [%s], got [%s]", c.calc, c.values, c.expected, got)
+		}
+	}
+}
+
+// newTestRelation 创建互相关联的属性视图 a 和 b，a 的第 1 列关联 b，b 的第 1 列为反向关联列。
+func newTestRelation() (a, b *AttributeView) {
+	a = NewAttributeView("20230101000000-aaaaaaa")
+	b = NewAttributeView("20230101000000-bbbbbbb")
+	a.Columns = append(a.Columns, &Column{ID: "relation", Name: "B", Type: ColumnTypeRelation, AttributeViewID: b.ID, RelationColumnID: "back"})
+	b.Columns = append(b.Columns,
+		&Column{ID: "back", Name: "A", Type: ColumnTypeRelation, AttributeViewID: a.ID, RelationColumnID: "relation"},
+		&Column{ID: "price", Name: "Price", Type: ColumnTypeNumber},
+	)
+	for _, id := range []string{"a1", "a2"} {
+		a.Rows = append(a.Rows, &Row{ID: id, Cells: []*Cell{{ID: id + "-block", Value: id}}})
+	}
+	for i, id := range []string{"b1", "b2", "b3"} {
+		b.Rows = append(b.Rows, &Row{ID: id, Cells: []*Cell{{ID: id + "-block", Value: id}, {ID: id + "-back"}, {ID: id + "-price", Value: strconv.Itoa(i + 1)}}})
+	}
+	return
+}
+
+func TestSetRelation(t *testing.T) {
+	cases := []struct {
+		row           string
+		relatedRowIDs []string
+		expected      string // a1 和 a2 的关联
+		expectedBack  string // b1、b2 和 b3 的反向关联
+	}{
+		{"a1", []string{"b1", "b2", "b1", " "}, "b1,b2|", "a1|a1|"},
+		{"a2", []string{"b2"}, "b1,b2|b2", "a1|a1,a2|"},
+		{"a1", []string{"b2", "b3"}, "b2,b3|b2", "|a1,a2|a1"},
+		{"a2", []string{"b3", "b2"}, "b2,b3|b3,b2", "|a1,a2|a1,a2"},
+		{"a1", nil, "|b3,b2", "|a2|a2"},
+		{"a2", []string{"missing"}, "|missing", "||"},
+	}
+
+	a, b := newTestRelation()
+	for _, c := range cases {
+		a.SetRelation(a.GetRow(c.row), 1, c.relatedRowIDs, b, 1)
+		got := a.Rows[0].GetCell(1).Value + "|" + a.Rows[1].GetCell(1).Value
+		gotBack := b.Rows[0].Cells[1].Value + "|" + b.Rows[1].Cells[1].Value + "|" + b.Rows[2].Cells[1].Value
+		if c.expected != got || c.expectedBack != gotBack {
+			t.Fatalf("relate [%s] to %v expected [%s] [%s], got [%s] [%s]", c.row, c.relatedRowIDs, c.expected, c.expectedBack, got, gotBack)
+		}
+	}
+}
+
+func TestSetRelationWithoutBack(t *testing.T) {
+	a, b := newTestRelation()
+	a.SetRelation(a.Rows[0], 1, []string{"b1"}, b, -1)
+	if "b1" != a.Rows[0].GetCell(1).Value || "" != b.Rows[0].Cells[1].Value {
+		t.Fatalf("relation without back column not match")
+	}
+}
+
+func TestRelateRow(t *testing.T) {
+	a, _ := newTestRelation()
+	a.RelateRow(1, "a1", "b1", true)
+	a.RelateRow(1, "a1", "b2", true)
+	a.RelateRow(1, "a1", "b1", true)
+	if "b2,b1" != a.Rows[0].GetCell(1).Value {
+		t.Fatalf("relate row [%s] not match", a.Rows[0].GetCell(1).Value)
+	}
+	a.RelateRow(1, "a1", "b2", false)
+	a.RelateRow(1, "missing", "b2", true)
+	if "b1" != a.Rows[0].GetCell(1).Value {
+		t.Fatalf("unrelate row [%s] not match", a.Rows[0].GetCell(1).Value)
+	}
+}
+
+func TestCalcRollups(t *testing.T) {
+	a, b := newTestRelation()
+	a.Columns = append(a.Columns,
+		&Column{ID: "total", Name: "Total", Type: ColumnTypeRollup, Rollup: &ColumnRollup{RelationColumnID: "relation", TargetColumnID: "price", Calc: RollupCalcSum}},
+		&Column{ID: "names", Name: "Names", Type: ColumnTypeRollup, Rollup: &ColumnRollup{RelationColumnID: "relation", TargetColumnID: b.Columns[0].ID, Calc: RollupCalcUnique}},
+	)
+	a.SetRelation(a.Rows[0], 1, []string{"b1", "b3"}, b, 1)
+
+	getAttributeView := func(avID string) *AttributeView {
+		if b.ID == avID {
+			return b
+		}
+		return nil
+	}
+	a.CalcRollups(getAttributeView, func(column *Column, value string) string { return "content " + value })
+	if "4" != a.Rows[0].Cells[2].Value || "content b1,content b3" != a.Rows[0].Cells[3].Value {
+		t.Fatalf("rollups [%s] [%s] not match", a.Rows[0].Cells[2].Value, a.Rows[0].Cells[3].Value)
+	}
+	if "" != a.Rows[1].GetCell(2).Value || "" != a.Rows[1].GetCell(3).Value {
+		t.Fatalf("rollups of row without relations should be empty")
+	}
+	if ColumnTypeNumber != a.Columns[2].ValueType() || ColumnTypeText != a.Columns[3].ValueType() {
+		t.Fatalf("rollup value types not match")
+	}
+}
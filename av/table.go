@@ -0,0 +1,243 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Table 描述了属性视图渲染后的表格数据。
+type Table struct {
+	ID        string      `json:"id"`        // 属性视图 ID
+	Columns   []*Column   `json:"columns"`   // 显示的列
+	Rows      []*TableRow `json:"rows"`      // 当前页的行
+	Total     int         `json:"total"`     // 过滤后的总行数
+	Page      int         `json:"page"`      // 当前页码，从 1 开始
+	PageSize  int         `json:"pageSize"`  // 每页行数，0 表示不分页
+	PageCount int         `json:"pageCount"` // 总页数
+}
+
+// TableRow 描述了表格中的一行，单元格和 Table.Columns 一一对应。
+type TableRow struct {
+	ID    string       `json:"id"`
+	Cells []*TableCell `json:"cells"`
+}
+
+// TableCell 描述了表格中的一个单元格。
+type TableCell struct {
+	ID      string    `json:"id"`
+	Value   string    `json:"value"`
+	Date    *CellDate `json:"date,omitempty"`    // 日期列的结束时间和时区
+	Content string    `json:"content,omitempty"` // 显示内容，块列为块内容，关联列为关联行的块内容，其他列为格式化后的值
+}
+
+// Query 按照视图 viewID 的过滤规则、排序规则和显示列查询第 page 页（从 1 开始）的表格数据，pageSize 小于 1 时返回所有行，viewID 为空时使用默认视图。
+//
+// content 用于获取块列和关联列的显示内容（块内容和关联行的块内容），这两种列的过滤和排序基于显示内容，为 nil 时基于单元格的值。
+func (av *AttributeView) Query(viewID string, page, pageSize int, content func(column *Column, value string) string) (ret *Table, err error) {
+	view, err := av.getViewOrErr(viewID)
+	if nil != err {
+		return
+	}
+	rows, projections, err := av.queryRows(view, content)
+	if nil != err {
+		return
+	}
+
+	ret = &Table{ID: av.ID, Total: len(rows), Page: 1, PageSize: pageSize, PageCount: 1}
+	for _, index := range projections {
+		ret.Columns = append(ret.Columns, av.Columns[index])
+	}
+
+	if 0 < pageSize {
+		if 1 < page {
+			ret.Page = page
+		}
+		ret.PageCount = (len(rows) + pageSize - 1) / pageSize
+		start := (ret.Page - 1) * pageSize
+		if start > len(rows) {
+			start = len(rows)
+		}
+		end := start + pageSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		rows = rows[start:end]
+	} else {
+		ret.PageSize = 0
+	}
+
+	ret.Rows = []*TableRow{}
+	for _, row := range rows {
+		ret.Rows = append(ret.Rows, av.tableRow(row, projections, content))
+	}
+	return
+}
+
+// queryRows 返回满足视图 view 过滤规则并按照排序规则排序后的行，以及视图显示列的下标。
+func (av *AttributeView) queryRows(view *View, content func(column *Column, value string) string) (rows []*Row, projections []int, err error) {
+	projections, err = av.projectionIndexes(view)
+	if nil != err {
+		return
+	}
+
+	var filters []*rowFilter
+	for _, filter := range view.Filters {
+		index := av.columnIndex(filter.Column)
+		if 0 > index {
+			err = errors.New(fmt.Sprintf("filter column [%s] not found", filter.Column))
+			return
+		}
+
+		var f *rowFilter
+		if f, err = newRowFilter(av.Columns[index], index, filter); nil != err {
+			return
+		}
+		filters = append(filters, f)
+	}
+
+	sortIndexes := make([]int, len(view.Sorts))
+	for i, s := range view.Sorts {
+		sortIndexes[i] = av.columnIndex(s.Column)
+		if 0 > sortIndexes[i] {
+			err = errors.New(fmt.Sprintf("sort column [%s] not found", s.Column))
+			return
+		}
+		if SortOrderAsc != s.Order && SortOrderDesc != s.Order {
+			err = errors.New(fmt.Sprintf("invalid sort order [%s]", s.Order))
+			return
+		}
+	}
+
+	value := func(row *Row, index int) string {
+		if index >= len(row.Cells) || nil == row.Cells[index] {
+			return ""
+		}
+		if isContentColumn(av.Columns[index]) && nil != content {
+			return content(av.Columns[index], row.Cells[index].Value)
+		}
+		return row.Cells[index].Value
+	}
+
+	for _, row := range av.Rows {
+		matched := true
+		for _, f := range filters {
+			if !f.match(value(row, f.index)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			rows = append(rows, row)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, s := range view.Sorts {
+			index := sortIndexes[k]
+			columnType := av.Columns[index].ValueType()
+			a, b := value(rows[i], index), value(rows[j], index)
+			result, ok := compareValues(columnType, a, b)
+			if !ok {
+				// 无法按照列类型解析的值总是排在最后
+				_, okA := compareValues(columnType, a, a)
+				_, okB := compareValues(columnType, b, b)
+				if okA == okB {
+					continue
+				}
+				return okA
+			}
+			if 0 == result {
+				continue
+			}
+			if SortOrderDesc == s.Order {
+				return 0 < result
+			}
+			return 0 > result
+		}
+		return false
+	})
+	return
+}
+
+// tableRow 返回行 row 中显示列 projections 对应的表格行。
+func (av *AttributeView) tableRow(row *Row, projections []int, content func(column *Column, value string) string) (ret *TableRow) {
+	ret = &TableRow{ID: row.ID}
+	for _, index := range projections {
+		cell := &TableCell{}
+		if index < len(row.Cells) && nil != row.Cells[index] {
+			cell.ID = row.Cells[index].ID
+			cell.Value = row.Cells[index].Value
+			cell.Date = row.Cells[index].Date
+			if isContentColumn(av.Columns[index]) {
+				if nil != content {
+					cell.Content = content(av.Columns[index], cell.Value)
+				}
+			} else if formatted := av.Columns[index].FormatCellValue(row.Cells[index]); formatted != cell.Value {
+				cell.Content = formatted
+			}
+		}
+		ret.Cells = append(ret.Cells, cell)
+	}
+	return
+}
+
+// projectionIndexes 返回视图 view 显示列的下标，Projections 为空时显示所有列，隐藏的列不显示。
+func (av *AttributeView) projectionIndexes(view *View) (ret []int, err error) {
+	if 1 > len(view.Projections) {
+		for i, column := range av.Columns {
+			if !column.Hidden {
+				ret = append(ret, i)
+			}
+		}
+		return
+	}
+
+	for _, projection := range view.Projections {
+		index := av.columnIndex(projection)
+		if 0 > index {
+			err = errors.New(fmt.Sprintf("projection column [%s] not found", projection))
+			return
+		}
+		if !av.Columns[index].Hidden {
+			ret = append(ret, index)
+		}
+	}
+	return
+}
+
+// columnIndex 返回 ID 或者列名为 column 的列的下标，找不到时返回 -1。
+func (av *AttributeView) columnIndex(column string) int {
+	for i, c := range av.Columns {
+		if c.ID == column {
+			return i
+		}
+	}
+	for i, c := range av.Columns {
+		if c.Name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// isContentColumn 判断列 column 的显示内容是否需要通过 Query 的 content 获取。
+func isContentColumn(column *Column) bool {
+	return ColumnTypeBlock == column.Type || ColumnTypeRelation == column.Type
+}
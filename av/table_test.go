@@ -0,0 +1,147 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryProjections(t *testing.T) {
+	cases := []struct {
+		projections []string
+		hidden      string
+		expected    string
+	}{
+		{nil, "", "Block,Name,Score,Due,Status,Tags"},
+		{nil, "due", "Block,Name,Score,Status,Tags"},
+		{[]string{"Score", "name"}, "", "Score,Name"},
+		{[]string{"Score", "Due"}, "due", "Score"},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		if "" != c.hidden {
+			column, _ := attrView.GetColumn(c.hidden)
+			column.Hidden = true
+		}
+		attrView.Projections = c.projections
+		table, err := attrView.Query("", 0, 0, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, column := range table.Columns {
+			names = append(names, column.Name)
+		}
+		if got := strings.Join(names, ","); c.expected != got {
+			t.Fatalf("projections %v expected [%s], got [%s]", c.projections, c.expected, got)
+		}
+		for _, row := range table.Rows {
+			if len(table.Columns) != len(row.Cells) {
+				t.Fatalf("cells of row [%s] not match columns", row.ID)
+			}
+		}
+	}
+
+	attrView := newTestAttributeView(t)
+	attrView.Projections = []string{"Missing"}
+	if _, err := attrView.Query("", 0, 0, nil); nil == err {
+		t.Fatalf("query with missing projection should fail")
+	}
+}
+
+func TestQueryCells(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	attrView.Columns[2].NumberFormat = NumberFormatPercent
+	attrView.Projections = []string{"Score", "Due", "Tags"}
+	table, err := attrView.Query("", 0, 0, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cells := table.Rows[0].Cells
+	if "10" != cells[0].Value || "1000%" != cells[0].Content {
+		t.Fatalf("number cell [%s, %s] not match", cells[0].Value, cells[0].Content)
+	}
+	if "2023-01-01" != cells[1].Content {
+		t.Fatalf("date cell [%s, %s] not match", cells[1].Value, cells[1].Content)
+	}
+	if "x,y" != cells[2].Value || "" != cells[2].Content {
+		t.Fatalf("mSelect cell [%s, %s] not match", cells[2].Value, cells[2].Content)
+	}
+	// 无法解析的值原样显示
+	if cells = table.Rows[3].Cells; "n/a" != cells[0].Value || "" != cells[0].Content || "" != cells[1].Content {
+		t.Fatalf("unparseable cells not match")
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	cases := []struct {
+		page, pageSize    int
+		expected          string
+		expectedPage      int
+		expectedPageSize  int
+		expectedPageCount int
+	}{
+		{1, 3, "r1,r2,r3", 1, 3, 2},
+		{2, 3, "r4", 2, 3, 2},
+		{3, 3, "", 3, 3, 2},
+		{100, 3, "", 100, 3, 2},
+		{0, 3, "r1,r2,r3", 1, 3, 2},
+		{-1, 2, "r1,r2", 1, 2, 2},
+		{1, 4, "r1,r2,r3,r4", 1, 4, 1},
+		{1, 10, "r1,r2,r3,r4", 1, 10, 1},
+		{2, 0, "r1,r2,r3,r4", 1, 0, 1},
+		{1, -5, "r1,r2,r3,r4", 1, 0, 1},
+	}
+
+	attrView := newTestAttributeView(t)
+	for _, c := range cases {
+		table, err := attrView.Query("", c.page, c.pageSize, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, row := range table.Rows {
+			ids = append(ids, row.ID)
+		}
+		if got := strings.Join(ids, ","); c.expected != got {
+			t.Fatalf("page [%d, %d] expected [%s], got [%s]", c.page, c.pageSize, c.expected, got)
+		}
+		if 4 != table.Total || c.expectedPage != table.Page || c.expectedPageSize != table.PageSize || c.expectedPageCount != table.PageCount {
+			t.Fatalf("page [%d, %d] got total [%d], page [%d], page size [%d], page count [%d]", c.page, c.pageSize, table.Total, table.Page, table.PageSize, table.PageCount)
+		}
+	}
+
+	if err := attrView.SetFilters("", []*AttributeViewFilter{{Column: "Status", Operator: FilterOperatorEq, Value: "Todo"}}); nil != err {
+		t.Fatal(err)
+	}
+	table, err := attrView.Query("", 2, 1, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != table.Total || 2 != table.PageCount || 1 != len(table.Rows) || "r4" != table.Rows[0].ID {
+		t.Fatalf("page of filtered rows not match")
+	}
+
+	if _, err = attrView.Query("missing", 1, 1, nil); nil == err {
+		t.Fatalf("query missing view should fail")
+	}
+}
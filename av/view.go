@@ -0,0 +1,375 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/88250/lute/ast"
+)
+
+// View 描述了属性视图的一个视图，每个视图有自己的布局、过滤规则、排序规则和显示列。
+//
+// 属性视图本身的 Type、Projections、Filters 和 Sorts 作为 ID 为空的默认视图。
+type View struct {
+	ID          string                 `json:"id"`          // 视图 ID
+	Name        string                 `json:"name"`        // 视图名称
+	Type        AttributeViewType      `json:"type"`        // 视图布局
+	Projections []string               `json:"projections"` // 显示的列名，SELECT *
+	Filters     []*AttributeViewFilter `json:"filters"`     // 过滤规则，WHERE ...
+	Sorts       []*AttributeViewSort   `json:"sorts"`       // 排序规则，ORDER BY ...
+
+	GroupColumn string `json:"groupColumn"` // 看板分组列，必须为单选或者多选列
+	CoverColumn string `json:"coverColumn"` // 画廊封面列，值为资源文件路径，为空时使用块中的第一张图片
+	DateColumn  string `json:"dateColumn"`  // 日历日期列，必须为日期列
+}
+
+// NewView 创建一个名为 name 的 viewType 布局视图。
+func NewView(name string, viewType AttributeViewType) *View {
+	return &View{
+		ID:          ast.NewNodeID(),
+		Name:        name,
+		Type:        viewType,
+		Projections: []string{},
+		Filters:     []*AttributeViewFilter{},
+		Sorts:       []*AttributeViewSort{},
+	}
+}
+
+// GetView 返回视图 viewID，viewID 为空时返回默认视图，找不到时返回 nil。
+//
+// 修改返回的视图后需要调用 SetView 写回属性视图。
+func (av *AttributeView) GetView(viewID string) *View {
+	if "" == viewID {
+		viewType := av.Type
+		if "" == viewType {
+			viewType = AttributeViewTypeTable
+		}
+		return &View{Type: viewType, Projections: av.Projections, Filters: av.Filters, Sorts: av.Sorts}
+	}
+
+	for _, view := range av.Views {
+		if view.ID == viewID {
+			return view
+		}
+	}
+	return nil
+}
+
+// SetView 校验视图 view 的布局设置并写回属性视图，view 的 ID 为空时写回默认视图，默认视图总是表格布局。
+func (av *AttributeView) SetView(view *View) (err error) {
+	if err = av.checkView(view); nil != err {
+		return
+	}
+
+	if "" == view.ID {
+		if AttributeViewTypeTable != view.Type {
+			err = errors.New("default view must be a table")
+			return
+		}
+		av.Projections, av.Filters, av.Sorts = view.Projections, view.Filters, view.Sorts
+		return
+	}
+
+	for i, v := range av.Views {
+		if v.ID == view.ID {
+			av.Views[i] = view
+			return
+		}
+	}
+	av.Views = append(av.Views, view)
+	return
+}
+
+// RemoveView 移除视图 viewID，默认视图不能移除。
+func (av *AttributeView) RemoveView(viewID string) (err error) {
+	for i, view := range av.Views {
+		if view.ID == viewID {
+			av.Views = append(av.Views[:i], av.Views[i+1:]...)
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("view [%s] not found", viewID))
+	return
+}
+
+func (av *AttributeView) getViewOrErr(viewID string) (ret *View, err error) {
+	if ret = av.GetView(viewID); nil == ret {
+		err = errors.New(fmt.Sprintf("view [%s] not found", viewID))
+	}
+	return
+}
+
+// checkView 校验视图 view 的显示列、过滤规则、排序规则和布局相关的列设置。
+func (av *AttributeView) checkView(view *View) (err error) {
+	if nil == view.Projections {
+		view.Projections = []string{}
+	}
+	if nil == view.Filters {
+		view.Filters = []*AttributeViewFilter{}
+	}
+	if nil == view.Sorts {
+		view.Sorts = []*AttributeViewSort{}
+	}
+
+	if _, err = av.projectionIndexes(view); nil != err {
+		return
+	}
+	for _, filter := range view.Filters {
+		index := av.columnIndex(filter.Column)
+		if 0 > index {
+			return errors.New(fmt.Sprintf("filter column [%s] not found", filter.Column))
+		}
+		if _, err = newRowFilter(av.Columns[index], index, filter); nil != err {
+			return
+		}
+	}
+	for _, s := range view.Sorts {
+		if 0 > av.columnIndex(s.Column) {
+			return errors.New(fmt.Sprintf("sort column [%s] not found", s.Column))
+		}
+		if SortOrderAsc != s.Order && SortOrderDesc != s.Order {
+			return errors.New(fmt.Sprintf("invalid sort order [%s]", s.Order))
+		}
+	}
+
+	switch view.Type {
+	case AttributeViewTypeTable:
+	case AttributeViewTypeBoard:
+		err = av.checkViewColumn(view.GroupColumn, "group", ColumnTypeSelect, ColumnTypeMSelect)
+	case AttributeViewTypeGallery:
+		if "" != view.CoverColumn {
+			err = av.checkViewColumn(view.CoverColumn, "cover", ColumnTypeText)
+		}
+	case AttributeViewTypeCalendar:
+		err = av.checkViewColumn(view.DateColumn, "date", ColumnTypeDate)
+	default:
+		err = errors.New(fmt.Sprintf("invalid view type [%s]", view.Type))
+	}
+	return
+}
+
+func (av *AttributeView) checkViewColumn(column, usage string, types ...ColumnType) (err error) {
+	index := av.columnIndex(column)
+	if 0 > index {
+		return errors.New(fmt.Sprintf("%s column [%s] not found", usage, column))
+	}
+
+	for _, typ := range types {
+		if typ == av.Columns[index].ValueType() {
+			return
+		}
+	}
+	return errors.New(fmt.Sprintf("invalid %s column type [%s]", usage, av.Columns[index].Type))
+}
+
+// Board 描述了看板布局的数据。
+type Board struct {
+	ID      string        `json:"id"`      // 属性视图 ID
+	ViewID  string        `json:"viewId"`  // 视图 ID
+	Columns []*Column     `json:"columns"` // 卡片上显示的列
+	Groups  []*BoardGroup `json:"groups"`  // 分组，按照分组列的选项顺序排列，最后为未分组
+}
+
+// BoardGroup 描述了看板中的一个分组，多选列的行会出现在每个选中选项的分组中。
+type BoardGroup struct {
+	Name  string      `json:"name"`  // 选项名称，为空表示未分组
+	Color string      `json:"color"` // 选项颜色
+	Rows  []*TableRow `json:"rows"`
+}
+
+// Gallery 描述了画廊布局的数据。
+type Gallery struct {
+	ID      string         `json:"id"`      // 属性视图 ID
+	ViewID  string         `json:"viewId"`  // 视图 ID
+	Columns []*Column      `json:"columns"` // 卡片上显示的列
+	Cards   []*GalleryCard `json:"cards"`
+}
+
+// GalleryCard 描述了画廊中的一张卡片。
+type GalleryCard struct {
+	*TableRow
+	BlockID string `json:"blockId"` // 行对应的块 ID
+	Cover   string `json:"cover"`   // 封面资源文件路径
+}
+
+// Calendar 描述了日历布局的数据。
+type Calendar struct {
+	ID      string           `json:"id"`      // 属性视图 ID
+	ViewID  string           `json:"viewId"`  // 视图 ID
+	Columns []*Column        `json:"columns"` // 事件上显示的列
+	Events  []*CalendarEvent `json:"events"`  // 按照开始时间排列的事件
+}
+
+// CalendarEvent 描述了日历中的一个事件。
+type CalendarEvent struct {
+	*TableRow
+	Start int64 `json:"start"` // 开始时间，毫秒时间戳
+	End   int64 `json:"end"`   // 结束时间，毫秒时间戳，没有结束时间时等于开始时间
+}
+
+// QueryBoard 按照看板视图 viewID 的分组列对满足过滤规则的行进行分组。
+func (av *AttributeView) QueryBoard(viewID string, content func(column *Column, value string) string) (ret *Board, err error) {
+	view, rows, projections, err := av.queryLayout(viewID, AttributeViewTypeBoard, content)
+	if nil != err {
+		return
+	}
+
+	index := av.columnIndex(view.GroupColumn)
+	column := av.Columns[index]
+	ret = &Board{ID: av.ID, ViewID: view.ID, Columns: av.projectionColumns(projections)}
+	groups := map[string]*BoardGroup{}
+	for _, option := range column.Options {
+		group := &BoardGroup{Name: option.Name, Color: option.Color, Rows: []*TableRow{}}
+		groups[option.Name] = group
+		ret.Groups = append(ret.Groups, group)
+	}
+	ungrouped := &BoardGroup{Rows: []*TableRow{}}
+	ret.Groups = append(ret.Groups, ungrouped)
+
+	for _, row := range rows {
+		var options []string
+		if index < len(row.Cells) && nil != row.Cells[index] {
+			options = splitOptions(row.Cells[index].Value)
+		}
+
+		tableRow := av.tableRow(row, projections, content)
+		grouped := false
+		for _, option := range options {
+			if group := groups[option]; nil != group {
+				group.Rows = append(group.Rows, tableRow)
+				grouped = true
+			}
+		}
+		if !grouped {
+			ungrouped.Rows = append(ungrouped.Rows, tableRow)
+		}
+	}
+	return
+}
+
+// QueryGallery 返回画廊视图 viewID 中满足过滤规则的卡片，封面列为空时封面为空，由调用方使用块中的图片补全。
+func (av *AttributeView) QueryGallery(viewID string, content func(column *Column, value string) string) (ret *Gallery, err error) {
+	view, rows, projections, err := av.queryLayout(viewID, AttributeViewTypeGallery, content)
+	if nil != err {
+		return
+	}
+
+	coverIndex := -1
+	if "" != view.CoverColumn {
+		coverIndex = av.columnIndex(view.CoverColumn)
+	}
+	ret = &Gallery{ID: av.ID, ViewID: view.ID, Columns: av.projectionColumns(projections), Cards: []*GalleryCard{}}
+	for _, row := range rows {
+		card := &GalleryCard{TableRow: av.tableRow(row, projections, content)}
+		if 0 < len(row.Cells) && nil != row.Cells[0] {
+			card.BlockID = row.Cells[0].Value
+		}
+		if 0 <= coverIndex && coverIndex < len(row.Cells) && nil != row.Cells[coverIndex] {
+			card.Cover = row.Cells[coverIndex].Value
+		}
+		ret.Cards = append(ret.Cards, card)
+	}
+	return
+}
+
+// QueryCalendar 返回日历视图 viewID 中满足过滤规则并且日期与时间范围 [start, end]（毫秒时间戳）有交集的事件，start 或者 end 为 0 时不限制。
+func (av *AttributeView) QueryCalendar(viewID string, start, end int64, content func(column *Column, value string) string) (ret *Calendar, err error) {
+	view, rows, projections, err := av.queryLayout(viewID, AttributeViewTypeCalendar, content)
+	if nil != err {
+		return
+	}
+
+	index := av.columnIndex(view.DateColumn)
+	ret = &Calendar{ID: av.ID, ViewID: view.ID, Columns: av.projectionColumns(projections), Events: []*CalendarEvent{}}
+	for _, row := range rows {
+		if index >= len(row.Cells) || nil == row.Cells[index] {
+			continue
+		}
+
+		cell := row.Cells[index]
+		eventStart, ok := parseDate(cell.Value)
+		if !ok {
+			continue
+		}
+		event := &CalendarEvent{Start: eventStart.UnixMilli(), End: eventStart.UnixMilli()}
+		if nil != cell.Date && event.Start < cell.Date.End {
+			event.End = cell.Date.End
+		}
+		if (0 < start && event.End < start) || (0 < end && event.Start > end) {
+			continue
+		}
+
+		event.TableRow = av.tableRow(row, projections, content)
+		ret.Events = append(ret.Events, event)
+	}
+
+	// 日历中的事件总是按照开始时间排列，开始时间相同时保持视图的排序
+	sortCalendarEvents(ret.Events)
+	return
+}
+
+// ParseCalendarTime 解析日历时间范围参数，支持日期和毫秒时间戳，空值返回 0。
+func ParseCalendarTime(value string) (ret int64, err error) {
+	if "" == value {
+		return
+	}
+	if ms, parseErr := strconv.ParseInt(value, 10, 64); nil == parseErr {
+		return ms, nil
+	}
+
+	t, ok := parseDateInLocation(value, time.Local)
+	if !ok {
+		err = errors.New(fmt.Sprintf("invalid time [%s]", value))
+		return
+	}
+	ret = t.UnixMilli()
+	return
+}
+
+func sortCalendarEvents(events []*CalendarEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start < events[j].Start
+	})
+}
+
+func (av *AttributeView) queryLayout(viewID string, viewType AttributeViewType, content func(column *Column, value string) string) (view *View, rows []*Row, projections []int, err error) {
+	if view, err = av.getViewOrErr(viewID); nil != err {
+		return
+	}
+	if viewType != view.Type {
+		err = errors.New(fmt.Sprintf("view [%s] is not a %s view", viewID, viewType))
+		return
+	}
+	if err = av.checkView(view); nil != err {
+		return
+	}
+
+	rows, projections, err = av.queryRows(view, content)
+	return
+}
+
+func (av *AttributeView) projectionColumns(projections []int) (ret []*Column) {
+	for _, index := range projections {
+		ret = append(ret, av.Columns[index])
+	}
+	return
+}
@@ -0,0 +1,162 @@
+// SiYuan - Build Your Eternal Digital Garden
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"strings"
+	"testing"
+)
+
+func boardGroups(board *Board) string {
+	var ret []string
+	for _, group := range board.Groups {
+		var ids []string
+		for _, row := range group.Rows {
+			ids = append(ids, row.ID)
+		}
+		ret = append(ret, group.Name+":"+strings.Join(ids, ","))
+	}
+	return strings.Join(ret, "|")
+}
+
+func TestQueryBoard(t *testing.T) {
+	cases := []struct {
+		groupColumn string
+		filters     []*AttributeViewFilter
+		sorts       []*AttributeViewSort
+		expected    string
+	}{
+		{"Status", nil, nil, "Todo:r1,r4|Done:r2|:r3"},
+		{"Status", nil, []*AttributeViewSort{{Column: "Name", Order: SortOrderDesc}}, "Todo:r4,r1|Done:r2|:r3"},
+		// 多选列的行出现在每个选中选项的分组中
+		{"Tags", nil, nil, "x:r1|y:r1,r2|z:|:r3,r4"},
+		{"Tags", []*AttributeViewFilter{{Column: "Status", Operator: FilterOperatorEq, Value: "Todo"}}, nil, "x:r1|y:r1|z:|:r4"},
+	}
+
+	for _, c := range cases {
+		attrView := newTestAttributeView(t)
+		view := NewView("Board", AttributeViewTypeBoard)
+		view.GroupColumn, view.Filters, view.Sorts = c.groupColumn, c.filters, c.sorts
+		if err := attrView.SetView(view); nil != err {
+			t.Fatal(err)
+		}
+		board, err := attrView.QueryBoard(view.ID, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if got := boardGroups(board); c.expected != got {
+			t.Fatalf("board grouped by [%s] expected [%s], got [%s]", c.groupColumn, c.expected, got)
+		}
+	}
+}
+
+func TestInvalidLayoutView(t *testing.T) {
+	cases := []*View{
+		{Name: "Board", Type: AttributeViewTypeBoard, GroupColumn: "Name"},
+		{Name: "Board", Type: AttributeViewTypeBoard},
+		{Name: "Calendar", Type: AttributeViewTypeCalendar, DateColumn: "Score"},
+		{Name: "Gallery", Type: AttributeViewTypeGallery, CoverColumn: "Due"},
+		{Name: "Unknown", Type: "timeline"},
+		{Type: AttributeViewTypeBoard, GroupColumn: "Status"},
+	}
+	for _, view := range cases {
+		if "" != view.Name {
+			view.ID = view.Name
+		}
+		attrView := newTestAttributeView(t)
+		if err := attrView.SetView(view); nil == err {
+			t.Fatalf("invalid view [%s, %s] should be rejected", view.Name, view.Type)
+		}
+	}
+
+	attrView := newTestAttributeView(t)
+	view := NewView("Gallery", AttributeViewTypeGallery)
+	if err := attrView.SetView(view); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := attrView.QueryBoard(view.ID, nil); nil == err {
+		t.Fatalf("query gallery view as board should fail")
+	}
+}
+
+func TestQueryGallery(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	attrView.Rows[1].Cells[1].Value = "assets/banana.png"
+	view := NewView("Gallery", AttributeViewTypeGallery)
+	view.CoverColumn = "Name"
+	view.Projections = []string{"Status"}
+	if err := attrView.SetView(view); nil != err {
+		t.Fatal(err)
+	}
+	gallery, err := attrView.QueryGallery(view.ID, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != len(gallery.Cards) || "b" != gallery.Cards[1].BlockID || "assets/banana.png" != gallery.Cards[1].Cover || 1 != len(gallery.Cards[1].Cells) {
+		t.Fatalf("gallery cards not match")
+	}
+}
+
+func TestQueryCalendar(t *testing.T) {
+	attrView := newTestAttributeView(t)
+	if err := attrView.Columns[3].SetCellValue(attrView.Rows[0].Cells[3], "2023-01-01"+DateRangeSeparator+"2023-02-15"); nil != err {
+		t.Fatal(err)
+	}
+	view := NewView("Calendar", AttributeViewTypeCalendar)
+	view.DateColumn = "Due"
+	view.Sorts = []*AttributeViewSort{{Column: "Name", Order: SortOrderDesc}}
+	if err := attrView.SetView(view); nil != err {
+		t.Fatal(err)
+	}
+
+	time := func(value string) int64 {
+		ret, err := ParseCalendarTime(value)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	cases := []struct {
+		start, end string
+		expected   string
+	}{
+		// 没有日期和日期无法解析的行不显示，事件总是按照开始时间排列
+		{"", "", "r1,r2"},
+		{"2023-02-01", "", "r1,r2"},
+		{"2023-02-16", "", "r2"},
+		{"", "2023-02-28", "r1"},
+		{"2023-03-01", "2023-03-01", "r2"},
+		{"2024-01-01", "", ""},
+	}
+	for _, c := range cases {
+		calendar, err := attrView.QueryCalendar(view.ID, time(c.start), time(c.end), nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, event := range calendar.Events {
+			ids = append(ids, event.ID)
+		}
+		if got := strings.Join(ids, ","); c.expected != got {
+			t.Fatalf("calendar [%s, %s] expected [%s], got [%s]", c.start, c.end, c.expected, got)
+		}
+	}
+
+	if _, err := ParseCalendarTime("tomorrow"); nil == err {
+		t.Fatalf("invalid calendar time should fail")
+	}
+}
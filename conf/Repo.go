@@ -23,11 +23,23 @@ import (
 )
 
 type Repo struct {
-	Key []byte `json:"key"` // AES 密钥
+	Key         []byte         `json:"key"`         // AES 密钥
+	RotatingKey []byte         `json:"rotatingKey"` // 正在轮换中的新 AES 密钥，轮换完成后替换 Key
+	Retention   *RepoRetention `json:"retention"`   // 快照保留策略
+}
+
+// RepoRetention 描述了本地数据仓库快照保留策略，各项为 0 时表示不使用该项规则，全部为 0 时不自动清理快照。
+type RepoRetention struct {
+	KeepLast    int `json:"keepLast"`    // 保留最近的 N 个快照
+	KeepHourly  int `json:"keepHourly"`  // 保留最近 N 个小时中每小时最新的一个快照
+	KeepDaily   int `json:"keepDaily"`   // 保留最近 N 天中每天最新的一个快照
+	KeepWeekly  int `json:"keepWeekly"`  // 保留最近 N 周中每周最新的一个快照
+	KeepMonthly int `json:"keepMonthly"` // 保留最近 N 个月中每月最新的一个快照
+	KeepYearly  int `json:"keepYearly"`  // 保留最近 N 年中每年最新的一个快照
 }
 
 func NewRepo() *Repo {
-	return &Repo{}
+	return &Repo{Retention: &RepoRetention{}}
 }
 
 func (*Repo) GetSaveDir() string {
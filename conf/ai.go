@@ -22,7 +22,8 @@ import (
 )
 
 type AI struct {
-	OpenAI *OpenAI `json:"openAI"`
+	OpenAI    *OpenAI    `json:"openAI"`
+	Embedding *Embedding `json:"embedding"`
 }
 
 type OpenAI struct {
@@ -33,6 +34,22 @@ type OpenAI struct {
 	APIBaseURL   string `json:"apiBaseURL"`
 }
 
+// Embedding 描述了语义搜索使用的向量嵌入接口配置，接口需要兼容 OpenAI 的 /embeddings 接口。
+type Embedding struct {
+	Enabled    bool   `json:"enabled"`    // 是否启用语义搜索
+	APIKey     string `json:"apiKey"`     // 为空时使用 OpenAI 的 APIKey
+	APIBaseURL string `json:"apiBaseURL"` // 为空时使用 OpenAI 的 APIBaseURL
+	APIModel   string `json:"apiModel"`   // 嵌入模型
+	APITimeout int    `json:"apiTimeout"` // 请求超时时间，单位：秒
+}
+
+func NewEmbedding() *Embedding {
+	return &Embedding{
+		APIModel:   "text-embedding-ada-002",
+		APITimeout: 30,
+	}
+}
+
 func NewAI() *AI {
 	openAI := &OpenAI{
 		APITimeout: 30,
@@ -63,5 +80,5 @@ func NewAI() *AI {
 		openAI.APIBaseURL = baseURL
 	}
 
-	return &AI{OpenAI: openAI}
+	return &AI{OpenAI: openAI, Embedding: NewEmbedding()}
 }
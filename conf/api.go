@@ -19,11 +19,13 @@ package conf
 import "github.com/88250/gulu"
 
 type API struct {
-	Token string `json:"token"`
+	Token      string `json:"token"`
+	SQLTimeout int    `json:"sqlTimeout"` // SQL 查询语句超时时间，单位：秒
 }
 
 func NewAPI() *API {
 	return &API{
-		Token: gulu.Rand.String(16),
+		Token:      gulu.Rand.String(16),
+		SQLTimeout: 30,
 	}
 }
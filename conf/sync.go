@@ -23,9 +23,14 @@ type Sync struct {
 	Synced              int64   `json:"synced"`              // 最近同步时间
 	Stat                string  `json:"stat"`                // 最近同步统计信息
 	GenerateConflictDoc bool    `json:"generateConflictDoc"` // 云端同步冲突时是否生成冲突文档
+	Pack                bool    `json:"pack"`                // 是否将小对象合并为包文件上传，仅第三方存储服务可用
+	UploadLimit         int64   `json:"uploadLimit"`         // 上传带宽限制，单位：KB/s，0 表示不限制
+	DownloadLimit       int64   `json:"downloadLimit"`       // 下载带宽限制，单位：KB/s，0 表示不限制
+	Concurrency         int     `json:"concurrency"`         // 上传下载并发数，0 表示使用默认值 8
 	Provider            int     `json:"provider"`            // 云端存储服务提供者
 	S3                  *S3     `json:"s3"`                  // S3 对象存储服务配置
 	WebDAV              *WebDAV `json:"webdav"`              // WebDAV 服务配置
+	Local               *Local  `json:"local"`               // 本地文件系统目录配置
 }
 
 func NewSync() *Sync {
@@ -57,10 +62,15 @@ type WebDAV struct {
 	Timeout       int    `json:"timeout"`       // 超时时间，单位：秒
 }
 
+type Local struct {
+	Endpoint string `json:"endpoint"` // 存储目录的绝对路径，比如 NAS 挂载目录、U 盘目录
+}
+
 const (
 	ProviderSiYuan = 0 // ProviderSiYuan 为思源官方提供的云端存储服务
 	ProviderS3     = 2 // ProviderS3 为 S3 协议对象存储提供的云端存储服务
 	ProviderWebDAV = 3 // ProviderWebDAV 为 WebDAV 协议提供的云端存储服务
+	ProviderLocal  = 4 // ProviderLocal 为本地文件系统目录（比如 NAS 挂载目录、U 盘）提供的存储服务
 )
 
 func ProviderToStr(provider int) string {
@@ -71,6 +81,8 @@ func ProviderToStr(provider int) string {
 		return "S3"
 	case ProviderWebDAV:
 		return "WebDAV"
+	case ProviderLocal:
+		return "Local"
 	}
 	return "Unknown"
 }
@@ -0,0 +1,303 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/dejavu/util"
+	"github.com/wangxu0213/esnote-kernel/eventbus"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// CheckResult 描述了仓库校验结果。
+type CheckResult struct {
+	Indexes int `json:"indexes"` // 校验的索引数
+	Files   int `json:"files"`   // 校验的文件数
+	Chunks  int `json:"chunks"`  // 校验的分块数
+
+	MissingObjects      []string            `json:"missingObjects"`      // 本地缺失的对象
+	CorruptObjects      []string            `json:"corruptObjects"`      // 本地损坏（无法解密解压或者哈希不匹配）的对象
+	CloudMissingObjects []string            `json:"cloudMissingObjects"` // 云端缺失的对象，仅在完整校验时计算
+	BrokenIndexes       map[string][]string `json:"brokenIndexes"`       // 损坏的快照，索引 ID -> 缺失或者损坏的对象 ID
+}
+
+// IsOK 判断校验结果是否没有任何问题。
+func (result *CheckResult) IsOK() bool {
+	return 1 > len(result.MissingObjects) && 1 > len(result.CorruptObjects) && 1 > len(result.CloudMissingObjects)
+}
+
+const (
+	checkObjectOK = iota
+	checkObjectMissing
+	checkObjectCorrupt
+)
+
+// Check 校验本地仓库中所有索引、文件和分块，对象在解密解压后重新计算 SHA-1 并和对象 ID 比对。
+//
+// full 为 true 时还会校验云端是否缺失最近一次同步快照引用的对象。context 参数用于发布事件时传递调用上下文。
+func (repo *Repo) Check(full bool, context map[string]interface{}) (ret *CheckResult, err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	ret = &CheckResult{MissingObjects: []string{}, CorruptObjects: []string{}, CloudMissingObjects: []string{}, BrokenIndexes: map[string][]string{}}
+	indexIDs, err := repo.store.getIndexIDs()
+	if nil != err {
+		return
+	}
+
+	eventbus.Publish(eventbus.EvtCheckBeforeCheckIndexes, context, len(indexIDs))
+	checked := map[string]int{}
+	for _, indexID := range indexIDs {
+		eventbus.Publish(eventbus.EvtCheckIndex, context, indexID)
+		ret.Indexes++
+
+		index, getErr := repo.store.checkIndex(indexID)
+		if nil != getErr {
+			logging.LogWarnf("check index [%s] failed: %s", indexID, getErr)
+			ret.CorruptObjects = append(ret.CorruptObjects, indexID)
+			ret.BrokenIndexes[indexID] = []string{indexID}
+			continue
+		}
+
+		var brokens []string
+		for _, fileID := range index.Files {
+			status, ok := checked[fileID]
+			if !ok {
+				eventbus.Publish(eventbus.EvtCheckObject, context, fileID)
+				ret.Files++
+
+				var file *entity.File
+				file, status = repo.store.checkFile(fileID)
+				checked[fileID] = status
+				ret.collect(fileID, status)
+				if nil != file {
+					for _, chunkID := range file.Chunks {
+						if chunkStatus, chunkChecked := checked[chunkID]; chunkChecked {
+							if checkObjectOK != chunkStatus {
+								checked[fileID] = chunkStatus
+							}
+							continue
+						}
+
+						eventbus.Publish(eventbus.EvtCheckObject, context, chunkID)
+						ret.Chunks++
+						chunkStatus := repo.store.checkChunk(chunkID)
+						checked[chunkID] = chunkStatus
+						ret.collect(chunkID, chunkStatus)
+						if checkObjectOK != chunkStatus {
+							checked[fileID] = chunkStatus
+						}
+					}
+				}
+				status = checked[fileID]
+			}
+
+			if checkObjectOK != status {
+				brokens = append(brokens, fileID)
+			}
+		}
+		if 0 < len(brokens) {
+			ret.BrokenIndexes[indexID] = brokens
+		}
+	}
+
+	if full && nil != repo.cloud {
+		if ret.CloudMissingObjects, err = repo.checkCloud(context); nil != err {
+			return
+		}
+	}
+
+	sort.Strings(ret.MissingObjects)
+	sort.Strings(ret.CorruptObjects)
+	logging.LogInfof("checked repo [indexes=%d, files=%d, chunks=%d, missing=%d, corrupt=%d, cloudMissing=%d]",
+		ret.Indexes, ret.Files, ret.Chunks, len(ret.MissingObjects), len(ret.CorruptObjects), len(ret.CloudMissingObjects))
+	return
+}
+
+func (result *CheckResult) collect(id string, status int) {
+	switch status {
+	case checkObjectMissing:
+		result.MissingObjects = append(result.MissingObjects, id)
+	case checkObjectCorrupt:
+		result.CorruptObjects = append(result.CorruptObjects, id)
+	}
+}
+
+// checkCloud 校验云端是否缺失最近一次同步快照引用的文件和分块。
+func (repo *Repo) checkCloud(context map[string]interface{}) (ret []string, err error) {
+	ret = []string{}
+	latestSync := repo.latestSync()
+	if "" == latestSync.ID {
+		return
+	}
+
+	files, err := repo.getFiles(latestSync.Files)
+	if nil != err {
+		return
+	}
+
+	var objectIDs []string
+	for _, file := range files {
+		objectIDs = append(objectIDs, file.ID)
+	}
+	objectIDs = append(objectIDs, repo.getChunks(files)...)
+	eventbus.Publish(eventbus.EvtCheckBeforeCheckCloud, context, len(objectIDs))
+
+	// 已经合并到包文件中的对象不需要再检查
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err {
+		return
+	}
+
+	// 文件和分块都存放在 objects 下，所以可以一起通过 GetChunks 检查
+	const batch = 512
+	for i := 0; i < len(objectIDs); i += batch {
+		end := i + batch
+		if end > len(objectIDs) {
+			end = len(objectIDs)
+		}
+
+		missing, getErr := repo.cloud.GetChunks(objectIDs[i:end])
+		if nil != getErr {
+			err = getErr
+			logging.LogErrorf("check cloud objects failed: %s", err)
+			return
+		}
+		for _, m := range missing {
+			id := objectIDFromKey(m)
+			if _, packed := packs.objects[id]; !packed {
+				ret = append(ret, id)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return
+}
+
+// objectIDFromKey 从对象存储键（如 repo/objects/xx/yyy）中解析对象 ID，不是键时原样返回。
+func objectIDFromKey(key string) string {
+	if 40 == len(key) {
+		return key
+	}
+
+	parts := strings.Split(strings.ReplaceAll(key, "\\", "/"), "/")
+	if 2 > len(parts) {
+		return key
+	}
+	return parts[len(parts)-2] + parts[len(parts)-1]
+}
+
+func (store *Store) getIndexIDs() (ret []string, err error) {
+	indexesDir := filepath.Join(store.Path, "indexes")
+	if !gulu.File.IsDir(indexesDir) {
+		return
+	}
+
+	entries, err := os.ReadDir(indexesDir)
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		if 40 != len(entry.Name()) || entry.IsDir() {
+			continue
+		}
+		ret = append(ret, entry.Name())
+	}
+	return
+}
+
+// checkIndex 不经过缓存直接读取并解析索引。
+func (store *Store) checkIndex(id string) (ret *entity.Index, err error) {
+	_, file := store.IndexAbsPath(id)
+	data, err := filelock.ReadFile(file)
+	if nil != err {
+		return
+	}
+	if data, err = store.compressDecoder.DecodeAll(data, nil); nil != err {
+		return
+	}
+	ret = &entity.Index{}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
+func (store *Store) checkFile(id string) (ret *entity.File, status int) {
+	data, status := store.checkObject(id)
+	if checkObjectOK != status {
+		return
+	}
+
+	ret = &entity.File{}
+	if err := gulu.JSON.UnmarshalJSON(data, ret); nil != err {
+		logging.LogWarnf("unmarshal file [%s] failed: %s", id, err)
+		return nil, checkObjectCorrupt
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(ret.Path)
+	buf.WriteString(strconv.FormatInt(ret.Updated, 10))
+	if id != ret.ID || id != util.Hash(buf.Bytes()) {
+		logging.LogWarnf("file [%s] hash mismatch", id)
+		return nil, checkObjectCorrupt
+	}
+	return
+}
+
+func (store *Store) checkChunk(id string) (status int) {
+	data, status := store.checkObject(id)
+	if checkObjectOK != status {
+		return
+	}
+
+	if id != util.Hash(data) {
+		logging.LogWarnf("chunk [%s] hash mismatch", id)
+		return checkObjectCorrupt
+	}
+	return
+}
+
+func (store *Store) checkObject(id string) (data []byte, status int) {
+	if err := store.resolve(id); nil != err {
+		logging.LogWarnf("resolve object [%s] failed: %s", id, err)
+		return nil, checkObjectCorrupt
+	}
+	_, file := store.AbsPath(id)
+	data, err := filelock.ReadFile(file)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, checkObjectMissing
+		}
+		logging.LogWarnf("read object [%s] failed: %s", id, err)
+		return nil, checkObjectCorrupt
+	}
+
+	if data, err = store.decodeData(data); nil != err {
+		logging.LogWarnf("decode object [%s] failed: %s", id, err)
+		return nil, checkObjectCorrupt
+	}
+	return
+}
@@ -0,0 +1,79 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	clearTestdata(t)
+
+	repo, index := initIndex(t)
+	result, err := repo.Check(false, map[string]interface{}{})
+	if nil != err {
+		t.Fatalf("check failed: %s", err)
+		return
+	}
+	if !result.IsOK() || 1 != result.Indexes || 1 > result.Files || 1 > result.Chunks {
+		t.Fatalf("check result not match: %+v", result)
+		return
+	}
+
+	files, err := repo.GetFiles(index)
+	if nil != err || 1 > len(files) {
+		t.Fatalf("get files failed: %v", err)
+		return
+	}
+
+	// 篡改一个分块
+	chunkID := files[0].Chunks[0]
+	_, chunkPath := repo.store.AbsPath(chunkID)
+	if err = os.WriteFile(chunkPath, []byte("corrupt"), 0644); nil != err {
+		t.Fatalf("write chunk failed: %s", err)
+		return
+	}
+	result, err = repo.Check(false, map[string]interface{}{})
+	if nil != err {
+		t.Fatalf("check failed: %s", err)
+		return
+	}
+	if 1 != len(result.CorruptObjects) || chunkID != result.CorruptObjects[0] {
+		t.Fatalf("corrupt objects [%v] not match", result.CorruptObjects)
+		return
+	}
+	if 1 != len(result.BrokenIndexes[index.ID]) || files[0].ID != result.BrokenIndexes[index.ID][0] {
+		t.Fatalf("broken indexes [%v] not match", result.BrokenIndexes)
+		return
+	}
+
+	// 删除该分块
+	if err = repo.store.Remove(chunkID); nil != err {
+		t.Fatalf("remove chunk failed: %s", err)
+		return
+	}
+	result, err = repo.Check(false, map[string]interface{}{})
+	if nil != err {
+		t.Fatalf("check failed: %s", err)
+		return
+	}
+	if 1 != len(result.MissingObjects) || chunkID != result.MissingObjects[0] || 0 != len(result.CorruptObjects) {
+		t.Fatalf("missing objects [%v] not match", result.MissingObjects)
+		return
+	}
+}
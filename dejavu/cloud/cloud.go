@@ -40,10 +40,17 @@ type Conf struct {
 	// WebDAV 协议所需配置
 	WebDAV *ConfWebDAV
 
+	// 本地文件系统目录所需配置
+	Local *ConfLocal
+
 	// 以下值非官方存储服务不必传入
 	Token         string // 云端接口鉴权令牌
 	AvailableSize int64  // 云端存储可用空间字节数
 	Server        string // 云端接口端点
+
+	// 传输带宽限制，nil 表示不限制，同一个仓库的所有并发传输共享
+	UploadLimiter   *RateLimiter // 上传带宽限制
+	DownloadLimiter *RateLimiter // 下载带宽限制
 }
 
 // ConfS3 用于描述 S3 对象存储协议所需配置。
@@ -67,6 +74,11 @@ type ConfWebDAV struct {
 	Timeout       int    // 超时时间，单位：秒
 }
 
+// ConfLocal 用于描述本地文件系统目录所需配置。
+type ConfLocal struct {
+	Endpoint string // 存储目录的绝对路径，比如 NAS 挂载目录、U 盘目录
+}
+
 // Cloud 描述了云端存储服务，接入云端存储服务时需要实现该接口。
 type Cloud interface {
 
@@ -253,6 +265,7 @@ var (
 	ErrCloudAuthFailed         = errors.New("cloud account auth failed") // ErrCloudAuthFailed 描述了云端存储服务鉴权失败的错误
 	ErrCloudServiceUnavailable = errors.New("cloud service unavailable") // ErrCloudServiceUnavailable 描述了云端存储服务不可用的错误
 	ErrSystemTimeIncorrect     = errors.New("system time incorrect")     // ErrSystemTimeIncorrect 描述了系统时间不正确的错误
+	ErrInvalidRepoName         = errors.New("invalid repo name")         // ErrInvalidRepoName 描述了云端仓库名称不合法的错误
 )
 
 func IsValidCloudDirName(cloudDirName string) bool {
@@ -0,0 +1,135 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cloud
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limitChunkSize 为每次读取预约的最大字节数，避免单次预约过大导致传输突发。
+const limitChunkSize = 32 * 1024
+
+// RateLimiter 用于限制传输字节流的平均速率，多个并发传输共享同一个限制器时限制的是总速率。
+type RateLimiter struct {
+	limit int64     // 字节/秒
+	next  time.Time // 下一次传输可以开始的时间
+	lock  sync.Mutex
+}
+
+// NewRateLimiter 创建速率为 limit 字节/秒的限制器，limit 小于 1 时返回 nil 表示不限制。
+func NewRateLimiter(limit int64) *RateLimiter {
+	if 1 > limit {
+		return nil
+	}
+	return &RateLimiter{limit: limit}
+}
+
+// Reader 返回按照限制速率读取 reader 的 io.Reader，limiter 为 nil 时直接返回 reader。
+func (limiter *RateLimiter) Reader(reader io.Reader) io.Reader {
+	if nil == limiter {
+		return reader
+	}
+	return &limitedReader{reader: reader, limiter: limiter}
+}
+
+// limitRequest 使请求 req 的请求体按照限制速率发送，limiter 为 nil 或者请求没有请求体时不做处理。
+//
+// 请求体在发送时才被读取，所以限制的是实际的网络传输速率，请求体长度等其他属性保持不变。
+func (limiter *RateLimiter) limitRequest(req *http.Request) {
+	if nil == limiter || nil == req.Body || http.NoBody == req.Body {
+		return
+	}
+
+	req.Body = &limitedReadCloser{Reader: limiter.Reader(req.Body), Closer: req.Body}
+	if getBody := req.GetBody; nil != getBody {
+		// 重定向时会重新获取请求体
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if nil != err {
+				return nil, err
+			}
+			return &limitedReadCloser{Reader: limiter.Reader(body), Closer: body}, nil
+		}
+	}
+}
+
+// wait 为 n 个字节的传输预约时间片，并阻塞直到轮到该传输。
+func (limiter *RateLimiter) wait(n int) {
+	limiter.lock.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.duration(n))
+	limiter.lock.Unlock()
+
+	if 0 < delay {
+		time.Sleep(delay)
+	}
+}
+
+// refund 归还预约了但是没有实际传输的 n 个字节。
+func (limiter *RateLimiter) refund(n int) {
+	if 1 > n {
+		return
+	}
+
+	limiter.lock.Lock()
+	limiter.next = limiter.next.Add(-limiter.duration(n))
+	limiter.lock.Unlock()
+}
+
+func (limiter *RateLimiter) duration(n int) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(limiter.limit)
+}
+
+func (limiter *RateLimiter) chunkSize() int {
+	if limitChunkSize > limiter.limit {
+		return int(limiter.limit)
+	}
+	return limitChunkSize
+}
+
+// limitedReader 在每次读取前预约时间片，读取不足的部分再归还，所以等待发生在传输之前。
+type limitedReader struct {
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (n int, err error) {
+	if size := r.limiter.chunkSize(); size < len(p) {
+		p = p[:size]
+	}
+	if 1 > len(p) {
+		return r.reader.Read(p)
+	}
+
+	r.limiter.wait(len(p))
+	n, err = r.reader.Read(p)
+	r.limiter.refund(len(p) - n)
+	return
+}
+
+// limitedReadCloser 按照限制速率读取请求体，关闭时关闭原来的请求体。
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
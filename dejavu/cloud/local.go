@@ -0,0 +1,416 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cloud
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// Local 描述了本地文件系统目录云端存储服务实现，可用于 NAS 挂载目录、U 盘等。
+type Local struct {
+	*BaseCloud
+}
+
+func NewLocal(baseCloud *BaseCloud) *Local {
+	return &Local{BaseCloud: baseCloud}
+}
+
+func (local *Local) CreateRepo(name string) (err error) {
+	repoPath, err := local.repoDirPath(name)
+	if nil != err {
+		return
+	}
+	err = os.MkdirAll(repoPath, 0755)
+	return
+}
+
+func (local *Local) RemoveRepo(name string) (err error) {
+	repoPath, err := local.repoDirPath(name)
+	if nil != err {
+		return
+	}
+	err = os.RemoveAll(repoPath)
+	return
+}
+
+func (local *Local) GetRepos() (repos []*Repo, size int64, err error) {
+	repos, err = local.listRepos()
+	if nil != err {
+		return
+	}
+
+	for _, repo := range repos {
+		size += repo.Size
+	}
+	return
+}
+
+func (local *Local) UploadObject(filePath string, overwrite bool) (err error) {
+	absFilePath := filepath.Join(local.Conf.RepoPath, filePath)
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	key := filepath.Join(repoDirPath, filePath)
+	if !overwrite && gulu.File.IsExist(key) {
+		return
+	}
+
+	data, err := filelock.ReadFile(absFilePath)
+	if nil != err {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(key), 0755); nil != err {
+		logging.LogErrorf("mkdir [%s] failed: %s", filepath.Dir(key), err)
+		return
+	}
+
+	err = gulu.File.WriteFileSaferByReader(key, local.UploadLimiter.Reader(bytes.NewReader(data)), 0644)
+	if nil != err {
+		logging.LogErrorf("upload object [%s] failed: %s", key, err)
+	}
+	return
+}
+
+func (local *Local) DownloadObject(filePath string) (data []byte, err error) {
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	key := filepath.Join(repoDirPath, filePath)
+	file, err := os.Open(key)
+	if nil != err {
+		err = local.parseErr(err)
+		return
+	}
+	defer file.Close()
+	data, err = io.ReadAll(local.DownloadLimiter.Reader(file))
+	return
+}
+
+func (local *Local) RemoveObject(filePath string) (err error) {
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	key := filepath.Join(repoDirPath, filePath)
+	err = os.Remove(key)
+	err = local.parseErr(err)
+	if ErrCloudObjectNotFound == err {
+		err = nil
+	}
+	return
+}
+
+func (local *Local) GetTags() (tags []*Ref, err error) {
+	tags, err = local.listRepoRefs("tags")
+	if nil != err {
+		logging.LogErrorf("list repo tags failed: %s", err)
+		return
+	}
+	if 1 > len(tags) {
+		tags = []*Ref{}
+	}
+	return
+}
+
+func (local *Local) GetIndexes(page int) (ret []*entity.Index, pageCount, totalCount int, err error) {
+	ret = []*entity.Index{}
+	data, err := local.DownloadObject("indexes-v2.json")
+	if nil != err {
+		if ErrCloudObjectNotFound == err {
+			err = nil
+		}
+		return
+	}
+
+	data, err = compressDecoder.DecodeAll(data, nil)
+	if nil != err {
+		return
+	}
+
+	indexesJSON := &Indexes{}
+	if err = gulu.JSON.UnmarshalJSON(data, indexesJSON); nil != err {
+		return
+	}
+
+	totalCount = len(indexesJSON.Indexes)
+	pageCount = int(math.Ceil(float64(totalCount) / float64(pageSize)))
+
+	start := (page - 1) * pageSize
+	end := page * pageSize
+	if end > totalCount {
+		end = totalCount
+	}
+
+	for i := start; i < end; i++ {
+		index, getErr := local.repoIndex(indexesJSON.Indexes[i].ID)
+		if nil != getErr {
+			logging.LogWarnf("get index [%s] failed: %s", indexesJSON.Indexes[i].ID, getErr)
+			continue
+		}
+		if nil == index {
+			continue
+		}
+
+		ret = append(ret, index)
+	}
+	return
+}
+
+func (local *Local) GetRefsFiles() (fileIDs []string, refs []*Ref, err error) {
+	refs, err = local.listRepoRefs("")
+	if nil != err {
+		logging.LogErrorf("list repo refs failed: %s", err)
+		return
+	}
+
+	var files []string
+	for _, ref := range refs {
+		index, getErr := local.repoIndex(ref.ID)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		if nil == index {
+			continue
+		}
+
+		files = append(files, index.Files...)
+	}
+	fileIDs = gulu.Str.RemoveDuplicatedElem(files)
+	if 1 > len(fileIDs) {
+		fileIDs = []string{}
+	}
+	return
+}
+
+func (local *Local) GetChunks(checkChunkIDs []string) (chunkIDs []string, err error) {
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	for _, chunk := range checkChunkIDs {
+		key := filepath.Join(repoDirPath, "objects", chunk[:2], chunk[2:])
+		if !gulu.File.IsExist(key) {
+			chunkIDs = append(chunkIDs, chunk)
+		}
+	}
+	chunkIDs = gulu.Str.RemoveDuplicatedElem(chunkIDs)
+	if 1 > len(chunkIDs) {
+		chunkIDs = []string{}
+	}
+	return
+}
+
+func (local *Local) GetStat() (stat *Stat, err error) {
+	stat = &Stat{
+		Sync:   &StatSync{},
+		Backup: &StatBackup{},
+	}
+
+	repos, err := local.listRepos()
+	if nil != err {
+		return
+	}
+	stat.RepoCount = len(repos)
+
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	objectsPath := filepath.Join(repoDirPath, "objects")
+	filepath.Walk(objectsPath, func(path string, info fs.FileInfo, walkErr error) error {
+		if nil != walkErr || info.IsDir() {
+			return nil
+		}
+		stat.Sync.Size += info.Size()
+		stat.Sync.FileCount++
+		return nil
+	})
+	if info, statErr := os.Stat(filepath.Join(repoDirPath, "refs", "latest")); nil == statErr {
+		stat.Sync.Updated = info.ModTime().Format("2006-01-02 15:04:05")
+	}
+
+	tags, _ := local.listRepoRefs("tags")
+	stat.Backup.Count = len(tags)
+	return
+}
+
+func (local *Local) listRepoRefs(refPrefix string) (ret []*Ref, err error) {
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	refsPath := filepath.Join(repoDirPath, "refs", refPrefix)
+	if !gulu.File.IsDir(refsPath) {
+		return
+	}
+
+	err = filepath.Walk(refsPath, func(path string, info fs.FileInfo, walkErr error) error {
+		if nil != walkErr {
+			return walkErr
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		data, readErr := os.ReadFile(path)
+		if nil != readErr {
+			return readErr
+		}
+
+		id := strings.TrimSpace(string(data))
+		index, indexErr := local.repoIndex(id)
+		if nil != indexErr || nil == index {
+			return nil
+		}
+
+		ret = append(ret, &Ref{
+			Name:    info.Name(),
+			ID:      id,
+			Updated: info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+		return nil
+	})
+	return
+}
+
+func (local *Local) listRepos() (ret []*Repo, err error) {
+	ret = []*Repo{}
+	entries, err := os.ReadDir(filepath.Join(local.Local.Endpoint, "repo"))
+	if nil != err {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		info, infoErr := entry.Info()
+		if nil != infoErr {
+			continue
+		}
+
+		size, sizeErr := dirSize(filepath.Join(local.Local.Endpoint, "repo", entry.Name()))
+		if nil != sizeErr {
+			logging.LogWarnf("get repo [%s] size failed: %s", entry.Name(), sizeErr)
+		}
+
+		ret = append(ret, &Repo{
+			Name:    entry.Name(),
+			Size:    size,
+			Updated: info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return
+}
+
+func (local *Local) repoIndex(id string) (ret *entity.Index, err error) {
+	repoDirPath, err := local.getCurrentRepoDirPath()
+	if nil != err {
+		return
+	}
+	indexPath := filepath.Join(repoDirPath, "indexes", id)
+	info, err := os.Stat(indexPath)
+	if nil != err {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if 1 > info.Size() {
+		return
+	}
+
+	data, err := os.ReadFile(indexPath)
+	if nil != err {
+		return
+	}
+	data, err = compressDecoder.DecodeAll(data, nil)
+	if nil != err {
+		return
+	}
+	ret = &entity.Index{}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
+// repoDirPath 返回名称为 name 的仓库文件夹路径，name 必须是单个路径元素，避免操作存储目录之外的文件夹。
+func (local *Local) repoDirPath(name string) (ret string, err error) {
+	if "" == name || "." == name || ".." == name || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		err = ErrInvalidRepoName
+		return
+	}
+	ret = filepath.Join(local.Local.Endpoint, "repo", name)
+	return
+}
+
+// dirSize 返回文件夹 dir 下所有文件的总大小字节数。
+func dirSize(dir string) (ret int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, infoErr := d.Info()
+		if nil != infoErr {
+			return infoErr
+		}
+		ret += info.Size()
+		return nil
+	})
+	return
+}
+
+// getCurrentRepoDirPath 返回当前同步仓库的文件夹路径，仓库名称和 repoDirPath 一样需要校验。
+func (local *Local) getCurrentRepoDirPath() (string, error) {
+	return local.repoDirPath(local.Dir)
+}
+
+func (local *Local) parseErr(err error) error {
+	if nil == err {
+		return nil
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrCloudObjectNotFound
+	}
+	return err
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	as3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/panjf2000/ants/v2"
@@ -76,6 +77,11 @@ func (s3 *S3) UploadObject(filePath string, overwrite bool) (err error) {
 		Bucket: aws.String(s3.Conf.S3.Bucket),
 		Key:    aws.String(path.Join("repo", filePath)),
 		Body:   file,
+	}, func(req *request.Request) {
+		// 请求签名时会先读取一遍请求体，所以在发送前（包括每次重试）才限制请求体的发送速率
+		req.Handlers.Send.PushFront(func(req *request.Request) {
+			s3.UploadLimiter.limitRequest(req.HTTPRequest)
+		})
 	})
 	return
 }
@@ -96,7 +102,7 @@ func (s3 *S3) DownloadObject(filePath string) (data []byte, err error) {
 		return
 	}
 	defer resp.Body.Close()
-	data, err = io.ReadAll(resp.Body)
+	data, err = io.ReadAll(s3.DownloadLimiter.Reader(resp.Body))
 	return
 }
 
@@ -19,6 +19,8 @@ package cloud
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"path"
 	"path/filepath"
 	"sort"
@@ -67,7 +69,7 @@ func (siyuan *SiYuan) UploadObject(filePath string, overwrite bool) (err error)
 	formUploader := storage.NewFormUploader(&storage.Config{UseHTTPS: true, Region: &region, UseCdnDomains: true})
 
 	ret := storage.PutRet{}
-	err = formUploader.PutFile(context.Background(), &ret, uploadToken, key, absFilePath, nil)
+	err = siyuan.putFile(formUploader, &ret, uploadToken, key, absFilePath)
 	if nil != err {
 		if msg := fmt.Sprintf("%s", err); strings.Contains(msg, "file exists") {
 			err = nil
@@ -90,7 +92,7 @@ func (siyuan *SiYuan) UploadObject(filePath string, overwrite bool) (err error)
 		}
 
 		time.Sleep(1 * time.Second)
-		err = formUploader.PutFile(context.Background(), &ret, uploadToken, key, absFilePath, nil)
+		err = siyuan.putFile(formUploader, &ret, uploadToken, key, absFilePath)
 		if nil != err {
 			if msg := fmt.Sprintf("%s", err); strings.Contains(msg, "file exists") {
 				err = nil
@@ -119,13 +121,33 @@ func (siyuan *SiYuan) UploadObject(filePath string, overwrite bool) (err error)
 	return
 }
 
+// putFile 按照上传带宽限制读取本地文件 absFilePath 并以表单方式上传。
+func (siyuan *SiYuan) putFile(formUploader *storage.FormUploader, ret *storage.PutRet, uploadToken, key, absFilePath string) (err error) {
+	file, err := os.Open(absFilePath)
+	if nil != err {
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if nil != err {
+		return
+	}
+
+	// Put 不会像 PutFile 那样初始化上传选项，所以这里需要显式传入
+	extra := &storage.PutExtra{TryTimes: 3, HostFreezeDuration: 10 * time.Minute}
+	err = formUploader.Put(context.Background(), ret, uploadToken, key, siyuan.UploadLimiter.Reader(file), info.Size(), extra)
+	return
+}
+
 func (siyuan *SiYuan) DownloadObject(filePath string) (ret []byte, err error) {
 	key := path.Join("siyuan", siyuan.Conf.UserID, "repo", siyuan.Conf.Dir, filePath)
-	resp, err := httpclient.NewCloudFileRequest2m().Get(siyuan.Endpoint + key)
+	resp, err := httpclient.NewCloudFileRequest2m().DisableAutoReadResponse().Get(siyuan.Endpoint + key)
 	if nil != err {
 		err = fmt.Errorf("download object [%s] failed: %s", key, err)
 		return
 	}
+	defer resp.Body.Close()
 	if 200 != resp.StatusCode {
 		if 404 == resp.StatusCode {
 			if !strings.HasSuffix(key, "/refs/latest") && !strings.HasSuffix(key, "/lock-sync") {
@@ -138,7 +160,7 @@ func (siyuan *SiYuan) DownloadObject(filePath string) (ret []byte, err error) {
 		return
 	}
 
-	ret, err = resp.ToBytes()
+	ret, err = io.ReadAll(siyuan.DownloadLimiter.Reader(resp.Body))
 	if nil != err {
 		err = fmt.Errorf("download read data failed: %s", err)
 		return
@@ -18,8 +18,10 @@ package cloud
 
 import (
 	"errors"
+	"io"
 	"io/fs"
 	"math"
+	"net/http"
 	"path"
 	"path/filepath"
 	"sort"
@@ -47,6 +49,12 @@ func NewWebDAV(baseCloud *BaseCloud, client *gowebdav.Client) (ret *WebDAV) {
 		Client:    client,
 		lock:      sync.Mutex{},
 	}
+	// 上传请求的请求体在发送时按照带宽限制读取，部分 WebDAV 服务不支持分块传输编码，所以仍然保留请求体长度
+	client.SetInterceptor(func(method string, req *http.Request) {
+		if http.MethodPut == method {
+			ret.UploadLimiter.limitRequest(req)
+		}
+	})
 	return
 }
 
@@ -85,8 +93,13 @@ func (webdav *WebDAV) UploadObject(filePath string, overwrite bool) (err error)
 }
 
 func (webdav *WebDAV) DownloadObject(filePath string) (data []byte, err error) {
-	data, err = webdav.Client.Read(path.Join(webdav.Dir, "siyuan", "repo", filePath))
-	err = webdav.parseErr(err)
+	stream, err := webdav.Client.ReadStream(path.Join(webdav.Dir, "siyuan", "repo", filePath))
+	if nil != err {
+		err = webdav.parseErr(err)
+		return
+	}
+	defer stream.Close()
+	data, err = io.ReadAll(webdav.DownloadLimiter.Reader(stream))
 	return
 }
 
@@ -0,0 +1,183 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// RetentionPolicy 描述了快照保留策略，各项为 0 时表示不使用该项规则。
+//
+// 规则参考 restic forget：按时间从新到旧遍历快照，KeepLast 保留最近的 N 个快照，
+// KeepHourly/KeepDaily/KeepWeekly/KeepMonthly/KeepYearly 在最近的 N 个时间段中每个时间段保留最新的一个快照。
+type RetentionPolicy struct {
+	KeepLast    int `json:"keepLast"`
+	KeepHourly  int `json:"keepHourly"`
+	KeepDaily   int `json:"keepDaily"`
+	KeepWeekly  int `json:"keepWeekly"`
+	KeepMonthly int `json:"keepMonthly"`
+	KeepYearly  int `json:"keepYearly"`
+}
+
+// IsEmpty 判断保留策略是否为空，空策略不会删除任何快照。
+func (policy *RetentionPolicy) IsEmpty() bool {
+	return nil == policy || (1 > policy.KeepLast && 1 > policy.KeepHourly && 1 > policy.KeepDaily &&
+		1 > policy.KeepWeekly && 1 > policy.KeepMonthly && 1 > policy.KeepYearly)
+}
+
+type ForgetResult struct {
+	Keeps   []*Log     `json:"keeps"`   // 保留的快照
+	Removes []*Log     `json:"removes"` // 删除的快照
+	Purge   *PurgeStat `json:"purge"`   // 清理统计，dryRun 时为 nil
+}
+
+// Forget 按照保留策略 policy 删除本地仓库中的旧快照，然后清理不再被引用的对象。
+//
+// 被引用（latest、latest-sync 和标记快照）的索引始终保留；dryRun 为 true 时仅计算结果而不执行删除。
+func (repo *Repo) Forget(policy *RetentionPolicy, dryRun bool) (ret *ForgetResult, err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	ret = &ForgetResult{Keeps: []*Log{}, Removes: []*Log{}}
+	if policy.IsEmpty() {
+		return
+	}
+
+	indexes, err := repo.store.getIndexes()
+	if nil != err {
+		return
+	}
+	refIndexIDs, err := repo.store.readRefs()
+	if nil != err {
+		return
+	}
+
+	keeps := applyRetentionPolicy(indexes, policy)
+	keepIDs := map[string]bool{}
+	for _, index := range indexes {
+		var log *Log
+		if log, err = repo.getLog(index, false); nil != err {
+			return
+		}
+
+		if keeps[index.ID] || refIndexIDs[index.ID] {
+			keepIDs[index.ID] = true
+			ret.Keeps = append(ret.Keeps, log)
+			continue
+		}
+		ret.Removes = append(ret.Removes, log)
+	}
+	if dryRun {
+		return
+	}
+
+	for _, log := range ret.Removes {
+		_, indexPath := repo.store.IndexAbsPath(log.ID)
+		if err = filelock.Remove(indexPath); nil != err {
+			return
+		}
+		indexCache.Del(log.ID)
+	}
+
+	ret.Purge, err = repo.store.purge(keepIDs)
+	if nil != err {
+		return
+	}
+	ret.Purge.Indexes += len(ret.Removes)
+	logging.LogInfof("forgot [%d] indexes, purged [%d] objects", len(ret.Removes), ret.Purge.Objects)
+	return
+}
+
+// applyRetentionPolicy 返回按照保留策略需要保留的索引 ID。
+func applyRetentionPolicy(indexes []*entity.Index, policy *RetentionPolicy) (ret map[string]bool) {
+	ret = map[string]bool{}
+	sort.SliceStable(indexes, func(i, j int) bool { return indexes[i].Created > indexes[j].Created })
+
+	for i := 0; i < policy.KeepLast && i < len(indexes); i++ {
+		ret[indexes[i].ID] = true
+	}
+
+	buckets := []struct {
+		count int
+		key   func(t time.Time) string
+	}{
+		{policy.KeepHourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{policy.KeepDaily, func(t time.Time) string { return t.Format("20060102") }},
+		{policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%04d%02d", year, week)
+		}},
+		{policy.KeepMonthly, func(t time.Time) string { return t.Format("200601") }},
+		{policy.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, bucket := range buckets {
+		if 1 > bucket.count {
+			continue
+		}
+
+		lastKey, kept := "", 0
+		for _, index := range indexes {
+			if kept >= bucket.count {
+				break
+			}
+
+			key := bucket.key(time.UnixMilli(index.Created))
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			ret[index.ID] = true
+			kept++
+		}
+	}
+	return
+}
+
+func (store *Store) getIndexes() (ret []*entity.Index, err error) {
+	indexesDir := filepath.Join(store.Path, "indexes")
+	if !gulu.File.IsDir(indexesDir) {
+		return
+	}
+
+	entries, err := os.ReadDir(indexesDir)
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		id := entry.Name()
+		if 40 != len(id) || entry.IsDir() {
+			continue
+		}
+
+		var index *entity.Index
+		if index, err = store.GetIndex(id); nil != err {
+			return
+		}
+		ret = append(ret, index)
+	}
+	return
+}
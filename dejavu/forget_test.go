@@ -0,0 +1,109 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/dejavu/util"
+)
+
+func TestForget(t *testing.T) {
+	clearTestdata(t)
+
+	repo, index := initIndex(t)
+
+	// 构造 5 个按天递减的历史快照
+	var olds []*entity.Index
+	for i := 1; i <= 5; i++ {
+		old := *index
+		old.ID = util.RandHash()
+		old.Created = time.Now().AddDate(0, 0, -i).UnixMilli()
+		if err := repo.PutIndex(&old); nil != err {
+			t.Fatalf("put index failed: %s", err)
+			return
+		}
+		olds = append(olds, &old)
+	}
+	if err := repo.AddTag(olds[4].ID, "tag1"); nil != err {
+		t.Fatalf("add tag failed: %s", err)
+		return
+	}
+
+	policy := &RetentionPolicy{KeepLast: 1, KeepDaily: 3}
+	result, err := repo.Forget(policy, true)
+	if nil != err {
+		t.Fatalf("forget failed: %s", err)
+		return
+	}
+	// 保留 latest、最近 3 天（包括今天）各一个以及标记的快照
+	if 4 != len(result.Keeps) || 2 != len(result.Removes) {
+		t.Fatalf("forget dry run result not match: keeps [%d], removes [%d]", len(result.Keeps), len(result.Removes))
+		return
+	}
+	if _, err = repo.GetIndex(olds[3].ID); nil != err {
+		t.Fatalf("dry run should not remove index")
+		return
+	}
+
+	result, err = repo.Forget(policy, false)
+	if nil != err {
+		t.Fatalf("forget failed: %s", err)
+		return
+	}
+	if 2 != len(result.Removes) || nil == result.Purge {
+		t.Fatalf("forget result not match")
+		return
+	}
+	for _, old := range olds[2:4] {
+		if _, err = repo.GetIndex(old.ID); nil == err {
+			t.Fatalf("index [%s] should be removed", old.ID)
+			return
+		}
+	}
+	if _, err = repo.GetIndex(olds[4].ID); nil != err {
+		t.Fatalf("tagged index should be kept")
+		return
+	}
+	if _, _, err = repo.Checkout(index.ID, map[string]interface{}{}); nil != err {
+		t.Fatalf("checkout failed: %s", err)
+		return
+	}
+}
+
+func TestApplyRetentionPolicy(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.Local)
+	var indexes []*entity.Index
+	for i := 0; i < 48; i++ {
+		indexes = append(indexes, &entity.Index{ID: util.RandHash(), Created: now.Add(-time.Duration(i) * time.Hour).UnixMilli()})
+	}
+
+	keeps := applyRetentionPolicy(indexes, &RetentionPolicy{KeepHourly: 5})
+	if 5 != len(keeps) {
+		t.Fatalf("hourly keeps [%d] not match", len(keeps))
+		return
+	}
+
+	keeps = applyRetentionPolicy(indexes, &RetentionPolicy{KeepLast: 2, KeepDaily: 7})
+	// 最近 2 个快照（同在 5 月 10 日）加上 5 月 10 日、9 日、8 日各一个，其中 10 日的一个与最近快照重合
+	if 4 != len(keeps) {
+		t.Fatalf("daily keeps [%d] not match", len(keeps))
+		return
+	}
+}
@@ -0,0 +1,500 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/88250/lute/render"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/filesys"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+var errSyMergeConflict = errors.New("block merge conflict")
+
+// mergeSyConflicts 对本地和云端都发生变更的 .sy 文件进行块级三路合并，合并基准为上一个同步点。
+//
+// merges 为合并成功并已经写入工作区的文件，remains 为无法合并仍需按冲突处理的文件。
+func (repo *Repo) mergeSyConflicts(conflicts, localUpserts, latestSyncFiles []*entity.File) (merges, remains []*entity.File) {
+	for _, conflict := range conflicts {
+		if !strings.HasSuffix(conflict.Path, ".sy") {
+			remains = append(remains, conflict)
+			continue
+		}
+
+		base, local := repo.getFileByPath(latestSyncFiles, conflict.Path), repo.getFileByPath(localUpserts, conflict.Path)
+		if nil == base || nil == local {
+			remains = append(remains, conflict)
+			continue
+		}
+
+		if err := repo.mergeSy(base, local, conflict); nil != err {
+			if !errors.Is(err, errSyMergeConflict) {
+				logging.LogWarnf("merge [%s] failed: %s", conflict.Path, err)
+			}
+			remains = append(remains, conflict)
+			continue
+		}
+		merges = append(merges, conflict)
+	}
+	return
+}
+
+func (repo *Repo) mergeSy(base, local, cloud *entity.File) (err error) {
+	absPath := repo.absPath(local.Path)
+	info, err := os.Stat(absPath)
+	if nil != err {
+		return
+	}
+	if info.ModTime().UnixMilli() != local.Updated {
+		// 索引后工作区文件又发生了变更，不能覆盖
+		err = errSyMergeConflict
+		return
+	}
+
+	baseData, err := repo.openFile(base)
+	if nil != err {
+		return
+	}
+	localData, err := repo.openFile(local)
+	if nil != err {
+		return
+	}
+	cloudData, err := repo.openFile(cloud)
+	if nil != err {
+		return
+	}
+
+	data, err := mergeSyData(baseData, localData, cloudData)
+	if nil != err {
+		return
+	}
+
+	if err = filelock.WriteFile(absPath, data); nil != err {
+		logging.LogErrorf("write merged file [%s] failed: %s", absPath, err)
+		return
+	}
+	logging.LogInfof("merged [%s]", local.Path)
+	return
+}
+
+func (repo *Repo) getFileByPath(files []*entity.File, p string) *entity.File {
+	for _, f := range files {
+		if f.Path == p {
+			return f
+		}
+	}
+	return nil
+}
+
+// mergeSyData 以 base 为基准对 local 和 cloud 进行块级三路合并：
+//
+//   - 块按 ID 对应，只有一端修改的块使用修改后的内容，两端修改了同一个块则认为冲突
+//   - 子块顺序按块 ID 列表进行三路合并，两端都调整了同一组子块的顺序则认为冲突
+//   - 一端删除而另一端修改（包括其下级块）的块认为冲突
+func mergeSyData(baseData, localData, cloudData []byte) (ret []byte, err error) {
+	luteEngine := lute.New()
+	m := &syMerger{used: map[string]bool{}}
+	if m.base, err = newSyMergeSide(baseData, luteEngine); nil != err {
+		return
+	}
+	if m.local, err = newSyMergeSide(localData, luteEngine); nil != err {
+		return
+	}
+	if m.cloud, err = newSyMergeSide(cloudData, luteEngine); nil != err {
+		return
+	}
+
+	rootID := m.local.tree.Root.ID
+	if rootID != m.base.tree.Root.ID || rootID != m.cloud.tree.Root.ID {
+		err = errSyMergeConflict
+		return
+	}
+
+	root, err := m.build(rootID)
+	if nil != err {
+		return
+	}
+	if err = m.checkLost(m.local); nil != err {
+		return
+	}
+	if err = m.checkLost(m.cloud); nil != err {
+		return
+	}
+
+	// 文档更新时间取两端较新者
+	updated := m.local.tree.Root.IALAttr("updated")
+	if cloudUpdated := m.cloud.tree.Root.IALAttr("updated"); cloudUpdated > updated {
+		updated = cloudUpdated
+	}
+	if "" != updated {
+		root.SetIALAttr("updated", updated)
+	}
+
+	tree := &parse.Tree{Root: root, Context: &parse.Context{ParseOption: luteEngine.ParseOptions}}
+	renderer := render.NewJSONRenderer(tree, luteEngine.RenderOptions)
+	data := renderer.Render()
+
+	// .sy 文档数据使用格式化好的 JSON 而非单行 JSON
+	buf := bytes.Buffer{}
+	buf.Grow(4096)
+	if err = json.Indent(&buf, data, "", "\t"); nil != err {
+		return
+	}
+	ret = buf.Bytes()
+	return
+}
+
+// syMergeSide 描述了参与三路合并的一端文档。
+type syMergeSide struct {
+	tree     *parse.Tree
+	nodes    map[string]*ast.Node // 块 ID -> 块节点
+	children map[string][]string  // 块 ID -> 子块 ID 列表
+	sigs     map[string]string    // 块 ID -> 块自身内容签名（不包含子块）
+}
+
+func newSyMergeSide(data []byte, luteEngine *lute.Lute) (ret *syMergeSide, err error) {
+	tree, _, err := filesys.ParseJSON(data, luteEngine.ParseOptions)
+	if nil != err {
+		return
+	}
+
+	ret = &syMergeSide{tree: tree, nodes: map[string]*ast.Node{}, children: map[string][]string{}, sigs: map[string]string{}}
+	err = ret.collect(tree.Root)
+	return
+}
+
+func (side *syMergeSide) collect(node *ast.Node) (err error) {
+	if nil != side.nodes[node.ID] {
+		err = errSyMergeConflict // 重复的块 ID 无法合并
+		return
+	}
+
+	side.nodes[node.ID] = node
+	side.sigs[node.ID] = blockSig(node)
+	for c := node.FirstChild; nil != c; c = c.Next {
+		if !isMergeBlock(c) {
+			continue
+		}
+
+		side.children[node.ID] = append(side.children[node.ID], c.ID)
+		if err = side.collect(c); nil != err {
+			return
+		}
+	}
+	return
+}
+
+// unchanged 判断 id 对应的块及其所有下级块相比 base 是否都没有变化。
+func (side *syMergeSide) unchanged(base *syMergeSide, id string) bool {
+	if nil == base.nodes[id] || side.sigs[id] != base.sigs[id] || !equalIDs(side.children[id], base.children[id]) {
+		return false
+	}
+	for _, child := range side.children[id] {
+		if !side.unchanged(base, child) {
+			return false
+		}
+	}
+	return true
+}
+
+type syMerger struct {
+	base, local, cloud *syMergeSide
+	used               map[string]bool
+}
+
+func (m *syMerger) build(id string) (ret *ast.Node, err error) {
+	if m.used[id] {
+		err = errSyMergeConflict // 两端将同一个块移动到了不同位置
+		return
+	}
+	m.used[id] = true
+
+	src, err := m.mergeContent(id)
+	if nil != err {
+		return
+	}
+	childIDs, err := m.mergeChildren(id)
+	if nil != err {
+		return
+	}
+
+	var children []*ast.Node
+	for _, childID := range childIDs {
+		var child *ast.Node
+		if child, err = m.build(childID); nil != err {
+			return
+		}
+		children = append(children, child)
+	}
+
+	// 使用选中的块作为外壳，替换其子块
+	var oldChildren []*ast.Node
+	for c := src.FirstChild; nil != c; c = c.Next {
+		if isMergeBlock(c) {
+			oldChildren = append(oldChildren, c)
+		}
+	}
+
+	var anchor *ast.Node
+	if 0 < len(oldChildren) {
+		anchor = oldChildren[0].Previous
+	} else if nil != src.LastChild && ast.NodeSuperBlockCloseMarker == src.LastChild.Type {
+		anchor = src.LastChild.Previous
+	} else {
+		anchor = src.LastChild
+	}
+	for _, c := range oldChildren {
+		c.Unlink()
+	}
+
+	for _, child := range children {
+		if nil == anchor {
+			src.PrependChild(child)
+		} else {
+			anchor.InsertAfter(child)
+		}
+		anchor = child
+	}
+	ret = src
+	return
+}
+
+// mergeContent 选择 id 对应块自身内容所在的节点。
+func (m *syMerger) mergeContent(id string) (ret *ast.Node, err error) {
+	local, cloud := m.local.nodes[id], m.cloud.nodes[id]
+	if nil == local {
+		ret = cloud
+		return
+	}
+	if nil == cloud {
+		ret = local
+		return
+	}
+
+	localSig, cloudSig := m.local.sigs[id], m.cloud.sigs[id]
+	if localSig == cloudSig {
+		ret = local
+		return
+	}
+
+	if nil != m.base.nodes[id] {
+		baseSig := m.base.sigs[id]
+		if localSig == baseSig {
+			ret = cloud
+			return
+		}
+		if cloudSig == baseSig {
+			ret = local
+			return
+		}
+	}
+
+	err = errSyMergeConflict // 两端都修改了该块
+	return
+}
+
+// mergeChildren 对 id 对应块的子块 ID 列表进行三路合并。
+func (m *syMerger) mergeChildren(id string) (ret []string, err error) {
+	base, local, cloud := m.base.children[id], m.local.children[id], m.cloud.children[id]
+	if nil == m.local.nodes[id] {
+		local = cloud
+	}
+	if nil == m.cloud.nodes[id] {
+		cloud = local
+	}
+	if nil == m.base.nodes[id] {
+		base = nil
+	}
+
+	if equalIDs(local, cloud) {
+		ret = local
+		return
+	}
+
+	inBase, inLocal, inCloud := idSet(base), idSet(local), idSet(cloud)
+
+	// 以调整了顺序的一端作为主序列，另一端的新增块插入到主序列中
+	localOrder, cloudOrder, baseOrder := commonIDs(local, inBase, inCloud), commonIDs(cloud, inBase, inLocal), commonIDs(base, inLocal, inCloud)
+	primary, secondary := cloud, local
+	if !equalIDs(localOrder, baseOrder) {
+		if !equalIDs(cloudOrder, baseOrder) && !equalIDs(cloudOrder, localOrder) {
+			err = errSyMergeConflict // 两端都调整了子块顺序
+			return
+		}
+		primary, secondary = local, cloud
+	}
+
+	keeps := map[string]bool{}
+	for _, childID := range append(append([]string{}, local...), cloud...) {
+		if _, ok := keeps[childID]; ok {
+			continue
+		}
+
+		var keep bool
+		if keep, err = m.keepChild(childID, inBase[childID], inLocal[childID], inCloud[childID]); nil != err {
+			return
+		}
+		keeps[childID] = keep
+	}
+
+	for _, childID := range primary {
+		if keeps[childID] {
+			ret = append(ret, childID)
+		}
+	}
+
+	pos := 0
+	for _, childID := range secondary {
+		if idx := indexOfID(ret, childID); -1 < idx {
+			pos = idx + 1
+			continue
+		}
+		if !keeps[childID] {
+			continue
+		}
+
+		ret = append(ret[:pos], append([]string{childID}, ret[pos:]...)...)
+		pos++
+	}
+	return
+}
+
+// keepChild 判断子块在合并后的子块列表中是否保留。
+func (m *syMerger) keepChild(id string, inBase, inLocal, inCloud bool) (ret bool, err error) {
+	if inLocal && inCloud {
+		return true, nil
+	}
+
+	// 只在一端的子块列表中出现：可能是该端新增、移入，或者另一端删除、移出
+	this, other := m.local, m.cloud
+	if inCloud {
+		this, other = m.cloud, m.local
+	}
+
+	if inBase {
+		if nil != other.nodes[id] {
+			// 另一端将该块移动到了其他位置
+			return false, nil
+		}
+
+		// 另一端删除了该块，需要确认这一端没有修改过该块
+		if this.unchanged(m.base, id) {
+			return false, nil
+		}
+		return false, errSyMergeConflict
+	}
+
+	if nil != m.base.nodes[id] && nil == other.nodes[id] {
+		// 这一端移入了另一端已经删除的块
+		if this.unchanged(m.base, id) {
+			return false, nil
+		}
+		return false, errSyMergeConflict
+	}
+	return true, nil
+}
+
+// checkLost 检查 side 中新增或者修改过的块是否都保留在了合并结果中，避免丢失数据。
+func (m *syMerger) checkLost(side *syMergeSide) error {
+	for id := range side.nodes {
+		if m.used[id] {
+			continue
+		}
+		if nil == m.base.nodes[id] || side.sigs[id] != m.base.sigs[id] {
+			return errSyMergeConflict
+		}
+	}
+	return nil
+}
+
+func isMergeBlock(node *ast.Node) bool {
+	return "" != node.ID && node.IsBlock()
+}
+
+// blockSig 计算块自身内容（包括属性和行级元素，不包括子块和更新时间）的签名。
+func blockSig(node *ast.Node) string {
+	buf := &bytes.Buffer{}
+	writeNodeSig(buf, node)
+	return buf.String()
+}
+
+func writeNodeSig(buf *bytes.Buffer, node *ast.Node) {
+	n := *node
+	n.Parent, n.Previous, n.Next, n.FirstChild, n.LastChild, n.Children, n.FootnotesRefs = nil, nil, nil, nil, nil, nil, nil
+	n.TypeStr, n.Data = node.Type.String(), string(node.Tokens)
+	n.Properties = parse.IAL2Map(node.KramdownIAL)
+	delete(n.Properties, "updated")
+	data, _ := json.Marshal(&n)
+	buf.Write(data)
+
+	buf.WriteByte('[')
+	for c := node.FirstChild; nil != c; c = c.Next {
+		if isMergeBlock(c) {
+			continue
+		}
+		writeNodeSig(buf, c)
+	}
+	buf.WriteByte(']')
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func idSet(ids []string) (ret map[string]bool) {
+	ret = map[string]bool{}
+	for _, id := range ids {
+		ret[id] = true
+	}
+	return
+}
+
+func commonIDs(ids []string, in1, in2 map[string]bool) (ret []string) {
+	for _, id := range ids {
+		if in1[id] && in2[id] {
+			ret = append(ret, id)
+		}
+	}
+	return
+}
+
+func indexOfID(ids []string, id string) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
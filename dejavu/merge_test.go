@@ -0,0 +1,125 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/88250/gulu"
+)
+
+func TestMergeSyData(t *testing.T) {
+	base := testSyDoc("a", "b", "c")
+	local := testSyDoc("a1", "b", "c")
+	cloud := testSyDoc("a", "b", "c1", "d")
+
+	merged, err := mergeSyData(base, local, cloud)
+	if nil != err {
+		t.Fatalf("merge failed: %s", err)
+		return
+	}
+
+	texts := testSyTexts(t, merged)
+	if "a1,b,c1,d" != strings.Join(texts, ",") {
+		t.Fatalf("merged texts [%s] not match", strings.Join(texts, ","))
+		return
+	}
+}
+
+func TestMergeSyDataRemove(t *testing.T) {
+	base := testSyDoc("a", "b", "c")
+	local := testSyDoc("a", "b", "c1")
+	cloud := testSyDoc("a", "", "c")
+
+	merged, err := mergeSyData(base, local, cloud)
+	if nil != err {
+		t.Fatalf("merge failed: %s", err)
+		return
+	}
+
+	texts := testSyTexts(t, merged)
+	if "a,c1" != strings.Join(texts, ",") {
+		t.Fatalf("merged texts [%s] not match", strings.Join(texts, ","))
+		return
+	}
+}
+
+func TestMergeSyDataConflict(t *testing.T) {
+	base := testSyDoc("a", "b", "c")
+	local := testSyDoc("a", "b1", "c")
+	cloud := testSyDoc("a", "b2", "c")
+
+	_, err := mergeSyData(base, local, cloud)
+	if !errors.Is(err, errSyMergeConflict) {
+		t.Fatalf("merge should be conflicted")
+		return
+	}
+
+	// 一端删除而另一端修改
+	cloud = testSyDoc("a", "", "c")
+	_, err = mergeSyData(base, local, cloud)
+	if !errors.Is(err, errSyMergeConflict) {
+		t.Fatalf("merge should be conflicted")
+		return
+	}
+}
+
+var testSyBlockIDs = []string{"20230101000000-aaaaaaa", "20230101000000-bbbbbbb", "20230101000000-ccccccc", "20230101000000-ddddddd"}
+
+// testSyDoc 生成测试用的 .sy 文档数据，texts 中的空字符串表示该位置的段落块不存在。
+func testSyDoc(texts ...string) []byte {
+	var children []interface{}
+	for i, text := range texts {
+		if "" == text {
+			continue
+		}
+
+		children = append(children, map[string]interface{}{
+			"ID":         testSyBlockIDs[i],
+			"Type":       "NodeParagraph",
+			"Properties": map[string]interface{}{"id": testSyBlockIDs[i], "updated": "20230101000000"},
+			"Children":   []interface{}{map[string]interface{}{"Type": "NodeText", "Data": text}},
+		})
+	}
+
+	doc := map[string]interface{}{
+		"ID":         "20230101000000-0000000",
+		"Spec":       "1",
+		"Type":       "NodeDocument",
+		"Properties": map[string]interface{}{"id": "20230101000000-0000000", "title": "test", "updated": "20230101000000"},
+		"Children":   children,
+	}
+	data, _ := gulu.JSON.MarshalJSON(doc)
+	return data
+}
+
+func testSyTexts(t *testing.T, data []byte) (ret []string) {
+	doc := map[string]interface{}{}
+	if err := gulu.JSON.UnmarshalJSON(data, &doc); nil != err {
+		t.Fatalf("unmarshal merged data failed: %s", err)
+		return
+	}
+
+	for _, child := range doc["Children"].([]interface{}) {
+		paragraph := child.(map[string]interface{})
+		text := paragraph["Children"].([]interface{})[0].(map[string]interface{})
+		ret = append(ret, text["Data"].(string))
+	}
+	return
+}
@@ -0,0 +1,637 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/cloud"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/dejavu/util"
+	"github.com/wangxu0213/esnote-kernel/eventbus"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// 包文件（pack）用于将多个小对象合并为一个云端对象上传和下载，以减少云端接口请求次数。
+//
+// 包文件格式：若干对象数据（和 objects 下的对象文件内容一致，即压缩并加密后的数据）依次拼接，
+// 然后是 zstd 压缩的 JSON 包头（对象 ID、偏移和长度列表），最后是 4 字节大端序的包头长度。
+// 包文件 ID 为整个包文件内容的 SHA-1，存放在 packs/ 下；云端的 packs/index.json 记录了每个包文件中包含的对象。
+//
+// 上传时包文件仅临时生成；下载的包文件保存在本地仓库的 packs/ 下，Store 读取对象时如果单个对象文件不存在则从包文件中释放，
+// Purge 时清理包含未引用对象或者对象已经全部释放的包文件。
+// 云端同时支持单个对象和包文件，未打包的对象仍然可以按照原来的方式下载，已有仓库可以通过 PackCloud 迁移。
+
+const (
+	packMaxSize       = 8 * 1024 * 1024 // 单个包文件的目标大小
+	packObjectMaxSize = 1024 * 1024     // 超过该大小的对象不打包，仍然按照单个对象上传
+)
+
+var ErrInvalidPack = errors.New("invalid pack")
+
+type packEntry struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// cloudPacks 描述了云端的包文件索引 packs/index.json。
+type cloudPacks struct {
+	Packs map[string][]string `json:"packs"` // 包文件 ID -> 对象 ID 列表
+
+	objects map[string]string // 对象 ID -> 包文件 ID
+}
+
+func (packs *cloudPacks) add(packID string, objectIDs []string) {
+	packs.Packs[packID] = objectIDs
+	for _, id := range objectIDs {
+		packs.objects[id] = packID
+	}
+}
+
+// PackCloud 将云端最近一次同步快照引用的、以单个对象存储的文件和分块合并为包文件。
+//
+// 用于已有云端仓库迁移到包文件格式，迁移后支持包文件的客户端从包文件下载这些对象。云端的单个对象会被保留，
+// 所以不支持包文件的客户端仍然可以同步同一个云端仓库。context 参数用于发布事件时传递调用上下文。
+func (repo *Repo) PackCloud(context map[string]interface{}) (packedCount int, err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	latestSync := repo.latestSync()
+	if "" == latestSync.ID {
+		return
+	}
+
+	files, err := repo.getFiles(latestSync.Files)
+	if nil != err {
+		return
+	}
+	var ids []string
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+	ids = append(ids, repo.getChunks(files)...)
+
+	err = repo.tryLockCloud(context)
+	if nil != err {
+		return
+	}
+	defer repo.unlockCloud(context)
+
+	// 只迁移云端以单个对象存在的对象
+	missing := map[string]bool{}
+	for i := 0; i < len(ids); i += 512 {
+		end := i + 512
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var m []string
+		if m, err = repo.cloud.GetChunks(ids[i:end]); nil != err {
+			return
+		}
+		for _, id := range m {
+			missing[objectIDFromKey(id)] = true
+		}
+	}
+	var looseIDs []string
+	for _, id := range ids {
+		if !missing[id] {
+			looseIDs = append(looseIDs, id)
+		}
+	}
+
+	_, packed, _, err := repo.uploadPacked(looseIDs, context)
+	if nil != err {
+		return
+	}
+	packedCount = len(packed)
+	logging.LogInfof("packed [%d] cloud objects", packedCount)
+	return
+}
+
+// uploadPacked 将 ids 中的对象打包上传，返回已经打包上传的对象 packed 和没有打包需要单独上传的对象 remains。
+// 已经存在于云端包文件中的对象不会重复上传。
+func (repo *Repo) uploadPacked(ids []string, context map[string]interface{}) (uploadBytes int64, packed, remains []string, err error) {
+	if 1 > len(ids) {
+		return
+	}
+
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err {
+		return
+	}
+
+	var group []string
+	var groupSize int64
+	var groups [][]string
+	for _, id := range gulu.Str.RemoveDuplicatedElem(ids) {
+		if _, ok := packs.objects[id]; ok {
+			continue
+		}
+
+		info, statErr := repo.store.Stat(id)
+		if nil != statErr {
+			err = statErr
+			return
+		}
+		if packObjectMaxSize < info.Size() {
+			remains = append(remains, id)
+			continue
+		}
+
+		if packMaxSize < groupSize+info.Size() && 0 < len(group) {
+			groups = append(groups, group)
+			group, groupSize = nil, 0
+		}
+		group = append(group, id)
+		groupSize += info.Size()
+	}
+	if 0 < len(group) {
+		groups = append(groups, group)
+	}
+	if 1 > len(groups) {
+		return
+	}
+
+	for _, g := range groups {
+		var packID string
+		var length int64
+		if packID, length, err = repo.store.writePack(g); nil != err {
+			return
+		}
+
+		eventbus.Publish(eventbus.EvtCloudBeforeUploadPack, context, packID)
+		err = repo.cloud.UploadObject(path.Join("packs", packID), false)
+		_ = os.Remove(filepath.Join(repo.Path, "packs", packID))
+		if nil != err {
+			return
+		}
+		uploadBytes += length
+		packs.add(packID, g)
+		packed = append(packed, g...)
+
+		// 每上传一个包文件就更新包索引，同步中断后已经上传的包文件中的对象不会重复上传
+		if length, err = repo.uploadCloudPacks(packs); nil != err {
+			return
+		}
+		uploadBytes += length
+	}
+	return
+}
+
+// downloadPacked 从云端包文件中下载 ids 中的对象，包文件保存到本地仓库后返回对象解码后的数据 objects 和不在包文件中需要单独下载的对象 remains。
+func (repo *Repo) downloadPacked(ids []string, context map[string]interface{}) (downloadBytes int64, objects map[string][]byte, remains []string, err error) {
+	objects = map[string][]byte{}
+	if 1 > len(ids) {
+		return
+	}
+
+	packs, downloadBytes, err := repo.downloadCloudPacks()
+	if nil != err {
+		return
+	}
+
+	wants := map[string]map[string]bool{}
+	for _, id := range ids {
+		packID, ok := packs.objects[id]
+		if !ok {
+			remains = append(remains, id)
+			continue
+		}
+		if nil == wants[packID] {
+			wants[packID] = map[string]bool{}
+		}
+		wants[packID][id] = true
+	}
+
+	for packID, wantIDs := range wants {
+		eventbus.Publish(eventbus.EvtCloudBeforeDownloadPack, context, packID)
+		data, dpErr := repo.cloud.DownloadObject(path.Join("packs", packID))
+		if nil != dpErr {
+			err = dpErr
+			logging.LogErrorf("download cloud pack [%s] failed: %s", packID, err)
+			return
+		}
+		downloadBytes += int64(len(data))
+
+		var unpacked map[string][]byte
+		if unpacked, err = repo.store.putPack(packID, data, wantIDs); nil != err {
+			logging.LogErrorf("unpack cloud pack [%s] failed: %s", packID, err)
+			return
+		}
+		for id, obj := range unpacked {
+			objects[id] = obj
+		}
+	}
+	return
+}
+
+func (repo *Repo) downloadCloudPacks() (ret *cloudPacks, downloadBytes int64, err error) {
+	ret = &cloudPacks{Packs: map[string][]string{}, objects: map[string]string{}}
+	data, err := repo.cloud.DownloadObject("packs/index.json")
+	if nil != err {
+		if errors.Is(err, cloud.ErrCloudObjectNotFound) {
+			err = nil
+		}
+		return
+	}
+	downloadBytes = int64(len(data))
+
+	if data, err = repo.store.compressDecoder.DecodeAll(data, nil); nil != err {
+		return
+	}
+	packs := &cloudPacks{}
+	if err = gulu.JSON.UnmarshalJSON(data, packs); nil != err {
+		return
+	}
+	for packID, ids := range packs.Packs {
+		ret.add(packID, ids)
+	}
+	return
+}
+
+func (repo *Repo) uploadCloudPacks(packs *cloudPacks) (uploadBytes int64, err error) {
+	data, err := gulu.JSON.MarshalJSON(packs)
+	if nil != err {
+		return
+	}
+	data = repo.store.compressEncoder.EncodeAll(data, nil)
+	uploadBytes = int64(len(data))
+
+	packsDir := filepath.Join(repo.Path, "packs")
+	if err = os.MkdirAll(packsDir, 0755); nil != err {
+		return
+	}
+	if err = gulu.File.WriteFileSafer(filepath.Join(packsDir, "index.json"), data, 0644); nil != err {
+		return
+	}
+	err = repo.cloud.UploadObject("packs/index.json", true)
+	return
+}
+
+// writePack 将 ids 中的对象打包写入 packs/ 下，返回包文件 ID 和大小。
+func (store *Store) writePack(ids []string) (packID string, length int64, err error) {
+	objects := map[string][]byte{}
+	for _, id := range ids {
+		if err = store.resolve(id); nil != err {
+			return
+		}
+		_, file := store.AbsPath(id)
+		if objects[id], err = filelock.ReadFile(file); nil != err {
+			return
+		}
+	}
+	packID, length, err = store.writePackObjects(objects)
+	return
+}
+
+// writePackObjects 将对象 ID 和对象文件内容 objects 打包写入 packs/ 下，返回包文件 ID 和大小。
+func (store *Store) writePackObjects(objects map[string][]byte) (packID string, length int64, err error) {
+	var ids []string
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	buf := bytes.Buffer{}
+	var entries []*packEntry
+	for _, id := range ids {
+		data := objects[id]
+		entries = append(entries, &packEntry{ID: id, Offset: int64(buf.Len()), Length: int64(len(data))})
+		buf.Write(data)
+	}
+
+	header, err := gulu.JSON.MarshalJSON(entries)
+	if nil != err {
+		return
+	}
+	header = store.compressEncoder.EncodeAll(header, nil)
+	buf.Write(header)
+	headerLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(headerLen, uint32(len(header)))
+	buf.Write(headerLen)
+
+	data := buf.Bytes()
+	packID = util.Hash(data)
+	length = int64(len(data))
+	packsDir := filepath.Join(store.Path, "packs")
+	if err = os.MkdirAll(packsDir, 0755); nil != err {
+		return
+	}
+	err = gulu.File.WriteFileSafer(filepath.Join(packsDir, packID), data, 0644)
+	return
+}
+
+// putPack 校验包文件数据 data 中的所有对象后将包文件保存到本地仓库的 packs/ 下，返回 ids 中的对象解码后的数据。
+func (store *Store) putPack(packID string, data []byte, ids map[string]bool) (ret map[string][]byte, err error) {
+	ret = map[string][]byte{}
+	entries, err := store.readPackHeader(data)
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		var decoded []byte
+		if decoded, err = store.decodeData(data[entry.Offset : entry.Offset+entry.Length]); nil != err {
+			return
+		}
+		if !store.verifyObject(entry.ID, decoded) {
+			err = ErrInvalidPack
+			return
+		}
+		if ids[entry.ID] {
+			ret[entry.ID] = decoded
+		}
+	}
+
+	store.packLock.Lock()
+	defer store.packLock.Unlock()
+	if err = store.loadPacks(); nil != err {
+		return
+	}
+
+	packsDir := filepath.Join(store.Path, "packs")
+	if err = os.MkdirAll(packsDir, 0755); nil != err {
+		return
+	}
+	if err = gulu.File.WriteFileSafer(filepath.Join(packsDir, packID), data, 0644); nil != err {
+		return
+	}
+	for _, entry := range entries {
+		store.packs[entry.ID] = packID
+	}
+	return
+}
+
+// resolve 在对象文件不存在时从本地包文件中释放该对象，使包文件中的对象可以和单个对象一样读取。
+func (store *Store) resolve(id string) (err error) {
+	store.packLock.Lock()
+	defer store.packLock.Unlock()
+	if err = store.loadPacks(); nil != err {
+		return
+	}
+
+	packID, ok := store.packs[id]
+	if !ok {
+		return
+	}
+	_, file := store.AbsPath(id)
+	if gulu.File.IsExist(file) {
+		return
+	}
+	err = store.extract(packID, map[string]bool{id: true})
+	return
+}
+
+// loadPacks 读取本地包文件的包头，建立对象 ID 到包文件 ID 的映射，调用方需要持有 packLock。
+func (store *Store) loadPacks() (err error) {
+	if nil != store.packs {
+		return
+	}
+
+	packs := map[string]string{}
+	packsDir := filepath.Join(store.Path, "packs")
+	if gulu.File.IsDir(packsDir) {
+		entries, readErr := os.ReadDir(packsDir)
+		if nil != readErr {
+			err = readErr
+			return
+		}
+
+		for _, entry := range entries {
+			packID := entry.Name()
+			if entry.IsDir() || 40 != len(packID) {
+				continue // 跳过云端包文件索引 index.json
+			}
+
+			var packEntries []*packEntry
+			if packEntries, err = store.readPackFileHeader(packID); nil != err {
+				logging.LogErrorf("read pack [%s] header failed: %s", packID, err)
+				return
+			}
+			for _, packEntry := range packEntries {
+				packs[packEntry.ID] = packID
+			}
+		}
+	}
+	store.packs = packs
+	return
+}
+
+// extract 将本地包文件 packID 中 ids 里的对象释放为单个对象文件，已经存在的对象文件不会被覆盖。
+func (store *Store) extract(packID string, ids map[string]bool) (err error) {
+	data, err := filelock.ReadFile(filepath.Join(store.Path, "packs", packID))
+	if nil != err {
+		return
+	}
+	entries, err := store.readPackHeader(data)
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		if !ids[entry.ID] {
+			continue
+		}
+
+		dir, file := store.AbsPath(entry.ID)
+		if gulu.File.IsExist(file) {
+			continue
+		}
+		if err = os.MkdirAll(dir, 0755); nil != err {
+			return
+		}
+		if err = filelock.WriteFile(file, data[entry.Offset:entry.Offset+entry.Length]); nil != err {
+			return
+		}
+	}
+	return
+}
+
+// purgePacks 清理本地包文件：包含未引用对象或者对象已经存在单个对象文件的包文件会被删除，其中被引用的对象先释放为单个对象文件。
+func (store *Store) purgePacks(referencedIDs map[string]bool, stat *PurgeStat) (err error) {
+	store.packLock.Lock()
+	defer store.packLock.Unlock()
+	if err = store.loadPacks(); nil != err {
+		return
+	}
+	defer func() { store.packs = nil }()
+
+	packs := map[string][]string{}
+	for id, packID := range store.packs {
+		packs[packID] = append(packs[packID], id)
+	}
+
+	for packID, ids := range packs {
+		var entries []*packEntry
+		if entries, err = store.readPackFileHeader(packID); nil != err {
+			return
+		}
+
+		live := map[string]bool{}
+		var garbage bool
+		var unreferencedCount int
+		var unreferencedSize int64
+		for _, entry := range entries {
+			_, file := store.AbsPath(entry.ID)
+			if gulu.File.IsExist(file) {
+				garbage = true
+				continue
+			}
+			if referencedIDs[entry.ID] {
+				live[entry.ID] = true
+				continue
+			}
+			garbage = true
+			unreferencedCount++
+			unreferencedSize += entry.Length
+		}
+		if !garbage {
+			continue
+		}
+
+		if err = store.extract(packID, live); nil != err {
+			return
+		}
+		if err = filelock.Remove(filepath.Join(store.Path, "packs", packID)); nil != err {
+			return
+		}
+		stat.Objects += unreferencedCount
+		stat.Size += unreferencedSize
+		logging.LogInfof("purged pack [%s], extracted [%d/%d] objects", packID, len(live), len(ids))
+	}
+	return
+}
+
+// dissolvePacks 将本地包文件中的对象全部释放为单个对象文件，然后删除包文件。
+func (store *Store) dissolvePacks() (err error) {
+	store.packLock.Lock()
+	defer store.packLock.Unlock()
+	if err = store.loadPacks(); nil != err {
+		return
+	}
+	defer func() { store.packs = nil }()
+
+	packs := map[string]map[string]bool{}
+	for id, packID := range store.packs {
+		if nil == packs[packID] {
+			packs[packID] = map[string]bool{}
+		}
+		packs[packID][id] = true
+	}
+	for packID, ids := range packs {
+		if err = store.extract(packID, ids); nil != err {
+			return
+		}
+		if err = filelock.Remove(filepath.Join(store.Path, "packs", packID)); nil != err {
+			return
+		}
+	}
+	return
+}
+
+// readPackFileHeader 仅读取本地包文件 packID 末尾的包头。
+func (store *Store) readPackFileHeader(packID string) (ret []*packEntry, err error) {
+	file, err := os.Open(filepath.Join(store.Path, "packs", packID))
+	if nil != err {
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if nil != err {
+		return
+	}
+	size := info.Size()
+	if 4 > size {
+		err = ErrInvalidPack
+		return
+	}
+	headerLen := make([]byte, 4)
+	if _, err = file.ReadAt(headerLen, size-4); nil != err {
+		return
+	}
+	headerStart := size - 4 - int64(binary.BigEndian.Uint32(headerLen))
+	if 0 > headerStart {
+		err = ErrInvalidPack
+		return
+	}
+
+	header := make([]byte, size-4-headerStart)
+	if _, err = file.ReadAt(header, headerStart); nil != err {
+		return
+	}
+	ret, err = store.decodePackHeader(header, headerStart)
+	return
+}
+
+func (store *Store) readPackHeader(data []byte) (ret []*packEntry, err error) {
+	if 4 > len(data) {
+		err = ErrInvalidPack
+		return
+	}
+
+	headerLen := int(binary.BigEndian.Uint32(data[len(data)-4:]))
+	headerStart := len(data) - 4 - headerLen
+	if 0 > headerStart {
+		err = ErrInvalidPack
+		return
+	}
+
+	ret, err = store.decodePackHeader(data[headerStart:len(data)-4], int64(headerStart))
+	return
+}
+
+// decodePackHeader 解码包头 header 并校验对象范围都在包头起始位置 headerStart 之前。
+func (store *Store) decodePackHeader(header []byte, headerStart int64) (ret []*packEntry, err error) {
+	header, err = store.compressDecoder.DecodeAll(header, nil)
+	if nil != err {
+		return
+	}
+	if err = gulu.JSON.UnmarshalJSON(header, &ret); nil != err {
+		return
+	}
+	for _, entry := range ret {
+		if 0 > entry.Offset || 0 > entry.Length || headerStart < entry.Offset+entry.Length {
+			err = ErrInvalidPack
+			return
+		}
+	}
+	return
+}
+
+// verifyObject 校验解码后的对象数据是否和对象 ID 匹配，分块校验内容哈希，文件校验路径和更新时间哈希。
+func (store *Store) verifyObject(id string, data []byte) bool {
+	if id == util.Hash(data) {
+		return true
+	}
+
+	file := &entity.File{}
+	if err := gulu.JSON.UnmarshalJSON(data, file); nil != err {
+		return false
+	}
+	return id == file.ID && id == entity.NewFile(file.Path, file.Size, file.Updated).ID
+}
@@ -47,10 +47,14 @@ type Repo struct {
 	DeviceName  string   // 设备名称
 	DeviceOS    string   // 操作系统
 	IgnoreLines []string // 忽略配置文件内容行，是用 .gitignore 语法
+	UsePack     bool     // 是否将小对象合并为包文件上传到云端
 
 	store    *Store      // 仓库的存储
 	chunkPol chunker.Pol // 文件分块多项式值
 	cloud    cloud.Cloud // 云端存储服务
+
+	concurrency int              // 云端传输并发数
+	transfer    *transferJournal // 当前同步的传输记录
 }
 
 // NewRepo 创建一个新的仓库。
@@ -249,6 +253,65 @@ func (repo *Repo) Checkout(id string, context map[string]interface{}) (upserts,
 	return
 }
 
+// CheckoutPaths 将仓库中快照 id 里路径匹配 pathPrefixes 的文件迁出到 repo 数据文件夹下，不会改动其他文件。
+//
+// pathPrefixes 中的路径相对于数据文件夹并以 / 开头，可以是单个文件（如 /20230101000000-abcdefg/foo.sy）
+// 或者文件夹（如 /20230101000000-abcdefg、/assets）。已经和快照中一致的文件会被跳过。context 参数用于发布事件时传递调用上下文。
+func (repo *Repo) CheckoutPaths(id string, pathPrefixes []string, context map[string]interface{}) (upserts []*entity.File, err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var prefixes []string
+	for _, prefix := range pathPrefixes {
+		prefix = "/" + strings.Trim(filepath.ToSlash(prefix), "/")
+		if "/" == prefix {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if 1 > len(prefixes) {
+		err = errors.New("empty checkout paths")
+		return
+	}
+
+	index, err := repo.store.GetIndex(id)
+	if nil != err {
+		return
+	}
+
+	files, err := repo.getFiles(index.Files)
+	if nil != err {
+		return
+	}
+
+	for _, file := range files {
+		if !matchPathPrefixes(file.Path, prefixes) {
+			continue
+		}
+
+		if info, statErr := os.Stat(repo.absPath(file.Path)); nil == statErr && !info.IsDir() &&
+			info.Size() == file.Size && info.ModTime().UnixMilli() == file.Updated {
+			continue
+		}
+		upserts = append(upserts, file)
+	}
+	if 1 > len(upserts) {
+		return
+	}
+
+	err = repo.checkoutFiles(upserts, context)
+	return
+}
+
+func matchPathPrefixes(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // Index 将 repo 数据文件夹中的文件索引到仓库中。context 参数用于发布事件时传递调用上下文。
 func (repo *Repo) Index(memo string, context map[string]interface{}) (ret *entity.Index, err error) {
 	lock.Lock()
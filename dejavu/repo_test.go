@@ -36,6 +36,7 @@ const (
 	testTempPath         = "testdata/temp"
 	testDataPath         = "testdata/data"
 	testDataCheckoutPath = "testdata/data-checkout"
+	testCloudPath        = "testdata/cloud"
 )
 
 var (
@@ -91,6 +92,57 @@ func TestIndexCheckout(t *testing.T) {
 	}
 }
 
+func TestCheckoutPaths(t *testing.T) {
+	clearTestdata(t)
+
+	repo, index := initIndex(t)
+	aesKey := repo.store.AesKey
+	if err := os.RemoveAll(testDataCheckoutPath); nil != err {
+		t.Fatalf("remove failed: %s", err)
+		return
+	}
+	if err := os.MkdirAll(testDataCheckoutPath, 0755); nil != err {
+		t.Fatalf("mkdir failed: %s", err)
+		return
+	}
+	other := filepath.Join(testDataCheckoutPath, "other")
+	if err := gulu.File.WriteFileSafer(other, []byte("other"), 0644); nil != err {
+		t.Fatalf("write file failed: %s", err)
+		return
+	}
+
+	repo, err := NewRepo(testDataCheckoutPath, testRepoPath, testHistoryPath, testTempPath, deviceID, deviceName, deviceOS, aesKey, ignoreLines(), nil)
+	if nil != err {
+		t.Fatalf("new repo failed: %s", err)
+		return
+	}
+	upserts, err := repo.CheckoutPaths(index.ID, []string{"/fo"}, map[string]interface{}{})
+	if nil != err || 0 != len(upserts) {
+		t.Fatalf("checkout paths should not match prefix of file name")
+		return
+	}
+
+	upserts, err = repo.CheckoutPaths(index.ID, []string{"/foo"}, map[string]interface{}{})
+	if nil != err {
+		t.Fatalf("checkout paths failed: %s", err)
+		return
+	}
+	if 1 != len(upserts) || !gulu.File.IsExist(filepath.Join(testDataCheckoutPath, "foo")) {
+		t.Fatalf("checkout paths failed")
+		return
+	}
+	if !gulu.File.IsExist(other) {
+		t.Fatalf("checkout paths should not touch other files")
+		return
+	}
+
+	upserts, err = repo.CheckoutPaths(index.ID, []string{"/foo"}, map[string]interface{}{})
+	if nil != err || 0 != len(upserts) {
+		t.Fatalf("unchanged file should be skipped")
+		return
+	}
+}
+
 func clearTestdata(t *testing.T) {
 	err := os.RemoveAll(testRepoPath)
 	if nil != err {
@@ -0,0 +1,465 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/dejavu/util"
+	"github.com/wangxu0213/esnote-kernel/encryption"
+	"github.com/wangxu0213/esnote-kernel/eventbus"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+var ErrRotateKeyMismatch = errors.New("rotate key mismatch with the unfinished rotation")
+
+// rotateKeyJournal 记录了密钥轮换进度，用于中断后继续。
+type rotateKeyJournal struct {
+	KeyHash    string          `json:"keyHash"`    // 新密钥的哈希，用于校验继续轮换时使用的是同一个密钥
+	Dirs       map[string]bool `json:"dirs"`       // 已经完成的本地 objects 子文件夹
+	CloudDirs  map[string]bool `json:"cloudDirs"`  // 已经完成的云端单个对象所在的 objects 子文件夹
+	CloudPacks map[string]bool `json:"cloudPacks"` // 已经使用新密钥重新生成的云端包文件
+}
+
+// RotateKey 使用新密钥 newKey 重新加密仓库中的所有文件和分块，索引没有加密所以不需要处理，对象 ID 和快照 ID 保持不变。
+//
+// 进度记录在仓库文件夹下的 rotate-key.json 中，中断后使用同一个新密钥再次调用即可继续，完成后仓库改为使用新密钥。
+// withCloud 为 true 时还会重新加密云端仓库中的对象，云端索引引用的、本地仓库中没有的对象会先下载到本地再一起重新加密，
+// 避免云端残留使用旧密钥加密的对象。context 参数用于发布事件时传递调用上下文。
+func (repo *Repo) RotateKey(newKey []byte, withCloud bool, context map[string]interface{}) (err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if 32 != len(newKey) {
+		err = errors.New("invalid key")
+		return
+	}
+
+	oldKey := repo.store.AesKey
+	journal, err := repo.readRotateKeyJournal(newKey)
+	if nil != err {
+		return
+	}
+	if err = repo.writeRotateKeyJournal(journal); nil != err {
+		return
+	}
+
+	withCloud = withCloud && nil != repo.cloud
+	if withCloud {
+		if err = repo.tryLockCloud(context); nil != err {
+			return
+		}
+		defer repo.unlockCloud(context)
+
+		var fetched []string
+		if fetched, err = repo.fetchCloudObjects(oldKey, newKey, context); nil != err {
+			logging.LogErrorf("fetch cloud objects failed: %s", err)
+			return
+		}
+		// 新下载的对象所在的文件夹需要重新处理
+		for _, id := range fetched {
+			delete(journal.Dirs, id[:2])
+			delete(journal.CloudDirs, id[:2])
+		}
+		if err = repo.writeRotateKeyJournal(journal); nil != err {
+			return
+		}
+	}
+
+	// 本地包文件中的对象先释放为单个对象文件，然后和其他对象一起重新加密
+	if err = repo.store.dissolvePacks(); nil != err {
+		return
+	}
+
+	objectsDir := filepath.Join(repo.Path, "objects")
+	var dirs []string
+	if gulu.File.IsDir(objectsDir) {
+		entries, readErr := os.ReadDir(objectsDir)
+		if nil != readErr {
+			err = readErr
+			return
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && 2 == len(entry.Name()) {
+				dirs = append(dirs, entry.Name())
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		if journal.Dirs[dir] {
+			continue
+		}
+
+		eventbus.Publish(eventbus.EvtRotateKeyObjectsDir, context, dir)
+		if err = rotateObjectsDir(filepath.Join(objectsDir, dir), oldKey, newKey); nil != err {
+			logging.LogErrorf("rotate key for objects dir [%s] failed: %s", dir, err)
+			return
+		}
+		journal.Dirs[dir] = true
+		if err = repo.writeRotateKeyJournal(journal); nil != err {
+			return
+		}
+	}
+
+	if withCloud {
+		if err = repo.rotateCloudKey(dirs, oldKey, newKey, journal, context); nil != err {
+			logging.LogErrorf("rotate cloud key failed: %s", err)
+			return
+		}
+	}
+
+	repo.store.AesKey = newKey
+	fileCache.Clear()
+	err = os.RemoveAll(filepath.Join(repo.Path, "rotate-key.json"))
+	logging.LogInfof("rotated repo key, re-encrypted [%d] objects dirs", len(dirs))
+	return
+}
+
+// rotateObjectsDir 重新加密 dir 下的对象，已经使用新密钥加密的对象会被跳过。
+func rotateObjectsDir(dir string, oldKey, newKey []byte) (err error) {
+	entries, err := os.ReadDir(dir)
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		p := filepath.Join(dir, entry.Name())
+		data, readErr := filelock.ReadFile(p)
+		if nil != readErr {
+			err = readErr
+			return
+		}
+
+		rotated, changed, rotateErr := rotateObjectData(data, oldKey, newKey)
+		if nil != rotateErr {
+			err = rotateErr
+			logging.LogErrorf("rotate object [%s] failed: %s", p, err)
+			return
+		}
+		if !changed {
+			continue
+		}
+		if err = filelock.WriteFile(p, rotated); nil != err {
+			return
+		}
+	}
+	return
+}
+
+// rotateObjectData 将使用旧密钥加密的对象数据改为使用新密钥加密，已经使用新密钥加密时 changed 为 false。
+func rotateObjectData(data, oldKey, newKey []byte) (ret []byte, changed bool, err error) {
+	if _, decErr := encryption.AesDecrypt(data, newKey); nil == decErr {
+		return data, false, nil
+	}
+
+	plain, err := encryption.AesDecrypt(data, oldKey)
+	if nil != err {
+		return
+	}
+	ret, err = encryption.AesEncrypt(plain, newKey)
+	changed = nil == err
+	return
+}
+
+// fetchCloudObjects 将云端索引引用的、本地仓库中没有的文件和分块下载到本地仓库，返回下载的对象 ID。
+//
+// 单个对象按照原始数据保存，包文件中的对象随包文件保存到本地后由 dissolvePacks 释放。
+// 中断后继续时对象可能已经使用新密钥加密，所以读取文件时两个密钥都会尝试。
+func (repo *Repo) fetchCloudObjects(oldKey, newKey []byte, context map[string]interface{}) (ret []string, err error) {
+	fileIDs, _, err := repo.cloud.GetRefsFiles()
+	if nil != err {
+		return
+	}
+	for page := 1; ; page++ {
+		indexes, pageCount, _, getErr := repo.cloud.GetIndexes(page)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		for _, index := range indexes {
+			var cloudIndex *entity.Index
+			if _, cloudIndex, err = repo.downloadCloudIndex(index.ID, context); nil != err {
+				return
+			}
+			fileIDs = append(fileIDs, cloudIndex.Files...)
+		}
+		if page >= pageCount {
+			break
+		}
+	}
+	fileIDs = gulu.Str.RemoveDuplicatedElem(fileIDs)
+
+	fetchedFiles, err := repo.fetchMissingObjects(fileIDs, context)
+	if nil != err {
+		return
+	}
+	ret = append(ret, fetchedFiles...)
+
+	var chunkIDs []string
+	for _, fileID := range fileIDs {
+		_, p := repo.store.AbsPath(fileID)
+		data, readErr := filelock.ReadFile(p)
+		if nil != readErr {
+			err = readErr
+			return
+		}
+		if data, err = repo.decodeRotatingData(data, oldKey, newKey); nil != err {
+			logging.LogErrorf("decode file [%s] failed: %s", fileID, err)
+			return
+		}
+		file := &entity.File{}
+		if err = gulu.JSON.UnmarshalJSON(data, file); nil != err {
+			return
+		}
+		chunkIDs = append(chunkIDs, file.Chunks...)
+	}
+	chunkIDs = gulu.Str.RemoveDuplicatedElem(chunkIDs)
+
+	fetchedChunks, err := repo.fetchMissingObjects(chunkIDs, context)
+	if nil != err {
+		return
+	}
+	ret = append(ret, fetchedChunks...)
+	logging.LogInfof("fetched [%d] cloud objects missing locally before rotating key", len(ret))
+	return
+}
+
+// fetchMissingObjects 从云端下载 ids 中本地仓库没有的对象，返回下载的对象 ID。
+func (repo *Repo) fetchMissingObjects(ids []string, context map[string]interface{}) (ret []string, err error) {
+	var missing []string
+	for _, id := range ids {
+		if err = repo.store.resolve(id); nil != err {
+			return
+		}
+		if _, p := repo.store.AbsPath(id); !gulu.File.IsExist(p) {
+			missing = append(missing, id)
+		}
+	}
+	if 1 > len(missing) {
+		return
+	}
+
+	_, objects, remains, err := repo.downloadPacked(missing, context)
+	if nil != err {
+		return
+	}
+	for id := range objects {
+		if err = repo.store.resolve(id); nil != err {
+			return
+		}
+		ret = append(ret, id)
+	}
+
+	for _, id := range remains {
+		var data []byte
+		if data, err = repo.cloud.DownloadObject(path.Join("objects", id[:2], id[2:])); nil != err {
+			logging.LogErrorf("download cloud object [%s] failed: %s", id, err)
+			return
+		}
+		dir, p := repo.store.AbsPath(id)
+		if err = os.MkdirAll(dir, 0755); nil != err {
+			return
+		}
+		if err = filelock.WriteFile(p, data); nil != err {
+			return
+		}
+		ret = append(ret, id)
+	}
+	return
+}
+
+// decodeRotatingData 解码使用旧密钥或者新密钥加密的对象数据。
+func (repo *Repo) decodeRotatingData(data, oldKey, newKey []byte) (ret []byte, err error) {
+	plain, err := encryption.AesDecrypt(data, newKey)
+	if nil != err {
+		if plain, err = encryption.AesDecrypt(data, oldKey); nil != err {
+			return
+		}
+	}
+	ret, err = repo.store.compressDecoder.DecodeAll(plain, nil)
+	return
+}
+
+func (repo *Repo) rotateCloudKey(dirs []string, oldKey, newKey []byte, journal *rotateKeyJournal, context map[string]interface{}) (err error) {
+	// 云端的单个对象使用本地已经重新加密的对象覆盖
+	objectsDir := filepath.Join(repo.Path, "objects")
+	for _, dir := range dirs {
+		if journal.CloudDirs[dir] {
+			continue
+		}
+
+		eventbus.Publish(eventbus.EvtRotateKeyObjectsDir, context, dir)
+		entries, readErr := os.ReadDir(filepath.Join(objectsDir, dir))
+		if nil != readErr {
+			err = readErr
+			return
+		}
+		var ids []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				ids = append(ids, dir+entry.Name())
+			}
+		}
+
+		missing := map[string]bool{}
+		if 0 < len(ids) {
+			var m []string
+			if m, err = repo.cloud.GetChunks(ids); nil != err {
+				return
+			}
+			for _, id := range m {
+				missing[objectIDFromKey(id)] = true
+			}
+		}
+
+		for _, id := range ids {
+			if missing[id] {
+				continue
+			}
+			if err = repo.cloud.UploadObject(path.Join("objects", id[:2], id[2:]), true); nil != err {
+				return
+			}
+		}
+
+		journal.CloudDirs[dir] = true
+		if err = repo.writeRotateKeyJournal(journal); nil != err {
+			return
+		}
+	}
+
+	// 云端的包文件重新生成
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err {
+		return
+	}
+	for packID, ids := range packs.Packs {
+		if journal.CloudPacks[packID] {
+			continue
+		}
+
+		eventbus.Publish(eventbus.EvtRotateKeyCloudPack, context, packID)
+		var data []byte
+		if data, err = repo.cloud.DownloadObject(path.Join("packs", packID)); nil != err {
+			return
+		}
+		var entries []*packEntry
+		if entries, err = repo.store.readPackHeader(data); nil != err {
+			return
+		}
+
+		objects := map[string][]byte{}
+		for _, entry := range entries {
+			if objects[entry.ID], _, err = rotateObjectData(data[entry.Offset:entry.Offset+entry.Length], oldKey, newKey); nil != err {
+				return
+			}
+		}
+
+		var newPackID string
+		if newPackID, _, err = repo.store.writePackObjects(objects); nil != err {
+			return
+		}
+		if newPackID == packID {
+			// 上次中断前已经重新生成了该包文件但是没有记录进度，包文件 ID 由内容决定，所以不能上传后再删除
+			_ = os.Remove(filepath.Join(repo.Path, "packs", newPackID))
+			journal.CloudPacks[packID] = true
+			if err = repo.writeRotateKeyJournal(journal); nil != err {
+				return
+			}
+			continue
+		}
+
+		err = repo.cloud.UploadObject(path.Join("packs", newPackID), false)
+		_ = os.Remove(filepath.Join(repo.Path, "packs", newPackID))
+		if nil != err {
+			return
+		}
+
+		delete(packs.Packs, packID)
+		packs.add(newPackID, ids)
+		if _, err = repo.uploadCloudPacks(packs); nil != err {
+			return
+		}
+
+		// 先记录进度再删除旧的包文件，中断后包索引引用的包文件总是存在
+		journal.CloudPacks[newPackID] = true
+		if err = repo.writeRotateKeyJournal(journal); nil != err {
+			return
+		}
+		if err = repo.cloud.RemoveObject(path.Join("packs", packID)); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func (repo *Repo) readRotateKeyJournal(newKey []byte) (ret *rotateKeyJournal, err error) {
+	keyHash := util.Hash(newKey)
+	ret = &rotateKeyJournal{KeyHash: keyHash, Dirs: map[string]bool{}, CloudDirs: map[string]bool{}, CloudPacks: map[string]bool{}}
+	journalPath := filepath.Join(repo.Path, "rotate-key.json")
+	if !gulu.File.IsExist(journalPath) {
+		return
+	}
+
+	data, err := filelock.ReadFile(journalPath)
+	if nil != err {
+		return
+	}
+	journal := &rotateKeyJournal{}
+	if err = gulu.JSON.UnmarshalJSON(data, journal); nil != err {
+		return
+	}
+	if keyHash != journal.KeyHash {
+		err = ErrRotateKeyMismatch
+		return
+	}
+
+	for dir := range journal.Dirs {
+		ret.Dirs[dir] = true
+	}
+	for dir := range journal.CloudDirs {
+		ret.CloudDirs[dir] = true
+	}
+	for packID := range journal.CloudPacks {
+		ret.CloudPacks[packID] = true
+	}
+	return
+}
+
+func (repo *Repo) writeRotateKeyJournal(journal *rotateKeyJournal) (err error) {
+	data, err := gulu.JSON.MarshalJSON(journal)
+	if nil != err {
+		return
+	}
+	err = filelock.WriteFile(filepath.Join(repo.Path, "rotate-key.json"), data)
+	return
+}
+
+// IsRotatingKey 判断仓库是否存在未完成的密钥轮换。
+func (repo *Repo) IsRotatingKey() bool {
+	return gulu.File.IsExist(filepath.Join(repo.Path, "rotate-key.json"))
+}
@@ -0,0 +1,208 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/wangxu0213/esnote-kernel/dejavu/cloud"
+	"github.com/wangxu0213/esnote-kernel/encryption"
+)
+
+func TestRotateKey(t *testing.T) {
+	clearTestdata(t)
+
+	repo, index := initIndex(t)
+	oldKey := repo.store.AesKey
+	newKey, err := encryption.KDF("new password", "new salt")
+	if nil != err {
+		t.Fatalf("kdf failed: %s", err)
+		return
+	}
+
+	if err = repo.RotateKey(newKey, false, map[string]interface{}{}); nil != err {
+		t.Fatalf("rotate key failed: %s", err)
+		return
+	}
+	if repo.IsRotatingKey() {
+		t.Fatalf("rotate key journal should be removed")
+		return
+	}
+
+	result, err := repo.Check(false, map[string]interface{}{})
+	if nil != err || !result.IsOK() {
+		t.Fatalf("check after rotate key failed: %v", err)
+		return
+	}
+	if _, _, err = repo.Checkout(index.ID, map[string]interface{}{}); nil != err {
+		t.Fatalf("checkout failed: %s", err)
+		return
+	}
+
+	// 使用旧密钥无法读取
+	oldRepo, err := NewRepo(testDataPath, testRepoPath, testHistoryPath, testTempPath, deviceID, deviceName, deviceOS, oldKey, ignoreLines(), nil)
+	if nil != err {
+		t.Fatalf("new repo failed: %s", err)
+		return
+	}
+	result, err = oldRepo.Check(false, map[string]interface{}{})
+	if nil != err || 1 > len(result.CorruptObjects) {
+		t.Fatalf("objects should not be decrypted by old key")
+		return
+	}
+
+	// 未完成的轮换只能使用同一个新密钥继续
+	if err = oldRepo.writeRotateKeyJournal(&rotateKeyJournal{KeyHash: "unknown"}); nil != err {
+		t.Fatalf("write journal failed: %s", err)
+		return
+	}
+	if err = repo.RotateKey(oldKey, false, map[string]interface{}{}); !errors.Is(err, ErrRotateKeyMismatch) {
+		t.Fatalf("rotate key should be mismatched")
+		return
+	}
+}
+
+func TestRotateCloudKey(t *testing.T) {
+	clearTestdata(t)
+	defer os.RemoveAll(testCloudPath)
+
+	repo, index := initIndex(t)
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	repo.cloud = cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{
+		Dir:           "test",
+		UserID:        "0",
+		RepoPath:      repo.Path,
+		AvailableSize: 1024 * 1024 * 1024 * 8,
+		Local:         &cloud.ConfLocal{Endpoint: cloudPath},
+	}})
+	if _, _, err = repo.Sync(nil); nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	// 云端存在但本地没有的对象也需要重新加密
+	cloudOnlyID := index.Files[0]
+	if err = repo.store.Remove(cloudOnlyID); nil != err {
+		t.Fatalf("remove object failed: %s", err)
+		return
+	}
+
+	newKey, err := encryption.KDF("new password", "new salt")
+	if nil != err {
+		t.Fatalf("kdf failed: %s", err)
+		return
+	}
+	if err = repo.RotateKey(newKey, true, map[string]interface{}{}); nil != err {
+		t.Fatalf("rotate key failed: %s", err)
+		return
+	}
+
+	data, err := repo.cloud.DownloadObject(path.Join("objects", cloudOnlyID[:2], cloudOnlyID[2:]))
+	if nil != err {
+		t.Fatalf("download cloud object failed: %s", err)
+		return
+	}
+	if _, err = encryption.AesDecrypt(data, newKey); nil != err {
+		t.Fatalf("cloud object should be encrypted by new key: %s", err)
+		return
+	}
+	if _, err = repo.store.GetFile(cloudOnlyID); nil != err {
+		t.Fatalf("cloud object should be fetched to local: %s", err)
+		return
+	}
+}
+
+func TestRotateCloudKeyResume(t *testing.T) {
+	clearTestdata(t)
+	defer os.RemoveAll(testCloudPath)
+
+	repo, _ := initIndex(t)
+	repo.UsePack = true
+	oldKey := repo.store.AesKey
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	repo.cloud = cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{
+		Dir:           "test",
+		UserID:        "0",
+		RepoPath:      repo.Path,
+		AvailableSize: 1024 * 1024 * 1024 * 8,
+		Local:         &cloud.ConfLocal{Endpoint: cloudPath},
+	}})
+	if _, _, err = repo.Sync(nil); nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	newKey, err := encryption.KDF("new password", "new salt")
+	if nil != err {
+		t.Fatalf("kdf failed: %s", err)
+		return
+	}
+	if err = repo.RotateKey(newKey, true, map[string]interface{}{}); nil != err {
+		t.Fatalf("rotate key failed: %s", err)
+		return
+	}
+
+	// 模拟包文件和包索引已经上传但是进度还没有记录时中断
+	journal, err := repo.readRotateKeyJournal(newKey)
+	if nil != err {
+		t.Fatalf("read journal failed: %s", err)
+		return
+	}
+	entries, err := os.ReadDir(filepath.Join(repo.Path, "objects"))
+	if nil != err {
+		t.Fatalf("read objects dir failed: %s", err)
+		return
+	}
+	for _, entry := range entries {
+		journal.Dirs[entry.Name()] = true
+		journal.CloudDirs[entry.Name()] = true
+	}
+	if err = repo.writeRotateKeyJournal(journal); nil != err {
+		t.Fatalf("write journal failed: %s", err)
+		return
+	}
+	repo.store.AesKey = oldKey
+
+	if err = repo.RotateKey(newKey, true, map[string]interface{}{}); nil != err {
+		t.Fatalf("resume rotate key failed: %s", err)
+		return
+	}
+
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err || 1 > len(packs.Packs) {
+		t.Fatalf("cloud packs not match")
+		return
+	}
+	for packID := range packs.Packs {
+		if _, err = repo.cloud.DownloadObject(path.Join("packs", packID)); nil != err {
+			t.Fatalf("cloud pack [%s] should not be removed: %s", packID, err)
+			return
+		}
+	}
+}
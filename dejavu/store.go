@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/88250/gulu"
@@ -41,6 +42,9 @@ type Store struct {
 
 	compressEncoder *zstd.Encoder
 	compressDecoder *zstd.Decoder
+
+	packs    map[string]string // 对象 ID -> 本地包文件 ID，nil 表示还没有加载
+	packLock sync.Mutex
 }
 
 func NewStore(path string, aesKey []byte) (ret *Store, err error) {
@@ -59,6 +63,12 @@ func NewStore(path string, aesKey []byte) (ret *Store, err error) {
 }
 
 func (store *Store) Purge() (ret *PurgeStat, err error) {
+	return store.purge(nil)
+}
+
+// purge 清理未引用的索引和对象，retainIndexIDs 中的索引和引用（refs）中的索引一样会被保留。
+func (store *Store) purge(retainIndexIDs map[string]bool) (ret *PurgeStat, err error) {
+	ret = &PurgeStat{}
 	objectsDir := filepath.Join(store.Path, "objects")
 	if !gulu.File.IsDir(objectsDir) {
 		return
@@ -111,6 +121,9 @@ func (store *Store) Purge() (ret *PurgeStat, err error) {
 	if nil != err {
 		return
 	}
+	for indexID := range retainIndexIDs {
+		refIndexIDs[indexID] = true
+	}
 
 	unreferencedIndexIDs := map[string]bool{}
 	for indexID := range indexIDs {
@@ -141,6 +154,10 @@ func (store *Store) Purge() (ret *PurgeStat, err error) {
 		}
 	}
 
+	if err = store.purgePacks(referencedObjIDs, ret); nil != err {
+		return
+	}
+
 	unreferencedIDs := map[string]bool{}
 	for objID := range objIDs {
 		if !referencedObjIDs[objID] {
@@ -148,7 +165,6 @@ func (store *Store) Purge() (ret *PurgeStat, err error) {
 		}
 	}
 
-	ret = &PurgeStat{}
 	ret.Indexes = len(unreferencedIndexIDs)
 
 	for unreferencedID := range unreferencedIDs {
@@ -307,6 +323,9 @@ func (store *Store) GetFile(id string) (ret *entity.File, err error) {
 		return
 	}
 
+	if err = store.resolve(id); nil != err {
+		return
+	}
 	_, file := store.AbsPath(id)
 	data, err := filelock.ReadFile(file)
 	if nil != err {
@@ -352,6 +371,9 @@ func (store *Store) PutChunk(chunk *entity.Chunk) (err error) {
 }
 
 func (store *Store) GetChunk(id string) (ret *entity.Chunk, err error) {
+	if err = store.resolve(id); nil != err {
+		return
+	}
 	_, file := store.AbsPath(id)
 	data, err := filelock.ReadFile(file)
 	if nil != err {
@@ -371,6 +393,9 @@ func (store *Store) Remove(id string) (err error) {
 }
 
 func (store *Store) Stat(id string) (stat os.FileInfo, err error) {
+	if err = store.resolve(id); nil != err {
+		return
+	}
 	_, file := store.AbsPath(id)
 	stat, err = os.Stat(file)
 	return
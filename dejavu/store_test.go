@@ -18,8 +18,11 @@ package dejavu
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/88250/gulu"
 	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
 	"github.com/wangxu0213/esnote-kernel/dejavu/util"
 	"github.com/wangxu0213/esnote-kernel/encryption"
@@ -70,3 +73,120 @@ func TestPutGet(t *testing.T) {
 		return
 	}
 }
+
+func TestPutGetPacked(t *testing.T) {
+	clearTestdata(t)
+
+	aesKey, err := encryption.KDF(testRepoPassword, testRepoPasswordSalt)
+	if nil != err {
+		t.Fatalf("kdf failed: %s", err)
+		return
+	}
+
+	store, err := NewStore(testRepoPath, aesKey)
+	if nil != err {
+		t.Fatalf("new store failed: %s", err)
+		return
+	}
+
+	var ids []string
+	for _, data := range []string{"foo", "bar", "baz"} {
+		chunk := &entity.Chunk{ID: util.Hash([]byte(data)), Data: []byte(data)}
+		if err = store.PutChunk(chunk); nil != err {
+			t.Fatalf("put failed: %s", err)
+			return
+		}
+		ids = append(ids, chunk.ID)
+	}
+
+	// 模拟从云端下载包文件：本地只有包文件，没有单个对象文件
+	packID, _, err := store.writePack(ids)
+	if nil != err {
+		t.Fatalf("write pack failed: %s", err)
+		return
+	}
+	packPath := filepath.Join(testRepoPath, "packs", packID)
+	packData, err := os.ReadFile(packPath)
+	if nil != err {
+		t.Fatalf("read pack failed: %s", err)
+		return
+	}
+	putPack := func() {
+		for _, id := range ids {
+			store.Remove(id)
+		}
+		store.packs = nil
+		objects, putErr := store.putPack(packID, packData, map[string]bool{ids[0]: true})
+		if nil != putErr {
+			t.Fatalf("put pack failed: %s", putErr)
+			return
+		}
+		if 1 != len(objects) || "foo" != string(objects[ids[0]]) {
+			t.Fatalf("put pack objects not match")
+			return
+		}
+	}
+	putPack()
+
+	// 读取时从包文件中释放对象
+	chunk, err := store.GetChunk(ids[1])
+	if nil != err || "bar" != string(chunk.Data) {
+		t.Fatalf("get packed chunk failed: %v", err)
+		return
+	}
+	if _, err = store.Stat(ids[2]); nil != err {
+		t.Fatalf("stat packed chunk failed: %s", err)
+		return
+	}
+
+	cases := []struct {
+		name       string
+		referenced map[string]bool
+		purged     int
+		removed    bool
+	}{
+		{"all referenced", map[string]bool{ids[0]: true, ids[1]: true, ids[2]: true}, 0, false},
+		{"partially referenced", map[string]bool{ids[0]: true}, 2, true},
+		{"unreferenced", map[string]bool{}, 3, true},
+	}
+	for _, c := range cases {
+		putPack()
+		stat := &PurgeStat{}
+		if err = store.purgePacks(c.referenced, stat); nil != err {
+			t.Fatalf("[%s] purge packs failed: %s", c.name, err)
+			return
+		}
+		if c.purged != stat.Objects {
+			t.Fatalf("[%s] purged objects [%d] not match", c.name, stat.Objects)
+			return
+		}
+		if c.removed == gulu.File.IsExist(packPath) {
+			t.Fatalf("[%s] pack removal not match", c.name)
+			return
+		}
+		for id := range c.referenced {
+			if _, err = store.GetChunk(id); nil != err {
+				t.Fatalf("[%s] get referenced chunk failed: %s", c.name, err)
+				return
+			}
+		}
+	}
+
+	// 包中的对象已经全部释放后包文件会被清理
+	putPack()
+	for _, id := range ids {
+		if _, err = store.GetChunk(id); nil != err {
+			t.Fatalf("get packed chunk failed: %s", err)
+			return
+		}
+	}
+	stat := &PurgeStat{}
+	if err = store.purgePacks(map[string]bool{ids[0]: true, ids[1]: true, ids[2]: true}, stat); nil != err {
+		t.Fatalf("purge packs failed: %s", err)
+		return
+	}
+	if 0 != stat.Objects || gulu.File.IsExist(packPath) {
+		t.Fatalf("extracted pack should be removed")
+		return
+	}
+}
@@ -46,6 +46,7 @@ var (
 type MergeResult struct {
 	Time                        time.Time
 	Upserts, Removes, Conflicts []*entity.File
+	Merges                      []*entity.File // 本地和云端都发生变更但是已经通过块级三路合并写入工作区的文件
 }
 
 type DownloadTrafficStat struct {
@@ -131,6 +132,10 @@ func (repo *Repo) sync(context map[string]interface{}) (mergeResult *MergeResult
 		return
 	}
 
+	// 加载传输记录，同步中断后只需要继续传输缺失的对象
+	repo.beginTransfer(cloudLatest.ID)
+	defer func() { repo.finishTransfer(err) }()
+
 	// 计算本地缺失的文件
 	fetchFileIDs, err := repo.localNotFoundFiles(cloudLatest.Files)
 	if nil != err {
@@ -144,6 +149,12 @@ func (repo *Repo) sync(context map[string]interface{}) (mergeResult *MergeResult
 		logging.LogErrorf("download cloud files put failed: %s", err)
 		return
 	}
+
+	// 之前中断的同步中已经下载的文件也需要参与冲突检测
+	if fetchedFiles, err = repo.downloadedFiles(fetchedFiles); nil != err {
+		logging.LogErrorf("get downloaded files failed: %s", err)
+		return
+	}
 	trafficStat.DownloadBytes += length
 	trafficStat.DownloadFileCount += len(fetchFileIDs)
 	trafficStat.APIGet += trafficStat.DownloadFileCount
@@ -271,6 +282,9 @@ func (repo *Repo) sync0(context map[string]interface{},
 		}
 	}
 
+	// 对冲突的 .sy 文件尝试进行块级三路合并，合并成功的文件不再生成冲突文档
+	mergeResult.Merges, mergeResult.Conflicts = repo.mergeSyConflicts(mergeResult.Conflicts, localUpserts, latestSyncFiles)
+
 	// 计算能够无冲突合并的 remove，冲突的文件以本地 upsert 为准
 	for _, cloudRemove := range cloudRemoves {
 		if !repo.existDataFile(localUpserts, cloudRemove) {
@@ -342,7 +356,7 @@ func (repo *Repo) sync0(context map[string]interface{},
 	}
 
 	// 数据变更后需要还原工作区并创建 merge 快照
-	if 0 < len(mergeResult.Upserts) || 0 < len(mergeResult.Removes) {
+	if 0 < len(mergeResult.Upserts) || 0 < len(mergeResult.Removes) || 0 < len(mergeResult.Merges) {
 		if 0 < len(mergeResult.Upserts) {
 			// 迁出到工作区
 			err = repo.checkoutFiles(mergeResult.Upserts, context)
@@ -533,12 +547,17 @@ func (repo *Repo) downloadCloudChunksPut(chunkIDs []string, context map[string]i
 		return
 	}
 
+	// 先从包文件中下载，不在包文件中的分块再单独下载
+	if downloadBytes, _, chunkIDs, err = repo.downloadPacked(chunkIDs, context); nil != err {
+		return
+	}
+	if 1 > len(chunkIDs) {
+		return
+	}
+
 	waitGroup := &sync.WaitGroup{}
 	var downloadErr error
-	poolSize := 8
-	if poolSize > len(chunkIDs) {
-		poolSize = len(chunkIDs)
-	}
+	poolSize := repo.poolSize(len(chunkIDs))
 	p, err := ants.NewPoolWithFunc(poolSize, func(arg interface{}) {
 		defer waitGroup.Done()
 		if nil != downloadErr {
@@ -586,13 +605,26 @@ func (repo *Repo) downloadCloudFilesPut(fileIDs []string, context map[string]int
 		return
 	}
 
+	// 先从包文件中下载，不在包文件中的文件再单独下载
+	downloadBytes, packed, fileIDs, err := repo.downloadPacked(fileIDs, context)
+	if nil != err {
+		return
+	}
+	for _, data := range packed {
+		file := &entity.File{}
+		if err = gulu.JSON.UnmarshalJSON(data, file); nil != err {
+			return
+		}
+		ret = append(ret, file)
+	}
+	if 1 > len(fileIDs) {
+		return
+	}
+
 	lock := &sync.Mutex{}
 	waitGroup := &sync.WaitGroup{}
 	var downloadErr error
-	poolSize := 8
-	if poolSize > len(fileIDs) {
-		poolSize = len(fileIDs)
-	}
+	poolSize := repo.poolSize(len(fileIDs))
 	p, err := ants.NewPoolWithFunc(poolSize, func(arg interface{}) {
 		defer waitGroup.Done()
 		if nil != downloadErr {
@@ -775,9 +807,47 @@ func (repo *Repo) uploadFiles(upsertFiles []*entity.File, context map[string]int
 		return
 	}
 
+	// 跳过之前中断的同步中已经上传的文件
+	if nil != repo.transfer {
+		var upsertFileIDs []string
+		for _, upsertFile := range upsertFiles {
+			upsertFileIDs = append(upsertFileIDs, upsertFile.ID)
+		}
+		remains := repo.transfer.filterUploaded(upsertFileIDs)
+		var remainFiles []*entity.File
+		for _, upsertFile := range upsertFiles {
+			if gulu.Str.Contains(upsertFile.ID, remains) {
+				remainFiles = append(remainFiles, upsertFile)
+			}
+		}
+		if upsertFiles = remainFiles; 1 > len(upsertFiles) {
+			return
+		}
+	}
+
+	if repo.UsePack {
+		var upsertFileIDs []string
+		for _, upsertFile := range upsertFiles {
+			upsertFileIDs = append(upsertFileIDs, upsertFile.ID)
+		}
+		var remains []string
+		if uploadBytes, _, remains, err = repo.uploadPacked(upsertFileIDs, context); nil != err {
+			return
+		}
+
+		var remainFiles []*entity.File
+		for _, upsertFile := range upsertFiles {
+			if gulu.Str.Contains(upsertFile.ID, remains) {
+				remainFiles = append(remainFiles, upsertFile)
+			}
+		}
+		if upsertFiles = remainFiles; 1 > len(upsertFiles) {
+			return
+		}
+	}
+
 	for _, upsertFile := range upsertFiles {
-		absFilePath := filepath.Join(repo.Path, "objects", upsertFile.ID[:2], upsertFile.ID[2:])
-		info, statErr := os.Stat(absFilePath)
+		info, statErr := repo.store.Stat(upsertFile.ID)
 		if nil != statErr {
 			return
 		}
@@ -787,10 +857,7 @@ func (repo *Repo) uploadFiles(upsertFiles []*entity.File, context map[string]int
 
 	waitGroup := &sync.WaitGroup{}
 	var uploadErr error
-	poolSize := 8
-	if poolSize > len(upsertFiles) {
-		poolSize = len(upsertFiles)
-	}
+	poolSize := repo.poolSize(len(upsertFiles))
 	p, err := ants.NewPoolWithFunc(poolSize, func(arg interface{}) {
 		defer waitGroup.Done()
 		if nil != uploadErr {
@@ -804,6 +871,7 @@ func (repo *Repo) uploadFiles(upsertFiles []*entity.File, context map[string]int
 			uploadErr = uoErr
 			return
 		}
+		repo.transfer.uploaded(upsertFileID)
 	})
 	if nil != err {
 		return
@@ -830,9 +898,22 @@ func (repo *Repo) uploadChunks(upsertChunkIDs []string, context map[string]inter
 		return
 	}
 
+	// 跳过之前中断的同步中已经上传的分块
+	if upsertChunkIDs = repo.transfer.filterUploaded(upsertChunkIDs); 1 > len(upsertChunkIDs) {
+		return
+	}
+
+	if repo.UsePack {
+		if uploadBytes, _, upsertChunkIDs, err = repo.uploadPacked(upsertChunkIDs, context); nil != err {
+			return
+		}
+		if 1 > len(upsertChunkIDs) {
+			return
+		}
+	}
+
 	for _, upsertChunkID := range upsertChunkIDs {
-		absFilePath := filepath.Join(repo.Path, "objects", upsertChunkID[:2], upsertChunkID[2:])
-		info, statErr := os.Stat(absFilePath)
+		info, statErr := repo.store.Stat(upsertChunkID)
 		if nil != statErr {
 			return
 		}
@@ -842,10 +923,7 @@ func (repo *Repo) uploadChunks(upsertChunkIDs []string, context map[string]inter
 
 	waitGroup := &sync.WaitGroup{}
 	var uploadErr error
-	poolSize := 8
-	if poolSize > len(upsertChunkIDs) {
-		poolSize = len(upsertChunkIDs)
-	}
+	poolSize := repo.poolSize(len(upsertChunkIDs))
 	p, err := ants.NewPoolWithFunc(poolSize, func(arg interface{}) {
 		defer waitGroup.Done()
 		if nil != uploadErr {
@@ -859,6 +937,7 @@ func (repo *Repo) uploadChunks(upsertChunkIDs []string, context map[string]inter
 			uploadErr = uoErr
 			return
 		}
+		repo.transfer.uploaded(upsertChunkID)
 	})
 	if nil != err {
 		return
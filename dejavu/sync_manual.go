@@ -66,6 +66,10 @@ func (repo *Repo) SyncDownload(context map[string]interface{}) (mergeResult *Mer
 		return
 	}
 
+	// 加载传输记录，同步中断后只需要继续传输缺失的对象
+	repo.beginTransfer(cloudLatest.ID)
+	defer func() { repo.finishTransfer(err) }()
+
 	// 计算本地缺失的文件
 	fetchFileIDs, err := repo.localNotFoundFiles(cloudLatest.Files)
 	if nil != err {
@@ -83,6 +87,12 @@ func (repo *Repo) SyncDownload(context map[string]interface{}) (mergeResult *Mer
 	trafficStat.DownloadBytes += length
 	trafficStat.APIGet += trafficStat.DownloadFileCount
 
+	// 之前中断的同步中已经下载的文件也需要参与冲突检测
+	if fetchedFiles, err = repo.downloadedFiles(fetchedFiles); nil != err {
+		logging.LogErrorf("get downloaded files failed: %s", err)
+		return
+	}
+
 	// 组装还原云端最新文件列表
 	cloudLatestFiles, err := repo.getFiles(cloudLatest.Files)
 	if nil != err {
@@ -273,6 +283,10 @@ func (repo *Repo) SyncUpload(context map[string]interface{}) (trafficStat *Traff
 		return
 	}
 
+	// 加载传输记录，上传中断后只需要继续上传缺失的对象
+	repo.beginTransfer(cloudLatest.ID)
+	defer func() { repo.finishTransfer(err) }()
+
 	// 计算云端缺失的文件
 	var uploadFiles []*entity.File
 	for _, localFileID := range latest.Files {
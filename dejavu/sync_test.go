@@ -17,6 +17,10 @@
 package dejavu
 
 import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/wangxu0213/esnote-kernel/dejavu/cloud"
@@ -46,3 +50,245 @@ func TestSync(t *testing.T) {
 	_ = mergeResult
 	_ = trafficStat
 }
+
+func TestSyncLocal(t *testing.T) {
+	clearTestdata(t)
+	defer os.RemoveAll(testCloudPath)
+
+	repo, index := initIndex(t)
+
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	repo.cloud = cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{
+		Dir:           "test",
+		UserID:        "0",
+		RepoPath:      repo.Path,
+		AvailableSize: 1024 * 1024 * 1024 * 8,
+		Local:         &cloud.ConfLocal{Endpoint: cloudPath},
+	}})
+
+	_, _, err = repo.Sync(nil)
+	if nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	cloudLatest, err := repo.cloud.DownloadObject("refs/latest")
+	if nil != err {
+		t.Fatalf("download cloud latest failed: %s", err)
+		return
+	}
+	if index.ID != string(cloudLatest) {
+		t.Fatalf("cloud latest [%s] not match local latest [%s]", cloudLatest, index.ID)
+		return
+	}
+
+	repos, _, err := repo.GetCloudRepos()
+	if nil != err {
+		t.Fatalf("get cloud repos failed: %s", err)
+		return
+	}
+	if 1 != len(repos) || "test" != repos[0].Name || 1 > repos[0].Size {
+		t.Fatalf("cloud repos not match")
+		return
+	}
+}
+
+func TestLocalCloudRepo(t *testing.T) {
+	defer os.RemoveAll(testCloudPath)
+
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	local := cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{Local: &cloud.ConfLocal{Endpoint: cloudPath}}})
+
+	for _, name := range []string{"", ".", "..", "../test", "a/b", `a\b`, "/abs"} {
+		if err = local.CreateRepo(name); cloud.ErrInvalidRepoName != err {
+			t.Fatalf("create repo [%s] should be rejected", name)
+			return
+		}
+		if err = local.RemoveRepo(name); cloud.ErrInvalidRepoName != err {
+			t.Fatalf("remove repo [%s] should be rejected", name)
+			return
+		}
+
+		// 当前同步仓库名称不合法时不能读写存储目录之外的文件
+		current := cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{Dir: name, RepoPath: cloudPath, Local: &cloud.ConfLocal{Endpoint: cloudPath}}})
+		if err = current.UploadObject("refs/latest", true); cloud.ErrInvalidRepoName != err {
+			t.Fatalf("upload object to repo [%s] should be rejected", name)
+			return
+		}
+		if err = current.RemoveObject("refs/latest"); cloud.ErrInvalidRepoName != err {
+			t.Fatalf("remove object from repo [%s] should be rejected", name)
+			return
+		}
+	}
+	if entries, _ := os.ReadDir(cloudPath); 0 < len(entries) {
+		t.Fatalf("invalid repo names should not create dirs")
+		return
+	}
+
+	if err = local.CreateRepo("test"); nil != err {
+		t.Fatal(err)
+		return
+	}
+	repos, _, err := local.GetRepos()
+	if nil != err || 1 != len(repos) || "test" != repos[0].Name {
+		t.Fatalf("cloud repos not match")
+		return
+	}
+	if err = local.RemoveRepo("test"); nil != err {
+		t.Fatal(err)
+		return
+	}
+	if repos, _, err = local.GetRepos(); nil != err || 0 != len(repos) {
+		t.Fatalf("cloud repo should be removed")
+		return
+	}
+}
+
+func TestSyncLocalPack(t *testing.T) {
+	clearTestdata(t)
+	defer os.RemoveAll(testCloudPath)
+
+	repo, index := initIndex(t)
+	repo.UsePack = true
+
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	newCloud := func(repoPath string) cloud.Cloud {
+		return cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{
+			Dir:           "test",
+			UserID:        "0",
+			RepoPath:      repoPath,
+			AvailableSize: 1024 * 1024 * 1024 * 8,
+			Local:         &cloud.ConfLocal{Endpoint: cloudPath},
+		}})
+	}
+	repo.cloud = newCloud(repo.Path)
+
+	_, _, err = repo.Sync(nil)
+	if nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	// 小对象全部打包上传，分块和文件各一个包文件
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err || 2 != len(packs.Packs) {
+		t.Fatalf("cloud packs not match")
+		return
+	}
+	if _, err = os.Stat(filepath.Join(cloudPath, "repo", "test", "objects")); !os.IsNotExist(err) {
+		t.Fatalf("cloud objects should be packed")
+		return
+	}
+
+	// 另一个仓库从包文件中下载数据
+	repoPath2 := filepath.Join(testTempPath, "repo-pack")
+	defer os.RemoveAll(repoPath2)
+	os.RemoveAll(testDataCheckoutPath)
+	os.MkdirAll(testDataCheckoutPath, 0755)
+	os.WriteFile(filepath.Join(testDataCheckoutPath, "baz"), []byte("baz"), 0644)
+	repo2, err := NewRepo(testDataCheckoutPath, repoPath2, testHistoryPath, testTempPath, "device-id-1", deviceName, deviceOS, repo.store.AesKey, ignoreLines(), nil)
+	if nil != err {
+		t.Fatalf("new repo failed: %s", err)
+		return
+	}
+	repo2.cloud = newCloud(repoPath2)
+	if _, err = repo2.Index("Index 2", map[string]interface{}{}); nil != err {
+		t.Fatalf("index failed: %s", err)
+		return
+	}
+	if _, _, err = repo2.Sync(nil); nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(testDataCheckoutPath, "foo"))
+	if nil != err {
+		t.Fatalf("read synced file failed: %s", err)
+		return
+	}
+	files, _ := repo.GetFiles(index)
+	origin, _ := repo.OpenFile(files[0])
+	if string(origin) != string(data) {
+		t.Fatalf("synced file not match")
+		return
+	}
+
+	// 下载的包文件保存在本地仓库，清理后包中被引用的对象仍然可以读取
+	if localPacks, _ := filepath.Glob(filepath.Join(repoPath2, "packs", strings.Repeat("?", 40))); 2 != len(localPacks) {
+		t.Fatalf("local packs not match")
+		return
+	}
+	if _, err = repo2.Purge(); nil != err {
+		t.Fatalf("purge failed: %s", err)
+		return
+	}
+	files2, err := repo2.GetFiles(index)
+	if nil != err {
+		t.Fatalf("get files failed: %s", err)
+		return
+	}
+	if data, err = repo2.OpenFile(files2[0]); nil != err || string(origin) != string(data) {
+		t.Fatalf("purged repo file not match")
+		return
+	}
+}
+
+func TestPackCloud(t *testing.T) {
+	clearTestdata(t)
+	defer os.RemoveAll(testCloudPath)
+
+	repo, _ := initIndex(t)
+	cloudPath, err := filepath.Abs(testCloudPath)
+	if nil != err {
+		t.Fatalf("get abs path failed: %s", err)
+		return
+	}
+	repo.cloud = cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{
+		Dir:           "test",
+		UserID:        "0",
+		RepoPath:      repo.Path,
+		AvailableSize: 1024 * 1024 * 1024 * 8,
+		Local:         &cloud.ConfLocal{Endpoint: cloudPath},
+	}})
+	if _, _, err = repo.Sync(nil); nil != err {
+		t.Fatalf("sync failed: %s", err)
+		return
+	}
+
+	packedCount, err := repo.PackCloud(nil)
+	if nil != err {
+		t.Fatalf("pack cloud failed: %s", err)
+		return
+	}
+	packs, _, err := repo.downloadCloudPacks()
+	if nil != err || 1 > packedCount || packedCount != len(packs.objects) {
+		t.Fatalf("cloud packs not match")
+		return
+	}
+
+	// 迁移后保留云端的单个对象，不支持包文件的客户端仍然可以下载
+	for id := range packs.objects {
+		if _, err = repo.cloud.DownloadObject(path.Join("objects", id[:2], id[2:])); nil != err {
+			t.Fatalf("loose cloud object [%s] should be kept: %s", id, err)
+			return
+		}
+	}
+
+	// 再次迁移不会重复打包
+	if packedCount, err = repo.PackCloud(nil); nil != err || 0 != packedCount {
+		t.Fatalf("pack cloud again not match")
+		return
+	}
+}
@@ -0,0 +1,211 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/dejavu/cloud"
+	"github.com/wangxu0213/esnote-kernel/dejavu/entity"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// defaultConcurrency 为云端传输的默认并发数。
+const defaultConcurrency = 8
+
+// SetTransferLimit 设置云端传输的上传带宽 uploadLimit、下载带宽 downloadLimit（单位：字节/秒，0 表示不限制）和并发数 concurrency（0 表示使用默认值）。
+//
+// 带宽限制作用于传输的字节流，所有并发传输共享同一个限制器。
+func (repo *Repo) SetTransferLimit(uploadLimit, downloadLimit int64, concurrency int) {
+	if nil != repo.cloud {
+		conf := repo.cloud.GetConf()
+		conf.UploadLimiter = cloud.NewRateLimiter(uploadLimit)
+		conf.DownloadLimiter = cloud.NewRateLimiter(downloadLimit)
+	}
+	repo.concurrency = concurrency
+}
+
+// poolSize 返回传输 count 个对象时使用的并发数。
+func (repo *Repo) poolSize(count int) (ret int) {
+	ret = repo.concurrency
+	if 1 > ret {
+		ret = defaultConcurrency
+	}
+	if ret > count {
+		ret = count
+	}
+	return
+}
+
+// transferJournal 记录了同步过程中已经完成的传输，用于同步中断后继续。
+//
+// 下载的文件和分块会直接入库，中断后通过计算本地缺失对象就能继续，这里只需要记录已经下载的文件用于冲突检测；
+// 上传的对象在云端最新索引变更前不会被引用，所以需要记录下来避免重复上传。
+type transferJournal struct {
+	CloudLatest string          `json:"cloudLatest"` // 开始传输时的云端最新索引 ID，云端最新索引变更后记录失效
+	Uploaded    map[string]bool `json:"uploaded"`    // 已经上传到云端的文件和分块
+	Downloaded  map[string]bool `json:"downloaded"`  // 已经从云端下载的文件
+
+	path    string
+	changes int
+	lock    sync.Mutex
+}
+
+// transferJournalFlushCount 为传输记录变更多少次后写入磁盘。
+const transferJournalFlushCount = 64
+
+// beginTransfer 加载传输记录，如果记录对应的云端最新索引不是 cloudLatest 则重新开始记录。
+func (repo *Repo) beginTransfer(cloudLatest string) {
+	journal := &transferJournal{CloudLatest: cloudLatest, Uploaded: map[string]bool{}, Downloaded: map[string]bool{},
+		path: filepath.Join(repo.Path, "sync-transfer.json")}
+	repo.transfer = journal
+	if !gulu.File.IsExist(journal.path) {
+		return
+	}
+
+	data, err := filelock.ReadFile(journal.path)
+	if nil != err {
+		logging.LogWarnf("read transfer journal failed: %s", err)
+		return
+	}
+	saved := &transferJournal{}
+	if err = gulu.JSON.UnmarshalJSON(data, saved); nil != err {
+		logging.LogWarnf("unmarshal transfer journal failed: %s", err)
+		return
+	}
+	if cloudLatest != saved.CloudLatest {
+		return
+	}
+
+	for id := range saved.Uploaded {
+		journal.Uploaded[id] = true
+	}
+	for id := range saved.Downloaded {
+		journal.Downloaded[id] = true
+	}
+	logging.LogInfof("resume transfer [uploaded=%d, downloaded=%d]", len(journal.Uploaded), len(journal.Downloaded))
+}
+
+// finishTransfer 结束传输，err 为空时表示同步成功并删除传输记录，否则保存传输记录以便下次继续。
+func (repo *Repo) finishTransfer(err error) {
+	journal := repo.transfer
+	if nil == journal {
+		return
+	}
+	repo.transfer = nil
+
+	if nil == err {
+		if removeErr := os.RemoveAll(journal.path); nil != removeErr {
+			logging.LogWarnf("remove transfer journal failed: %s", removeErr)
+		}
+		return
+	}
+	journal.flush()
+}
+
+// filterUploaded 返回 ids 中还没有上传到云端的对象。
+func (journal *transferJournal) filterUploaded(ids []string) (ret []string) {
+	if nil == journal {
+		return ids
+	}
+
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	for _, id := range ids {
+		if !journal.Uploaded[id] {
+			ret = append(ret, id)
+		}
+	}
+	return
+}
+
+func (journal *transferJournal) uploaded(ids ...string) {
+	if nil == journal {
+		return
+	}
+
+	journal.lock.Lock()
+	for _, id := range ids {
+		journal.Uploaded[id] = true
+	}
+	journal.changes += len(ids)
+	flush := transferJournalFlushCount <= journal.changes
+	journal.lock.Unlock()
+	if flush {
+		journal.flush()
+	}
+}
+
+// downloadedFiles 记录本次下载的文件 fetchedFiles，并返回合并了之前中断的同步中已经下载的文件。
+func (repo *Repo) downloadedFiles(fetchedFiles []*entity.File) (ret []*entity.File, err error) {
+	ret = fetchedFiles
+	journal := repo.transfer
+	if nil == journal {
+		return
+	}
+
+	journal.lock.Lock()
+	var resumeIDs []string
+	fetched := map[string]bool{}
+	for _, file := range fetchedFiles {
+		fetched[file.ID] = true
+	}
+	for id := range journal.Downloaded {
+		if !fetched[id] {
+			resumeIDs = append(resumeIDs, id)
+		}
+	}
+	for id := range fetched {
+		journal.Downloaded[id] = true
+	}
+	journal.changes += len(fetched)
+	journal.lock.Unlock()
+	journal.flush()
+
+	for _, id := range resumeIDs {
+		file, getErr := repo.store.GetFile(id)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		ret = append(ret, file)
+	}
+	return
+}
+
+func (journal *transferJournal) flush() {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	if 1 > journal.changes {
+		return
+	}
+	data, err := gulu.JSON.MarshalJSON(journal)
+	if nil != err {
+		logging.LogWarnf("marshal transfer journal failed: %s", err)
+		return
+	}
+	if err = filelock.WriteFile(journal.path, data); nil != err {
+		logging.LogWarnf("write transfer journal failed: %s", err)
+		return
+	}
+	journal.changes = 0
+}
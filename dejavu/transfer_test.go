@@ -0,0 +1,208 @@
+// DejaVu - Data snapshot and sync.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dejavu
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/studio-b12/gowebdav"
+	"github.com/wangxu0213/esnote-kernel/dejavu/cloud"
+)
+
+func TestTransferJournal(t *testing.T) {
+	clearTestdata(t)
+
+	repo, _ := initIndex(t)
+	journalPath := filepath.Join(repo.Path, "sync-transfer.json")
+
+	// 同步中断时保存传输记录
+	repo.beginTransfer("cloud-latest-1")
+	repo.transfer.uploaded("chunk-1", "chunk-2")
+	repo.finishTransfer(errors.New("interrupted"))
+	if !gulu.File.IsExist(journalPath) {
+		t.Fatalf("transfer journal should be saved")
+		return
+	}
+
+	// 云端最新索引没有变更时继续传输
+	repo.beginTransfer("cloud-latest-1")
+	if remains := repo.transfer.filterUploaded([]string{"chunk-1", "chunk-2", "chunk-3"}); 1 != len(remains) || "chunk-3" != remains[0] {
+		t.Fatalf("filter uploaded not match: %v", remains)
+		return
+	}
+	repo.finishTransfer(errors.New("interrupted"))
+
+	// 云端最新索引变更后重新传输
+	repo.beginTransfer("cloud-latest-2")
+	if remains := repo.transfer.filterUploaded([]string{"chunk-1"}); 1 != len(remains) {
+		t.Fatalf("transfer journal should be reset")
+		return
+	}
+	repo.finishTransfer(nil)
+	if gulu.File.IsExist(journalPath) {
+		t.Fatalf("transfer journal should be removed")
+		return
+	}
+	if nil != repo.transfer {
+		t.Fatalf("transfer should be finished")
+		return
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if nil != cloud.NewRateLimiter(0) {
+		t.Fatalf("zero limit should not create limiter")
+		return
+	}
+
+	// 三个并发传输共享 1MB/s 的限制，总共 1.5MB 需要大约 1.5 秒
+	limiter := cloud.NewRateLimiter(1024 * 1024)
+	start := time.Now()
+	waitGroup := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			data, err := io.ReadAll(limiter.Reader(bytes.NewReader(make([]byte, 512*1024))))
+			if nil != err || 512*1024 != len(data) {
+				t.Errorf("read limited data failed: %v", err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if elapsed := time.Since(start); time.Second > elapsed || 2*time.Second < elapsed {
+		t.Fatalf("rate limiter elapsed [%s] not match", elapsed)
+		return
+	}
+
+	// 预约了但没有读取到的字节会被归还，小数据不需要等待
+	start = time.Now()
+	for i := 0; i < 64; i++ {
+		if _, err := io.ReadAll(limiter.Reader(bytes.NewReader([]byte("dejavu")))); nil != err {
+			t.Fatal(err)
+			return
+		}
+	}
+	if elapsed := time.Since(start); 500*time.Millisecond < elapsed {
+		t.Fatalf("rate limiter refund elapsed [%s] not match", elapsed)
+		return
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	const limit, size, chunk = 64 * 1024, 128 * 1024, 32 * 1024
+	repoPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repoPath, "object"), make([]byte, size), 0644); nil != err {
+		t.Fatal(err)
+		return
+	}
+
+	// 服务端记录收到请求体的进度，任意时刻收到的字节数都不能超过限制速率允许的字节数（首个分块不需要等待）
+	var received int64
+	var start time.Time
+	var exceeded bool
+	lock := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodPut != r.Method {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		received, start, exceeded = 0, time.Time{}, false
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Body.Read(buf)
+			if 0 < n {
+				if start.IsZero() {
+					start = time.Now()
+				}
+				received += int64(n)
+				if allowed := chunk + int64(time.Since(start).Seconds()*limit); allowed < received {
+					exceeded = true
+				}
+			}
+			if nil != err {
+				break
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	webdavClient := gowebdav.NewClient(server.URL, "", "")
+	s3Conf := &cloud.ConfS3{Endpoint: server.URL, AccessKey: "access", SecretKey: "secret", Bucket: "bucket", Region: "us-east-1", PathStyle: true, Timeout: 30}
+	clouds := map[string]cloud.Cloud{
+		"s3":     cloud.NewS3(&cloud.BaseCloud{Conf: &cloud.Conf{RepoPath: repoPath, S3: s3Conf}}, &http.Client{}),
+		"webdav": cloud.NewWebDAV(&cloud.BaseCloud{Conf: &cloud.Conf{RepoPath: repoPath, WebDAV: &cloud.ConfWebDAV{Endpoint: server.URL}}}, webdavClient),
+	}
+	for name, c := range clouds {
+		repo := &Repo{cloud: c}
+		repo.SetTransferLimit(limit, 0, 0)
+		if err := c.UploadObject("object", true); nil != err {
+			t.Fatalf("upload to [%s] failed: %s", name, err)
+			return
+		}
+
+		lock.Lock()
+		elapsed := time.Since(start)
+		lock.Unlock()
+		if size != received || exceeded {
+			t.Fatalf("upload to [%s] received [%d] bytes in [%s] not match", name, received, elapsed)
+			return
+		}
+		if time.Duration(size-chunk)*time.Second/limit-100*time.Millisecond > elapsed {
+			t.Fatalf("upload to [%s] elapsed [%s] not match", name, elapsed)
+			return
+		}
+	}
+}
+
+func TestSetTransferLimit(t *testing.T) {
+	repo := &Repo{cloud: cloud.NewLocal(&cloud.BaseCloud{Conf: &cloud.Conf{}})}
+	repo.SetTransferLimit(1024, 0, 0)
+	conf := repo.cloud.GetConf()
+	if nil == conf.UploadLimiter || nil != conf.DownloadLimiter {
+		t.Fatalf("transfer limiter not match")
+		return
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	repo := &Repo{}
+	if defaultConcurrency != repo.poolSize(100) || 3 != repo.poolSize(3) {
+		t.Fatalf("default pool size not match")
+		return
+	}
+
+	repo.SetTransferLimit(0, 0, 2)
+	if 2 != repo.poolSize(100) {
+		t.Fatalf("pool size not match")
+		return
+	}
+}
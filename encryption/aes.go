@@ -13,6 +13,7 @@ package encryption
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"errors"
 )
 
 func AesEncrypt(data, key []byte) (ret []byte, err error) {
@@ -47,6 +48,11 @@ func AesDecrypt(cryptData, key []byte) (ret []byte, err error) {
 		return
 	}
 
+	if 12+aesgcm.Overhead() > len(cryptData) {
+		err = errors.New("invalid crypt data")
+		return
+	}
+
 	nonce := cryptData[:12]
 	ret = cryptData[12:]
 	ret, err = aesgcm.Open(nil, nonce, ret, nil)
@@ -60,4 +60,9 @@ func TestAes(t *testing.T) {
 		t.Error("decrypt not equal")
 		return
 	}
+
+	if _, err = AesDecrypt([]byte("corrupt"), key); nil == err {
+		t.Error("decrypt corrupt data should fail")
+		return
+	}
 }
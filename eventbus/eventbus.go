@@ -60,6 +60,20 @@ const (
 	EvtIndexUpsertFile           = "repo.index.upsertFile"
 )
 
+// 数据仓库校验事件。
+const (
+	EvtCheckBeforeCheckIndexes = "repo.check.beforeCheckIndexes"
+	EvtCheckIndex              = "repo.check.index"
+	EvtCheckObject             = "repo.check.object"
+	EvtCheckBeforeCheckCloud   = "repo.check.beforeCheckCloud"
+)
+
+// 数据仓库密钥轮换事件。
+const (
+	EvtRotateKeyObjectsDir = "repo.rotateKey.objectsDir"
+	EvtRotateKeyCloudPack  = "repo.rotateKey.cloudPack"
+)
+
 // 数据仓库云端同步事件。
 const (
 	EvtCloudLock                 = "repo.cloudLock"
@@ -76,4 +90,6 @@ const (
 	EvtCloudBeforeDownloadChunk  = "repo.cloudBeforeDownloadChunk"
 	EvtCloudBeforeDownloadRef    = "repo.cloudBeforeDownloadRef"
 	EvtCloudBeforeUploadRef      = "repo.cloudBeforeUploadRef"
+	EvtCloudBeforeUploadPack     = "repo.cloudBeforeUploadPack"
+	EvtCloudBeforeDownloadPack   = "repo.cloudBeforeDownloadPack"
 )
@@ -34,10 +34,12 @@ func StartCron() {
 	go every(5*time.Second, model.SyncDataJob)
 	go every(2*time.Hour, model.StatJob)
 	go every(2*time.Hour, model.RefreshCheckJob)
+	go every(2*time.Hour, model.AutoForgetRepoJob)
 	go every(3*time.Second, model.FlushUpdateRefTextRenameDocJob)
 	go every(50*time.Millisecond, model.FlushTxJob)
 	go every(util.SQLFlushInterval, sql.FlushTxJob)
 	go every(util.SQLFlushInterval, sql.FlushHistoryTxJob)
+	go every(5*time.Second, sql.FlushEmbeddingJob)
 	go every(10*time.Minute, model.FixIndexJob)
 	go every(10*time.Minute, model.IndexEmbedBlockJob)
 	go every(10*time.Minute, model.CacheVirtualBlockRefJob)
@@ -35,7 +35,10 @@ func main() {
 	model.InitAppearance()
 	sql.InitDatabase(false)
 	sql.InitHistoryDatabase(false)
+	sql.InitEmbeddingDatabase(false)
 	sql.SetCaseSensitive(model.Conf.Search.CaseSensitive)
+	model.LoadAttrSchema()
+	model.InitEmbedder()
 
 	model.BootSyncData()
 	model.InitBoxes()
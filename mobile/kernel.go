@@ -49,7 +49,10 @@ func StartKernel(container, appDir, workspaceBaseDir, timezoneID, localIPs, lang
 		model.InitAppearance()
 		sql.InitDatabase(false)
 		sql.InitHistoryDatabase(false)
+		sql.InitEmbeddingDatabase(false)
 		sql.SetCaseSensitive(model.Conf.Search.CaseSensitive)
+		model.LoadAttrSchema()
+		model.InitEmbedder()
 
 		model.BootSyncData()
 		model.InitBoxes()
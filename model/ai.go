@@ -23,6 +23,8 @@ import (
 	"github.com/88250/lute/ast"
 	"github.com/88250/lute/parse"
 	gogpt "github.com/sashabaranov/go-gpt3"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/sql"
 	"github.com/wangxu0213/esnote-kernel/treenode"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -101,6 +103,25 @@ func chatGPTContinueWrite(msg string, contextMsgs []string, cloud bool) (ret str
 	return
 }
 
+// InitEmbedder 根据配置设置语义搜索使用的向量嵌入接口，接口地址和密钥为空时使用 OpenAI 的配置。
+func InitEmbedder() {
+	embedding := Conf.AI.Embedding
+	if !embedding.Enabled {
+		sql.SetEmbedder(nil, "")
+		return
+	}
+
+	apiKey, apiBaseURL := embedding.APIKey, embedding.APIBaseURL
+	if "" == apiKey {
+		apiKey = Conf.AI.OpenAI.APIKey
+	}
+	if "" == apiBaseURL {
+		apiBaseURL = Conf.AI.OpenAI.APIBaseURL
+	}
+	sql.SetEmbedder(util.NewOpenAIEmbedder(apiKey, Conf.AI.OpenAI.APIProxy, apiBaseURL, embedding.APIModel, embedding.APITimeout), embedding.APIModel+"@"+apiBaseURL)
+	logging.LogInfof("embedding enabled [model=%s, baseURL=%s]", embedding.APIModel, apiBaseURL)
+}
+
 func isOpenAIAPIEnabled() bool {
 	if "" == Conf.AI.OpenAI.APIKey {
 		util.PushMsg(Conf.Language(193), 5000)
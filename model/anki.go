@@ -0,0 +1,832 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/html"
+	"github.com/open-spaced-repetition/go-fsrs"
+	"github.com/wangxu0213/esnote-kernel/filelock"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/riff"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// Anki 集合中使用的常量 https://github.com/ankidroid/Anki-Android/wiki/Database-Structure
+const (
+	ankiFieldSeparator = "\x1f"
+	ankiModelCloze     = 1
+
+	ankiCardNew      = 0
+	ankiCardLearning = 1
+	ankiCardReview   = 2
+	ankiCardRelearn  = 3
+
+	ankiQueueSuspended = -1
+
+	ankiRevlogLearn   = 0
+	ankiRevlogReview  = 1
+	ankiRevlogRelearn = 2
+	ankiRevlogManual  = 4
+)
+
+var (
+	ankiClozeRegexp   = regexp.MustCompile(`(?s){{c(\d+)::(.*?)(::[^}]*?)?}}`)
+	ankiSoundRegexp   = regexp.MustCompile(`\[sound:([^\]]+)]`)
+	ankiMediaRegexp   = regexp.MustCompile(`(?i)(src|href)="([^"]+)"`)
+	ankiHTMLTagRegexp = regexp.MustCompile(`<[^>]*>`)
+)
+
+type ankiModel struct {
+	Name string `json:"name"`
+	Type int    `json:"type"`
+}
+
+type ankiDeck struct {
+	Name string `json:"name"`
+}
+
+type ankiNote struct {
+	id     int64
+	mid    string
+	fields []string
+	cards  []*ankiCard
+}
+
+type ankiCard struct {
+	id, did                        int64
+	ord, typ, queue, group         int
+	due, ivl, factor, reps, lapses int64
+	logs                           []*riff.ReviewLog
+}
+
+// ImportAnkiDeck 将 Anki 导出的 .apkg 或者 .colpkg 包 apkgPath 导入到笔记本 boxID 中。
+//
+// 每个 Anki 牌组生成一篇文档，每条笔记生成一个制卡的块：问答题生成标题块，背面字段作为标题下的内容；完形填空题生成引述块，挖空部分使用带有分组编号的标记，每个分组生成一张闪卡。
+// 所有闪卡放入以导入包名称命名的新闪卡包中，复习记录按照 FSRS 重放得到闪卡的复习状态。
+func ImportAnkiDeck(apkgPath, boxID string) (deck *riff.Deck, err error) {
+	box := Conf.Box(boxID)
+	if nil == box {
+		err = errors.New(Conf.Language(0))
+		return
+	}
+
+	util.PushEndlessProgress(Conf.Language(73))
+	defer util.ClearPushProgress(100)
+
+	baseName := strings.TrimSuffix(filepath.Base(apkgPath), filepath.Ext(apkgPath))
+	unzipPath := filepath.Join(filepath.Dir(apkgPath), baseName+"-"+gulu.Rand.String(7))
+	defer os.RemoveAll(unzipPath)
+	if err = unzipAnkiPackage(apkgPath, unzipPath); nil != err {
+		return
+	}
+
+	collectionPath := filepath.Join(unzipPath, "collection.anki21")
+	if !gulu.File.IsExist(collectionPath) {
+		collectionPath = filepath.Join(unzipPath, "collection.anki2")
+	}
+	if !gulu.File.IsExist(collectionPath) {
+		if gulu.File.IsExist(filepath.Join(unzipPath, "collection.anki21b")) {
+			err = errors.New("unsupported Anki package format, please export with [Support older Anki versions] checked")
+			return
+		}
+		err = errors.New("not found Anki collection in package")
+		return
+	}
+
+	media, err := importAnkiMedia(unzipPath)
+	if nil != err {
+		return
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+collectionPath+"?mode=ro")
+	if nil != err {
+		return
+	}
+	defer db.Close()
+
+	crt, models, ankiDecks, err := readAnkiCol(db)
+	if nil != err {
+		return
+	}
+	notes, err := readAnkiNotes(db)
+	if nil != err {
+		return
+	}
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	// 按照 Anki 牌组分组生成文档，完形填空题放在问答题前面，避免引述块成为上一个标题的下方块
+	deckID := ast.NewNodeID()
+	var dids []int64
+	clozeMds, basicMds := map[int64][]string{}, map[int64][]string{}
+	blockCards := map[string][]*ankiCard{}
+	for _, note := range notes {
+		did := note.cards[0].did
+		if _, ok := clozeMds[did]; !ok {
+			if _, ok = basicMds[did]; !ok {
+				dids = append(dids, did)
+			}
+		}
+
+		blockID := ast.NewNodeID()
+		ial := fmt.Sprintf("{: id=\"%s\" custom-riff-decks=\"%s\"}", blockID, deckID)
+		fields := rewriteAnkiMedia(note.fields, media)
+		if model := models[note.mid]; nil != model && ankiModelCloze == model.Type {
+			md := ankiFieldsMarkdown(fields, true)
+			if "" == md {
+				continue
+			}
+			clozeMds[did] = append(clozeMds[did], "> "+strings.ReplaceAll(md, "\n", "\n> ")+"\n"+ial)
+			// 完形填空题的每张卡片对应一个分组，卡片序号从 0 开始
+			for _, card := range note.cards {
+				card.group = card.ord + 1
+			}
+			blockCards[blockID] = note.cards
+		} else {
+			front := ankiFieldsMarkdown(fields[:1], false)
+			front = strings.Join(strings.Fields(front), " ")
+			if "" == front {
+				continue
+			}
+			md := "## " + front + "\n" + ial
+			if back := ankiFieldsMarkdown(fields[1:], false); "" != back {
+				md += "\n\n" + back
+			}
+			basicMds[did] = append(basicMds[did], md)
+			blockCards[blockID] = []*ankiCard{note.mostReviewedCard()}
+		}
+	}
+
+	for _, did := range dids {
+		title := baseName
+		if srcDeck := ankiDecks[strconv.FormatInt(did, 10)]; nil != srcDeck && "" != srcDeck.Name {
+			title = srcDeck.Name
+		}
+		title = strings.ReplaceAll(title, "::", " - ")
+		md := strings.Join(append(clozeMds[did], basicMds[did]...), "\n\n")
+		if _, err = CreateDocByMd(box.ID, "/"+ast.NewNodeID()+".sy", title, md, nil); nil != err {
+			logging.LogErrorf("create doc for Anki deck [%s] failed: %s", title, err)
+			return
+		}
+	}
+
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if deck, err = createDeck0(baseName, deckID, riff.AlgoFSRS); nil != err {
+		return
+	}
+	cardCount := 0
+	for blockID, ankiCards := range blockCards {
+		for _, ankiCard := range ankiCards {
+			if err = importAnkiCard(deck, blockID, ankiCard, crt); nil != err {
+				return
+			}
+			cardCount++
+		}
+	}
+
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deck.ID, err)
+		return
+	}
+	logging.LogInfof("imported Anki package [%s] with [%d] cards into deck [%s]", apkgPath, cardCount, deck.ID)
+
+	IncSync()
+	util.ReloadUI()
+	return
+}
+
+// unzipAnkiPackage 将导入包 apkgPath 中的集合数据库、媒体清单和按照数字编号存放的媒体文件解压到 unzipPath 下。
+//
+// 导入包通常来自第三方分享，其他文件会被忽略，路径在 unzipPath 之外的文件会导致解压失败。
+func unzipAnkiPackage(apkgPath, unzipPath string) (err error) {
+	reader, err := zip.OpenReader(apkgPath)
+	if nil != err {
+		return
+	}
+	defer reader.Close()
+
+	if err = os.MkdirAll(unzipPath, 0755); nil != err {
+		return
+	}
+	for _, f := range reader.File {
+		target := filepath.Join(unzipPath, f.Name)
+		if target == filepath.Clean(unzipPath) || !util.IsSubPath(unzipPath, target) {
+			err = errors.New(fmt.Sprintf("invalid Anki package entry [%s]", f.Name))
+			return
+		}
+
+		switch f.Name {
+		case "collection.anki2", "collection.anki21", "collection.anki21b", "media":
+		default:
+			if _, parseErr := strconv.ParseUint(f.Name, 10, 64); nil != parseErr {
+				continue
+			}
+		}
+
+		if err = unzipAnkiFile(f, target); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func unzipAnkiFile(f *zip.File, target string) (err error) {
+	rc, err := f.Open()
+	if nil != err {
+		return
+	}
+	defer rc.Close()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if nil != err {
+		return
+	}
+	defer file.Close()
+	_, err = io.Copy(file, rc)
+	return
+}
+
+// importAnkiMedia 将导入包中的媒体文件复制到 assets 文件夹下，返回媒体文件名到资源路径的映射。
+func importAnkiMedia(unzipPath string) (ret map[string]string, err error) {
+	ret = map[string]string{}
+	mediaPath := filepath.Join(unzipPath, "media")
+	if !gulu.File.IsExist(mediaPath) {
+		return
+	}
+
+	data, err := os.ReadFile(mediaPath)
+	if nil != err {
+		return
+	}
+	files := map[string]string{}
+	if err = gulu.JSON.UnmarshalJSON(data, &files); nil != err {
+		err = errors.New("unsupported Anki media format, please export with [Support older Anki versions] checked")
+		return
+	}
+
+	assetsDir := filepath.Join(util.DataDir, "assets")
+	if err = os.MkdirAll(assetsDir, 0755); nil != err {
+		return
+	}
+	for num, name := range files {
+		// 媒体文件在导入包中按照数字编号存放，其他名称可能指向导入包之外的文件
+		if _, parseErr := strconv.ParseUint(num, 10, 64); nil != parseErr {
+			logging.LogWarnf("skip Anki media [%s] with invalid file number [%s]", name, num)
+			continue
+		}
+
+		src := filepath.Join(unzipPath, num)
+		if !gulu.File.IsExist(src) {
+			continue
+		}
+
+		assetName := util.AssetName(util.FilterFileName(name))
+		if err = filelock.Copy(src, filepath.Join(assetsDir, assetName)); nil != err {
+			logging.LogErrorf("copy Anki media [%s] failed: %s", name, err)
+			return
+		}
+		ret[name] = "assets/" + assetName
+	}
+	return
+}
+
+func readAnkiCol(db *sql.DB) (crt int64, models map[string]*ankiModel, decks map[string]*ankiDeck, err error) {
+	var modelsData, decksData string
+	if err = db.QueryRow("SELECT crt, models, decks FROM col").Scan(&crt, &modelsData, &decksData); nil != err {
+		return
+	}
+
+	models = map[string]*ankiModel{}
+	if err = gulu.JSON.UnmarshalJSON([]byte(modelsData), &models); nil != err {
+		return
+	}
+	decks = map[string]*ankiDeck{}
+	err = gulu.JSON.UnmarshalJSON([]byte(decksData), &decks)
+	return
+}
+
+// readAnkiNotes 读取笔记及其卡片和复习记录，忽略没有卡片的笔记。
+func readAnkiNotes(db *sql.DB) (ret []*ankiNote, err error) {
+	rows, err := db.Query("SELECT id, mid, flds FROM notes ORDER BY id")
+	if nil != err {
+		return
+	}
+	notes := map[int64]*ankiNote{}
+	for rows.Next() {
+		note := &ankiNote{}
+		var mid int64
+		var flds string
+		if err = rows.Scan(&note.id, &mid, &flds); nil != err {
+			rows.Close()
+			return
+		}
+		note.mid = strconv.FormatInt(mid, 10)
+		note.fields = strings.Split(flds, ankiFieldSeparator)
+		notes[note.id] = note
+		ret = append(ret, note)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT id, nid, did, ord, type, queue, due, ivl, factor, reps, lapses FROM cards ORDER BY ord")
+	if nil != err {
+		return
+	}
+	cards := map[int64]*ankiCard{}
+	for rows.Next() {
+		card := &ankiCard{}
+		var nid int64
+		if err = rows.Scan(&card.id, &nid, &card.did, &card.ord, &card.typ, &card.queue, &card.due, &card.ivl, &card.factor, &card.reps, &card.lapses); nil != err {
+			rows.Close()
+			return
+		}
+		cards[card.id] = card
+		if note := notes[nid]; nil != note {
+			note.cards = append(note.cards, card)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT id, cid, ease, type FROM revlog ORDER BY id")
+	if nil != err {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, cid int64
+		var ease, typ int
+		if err = rows.Scan(&id, &cid, &ease, &typ); nil != err {
+			return
+		}
+		// 手动调整和提前复习（按钮为 0）的记录不是真实的复习
+		card := cards[cid]
+		if nil == card || ankiRevlogManual == typ || 1 > ease || 4 < ease {
+			continue
+		}
+		card.logs = append(card.logs, &riff.ReviewLog{Rating: riff.Rating(ease - 1), Review: id})
+	}
+
+	var withCards []*ankiNote
+	for _, note := range ret {
+		if 0 < len(note.cards) {
+			withCards = append(withCards, note)
+		}
+	}
+	ret = withCards
+	return
+}
+
+// importAnkiCard 为内容块 blockID 新建 Anki 卡片 ankiCard 对应的闪卡，crt 为 Anki 集合的创建时间（秒）。
+func importAnkiCard(deck *riff.Deck, blockID string, ankiCard *ankiCard, crt int64) (err error) {
+	cardID := ast.NewNodeID()
+	deck.AddCard(cardID, blockID)
+	card := deck.GetCard(cardID)
+	card.SetClozeGroup(ankiCard.group)
+	card.SetSuspended(ankiQueueSuspended == ankiCard.queue)
+	deck.SetCard(card)
+
+	if 0 < len(ankiCard.logs) {
+		err = deck.ImportReviewLogs(cardID, ankiCard.logs)
+		return
+	}
+	if 0 < ankiCard.reps {
+		// 没有复习记录（比如共享牌组中的复习记录被清除）时根据 Anki 的调度状态估算
+		card.SetImpl(riff.SM2ToFSRS(ankiCard.sm2(crt)))
+		deck.SetCard(card)
+	}
+	return
+}
+
+// mostReviewedCard 返回复习次数最多的卡片，一个块只能生成一张问答题闪卡，所以问答题笔记有多张卡片（比如正反面）时使用该卡片。
+func (note *ankiNote) mostReviewedCard() (ret *ankiCard) {
+	for _, card := range note.cards {
+		if nil == ret || ret.reps < card.reps {
+			ret = card
+		}
+	}
+	return
+}
+
+// sm2 根据 Anki 卡片的调度状态构造 SM-2 复习状态，crt 为 Anki 集合的创建时间（秒）。
+func (card *ankiCard) sm2(crt int64) (ret *riff.SM2) {
+	ret = riff.NewSM2()
+	ret.Reps = uint64(card.reps)
+	ret.Lapses = uint64(card.lapses)
+	if 0 < card.factor {
+		ret.Ease = float64(card.factor) / 1000
+	}
+
+	switch card.typ {
+	case ankiCardReview:
+		ret.Interval = uint64(card.ivl)
+		ret.Repetition = 2
+		ret.Due = time.Unix(crt, 0).AddDate(0, 0, int(card.due))
+		ret.LastReview = ret.Due.AddDate(0, 0, -int(card.ivl))
+	case ankiCardLearning, ankiCardRelearn:
+		ret.Due = time.Unix(card.due, 0)
+		ret.LastReview = ret.Due
+	}
+	return
+}
+
+// rewriteAnkiMedia 将字段中引用的媒体文件替换为资源路径，声音引用转换为链接。
+func rewriteAnkiMedia(fields []string, media map[string]string) (ret []string) {
+	for _, field := range fields {
+		field = ankiMediaRegexp.ReplaceAllStringFunc(field, func(attr string) string {
+			groups := ankiMediaRegexp.FindStringSubmatch(attr)
+			name, unescapeErr := url.PathUnescape(groups[2])
+			if nil != unescapeErr {
+				name = groups[2]
+			}
+			if asset := media[html.UnescapeString(name)]; "" != asset {
+				return groups[1] + "=\"" + asset + "\""
+			}
+			return attr
+		})
+		field = ankiSoundRegexp.ReplaceAllStringFunc(field, func(sound string) string {
+			name := ankiSoundRegexp.FindStringSubmatch(sound)[1]
+			if asset := media[name]; "" != asset {
+				return "<a href=\"" + asset + "\">" + html.EscapeString(name) + "</a>"
+			}
+			return sound
+		})
+		ret = append(ret, field)
+	}
+	return
+}
+
+// ankiFieldsMarkdown 将非空字段转换为 Markdown，cloze 为 true 时将挖空转换为带有分组编号的标记。
+func ankiFieldsMarkdown(fields []string, cloze bool) string {
+	var mds []string
+	for _, field := range fields {
+		if cloze {
+			field = ankiClozeRegexp.ReplaceAllString(field, "<mark>c$1::$2</mark>")
+		}
+		md, err := HTML2Markdown(field)
+		if nil != err {
+			logging.LogWarnf("convert Anki field to markdown failed: %s", err)
+			continue
+		}
+		if md = strings.TrimSpace(strings.ReplaceAll(md, "\u200b", "")); "" != md {
+			mds = append(mds, md)
+		}
+	}
+	return strings.Join(mds, "\n\n")
+}
+
+// ExportAnkiDeck 将闪卡包 deckID 导出为 Anki 的 .apkg 包，返回导出文件的路径。
+//
+// 闪卡导出为问答题：标题块的正面为标题，背面为标题下方的内容；其他块的正面隐藏标记部分，背面为完整的块。
+// 复习状态按照 SM-2 转换为 Anki 的调度状态，复习记录也会一并导出。
+func ExportAnkiDeck(deckID string) (zipPath string, err error) {
+	deckLock.Lock()
+	deck := Decks[deckID]
+	deckLock.Unlock()
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	WaitForWritingFiles()
+	name := util.FilterFileName(deck.Name)
+	exportFolder := filepath.Join(util.TempDir, "export", name+"-"+gulu.Rand.String(7))
+	if err = os.MkdirAll(exportFolder, 0755); nil != err {
+		logging.LogErrorf("create export folder [%s] failed: %s", exportFolder, err)
+		return
+	}
+	defer os.RemoveAll(exportFolder)
+
+	collectionPath := filepath.Join(exportFolder, "collection.anki2")
+	luteEngine := util.NewLute()
+	media, err := writeAnkiCollection(collectionPath, deck, func(blockID string, group int) (front, back string) {
+		return ankiCardHTML(blockID, group, luteEngine)
+	})
+	if nil != err {
+		logging.LogErrorf("write Anki collection failed: %s", err)
+		return
+	}
+
+	zipPath = filepath.Join(util.TempDir, "export", name+".apkg")
+	zip, err := gulu.Zip.Create(zipPath)
+	if nil != err {
+		logging.LogErrorf("create export Anki package [%s] failed: %s", zipPath, err)
+		return
+	}
+	if err = zip.AddEntry("collection.anki2", collectionPath); nil != err {
+		logging.LogErrorf("create export Anki package [%s] failed: %s", zipPath, err)
+		return
+	}
+	mediaNums := map[string]string{}
+	for i, asset := range media {
+		num := strconv.Itoa(i)
+		if err = zip.AddEntry(num, filepath.Join(util.DataDir, asset)); nil != err {
+			logging.LogErrorf("add Anki media [%s] failed: %s", asset, err)
+			return
+		}
+		mediaNums[num] = path.Base(asset)
+	}
+	mediaData, err := gulu.JSON.MarshalJSON(mediaNums)
+	if nil != err {
+		return
+	}
+	mediaPath := filepath.Join(exportFolder, "media")
+	if err = os.WriteFile(mediaPath, mediaData, 0644); nil != err {
+		return
+	}
+	if err = zip.AddEntry("media", mediaPath); nil != err {
+		logging.LogErrorf("create export Anki package [%s] failed: %s", zipPath, err)
+		return
+	}
+	if err = zip.Close(); nil != err {
+		logging.LogErrorf("close export Anki package failed: %s", err)
+		return
+	}
+
+	zipPath = "/export/" + url.PathEscape(filepath.Base(zipPath))
+	return
+}
+
+// writeAnkiCollection 将闪卡包 deck 写入 Anki 集合数据库 collectionPath，返回闪卡引用的资源文件。
+//
+// cardHTML 返回闪卡的正面和背面，正面为空时跳过该闪卡。
+func writeAnkiCollection(collectionPath string, deck *riff.Deck, cardHTML func(blockID string, group int) (front, back string)) (media []string, err error) {
+	db, err := sql.Open("sqlite3", collectionPath)
+	if nil != err {
+		return
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(ankiSchema); nil != err {
+		return
+	}
+
+	now := time.Now()
+	created := time.UnixMilli(deck.Created)
+	crt := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.Local)
+	mid, did := now.UnixMilli(), now.UnixMilli()+1
+	models, decks, dconf, conf := ankiCollectionConf(mid, did, deck.Name, now.Unix())
+	if _, err = db.Exec("INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		crt.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf); nil != err {
+		return
+	}
+
+	tx, err := db.Begin()
+	if nil != err {
+		return
+	}
+	defer tx.Rollback()
+
+	mediaSet := map[string]bool{}
+	ankiCardIDs := map[string]int64{}
+	nextID := now.UnixMilli()
+	for i, card := range deck.GetCards() {
+		front, back := cardHTML(card.BlockID(), card.ClozeGroup())
+		if "" == front {
+			continue
+		}
+		front, back = exportAnkiMedia(front, mediaSet, &media), exportAnkiMedia(back, mediaSet, &media)
+
+		nextID++
+		nid, cid := nextID, nextID
+		sortField := strings.TrimSpace(ankiHTMLTagRegexp.ReplaceAllString(front, ""))
+		checksum := sha1.Sum([]byte(sortField))
+		if _, err = tx.Exec("INSERT INTO notes VALUES (?, ?, ?, ?, -1, '', ?, ?, ?, 0, '')",
+			nid, gulu.Rand.String(10), mid, now.Unix(), front+ankiFieldSeparator+back, sortField, binary.BigEndian.Uint32(checksum[:4])); nil != err {
+			return
+		}
+
+		typ, queue, due, ivl, factor, left := ankiSchedule(card, crt, i)
+		if card.IsSuspended() {
+			queue = ankiQueueSuspended
+		}
+		if _, err = tx.Exec("INSERT INTO cards VALUES (?, ?, ?, 0, ?, -1, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, '')",
+			cid, nid, did, now.Unix(), typ, queue, due, ivl, factor, card.Reps(), card.Lapses(), left); nil != err {
+			return
+		}
+		ankiCardIDs[card.ID()] = cid
+	}
+
+	lastIvls := map[string]int64{}
+	lastReview := int64(0)
+	for _, log := range deck.GetReviewLogs("") {
+		cid := ankiCardIDs[log.CardID]
+		if 0 == cid {
+			continue
+		}
+
+		// 复习记录 ID 为复习时间（毫秒），需要保证唯一
+		id := log.Review
+		if id <= lastReview {
+			id = lastReview + 1
+		}
+		lastReview = id
+		ivl := int64(log.ScheduledDays)
+		if _, err = tx.Exec("INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, 2500, 0, ?)",
+			id, cid, int(log.Rating)+1, ivl, lastIvls[log.CardID], ankiRevlogType(log.State)); nil != err {
+			return
+		}
+		lastIvls[log.CardID] = ivl
+	}
+	err = tx.Commit()
+	return
+}
+
+// ankiCardHTML 返回块 blockID 作为问答题的正面和背面，group 为需要隐藏的完形填空分组。
+func ankiCardHTML(blockID string, group int, luteEngine *lute.Lute) (front, back string) {
+	tree, err := loadTreeByBlockID(blockID)
+	if nil != err {
+		logging.LogWarnf("load tree by block [%s] failed: %s", blockID, err)
+		return
+	}
+	node := treenode.GetNodeInTree(tree, blockID)
+	if nil == node {
+		return
+	}
+
+	if ast.NodeHeading == node.Type {
+		front = luteEngine.Md2HTML(treenode.ExportNodeStdMd(node, luteEngine))
+		var mds []string
+		for _, child := range treenode.HeadingChildren(node) {
+			mds = append(mds, treenode.ExportNodeStdMd(child, luteEngine))
+		}
+		back = luteEngine.Md2HTML(strings.Join(mds, "\n\n"))
+		front, back = ankiClozeHTML(front, -1), ankiClozeHTML(back, -1)
+		return
+	}
+
+	htmlStr := luteEngine.Md2HTML(treenode.ExportNodeStdMd(node, luteEngine))
+	front, back = ankiClozeHTML(htmlStr, group), ankiClozeHTML(htmlStr, -1)
+	return
+}
+
+var ankiMarkRegexp = regexp.MustCompile(`(?s)<mark>(.*?)</mark>`)
+
+// ankiClozeHTML 隐藏 HTML 中完形填空分组为 group 的标记（group 为 0 时隐藏所有标记，为 -1 时不隐藏），并去掉其他标记的分组编号。
+func ankiClozeHTML(htmlStr string, group int) string {
+	return ankiMarkRegexp.ReplaceAllStringFunc(htmlStr, func(mark string) string {
+		markGroup, content := riff.ParseClozeGroup(ankiMarkRegexp.FindStringSubmatch(mark)[1])
+		if 0 == group || (0 < group && markGroup == group) {
+			return "<span class=\"cloze\">[...]</span>"
+		}
+		return "<mark>" + content + "</mark>"
+	})
+}
+
+// exportAnkiMedia 将 HTML 中引用的资源文件路径替换为 Anki 媒体文件名，并记录到 media 中。
+func exportAnkiMedia(htmlStr string, mediaSet map[string]bool, media *[]string) string {
+	return ankiMediaRegexp.ReplaceAllStringFunc(htmlStr, func(attr string) string {
+		groups := ankiMediaRegexp.FindStringSubmatch(attr)
+		asset, unescapeErr := url.PathUnescape(groups[2])
+		if nil != unescapeErr || !strings.HasPrefix(asset, "assets/") || !gulu.File.IsExist(filepath.Join(util.DataDir, asset)) {
+			return attr
+		}
+
+		if !mediaSet[asset] {
+			mediaSet[asset] = true
+			*media = append(*media, asset)
+		}
+		return groups[1] + "=\"" + path.Base(groups[2]) + "\""
+	})
+}
+
+// ankiSchedule 将闪卡的复习状态转换为 Anki 卡片的调度状态，position 为新卡的学习顺序。
+func ankiSchedule(card riff.Card, crt time.Time, position int) (typ, queue int, due, ivl, factor, left int64) {
+	var c *riff.SM2
+	switch impl := card.Impl().(type) {
+	case *fsrs.Card:
+		c = riff.FSRSToSM2(impl)
+	case *riff.SM2:
+		c = impl
+	default:
+		c = riff.NewSM2()
+	}
+
+	if c.IsNew() {
+		return ankiCardNew, ankiCardNew, int64(position + 1), 0, 0, 0
+	}
+
+	factor = int64(c.Ease * 1000)
+	if 1 > c.Interval {
+		// 学习中的卡片到期时间为时间戳（秒）
+		typ = ankiCardLearning
+		if 0 < c.Lapses {
+			typ = ankiCardRelearn
+		}
+		return typ, ankiCardLearning, c.Due.Unix(), 0, factor, 1001
+	}
+	due = int64(c.Due.Sub(crt) / (24 * time.Hour))
+	return ankiCardReview, ankiCardReview, due, int64(c.Interval), factor, 0
+}
+
+func ankiRevlogType(state riff.State) int {
+	switch state {
+	case riff.StateReview:
+		return ankiRevlogReview
+	case riff.StateRelearning:
+		return ankiRevlogRelearn
+	default:
+		return ankiRevlogLearn
+	}
+}
+
+// ankiCollectionConf 返回 Anki 集合的笔记类型、牌组、牌组选项和集合配置，笔记类型为只有正面和背面字段的问答题。
+func ankiCollectionConf(mid, did int64, deckName string, mod int64) (models, decks, dconf, conf string) {
+	field := func(name string, ord int) map[string]interface{} {
+		return map[string]interface{}{"name": name, "ord": ord, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}}
+	}
+	model := map[string]interface{}{
+		"id": mid, "name": "Basic (SiYuan)", "type": 0, "mod": mod, "usn": -1, "sortf": 0, "did": did,
+		"tmpls": []map[string]interface{}{{
+			"name": "Card 1", "ord": 0, "qfmt": "{{Front}}", "afmt": "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+			"did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      []map[string]interface{}{field("Front", 0), field("Back", 1)},
+		"css":       ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n",
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"req":       []interface{}{[]interface{}{0, "any", []int{0}}},
+		"tags":      []string{},
+		"vers":      []string{},
+	}
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "mod": mod, "usn": -1, "desc": "", "dyn": 0, "conf": 1, "collapsed": false,
+			"extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	options := map[string]interface{}{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new":   map[string]interface{}{"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500, "order": 1, "perDay": 20, "bury": false, "separate": true},
+		"rev":   map[string]interface{}{"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "bury": false, "minSpace": 1, "hardFactor": 1.2},
+		"lapse": map[string]interface{}{"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 1},
+	}
+	collection := map[string]interface{}{
+		"nextPos": 1, "estTimes": true, "activeDecks": []int64{did}, "sortType": "noteFld", "timeLim": 0, "sortBackwards": false,
+		"addToCur": true, "curDeck": did, "newBury": true, "newSpread": 0, "dueCounts": true, "curModel": strconv.FormatInt(mid, 10), "collapseTime": 1200,
+	}
+
+	marshal := func(v interface{}) string {
+		data, _ := gulu.JSON.MarshalJSON(v)
+		return string(data)
+	}
+	models = marshal(map[string]interface{}{strconv.FormatInt(mid, 10): model})
+	decks = marshal(map[string]interface{}{"1": deck(1, "Default"), strconv.FormatInt(did, 10): deck(did, deckName)})
+	dconf = marshal(map[string]interface{}{"1": options})
+	conf = marshal(collection)
+	return
+}
+
+// ankiSchema 为 Anki 集合数据库（版本 11）的表结构。
+const ankiSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
@@ -0,0 +1,335 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"archive/zip"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/88250/lute/ast"
+	"github.com/wangxu0213/esnote-kernel/riff"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func TestAnkiRoundTrip(t *testing.T) {
+	saveDir := t.TempDir()
+	deck, err := riff.CreateDeck(saveDir, ast.NewNodeID(), riff.AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+	deck.Name = "Round Trip"
+
+	const basicID, clozeID, suspendedID = "20230101000000-basic00", "20230101000000-cloze00", "20230101000000-suspend"
+	contents := map[string][2]string{
+		basicID:     {"<p>Question</p>", "<p>Answer</p>"},
+		suspendedID: {"<p>Suspended</p>", "<p>Later</p>"},
+	}
+	const clozeHTML = "<p>A <mark>c1::one</mark> B <mark>c2::two</mark></p>"
+
+	cardIDs := map[string]string{}
+	for _, blockID := range []string{basicID, clozeID, suspendedID} {
+		cardIDs[blockID] = ast.NewNodeID()
+		deck.AddCard(cardIDs[blockID], blockID)
+	}
+	cloze := deck.GetCard(cardIDs[clozeID])
+	cloze.SetClozeGroup(2)
+	deck.SetCard(cloze)
+	deck.Review(cardIDs[basicID], riff.Easy)
+	deck.Review(cardIDs[suspendedID], riff.Again)
+	suspended := deck.GetCard(cardIDs[suspendedID])
+	suspended.SetSuspended(true)
+	deck.SetCard(suspended)
+
+	collectionPath := filepath.Join(saveDir, "collection.anki2")
+	_, err = writeAnkiCollection(collectionPath, deck, func(blockID string, group int) (front, back string) {
+		if clozeID == blockID {
+			return ankiClozeHTML(clozeHTML, group), ankiClozeHTML(clozeHTML, -1)
+		}
+		return contents[blockID][0], contents[blockID][1]
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+collectionPath+"?mode=ro")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	crt, models, decks, err := readAnkiCol(db)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(models) {
+		t.Fatalf("models [%d] not match", len(models))
+	}
+	found := false
+	for _, d := range decks {
+		found = found || deck.Name == d.Name
+	}
+	if !found {
+		t.Fatalf("deck name not match")
+	}
+	notes, err := readAnkiNotes(db)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(notes) {
+		t.Fatalf("notes [%d] not match", len(notes))
+	}
+
+	blockNotes := map[string]*ankiNote{}
+	for _, note := range notes {
+		if 2 != len(note.fields) || 1 != len(note.cards) {
+			t.Fatalf("note [%d] not match", note.id)
+		}
+		switch note.fields[0] {
+		case contents[basicID][0]:
+			blockNotes[basicID] = note
+		case contents[suspendedID][0]:
+			blockNotes[suspendedID] = note
+		default:
+			blockNotes[clozeID] = note
+		}
+	}
+
+	if note := blockNotes[basicID]; contents[basicID][1] != note.fields[1] {
+		t.Fatalf("basic back [%s] not match", note.fields[1])
+	}
+	if note := blockNotes[clozeID]; "<p>A <mark>one</mark> B <span class=\"cloze\">[...]</span></p>" != note.fields[0] ||
+		"<p>A <mark>one</mark> B <mark>two</mark></p>" != note.fields[1] {
+		t.Fatalf("cloze fields %q not match", note.fields)
+	}
+
+	cases := []struct {
+		blockID      string
+		typ, queue   int
+		reps, lapses int64
+		ratings      []riff.Rating
+	}{
+		{basicID, ankiCardReview, ankiCardReview, 1, 0, []riff.Rating{riff.Easy}},
+		{clozeID, ankiCardNew, ankiCardNew, 0, 0, nil},
+		{suspendedID, ankiCardRelearn, ankiQueueSuspended, 1, 1, []riff.Rating{riff.Again}},
+	}
+	for _, c := range cases {
+		card := blockNotes[c.blockID].cards[0]
+		if c.typ != card.typ || c.queue != card.queue || c.reps != card.reps || c.lapses != card.lapses {
+			t.Fatalf("card [%s] schedule [type=%d, queue=%d, reps=%d, lapses=%d] not match", c.blockID, card.typ, card.queue, card.reps, card.lapses)
+		}
+		if len(c.ratings) != len(card.logs) {
+			t.Fatalf("card [%s] review logs [%d] not match", c.blockID, len(card.logs))
+		}
+		for i, rating := range c.ratings {
+			if rating != card.logs[i].Rating {
+				t.Fatalf("card [%s] review log rating [%d] not match", c.blockID, card.logs[i].Rating)
+			}
+		}
+	}
+	if card := blockNotes[basicID].cards[0]; 1 > card.ivl || time.Now().After(time.Unix(crt, 0).AddDate(0, 0, int(card.due))) {
+		t.Fatalf("review card interval [%d] due [%d] not match", card.ivl, card.due)
+	}
+
+	imported, err := riff.CreateDeck(saveDir, ast.NewNodeID(), riff.AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for blockID, note := range blockNotes {
+		if err = importAnkiCard(imported, blockID, note.cards[0], crt); nil != err {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range cases {
+		cards := imported.GetCardsByBlockID(c.blockID)
+		if 1 != len(cards) {
+			t.Fatalf("imported cards of block [%s] not match", c.blockID)
+		}
+		card, origin := cards[0], deck.GetCard(cardIDs[c.blockID])
+		if origin.Reps() != card.Reps() || origin.Lapses() != card.Lapses() || origin.State() != card.State() {
+			t.Fatalf("imported card [%s] state [%d] reps [%d] not match", c.blockID, card.State(), card.Reps())
+		}
+		if origin.IsSuspended() != card.IsSuspended() {
+			t.Fatalf("imported card [%s] suspended not match", c.blockID)
+		}
+		if logs := imported.GetReviewLogs(card.ID()); len(c.ratings) != len(logs) {
+			t.Fatalf("imported card [%s] review logs [%d] not match", c.blockID, len(logs))
+		}
+	}
+}
+
+func TestImportAnkiCloze(t *testing.T) {
+	collectionPath := filepath.Join(t.TempDir(), "collection.anki2")
+	db, err := sql.Open("sqlite3", collectionPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	crt := time.Now().AddDate(0, 0, -30).Unix()
+	statements := []string{
+		ankiSchema,
+		"INSERT INTO col VALUES (1, ?, 0, 0, 11, 0, 0, 0, '{}', '{\"1\":{\"name\":\"Cloze\",\"type\":1}}', '{\"1\":{\"name\":\"Default\"}}', '{}', '{}')",
+		"INSERT INTO notes VALUES (1, 'guid', 1, 0, -1, '', '{{c1::one}} and {{c2::two::hint}}\x1fextra', '', 0, 0, '')",
+		// 第一张卡片为新卡，第二张卡片已经复习但是没有复习记录
+		"INSERT INTO cards VALUES (1, 1, 1, 0, 0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, '')",
+		"INSERT INTO cards VALUES (2, 1, 1, 1, 0, -1, 2, 2, 35, 10, 2300, 3, 1, 0, 0, 0, 0, '')",
+	}
+	for i, statement := range statements {
+		var args []interface{}
+		if 1 == i {
+			args = append(args, crt)
+		}
+		if _, err = db.Exec(statement, args...); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	_, models, _, err := readAnkiCol(db)
+	if nil != err {
+		t.Fatal(err)
+	}
+	notes, err := readAnkiNotes(db)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(notes) || 2 != len(notes[0].cards) {
+		t.Fatalf("notes not match")
+	}
+	note := notes[0]
+	if model := models[note.mid]; nil == model || ankiModelCloze != model.Type {
+		t.Fatalf("cloze model not match")
+	}
+
+	md := ankiFieldsMarkdown(note.fields, true)
+	if !strings.Contains(md, "c1::one") || !strings.Contains(md, "c2::two") || strings.Contains(md, "hint") || !strings.Contains(md, "extra") {
+		t.Fatalf("cloze markdown [%s] not match", md)
+	}
+
+	deck, err := riff.CreateDeck(t.TempDir(), ast.NewNodeID(), riff.AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+	const blockID = "20230101000000-cloze00"
+	for _, card := range note.cards {
+		card.group = card.ord + 1
+		if err = importAnkiCard(deck, blockID, card, crt); nil != err {
+			t.Fatal(err)
+		}
+	}
+	cards := deck.GetCardsByBlockID(blockID)
+	if 2 != len(cards) {
+		t.Fatalf("cards [%d] not match", len(cards))
+	}
+	for _, card := range cards {
+		switch card.ClozeGroup() {
+		case 1:
+			if riff.StateNew != card.State() || 0 != card.Reps() {
+				t.Fatalf("new card state [%d] not match", card.State())
+			}
+		case 2:
+			if riff.StateReview != card.State() || 3 != card.Reps() || 1 != card.Lapses() {
+				t.Fatalf("reviewed card state [%d] reps [%d] lapses [%d] not match", card.State(), card.Reps(), card.Lapses())
+			}
+		default:
+			t.Fatalf("cloze group [%d] not match", card.ClozeGroup())
+		}
+	}
+}
+
+func TestImportAnkiMediaRejectsPaths(t *testing.T) {
+	dataDir := util.DataDir
+	util.DataDir = t.TempDir()
+	defer func() { util.DataDir = dataDir }()
+
+	root := t.TempDir()
+	unzipPath := filepath.Join(root, "unzip")
+	if err := os.MkdirAll(unzipPath, 0755); nil != err {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(unzipPath, "media"): `{"0": "image.png", "../secret": "secret.png"}`,
+		filepath.Join(unzipPath, "0"):     "image",
+		filepath.Join(root, "secret"):     "secret",
+	}
+	for p, data := range files {
+		if err := os.WriteFile(p, []byte(data), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	media, err := importAnkiMedia(unzipPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(media) || "" == media["image.png"] {
+		t.Fatalf("media [%v] should only contain numbered files", media)
+	}
+	if _, ok := media["secret.png"]; ok {
+		t.Fatalf("media outside the package should not be imported")
+	}
+}
+
+func TestUnzipAnkiPackage(t *testing.T) {
+	root := t.TempDir()
+	writePackage := func(names ...string) string {
+		apkgPath := filepath.Join(root, "deck.apkg")
+		file, err := os.Create(apkgPath)
+		if nil != err {
+			t.Fatal(err)
+		}
+		writer := zip.NewWriter(file)
+		for _, name := range names {
+			w, err := writer.Create(name)
+			if nil != err {
+				t.Fatal(err)
+			}
+			w.Write([]byte(name))
+		}
+		writer.Close()
+		file.Close()
+		return apkgPath
+	}
+
+	unzipPath := filepath.Join(root, "unzip")
+	if err := unzipAnkiPackage(writePackage("collection.anki2", "media", "0", "notes.txt", "dir/1"), unzipPath); nil != err {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(unzipPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got := strings.Join(names, ","); "0,collection.anki2,media" != got {
+		t.Fatalf("unzipped entries [%s] not match", got)
+	}
+
+	// 路径在解压文件夹之外的条目导致解压失败
+	unzipPath = filepath.Join(root, "unzip-slip")
+	if nil == unzipAnkiPackage(writePackage("collection.anki2", "../0"), unzipPath) {
+		t.Fatalf("entry outside the destination should be rejected")
+	}
+	if _, err = os.Stat(filepath.Join(root, "0")); !os.IsNotExist(err) {
+		t.Fatalf("entry outside the destination should not be written")
+	}
+}
@@ -19,16 +19,24 @@ package model
 import (
 	"errors"
 	"fmt"
+	"path"
+	"strings"
 
+	"github.com/88250/gulu"
 	"github.com/88250/lute/ast"
 	"github.com/88250/lute/parse"
 	"github.com/wangxu0213/esnote-kernel/av"
 	"github.com/wangxu0213/esnote-kernel/logging"
 	"github.com/wangxu0213/esnote-kernel/sql"
 	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
 )
 
-func RenderAttributeView(avID string) (dom string, err error) {
+// RenderAttributeView 按照属性视图 avID 中视图 viewID 的布局、过滤规则、排序规则和显示列返回视图数据，viewID 为空时使用默认视图。
+//
+// 表格视图返回第 page 页的表格数据，pageSize 小于 1 时不分页；看板视图返回分组后的卡片；画廊视图返回带封面的卡片；
+// 日历视图返回与时间范围 [start, end]（毫秒时间戳）有交集的事件，start 或者 end 为 0 时不限制。
+func RenderAttributeView(avID, viewID string, page, pageSize int, start, end int64) (ret interface{}, err error) {
 	waitForSyncingStorages()
 
 	attrView, err := av.ParseAttributeView(avID)
@@ -37,10 +45,64 @@ func RenderAttributeView(avID string) (dom string, err error) {
 		return
 	}
 
-	_ = attrView
+	view := attrView.GetView(viewID)
+	if nil == view {
+		err = errors.New(fmt.Sprintf("view [%s] not found", viewID))
+		return
+	}
+
+	getAttributeView, content := newAttributeViewContent(attrView)
+	attrView.CalcRollups(getAttributeView, content)
+	switch view.Type {
+	case av.AttributeViewTypeBoard:
+		ret, err = attrView.QueryBoard(viewID, content)
+	case av.AttributeViewTypeGallery:
+		var gallery *av.Gallery
+		if gallery, err = attrView.QueryGallery(viewID, content); nil == err {
+			fillAttributeViewGalleryCovers(gallery)
+			ret = gallery
+		}
+	case av.AttributeViewTypeCalendar:
+		ret, err = attrView.QueryCalendar(viewID, start, end, content)
+	default:
+		ret, err = attrView.Query(viewID, page, pageSize, content)
+	}
+	if nil != err {
+		logging.LogErrorf("query attribute view [%s] failed: %s", avID, err)
+	}
 	return
 }
 
+// fillAttributeViewGalleryCovers 使用块中的第一张图片作为没有封面的卡片的封面。
+func fillAttributeViewGalleryCovers(gallery *av.Gallery) {
+	var blockIDs []string
+	for _, card := range gallery.Cards {
+		if "" == card.Cover && "" != card.BlockID {
+			blockIDs = append(blockIDs, card.BlockID)
+		}
+	}
+
+	covers := map[string]string{}
+	for _, asset := range sql.QueryBlockAssets(blockIDs) {
+		if _, ok := covers[asset.BlockID]; !ok && isAttributeViewCoverImage(asset.Path) {
+			covers[asset.BlockID] = asset.Path
+		}
+	}
+	for _, card := range gallery.Cards {
+		if "" == card.Cover {
+			card.Cover = covers[card.BlockID]
+		}
+	}
+}
+
+func isAttributeViewCoverImage(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp", ".svg":
+		return true
+	}
+	return false
+}
+
 func (tx *Transaction) doInsertAttrViewBlock(operation *Operation) (ret *TxErr) {
 	firstSrcID := operation.SrcIDs[0]
 	tree, err := tx.loadTree(firstSrcID)
@@ -102,7 +164,15 @@ func (tx *Transaction) doRemoveAttrViewBlock(operation *Operation) (ret *TxErr)
 }
 
 func (tx *Transaction) doAddAttrViewColumn(operation *Operation) (ret *TxErr) {
-	err := addAttributeViewColumn(operation.Name, operation.Typ, 1024, operation.ParentID)
+	var err error
+	switch av.ColumnType(operation.Typ) {
+	case av.ColumnTypeRelation:
+		err = addAttributeViewRelationColumn(operation)
+	case av.ColumnTypeRollup:
+		err = addAttributeViewRollupColumn(operation)
+	default:
+		err = addAttributeViewColumn(operation.Name, operation.Typ, 1024, operation.ParentID)
+	}
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
 	}
@@ -117,6 +187,415 @@ func (tx *Transaction) doRemoveAttrViewColumn(operation *Operation) (ret *TxErr)
 	return
 }
 
+func (tx *Transaction) doUpdateAttrViewCell(operation *Operation) (ret *TxErr) {
+	arg := attributeViewColumnOptionArg(operation.Data)
+	if err := tx.updateAttributeViewCell(operation.ParentID, operation.ID, arg["rowID"], arg["value"]); nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doUpdateAttrViewColumnName(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) error {
+		return attrView.RenameColumn(operation.ID, operation.Name)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+// doUpdateAttrViewColumnType 修改属性视图 operation.ParentID 的列 operation.ID 的类型为 operation.Typ。
+//
+// 转换会清空无法转换的单元格，所以修改后 operation.RetData 为修改前的列和单元格，并广播包含撤销操作的更新事务。
+func (tx *Transaction) doUpdateAttrViewColumnType(operation *Operation) (ret *TxErr) {
+	var snapshot *av.ColumnSnapshot
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		if snapshot, err = attrView.SnapshotColumn(operation.ID); nil != err {
+			return
+		}
+		return attrView.ConvertColumnType(operation.ID, av.ColumnType(operation.Typ))
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+
+	undoOp := &Operation{Action: "restoreAttrViewCol", ID: operation.ID, ParentID: operation.ParentID, Data: snapshot}
+	operation.RetData = snapshot
+	evt := util.NewCmdResult("transactions", 0, util.PushModeBroadcast)
+	evt.Data = []*Transaction{{DoOperations: []*Operation{operation}, UndoOperations: []*Operation{undoOp}}}
+	util.PushEvent(evt)
+	return
+}
+
+// doRestoreAttrViewColumn 将属性视图 operation.ParentID 的列恢复为 operation.Data 记录的列和单元格，用于撤销修改列类型。
+func (tx *Transaction) doRestoreAttrViewColumn(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		snapshot := &av.ColumnSnapshot{}
+		if err = unmarshalOperationData(operation.Data, snapshot); nil != err {
+			return
+		}
+		return attrView.RestoreColumn(snapshot)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewColumnHidden(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		column, index := attrView.GetColumn(operation.ID)
+		if nil == column {
+			return errors.New(fmt.Sprintf("column [%s] not found", operation.ID))
+		}
+		if 0 == index {
+			return errors.New("block column can not be hidden")
+		}
+		column.Hidden, _ = operation.Data.(bool)
+		return
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSortAttrViewColumn(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) error {
+		return attrView.MoveColumn(operation.ID, operation.PreviousID)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSortAttrViewRow(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) error {
+		return attrView.MoveRow(operation.ID, operation.PreviousID)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewFilters(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		var filters []*av.AttributeViewFilter
+		if err = unmarshalOperationData(operation.Data, &filters); nil != err {
+			return
+		}
+		return attrView.SetFilters(operation.ID, filters)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewSorts(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		var sorts []*av.AttributeViewSort
+		if err = unmarshalOperationData(operation.Data, &sorts); nil != err {
+			return
+		}
+		return attrView.SetSorts(operation.ID, sorts)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doAddAttrViewView(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		view := av.NewView("", av.AttributeViewTypeTable)
+		if err = unmarshalOperationData(operation.Data, view); nil != err {
+			return
+		}
+		if "" == view.ID {
+			view.ID = operation.ID
+		}
+		if "" == view.ID {
+			return errors.New("view id is empty")
+		}
+		if nil != attrView.GetView(view.ID) {
+			return errors.New(fmt.Sprintf("view [%s] already exists", view.ID))
+		}
+		return attrView.SetView(view)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doUpdateAttrViewView(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) (err error) {
+		view := attrView.GetView(operation.ID)
+		if nil == view {
+			return errors.New(fmt.Sprintf("view [%s] not found", operation.ID))
+		}
+		updated := *view
+		if err = unmarshalOperationData(operation.Data, &updated); nil != err {
+			return
+		}
+		updated.ID = view.ID // 视图 ID 不能修改
+		return attrView.SetView(&updated)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doRemoveAttrViewView(operation *Operation) (ret *TxErr) {
+	err := updateAttributeView(operation.ParentID, func(attrView *av.AttributeView) error {
+		return attrView.RemoveView(operation.ID)
+	})
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+// updateAttributeViewCell 将属性视图 avID 中行 rowID 的列 columnID 的单元格设置为 value，并同步设置到行对应块的属性中。
+//
+// 关联列的值为逗号分隔的关联行 ID，块列和汇总列不能直接修改。
+func (tx *Transaction) updateAttributeViewCell(avID, columnID, rowID, value string) (err error) {
+	attrView, column, err := getAttributeViewColumn(avID, columnID)
+	if nil != err {
+		return
+	}
+
+	switch column.Type {
+	case av.ColumnTypeBlock, av.ColumnTypeRollup:
+		err = errors.New(fmt.Sprintf("cell of column [%s] can not be updated", column.Name))
+		return
+	case av.ColumnTypeRelation:
+		err = updateAttributeViewRelationCell(avID, columnID, rowID, av.GetRelatedRowIDs(&av.Cell{Value: value}))
+		return
+	}
+
+	row := attrView.GetRow(rowID)
+	if nil == row {
+		err = errors.New(fmt.Sprintf("row [%s] not found in attribute view [%s]", rowID, avID))
+		return
+	}
+
+	_, index := attrView.GetColumn(columnID)
+	cell := row.GetCell(index)
+	if err = column.SetCellValue(cell, value); nil != err {
+		return
+	}
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	sql.RebuildAttributeViewQueue(attrView)
+
+	// 行对应的块可能已经被删除，此时仅更新属性视图
+	blockID := row.Cells[0].Value
+	tree, loadErr := tx.loadTree(blockID)
+	if nil != loadErr {
+		logging.LogWarnf("load tree [%s] failed: %s", blockID, loadErr)
+		return
+	}
+	node := treenode.GetNodeInTree(tree, blockID)
+	if nil == node {
+		return
+	}
+	attrs := parse.IAL2Map(node.KramdownIAL)
+	attrs["av"+column.ID] = cell.Value
+	err = setNodeAttrsWithTx(tx, node, tree, attrs)
+	return
+}
+
+// updateAttributeView 使用 update 修改属性视图 avID 并保存。
+func updateAttributeView(avID string, update func(attrView *av.AttributeView) error) (err error) {
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		return
+	}
+
+	if err = update(attrView); nil != err {
+		return
+	}
+
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	sql.RebuildAttributeViewQueue(attrView)
+	return
+}
+
+func unmarshalOperationData(data interface{}, v interface{}) (err error) {
+	raw, err := gulu.JSON.MarshalJSON(data)
+	if nil != err {
+		return
+	}
+	err = gulu.JSON.UnmarshalJSON(raw, v)
+	return
+}
+
+func (tx *Transaction) doAddAttrViewColumnOption(operation *Operation) (ret *TxErr) {
+	err := addAttributeViewColumnOption(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doUpdateAttrViewColumnOption(operation *Operation) (ret *TxErr) {
+	err := updateAttributeViewColumnOption(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doRemoveAttrViewColumnOption(operation *Operation) (ret *TxErr) {
+	err := removeAttributeViewColumnOption(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewColumnNumberFormat(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewColumnNumberFormat(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+// addAttributeViewColumnOption 为属性视图 operation.ParentID 的列 operation.ID 添加选项 operation.Data {"name": "", "color": ""}。
+func addAttributeViewColumnOption(operation *Operation) (err error) {
+	attrView, column, err := getAttributeViewColumn(operation.ParentID, operation.ID)
+	if nil != err {
+		return
+	}
+
+	arg := attributeViewColumnOptionArg(operation.Data)
+	if err = column.AddOption(arg["name"], arg["color"]); nil != err {
+		return
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+// updateAttributeViewColumnOption 将属性视图 operation.ParentID 的列 operation.ID 的选项 operation.Data {"oldName": "", "newName": "", "color": ""} 重命名并修改颜色，同时更新使用该选项的单元格。
+func updateAttributeViewColumnOption(operation *Operation) (err error) {
+	attrView, column, err := getAttributeViewColumn(operation.ParentID, operation.ID)
+	if nil != err {
+		return
+	}
+
+	arg := attributeViewColumnOptionArg(operation.Data)
+	oldName, newName := arg["oldName"], arg["newName"]
+	if err = column.UpdateOption(oldName, newName, arg["color"]); nil != err {
+		return
+	}
+
+	if oldName != newName {
+		renameAttributeViewCellOption(attrView, column, oldName, newName)
+	}
+
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	sql.RebuildAttributeViewQueue(attrView)
+	return
+}
+
+// removeAttributeViewColumnOption 删除属性视图 operation.ParentID 的列 operation.ID 的选项 operation.Data {"name": ""}，同时从单元格中移除该选项。
+func removeAttributeViewColumnOption(operation *Operation) (err error) {
+	attrView, column, err := getAttributeViewColumn(operation.ParentID, operation.ID)
+	if nil != err {
+		return
+	}
+
+	name := attributeViewColumnOptionArg(operation.Data)["name"]
+	if err = column.RemoveOption(name); nil != err {
+		return
+	}
+
+	renameAttributeViewCellOption(attrView, column, name, "")
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	sql.RebuildAttributeViewQueue(attrView)
+	return
+}
+
+// setAttributeViewColumnNumberFormat 设置属性视图 operation.ParentID 的数字列 operation.ID 的数字格式 operation.Data。
+func setAttributeViewColumnNumberFormat(operation *Operation) (err error) {
+	attrView, column, err := getAttributeViewColumn(operation.ParentID, operation.ID)
+	if nil != err {
+		return
+	}
+
+	if av.ColumnTypeNumber != column.Type {
+		err = errors.New(fmt.Sprintf("column [%s] is not a number column", column.Name))
+		return
+	}
+
+	format, _ := operation.Data.(string)
+	if !av.IsValidNumberFormat(av.NumberFormat(format)) {
+		err = errors.New(fmt.Sprintf("invalid number format [%s]", format))
+		return
+	}
+
+	column.NumberFormat = av.NumberFormat(format)
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func getAttributeViewColumn(avID, columnID string) (attrView *av.AttributeView, column *av.Column, err error) {
+	attrView, err = av.ParseAttributeView(avID)
+	if nil != err {
+		return
+	}
+
+	for _, c := range attrView.Columns {
+		if c.ID == columnID {
+			column = c
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("column [%s] not found in attribute view [%s]", columnID, avID))
+	return
+}
+
+func renameAttributeViewCellOption(attrView *av.AttributeView, column *av.Column, oldName, newName string) {
+	index := -1
+	for i, c := range attrView.Columns {
+		if c == column {
+			index = i
+			break
+		}
+	}
+
+	for _, row := range attrView.Rows {
+		if index < len(row.Cells) {
+			column.RenameOptionInCell(row.Cells[index], oldName, newName)
+		}
+	}
+}
+
+func attributeViewColumnOptionArg(data interface{}) (ret map[string]string) {
+	ret = map[string]string{}
+	if arg, ok := data.(map[string]interface{}); ok {
+		for k, v := range arg {
+			ret[k], _ = v.(string)
+		}
+	}
+	return
+}
+
 func addAttributeViewColumn(name string, typ string, columnIndex int, avID string) (err error) {
 	attrView, err := av.ParseAttributeView(avID)
 	if nil != err {
@@ -124,8 +603,8 @@ func addAttributeViewColumn(name string, typ string, columnIndex int, avID strin
 	}
 
 	switch av.ColumnType(typ) {
-	case av.ColumnTypeText:
-		attrView.InsertColumn(columnIndex, &av.Column{ID: "av" + ast.NewNodeID(), Name: name, Type: av.ColumnTypeText})
+	case av.ColumnTypeText, av.ColumnTypeNumber, av.ColumnTypeDate, av.ColumnTypeSelect, av.ColumnTypeMSelect:
+		attrView.InsertColumn(columnIndex, &av.Column{ID: "av" + ast.NewNodeID(), Name: name, Type: av.ColumnType(typ)})
 	default:
 		msg := fmt.Sprintf("invalid column type [%s]", typ)
 		logging.LogErrorf(msg)
@@ -143,10 +622,16 @@ func removeAttributeViewColumn(columnID string, avID string) (err error) {
 		return
 	}
 
-	for i, column := range attrView.Columns[1:] {
-		if column.ID == columnID {
-			attrView.Columns = append(attrView.Columns[:i], attrView.Columns[i+1:]...)
-			break
+	column, index := attrView.GetColumn(columnID)
+	if 1 > index {
+		// 不能移除块列
+		return
+	}
+
+	removeAttributeViewColumnAt(attrView, index)
+	if av.ColumnTypeRelation == column.Type {
+		if err = removeAttributeViewBackRelationColumn(attrView, column); nil != err {
+			return
 		}
 	}
 
@@ -154,6 +639,17 @@ func removeAttributeViewColumn(columnID string, avID string) (err error) {
 	return
 }
 
+// removeAttributeViewColumnAt 移除属性视图 attrView 中下标为 index 的列及其单元格，同时移除视图中对该列的引用。
+func removeAttributeViewColumnAt(attrView *av.AttributeView, index int) {
+	attrView.RemoveColumnRefs(attrView.Columns[index].ID)
+	attrView.Columns = append(attrView.Columns[:index], attrView.Columns[index+1:]...)
+	for _, row := range attrView.Rows {
+		if index < len(row.Cells) {
+			row.Cells = append(row.Cells[:index], row.Cells[index+1:]...)
+		}
+	}
+}
+
 func removeAttributeViewBlock(blockID, avID string, tree *parse.Tree) (ret *av.AttributeView, err error) {
 	node := treenode.GetNodeInTree(tree, blockID)
 	if nil == node {
@@ -170,6 +666,11 @@ func removeAttributeViewBlock(blockID, avID string, tree *parse.Tree) (ret *av.A
 		if row.Cells[0].Value == blockID {
 			// 从行中移除，但是不移除属性
 			ret.Rows = append(ret.Rows[:i], ret.Rows[i+1:]...)
+
+			// 移除其他行对该行的反向关联
+			if err = removeAttributeViewRowRelations(ret, row); nil != err {
+				return
+			}
 			break
 		}
 	}
@@ -0,0 +1,194 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/wangxu0213/esnote-kernel/av"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/sql"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// ExportAttributeView 将属性视图 avID 中视图 viewID 的过滤、排序和显示列结果导出为 CSV 或者 JSON 文件，viewID 为空时使用默认视图，format 为 csv 或者 json，返回导出文件的路径。
+func ExportAttributeView(avID, viewID, format string) (name, exportPath string, err error) {
+	if "csv" != format && "json" != format {
+		err = errors.New(fmt.Sprintf("unsupported export format [%s]", format))
+		return
+	}
+
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		return
+	}
+	getAttributeView, content := newAttributeViewContent(attrView)
+	attrView.CalcRollups(getAttributeView, content)
+	table, err := attrView.Query(viewID, 1, 0, content)
+	if nil != err {
+		return
+	}
+
+	var data []byte
+	if "csv" == format {
+		data, err = table.CSV()
+	} else {
+		data, err = table.JSON()
+	}
+	if nil != err {
+		return
+	}
+
+	exportFolder := filepath.Join(util.TempDir, "export")
+	if err = os.MkdirAll(exportFolder, 0755); nil != err {
+		logging.LogErrorf("create export folder [%s] failed: %s", exportFolder, err)
+		return
+	}
+	name = avID + "." + format
+	if err = gulu.File.WriteFileSafer(filepath.Join(exportFolder, name), data, 0644); nil != err {
+		logging.LogErrorf("write export attribute view [%s] failed: %s", avID, err)
+		return
+	}
+	exportPath = "/export/" + url.PathEscape(name)
+	return
+}
+
+// ImportAttributeViewCSV 从 CSV 文件 csvPath 在笔记本 boxID 中创建一篇以文件名命名的文档，文档中包含一个新的属性视图。
+//
+// CSV 第一行为列名，第一列作为块列，其他列根据值推断为数字、日期、单选或者文本列。每行数据在文档中生成一个段落块，
+// asDocs 为 true 时每行数据生成一篇子文档，第一列为空的行会被忽略。返回新建的属性视图 ID 和文档 ID。
+func ImportAttributeViewCSV(csvPath, boxID string, asDocs bool) (avID, docID string, err error) {
+	box := Conf.Box(boxID)
+	if nil == box {
+		err = errors.New(Conf.Language(0))
+		return
+	}
+
+	data, err := os.ReadFile(csvPath)
+	if nil != err {
+		return
+	}
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	avID = ast.NewNodeID()
+	attrView, contents, err := av.ImportCSV(avID, data)
+	if nil != err {
+		return
+	}
+
+	docID = ast.NewNodeID()
+	luteEngine := util.NewLute()
+	dom := luteEngine.Md2BlockDOM(fmt.Sprintf("<div data-type=\"NodeAttributeView\" data-av-id=\"%s\" data-av-type=\"%s\"></div>\n{: id=\"%s\"}", avID, av.AttributeViewTypeTable, ast.NewNodeID()), false)
+	var paragraphs []*ast.Node
+	rowDocs := map[string]string{}
+	rowAttrs := map[string]map[string]string{}
+	for i, row := range attrView.Rows {
+		blockID, content := row.Cells[0].Value, contents[i]
+		attrs := map[string]string{}
+		for j, column := range attrView.Columns[1:] {
+			attrs["av"+column.ID] = row.Cells[j+1].Value // 将列作为属性添加到块中
+		}
+
+		rowAttrs[blockID] = attrs
+		if asDocs {
+			rowDocs[blockID] = content
+			continue
+		}
+		paragraphs = append(paragraphs, newAttributeViewRowParagraph(blockID, content))
+	}
+	dom += renderBlockDOMByNodes(paragraphs, luteEngine)
+
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+
+	title := strings.TrimSuffix(filepath.Base(csvPath), filepath.Ext(csvPath))
+	tree, err := createDoc(box.ID, "/"+docID+".sy", title, dom)
+	if nil != err {
+		logging.LogErrorf("create doc for CSV [%s] failed: %s", csvPath, err)
+		return
+	}
+	if !asDocs {
+		if err = setAttributeViewRowAttrs(tree, rowAttrs); nil != err {
+			return
+		}
+		if err = indexWriteJSONQueue(tree); nil != err {
+			return
+		}
+	}
+
+	for _, row := range attrView.Rows {
+		blockID := row.Cells[0].Value
+		title, ok := rowDocs[blockID]
+		if !ok {
+			continue
+		}
+
+		tree, createErr := CreateDocByMd(box.ID, "/"+docID+"/"+blockID+".sy", title, "", nil)
+		if nil != createErr {
+			logging.LogErrorf("create doc for CSV row [%s] failed: %s", title, createErr)
+			err = createErr
+			return
+		}
+		if err = setNodeAttrs(tree.Root, tree, rowAttrs[blockID]); nil != err {
+			return
+		}
+	}
+
+	sql.RebuildAttributeViewQueue(attrView)
+	IncSync()
+	return
+}
+
+// newAttributeViewRowParagraph 新建 ID 为 blockID 的段落块。
+//
+// 内容 content 作为纯文本添加到段落中，其中的空行、列表和引述标记、IAL 或者 HTML 等都不会被解析，保证每行数据只对应一个块。
+func newAttributeViewRowParagraph(blockID, content string) (ret *ast.Node) {
+	ret = &ast.Node{ID: blockID, Type: ast.NodeParagraph}
+	ret.SetIALAttr("id", blockID)
+	ret.AppendChild(&ast.Node{Type: ast.NodeText, Tokens: []byte(content)})
+	return
+}
+
+// setAttributeViewRowAttrs 为文档 tree 中每行数据对应的块设置属性 rowAttrs（块 ID 到属性的映射）。
+//
+// 属性视图的属性不会保留在 DOM 中，所以需要在文档创建后再设置。
+func setAttributeViewRowAttrs(tree *parse.Tree, rowAttrs map[string]map[string]string) (err error) {
+	for blockID, attrs := range rowAttrs {
+		node := treenode.GetNodeInTree(tree, blockID)
+		if nil == node {
+			continue
+		}
+		if _, err = setNodeAttrs0(node, attrs); nil != err {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/wangxu0213/esnote-kernel/av"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func TestAttributeViewRowParagraph(t *testing.T) {
+	data := "Name,Note\n" +
+		"\"first line\n\nthird line\",\"say \"\"hi\"\"\"\n" +
+		"- item,list\n" +
+		"> quote,blockquote\n" +
+		"\"{: id=\"\"20230101000000-fakeid0\"\"}\",ial\n" +
+		"<div>html</div>,html\n" +
+		"\"text\n{: id=\"\"20230101000000-fakeid1\"\"}\",trailing ial\n"
+	attrView, contents, err := av.ImportCSV(ast.NewNodeID(), []byte(data))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 6 != len(attrView.Rows) || "first line\n\nthird line" != contents[0] {
+		t.Fatalf("imported rows not match")
+	}
+
+	var paragraphs []*ast.Node
+	rowAttrs := map[string]map[string]string{}
+	for i, row := range attrView.Rows {
+		paragraphs = append(paragraphs, newAttributeViewRowParagraph(row.Cells[0].Value, contents[i]))
+		rowAttrs[row.Cells[0].Value] = map[string]string{"av" + attrView.Columns[1].ID: row.Cells[1].Value}
+	}
+	luteEngine := util.NewLute()
+	tree := luteEngine.BlockDOM2Tree(renderBlockDOMByNodes(paragraphs, luteEngine))
+	if err = setAttributeViewRowAttrs(tree, rowAttrs); nil != err {
+		t.Fatal(err)
+	}
+
+	// 每行数据只对应一个段落块，内容保持原样
+	count := 0
+	for child := tree.Root.FirstChild; nil != child; child = child.Next {
+		if ast.NodeKramdownBlockIAL != child.Type {
+			count++
+		}
+	}
+	if len(attrView.Rows) != count {
+		t.Fatalf("blocks [%d] not match", count)
+	}
+	for i, row := range attrView.Rows {
+		node := treenode.GetNodeInTree(tree, row.Cells[0].Value)
+		if nil == node || ast.NodeParagraph != node.Type || tree.Root != node.Parent {
+			t.Fatalf("row [%q] block not match", contents[i])
+		}
+		if contents[i] != node.Content() {
+			t.Fatalf("row block content [%q] not match [%q]", node.Content(), contents[i])
+		}
+		if row.Cells[1].Value != node.IALAttr("av"+attrView.Columns[1].ID) {
+			t.Fatalf("row [%q] block attr [%s] not match", contents[i], node.IALAttr("av"+attrView.Columns[1].ID))
+		}
+	}
+	for _, fakeID := range []string{"20230101000000-fakeid0", "20230101000000-fakeid1"} {
+		if nil != treenode.GetNodeInTree(tree, fakeID) {
+			t.Fatalf("content should not set block id [%s]", fakeID)
+		}
+	}
+}
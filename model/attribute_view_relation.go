@@ -0,0 +1,322 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/88250/lute/ast"
+	"github.com/wangxu0213/esnote-kernel/av"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/sql"
+)
+
+func (tx *Transaction) doUpdateAttrViewRelationCell(operation *Operation) (ret *TxErr) {
+	arg, _ := operation.Data.(map[string]interface{})
+	rowID, _ := arg["rowID"].(string)
+	var relatedRowIDs []string
+	if ids, ok := arg["relatedRowIDs"].([]interface{}); ok {
+		for _, id := range ids {
+			if relatedRowID, ok := id.(string); ok {
+				relatedRowIDs = append(relatedRowIDs, relatedRowID)
+			}
+		}
+	}
+
+	err := updateAttributeViewRelationCell(operation.ParentID, operation.ID, rowID, relatedRowIDs)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.ParentID, msg: err.Error()}
+	}
+	return
+}
+
+// addAttributeViewRelationColumn 在属性视图 operation.ParentID 中添加名为 operation.Name 的关联列，
+// 并在关联的属性视图 operation.Data {"avID": "", "backName": ""} 中添加名为 backName 的反向关联列，backName 为空时使用当前属性视图的 ID 作为列名。
+func addAttributeViewRelationColumn(operation *Operation) (err error) {
+	avID := operation.ParentID
+	arg := attributeViewColumnOptionArg(operation.Data)
+	targetAvID, backName := arg["avID"], arg["backName"]
+	if "" == targetAvID {
+		err = errors.New("relation attribute view is required")
+		return
+	}
+	if !ast.IsNodeIDPattern(targetAvID) {
+		err = errors.New(fmt.Sprintf("invalid relation attribute view [%s]", targetAvID))
+		return
+	}
+	if targetAvID != avID && !av.IsAttributeViewExist(targetAvID) {
+		// 不能为不存在的属性视图创建仅包含反向关联列的数据文件
+		err = errors.New(fmt.Sprintf("relation attribute view [%s] not found", targetAvID))
+		return
+	}
+	if "" == backName {
+		backName = avID
+	}
+
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		return
+	}
+	target := attrView
+	if targetAvID != avID {
+		if target, err = av.ParseAttributeView(targetAvID); nil != err {
+			return
+		}
+	}
+
+	column := &av.Column{ID: "av" + ast.NewNodeID(), Name: operation.Name, Type: av.ColumnTypeRelation, AttributeViewID: targetAvID}
+	backColumn := &av.Column{ID: "av" + ast.NewNodeID(), Name: backName, Type: av.ColumnTypeRelation, AttributeViewID: avID}
+	column.RelationColumnID = backColumn.ID
+	backColumn.RelationColumnID = column.ID
+	attrView.InsertColumn(-1, column)
+	target.InsertColumn(-1, backColumn)
+
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	if target != attrView {
+		err = av.SaveAttributeView(target)
+	}
+	return
+}
+
+// addAttributeViewRollupColumn 在属性视图 operation.ParentID 中添加名为 operation.Name 的汇总列，
+// 汇总方式为 operation.Data {"relationColumnID": "", "targetColumnID": "", "calc": ""}。
+func addAttributeViewRollupColumn(operation *Operation) (err error) {
+	arg := attributeViewColumnOptionArg(operation.Data)
+	attrView, relationColumn, err := getAttributeViewColumn(operation.ParentID, arg["relationColumnID"])
+	if nil != err {
+		return
+	}
+	if av.ColumnTypeRelation != relationColumn.Type {
+		err = errors.New(fmt.Sprintf("column [%s] is not a relation column", relationColumn.Name))
+		return
+	}
+
+	calc := av.RollupCalc(arg["calc"])
+	if !av.IsValidRollupCalc(calc) {
+		err = errors.New(fmt.Sprintf("invalid rollup calc [%s]", calc))
+		return
+	}
+
+	target := attrView
+	if relationColumn.AttributeViewID != attrView.ID {
+		if target, err = av.ParseAttributeView(relationColumn.AttributeViewID); nil != err {
+			return
+		}
+	}
+	if targetColumn, _ := target.GetColumn(arg["targetColumnID"]); nil == targetColumn {
+		err = errors.New(fmt.Sprintf("column [%s] not found in attribute view [%s]", arg["targetColumnID"], target.ID))
+		return
+	}
+
+	attrView.InsertColumn(-1, &av.Column{
+		ID:   "av" + ast.NewNodeID(),
+		Name: operation.Name,
+		Type: av.ColumnTypeRollup,
+		Rollup: &av.ColumnRollup{
+			RelationColumnID: relationColumn.ID,
+			TargetColumnID:   arg["targetColumnID"],
+			Calc:             calc,
+		},
+	})
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+// updateAttributeViewRelationCell 将属性视图 avID 中行 rowID 的关联列 columnID 设置为关联 relatedRowIDs，并同步更新关联属性视图中的反向关联。
+func updateAttributeViewRelationCell(avID, columnID, rowID string, relatedRowIDs []string) (err error) {
+	attrView, column, err := getAttributeViewColumn(avID, columnID)
+	if nil != err {
+		return
+	}
+	if av.ColumnTypeRelation != column.Type {
+		err = errors.New(fmt.Sprintf("column [%s] is not a relation column", column.Name))
+		return
+	}
+
+	row := attrView.GetRow(rowID)
+	if nil == row {
+		err = errors.New(fmt.Sprintf("row [%s] not found in attribute view [%s]", rowID, avID))
+		return
+	}
+
+	target := attrView
+	if column.AttributeViewID != avID {
+		if target, err = av.ParseAttributeView(column.AttributeViewID); nil != err {
+			return
+		}
+	}
+	for _, relatedRowID := range relatedRowIDs {
+		if nil == target.GetRow(relatedRowID) {
+			err = errors.New(fmt.Sprintf("row [%s] not found in attribute view [%s]", relatedRowID, target.ID))
+			return
+		}
+	}
+
+	_, index := attrView.GetColumn(columnID)
+	_, backIndex := target.GetColumn(column.RelationColumnID)
+	attrView.SetRelation(row, index, relatedRowIDs, target, backIndex)
+
+	if err = av.SaveAttributeView(attrView); nil != err {
+		return
+	}
+	sql.RebuildAttributeViewQueue(attrView)
+	if target != attrView {
+		if err = av.SaveAttributeView(target); nil != err {
+			return
+		}
+		sql.RebuildAttributeViewQueue(target)
+	}
+	return
+}
+
+// removeAttributeViewRowRelations 移除关联属性视图中对已经从属性视图 attrView 中移除的行 row 的反向关联。
+func removeAttributeViewRowRelations(attrView *av.AttributeView, row *av.Row) (err error) {
+	for index, column := range attrView.Columns {
+		if av.ColumnTypeRelation != column.Type || index >= len(row.Cells) {
+			continue
+		}
+
+		relatedRowIDs := av.GetRelatedRowIDs(row.Cells[index])
+		if 1 > len(relatedRowIDs) {
+			continue
+		}
+
+		target := attrView
+		if column.AttributeViewID != attrView.ID {
+			if target, err = av.ParseAttributeView(column.AttributeViewID); nil != err {
+				return
+			}
+		}
+
+		_, backIndex := target.GetColumn(column.RelationColumnID)
+		if 0 > backIndex {
+			continue
+		}
+		for _, relatedRowID := range relatedRowIDs {
+			target.RelateRow(backIndex, relatedRowID, row.ID, false)
+		}
+		if target != attrView {
+			if err = av.SaveAttributeView(target); nil != err {
+				return
+			}
+			sql.RebuildAttributeViewQueue(target)
+		}
+	}
+	return
+}
+
+// removeAttributeViewBackRelationColumn 移除已经从属性视图 attrView 中移除的关联列 column 对应的反向关联列。
+func removeAttributeViewBackRelationColumn(attrView *av.AttributeView, column *av.Column) (err error) {
+	target := attrView
+	if column.AttributeViewID != attrView.ID {
+		if target, err = av.ParseAttributeView(column.AttributeViewID); nil != err {
+			return
+		}
+	}
+
+	_, backIndex := target.GetColumn(column.RelationColumnID)
+	if 0 > backIndex {
+		return
+	}
+	removeAttributeViewColumnAt(target, backIndex)
+	if target != attrView {
+		err = av.SaveAttributeView(target)
+	}
+	return
+}
+
+// newAttributeViewContent 返回用于渲染属性视图 attrView 的关联属性视图获取函数和块列、关联列的显示内容获取函数。
+func newAttributeViewContent(attrView *av.AttributeView) (getAttributeView func(avID string) *av.AttributeView, content func(column *av.Column, value string) string) {
+	attrViews := map[string]*av.AttributeView{attrView.ID: attrView}
+	getAttributeView = func(avID string) *av.AttributeView {
+		if ret, ok := attrViews[avID]; ok {
+			return ret
+		}
+
+		ret, err := av.ParseAttributeView(avID)
+		if nil != err {
+			logging.LogErrorf("parse attribute view [%s] failed: %s", avID, err)
+			ret = nil
+		}
+		attrViews[avID] = ret
+		return ret
+	}
+
+	// 预先批量查询当前属性视图和直接关联的属性视图中的块内容
+	contents := map[string]string{}
+	var blockIDs []string
+	collectBlockIDs := func(attrView *av.AttributeView) {
+		for _, row := range attrView.Rows {
+			if 0 < len(row.Cells) && nil != row.Cells[0] {
+				blockIDs = append(blockIDs, row.Cells[0].Value)
+			}
+		}
+	}
+	collectBlockIDs(attrView)
+	for _, column := range attrView.Columns {
+		if av.ColumnTypeRelation == column.Type && column.AttributeViewID != attrView.ID {
+			if target := getAttributeView(column.AttributeViewID); nil != target {
+				collectBlockIDs(target)
+			}
+		}
+	}
+	for i, block := range sql.GetBlocks(blockIDs) {
+		if nil != block {
+			contents[blockIDs[i]] = block.Content
+		} else {
+			contents[blockIDs[i]] = ""
+		}
+	}
+
+	blockContent := func(blockID string) string {
+		if ret, ok := contents[blockID]; ok {
+			return ret
+		}
+
+		contents[blockID] = ""
+		if block := sql.GetBlock(blockID); nil != block {
+			contents[blockID] = block.Content
+		}
+		return contents[blockID]
+	}
+
+	content = func(column *av.Column, value string) string {
+		switch column.Type {
+		case av.ColumnTypeBlock:
+			return blockContent(value)
+		case av.ColumnTypeRelation:
+			target := getAttributeView(column.AttributeViewID)
+			if nil == target {
+				return ""
+			}
+
+			var ret []string
+			for _, relatedRowID := range av.GetRelatedRowIDs(&av.Cell{Value: value}) {
+				if row := target.GetRow(relatedRowID); nil != row && 0 < len(row.Cells) && nil != row.Cells[0] {
+					ret = append(ret, blockContent(row.Cells[0].Value))
+				}
+			}
+			return strings.Join(ret, ", ")
+		}
+		return value
+	}
+	return
+}
@@ -0,0 +1,91 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wangxu0213/esnote-kernel/av"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func TestAddAttributeViewRelationColumn(t *testing.T) {
+	dataDir := util.DataDir
+	defer func() { util.DataDir = dataDir }()
+	util.DataDir = t.TempDir()
+
+	const avID, targetAvID, missingAvID = "20230101000000-avaaaaa", "20230101000000-avbbbbb", "20230101000000-avccccc"
+	for _, id := range []string{avID, targetAvID} {
+		if err := av.SaveAttributeView(av.NewAttributeView(id)); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		targetAvID string
+		ok         bool
+	}{
+		{"", false},
+		{"../" + targetAvID, false},
+		{"../../escaped", false},
+		{missingAvID, false},
+		{targetAvID, true},
+		{avID, true},
+	}
+	for _, c := range cases {
+		operation := &Operation{ParentID: avID, Name: "Relation", Data: map[string]interface{}{"avID": c.targetAvID}}
+		if err := addAttributeViewRelationColumn(operation); c.ok != (nil == err) {
+			t.Fatalf("add relation column to [%s] error [%v] not match", c.targetAvID, err)
+		}
+	}
+
+	// 不存在的属性视图不会生成数据文件
+	entries, err := os.ReadDir(filepath.Join(util.DataDir, "storage", "av"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(entries) {
+		t.Fatalf("attribute view files [%d] not match", len(entries))
+	}
+	if _, err = os.Stat(filepath.Join(util.DataDir, "escaped.json")); !os.IsNotExist(err) {
+		t.Fatalf("attribute view file should not escape the storage dir")
+	}
+
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	target, err := av.ParseAttributeView(targetAvID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 自关联时正向和反向关联列都在当前属性视图中
+	if 3 != countColumns(attrView, av.ColumnTypeRelation) || 1 != countColumns(target, av.ColumnTypeRelation) {
+		t.Fatalf("relation columns not match")
+	}
+}
+
+func countColumns(attrView *av.AttributeView, typ av.ColumnType) (ret int) {
+	for _, column := range attrView.Columns {
+		if typ == column.Type {
+			ret++
+		}
+	}
+	return
+}
@@ -61,8 +61,9 @@ type Block struct {
 	Created  string            `json:"created"`
 	Updated  string            `json:"updated"`
 
-	RiffCardID   string `json:"riffCardID"`
-	RiffCardReps uint64 `json:"riffCardReps"`
+	RiffCardID        string `json:"riffCardID"`
+	RiffCardReps      uint64 `json:"riffCardReps"`
+	RiffCardSuspended bool   `json:"riffCardSuspended"`
 }
 
 func (block *Block) IsContainerBlock() bool {
@@ -279,14 +279,23 @@ func InitConf() {
 	}
 	Conf.Sync.WebDAV.Endpoint = util.NormalizeEndpoint(Conf.Sync.WebDAV.Endpoint)
 	Conf.Sync.WebDAV.Timeout = util.NormalizeTimeout(Conf.Sync.WebDAV.Timeout)
+	if nil == Conf.Sync.Local {
+		Conf.Sync.Local = &conf.Local{}
+	}
 
 	if nil == Conf.Api {
 		Conf.Api = conf.NewAPI()
 	}
+	if 1 > Conf.Api.SQLTimeout {
+		Conf.Api.SQLTimeout = 30
+	}
 
 	if nil == Conf.Repo {
 		Conf.Repo = conf.NewRepo()
 	}
+	if nil == Conf.Repo.Retention {
+		Conf.Repo.Retention = &conf.RepoRetention{}
+	}
 
 	if 1440 < Conf.Editor.GenerateHistoryInterval {
 		Conf.Editor.GenerateHistoryInterval = 1440
@@ -337,6 +346,9 @@ func InitConf() {
 	if nil == Conf.AI {
 		Conf.AI = conf.NewAI()
 	}
+	if nil == Conf.AI.Embedding {
+		Conf.AI.Embedding = conf.NewEmbedding()
+	}
 
 	if "" != Conf.AI.OpenAI.APIKey {
 		logging.LogInfof("OpenAI API enabled\n"+
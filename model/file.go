@@ -181,6 +181,17 @@ func SearchDocsByKeyword(keyword string, flashcard bool) (ret []map[string]strin
 			}
 		}
 		rootBlocks = sql.QueryRootBlockByCondition(condition)
+
+		// 补充模糊搜索的文档，容忍拼写错误
+		hits := map[string]bool{}
+		for _, rootBlock := range rootBlocks {
+			hits[rootBlock.ID] = true
+		}
+		for _, fuzzyBlock := range sql.FuzzySearchBlocks(keyword, " AND type = 'd'", 128) {
+			if !hits[fuzzyBlock.ID] {
+				rootBlocks = append(rootBlocks, fuzzyBlock.Block)
+			}
+		}
 	} else {
 		for _, box := range boxes {
 			if flashcard {
@@ -29,7 +29,6 @@ import (
 	"github.com/88250/gulu"
 	"github.com/88250/lute/ast"
 	"github.com/88250/lute/parse"
-	"github.com/open-spaced-repetition/go-fsrs"
 	"github.com/wangxu0213/esnote-kernel/cache"
 	"github.com/wangxu0213/esnote-kernel/logging"
 	"github.com/wangxu0213/esnote-kernel/riff"
@@ -230,20 +229,22 @@ func getCardsBlocks(cards []riff.Card, page int) (blocks []*Block, total, pageCo
 		}
 
 		b.RiffCardID = cards[i].ID()
-		b.RiffCardReps = cards[i].(*riff.FSRSCard).C.Reps
+		b.RiffCardReps = cards[i].Reps()
+		b.RiffCardSuspended = cards[i].IsSuspended()
 	}
 	return
 }
 
 var (
-	// reviewCardCache <cardID, card> 用于复习时缓存卡片，以便支持撤销。
-	reviewCardCache = map[string]riff.Card{}
+	// reviewCardCache <cardID, undo> 用于复习时缓存卡片复习前的状态，以便支持撤销。
+	reviewCardCache = map[string]*riff.ReviewUndo{}
 
 	// skipCardCache <cardID, card> 用于复习时缓存跳过的卡片，以便支持跳过过滤。
 	skipCardCache = map[string]riff.Card{}
 )
 
-func ReviewFlashcard(deckID, cardID string, rating riff.Rating, reviewedCardIDs []string) (err error) {
+// ReviewFlashcard 复习闪卡，闪卡因为遗忘次数过多被自动暂停时返回 leech 为 true。
+func ReviewFlashcard(deckID, cardID string, rating riff.Rating, reviewedCardIDs []string) (leech bool, err error) {
 	deckLock.Lock()
 	defer deckLock.Unlock()
 
@@ -258,19 +259,22 @@ func ReviewFlashcard(deckID, cardID string, rating riff.Rating, reviewedCardIDs
 		return
 	}
 
-	if cachedCard := reviewCardCache[cardID]; nil != cachedCard {
+	if undo := reviewCardCache[cardID]; nil != undo {
 		// 命中缓存说明这张卡片已经复习过了，这次调用复习是撤销后再次复习
-		// 将缓存的卡片重新覆盖回卡包中，以恢复最开始复习前的状态
-		deck.SetCard(cachedCard)
+		// 将缓存的卡片和同一内容块的其他闪卡恢复到最开始复习前的状态
+		deck.UndoReview(undo)
+		deck.RemoveLastReviewLog(cardID)
 
 		// 从跳过缓存中移除（如果上一次点的是跳过的话），如果不在跳过缓存中，说明上一次点的是复习，这里移除一下也没有副作用
 		delete(skipCardCache, cardID)
 	} else {
 		// 首次复习该卡片，将卡片缓存以便后续支持撤销后再次复习
-		reviewCardCache[cardID] = card
+		reviewCardCache[cardID] = deck.PrepareReviewUndo(cardID)
 	}
 
-	deck.Review(cardID, rating)
+	if leech = deck.Review(cardID, rating); leech {
+		logging.LogInfof("suspended leech card [%s] in deck [%s]", cardID, deckID)
+	}
 	err = deck.Save()
 	if nil != err {
 		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
@@ -280,7 +284,7 @@ func ReviewFlashcard(deckID, cardID string, rating riff.Rating, reviewedCardIDs
 	dueCards, _ := getDueFlashcards(deckID, reviewedCardIDs)
 	if 1 > len(dueCards) {
 		// 该卡包中没有待复习的卡片了，说明最后一张卡片已经复习完了，清空撤销缓存和跳过缓存
-		reviewCardCache = map[string]riff.Card{}
+		reviewCardCache = map[string]*riff.ReviewUndo{}
 		skipCardCache = map[string]riff.Card{}
 	}
 	return
@@ -306,10 +310,11 @@ func SkipReviewFlashcard(deckID, cardID string) (err error) {
 }
 
 type Flashcard struct {
-	DeckID   string                 `json:"deckID"`
-	CardID   string                 `json:"cardID"`
-	BlockID  string                 `json:"blockID"`
-	NextDues map[riff.Rating]string `json:"nextDues"`
+	DeckID     string                 `json:"deckID"`
+	CardID     string                 `json:"cardID"`
+	BlockID    string                 `json:"blockID"`
+	ClozeGroup int                    `json:"clozeGroup"` // 复习时需要隐藏的完形填空分组，0 表示隐藏所有标记
+	NextDues   map[riff.Rating]string `json:"nextDues"`
 }
 
 func newFlashcard(card riff.Card, blockID, deckID string, now time.Time) *Flashcard {
@@ -319,10 +324,11 @@ func newFlashcard(card riff.Card, blockID, deckID string, now time.Time) *Flashc
 	}
 
 	return &Flashcard{
-		DeckID:   deckID,
-		CardID:   card.ID(),
-		BlockID:  blockID,
-		NextDues: nextDues,
+		DeckID:     deckID,
+		CardID:     card.ID(),
+		BlockID:    blockID,
+		ClozeGroup: card.ClozeGroup(),
+		NextDues:   nextDues,
 	}
 }
 
@@ -616,7 +622,7 @@ func (tx *Transaction) doAddFlashcards(operation *Operation) (ret *TxErr) {
 		}
 	}
 	if !foundDeck {
-		deck, createErr := createDeck0("Built-in Deck", builtinDeckID)
+		deck, createErr := createDeck0("Built-in Deck", builtinDeckID, riff.AlgoFSRS)
 		if nil == createErr {
 			Decks[deck.ID] = deck
 		}
@@ -633,6 +639,7 @@ func (tx *Transaction) doAddFlashcards(operation *Operation) (ret *TxErr) {
 	}
 
 	trees := map[string]*parse.Tree{}
+	clozeGroups := map[string][]int{}
 	for _, blockID := range blockIDs {
 		rootID := blockRoots[blockID]
 
@@ -649,6 +656,7 @@ func (tx *Transaction) doAddFlashcards(operation *Operation) (ret *TxErr) {
 		if nil == node {
 			continue
 		}
+		clozeGroups[blockID] = getClozeGroups(node)
 
 		oldAttrs := parse.IAL2Map(node.KramdownIAL)
 
@@ -676,14 +684,9 @@ func (tx *Transaction) doAddFlashcards(operation *Operation) (ret *TxErr) {
 	}
 
 	for _, blockID := range blockIDs {
-		cards := deck.GetCardsByBlockID(blockID)
-		if 0 < len(cards) {
-			// 一个块只能添加生成一张闪卡 https://github.com/siyuan-note/siyuan/issues/7476
-			continue
-		}
-
-		cardID := ast.NewNodeID()
-		deck.AddCard(cardID, blockID)
+		// 一个块只能添加生成一张闪卡 https://github.com/siyuan-note/siyuan/issues/7476
+		// 使用完形填空分组时每个分组生成一张闪卡
+		deck.SyncClozeCards(blockID, clozeGroups[blockID], ast.NewNodeID)
 	}
 
 	if err := deck.Save(); nil != err {
@@ -693,6 +696,59 @@ func (tx *Transaction) doAddFlashcards(operation *Operation) (ret *TxErr) {
 	return
 }
 
+// syncClozeCards 在制卡的块 node 或者其子块更新后，同步块中的完形填空分组对应的闪卡。
+func syncClozeCards(node *ast.Node) {
+	var cardNodes []*ast.Node
+	for n := node; nil != n && ast.NodeDocument != n.Type; n = n.Parent {
+		if "" != n.IALAttr("custom-riff-decks") {
+			cardNodes = append(cardNodes, n)
+		}
+	}
+	if 1 > len(cardNodes) {
+		return
+	}
+
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		return
+	}
+
+	for _, n := range cardNodes {
+		deckAttrs := n.IALAttr("custom-riff-decks")
+		groups := getClozeGroups(n)
+		for _, deckID := range strings.Split(deckAttrs, ",") {
+			deck := Decks[deckID]
+			if nil == deck || 1 > len(deck.GetCardsByBlockID(n.ID)) {
+				continue
+			}
+
+			if !deck.SyncClozeCards(n.ID, groups, ast.NewNodeID) {
+				continue
+			}
+			if err := deck.Save(); nil != err {
+				logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+			}
+		}
+	}
+}
+
+// getClozeGroups 返回块 node 中标记使用的完形填空分组编号，可能包含重复的编号。
+func getClozeGroups(node *ast.Node) (ret []int) {
+	ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if !entering || ast.NodeTextMark != n.Type || !n.IsTextMarkType("mark") {
+			return ast.WalkContinue
+		}
+
+		if group, _ := riff.ParseClozeGroup(n.TextMarkTextContent); 0 < group {
+			ret = append(ret, group)
+		}
+		return ast.WalkContinue
+	})
+	return
+}
+
 func LoadFlashcards() {
 	riffSavePath := getRiffDir()
 	if err := os.MkdirAll(riffSavePath, 0755); nil != err {
@@ -750,6 +806,32 @@ func RenameDeck(deckID, name string) (err error) {
 	return
 }
 
+func ConvertDeck(deckID string, algo riff.Algo) (err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	if err = deck.ConvertAlgo(algo); nil != err {
+		logging.LogErrorf("convert deck [%s] to [%s] failed: %s", deckID, algo, err)
+		return
+	}
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
 func RemoveDeck(deckID string) (err error) {
 	deckLock.Lock()
 	defer deckLock.Unlock()
@@ -774,32 +856,39 @@ func RemoveDeck(deckID string) (err error) {
 		}
 	}
 
+	logsPath := filepath.Join(riffSavePath, deckID+".logs")
+	if gulu.File.IsExist(logsPath) {
+		if err = os.Remove(logsPath); nil != err {
+			return
+		}
+	}
+
 	LoadFlashcards()
 	return
 }
 
-func CreateDeck(name string) (deck *riff.Deck, err error) {
+func CreateDeck(name string, algo riff.Algo) (deck *riff.Deck, err error) {
 	deckLock.Lock()
 	defer deckLock.Unlock()
-	return createDeck(name)
+	return createDeck(name, algo)
 }
 
-func createDeck(name string) (deck *riff.Deck, err error) {
+func createDeck(name string, algo riff.Algo) (deck *riff.Deck, err error) {
 	if syncingStorages {
 		err = errors.New(Conf.Language(81))
 		return
 	}
 
 	deckID := ast.NewNodeID()
-	deck, err = createDeck0(name, deckID)
+	deck, err = createDeck0(name, deckID, algo)
 	return
 }
 
-func createDeck0(name string, deckID string) (deck *riff.Deck, err error) {
+func createDeck0(name string, deckID string, algo riff.Algo) (deck *riff.Deck, err error) {
 	riffSavePath := getRiffDir()
-	deck, err = riff.LoadDeck(riffSavePath, deckID)
+	deck, err = riff.CreateDeck(riffSavePath, deckID, algo)
 	if nil != err {
-		logging.LogErrorf("load deck [%s] failed: %s", deckID, err)
+		logging.LogErrorf("create deck [%s] failed: %s", deckID, err)
 		return
 	}
 	deck.Name = name
@@ -812,6 +901,185 @@ func createDeck0(name string, deckID string) (deck *riff.Deck, err error) {
 	return
 }
 
+// SuspendFlashcards 暂停或者恢复闪卡包 deckID 中的闪卡 cardIDs。
+func SuspendFlashcards(deckID string, cardIDs []string, suspend bool) (err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	deck.SuspendCards(cardIDs, suspend)
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
+// BuryFlashcards 搁置或者取消搁置闪卡包 deckID 中的闪卡 cardIDs，搁置的闪卡在第二天之前不会到期。
+func BuryFlashcards(deckID string, cardIDs []string, bury bool) (err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	deck.BuryCards(cardIDs, bury)
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
+// GetLeechFlashcards 分页返回闪卡包 deckID 中的难记卡。
+func GetLeechFlashcards(deckID string, page int) (blocks []*Block, total, pageCount int) {
+	blocks = []*Block{}
+	deck := Decks[deckID]
+	if nil == deck {
+		return
+	}
+
+	blocks, total, pageCount = getCardsBlocks(deck.GetLeechCards(), page)
+	return
+}
+
+// SetDeckLifecycle 设置闪卡包 deckID 复习后是否搁置同一内容块的其他闪卡，以及难记卡的遗忘次数阈值。
+func SetDeckLifecycle(deckID string, burySiblings bool, leechLapses int) (err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	if err = deck.SetLifecycle(burySiblings, leechLapses); nil != err {
+		return
+	}
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
+// SetDeckConf 设置闪卡包 deckID 的 FSRS 算法参数，params 为 nil 时恢复为默认参数。
+func SetDeckConf(deckID string, params *riff.FSRSParams) (err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	if err = deck.SetFSRSParams(params); nil != err {
+		return
+	}
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
+// OptimizeDeck 根据闪卡包 deckID 的复习记录优化 FSRS 算法参数，apply 为 true 时将优化后的参数应用到闪卡包。
+func OptimizeDeck(deckID string, apply bool) (ret *riff.OptimizeResult, err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	if syncingStorages {
+		err = errors.New(Conf.Language(81))
+		return
+	}
+
+	deck := Decks[deckID]
+	if nil == deck {
+		err = errors.New("deck not found")
+		return
+	}
+
+	if ret, err = deck.OptimizeFSRSParams(); nil != err {
+		return
+	}
+	logging.LogInfof("optimized deck [%s] params with [%d] reviews, loss [%.4f] -> [%.4f]", deckID, ret.Reviews, ret.LossBefore, ret.LossAfter)
+	if !apply {
+		return
+	}
+
+	if err = deck.SetFSRSParams(ret.After); nil != err {
+		return
+	}
+	if err = deck.Save(); nil != err {
+		logging.LogErrorf("save deck [%s] failed: %s", deckID, err)
+		return
+	}
+	return
+}
+
+// GetRiffStats 获取闪卡包 deckID 最近 days 天的学习统计，deckID 为空时统计所有闪卡包；cardID 不为空时还会返回该闪卡的复习记录。
+func GetRiffStats(deckID, cardID string, days int) (stats *riff.Stats, cardLogs []*riff.ReviewLog, err error) {
+	deckLock.Lock()
+	defer deckLock.Unlock()
+
+	var decks []*riff.Deck
+	if "" == deckID {
+		for _, deck := range Decks {
+			decks = append(decks, deck)
+		}
+	} else {
+		deck := Decks[deckID]
+		if nil == deck {
+			err = errors.New("deck not found")
+			return
+		}
+		decks = append(decks, deck)
+	}
+
+	var logs []*riff.ReviewLog
+	var cards []riff.Card
+	cardLogs = []*riff.ReviewLog{}
+	for _, deck := range decks {
+		logs = append(logs, deck.GetReviewLogs("")...)
+		cards = append(cards, deck.GetCards()...)
+		if "" != cardID {
+			cardLogs = append(cardLogs, deck.GetReviewLogs(cardID)...)
+		}
+	}
+	stats = riff.ComputeStats(logs, cards, days, time.Now())
+	return
+}
+
 func GetDecks() (decks []*riff.Deck) {
 	deckLock.Lock()
 	defer deckLock.Unlock()
@@ -867,7 +1135,7 @@ func getDeckDueCards(deck *riff.Deck, reviewedCardIDs, blockIDs []string) (ret [
 
 	if 1 > len(reviewedCardIDs) {
 		// 未传入已复习的卡片 ID，说明是开始新的复习，需要清空缓存
-		reviewCardCache = map[string]riff.Card{}
+		reviewCardCache = map[string]*riff.ReviewUndo{}
 		skipCardCache = map[string]riff.Card{}
 	}
 
@@ -878,8 +1146,7 @@ func getDeckDueCards(deck *riff.Deck, reviewedCardIDs, blockIDs []string) (ret [
 			continue
 		}
 
-		fsrsCard := c.Impl().(*fsrs.Card)
-		if fsrs.New == fsrsCard.State {
+		if c.IsNew() {
 			newCount++
 			if newCount > Conf.Flashcard.NewCardLimit {
 				continue
@@ -390,6 +390,7 @@ func ImportRepoKey(base64Key string) (err error) {
 	}
 
 	Conf.Repo.Key = key
+	Conf.Repo.RotatingKey = nil
 	Conf.Save()
 
 	if err = os.RemoveAll(Conf.Repo.GetSaveDir()); nil != err {
@@ -414,6 +415,7 @@ func ResetRepo() (err error) {
 	}
 
 	Conf.Repo.Key = nil
+	Conf.Repo.RotatingKey = nil
 	Conf.Sync.Enabled = false
 	Conf.Save()
 
@@ -448,6 +450,136 @@ func PurgeRepo() (err error) {
 	return
 }
 
+// CheckRepo 校验本地数据仓库中的快照和对象是否完整，full 为 true 时还会校验云端是否缺失对象。
+func CheckRepo(full bool) (ret *dejavu.CheckResult, err error) {
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+
+	repo, err := newRepository()
+	if nil != err {
+		return
+	}
+
+	defer util.PushClearProgress()
+	ret, err = repo.Check(full, map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToProgress})
+	if nil != err {
+		logging.LogErrorf("check repo failed: %s", err)
+		return
+	}
+
+	if !ret.IsOK() {
+		logging.LogWarnf("repo is broken [missing=%d, corrupt=%d, cloudMissing=%d, brokenIndexes=%d]",
+			len(ret.MissingObjects), len(ret.CorruptObjects), len(ret.CloudMissingObjects), len(ret.BrokenIndexes))
+	}
+	return
+}
+
+// PackCloudRepo 将云端仓库中以单个对象存储的文件和分块迁移为包文件，仅第三方存储服务可用。
+func PackCloudRepo() (ret int, err error) {
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+	if conf.ProviderSiYuan == Conf.Sync.Provider {
+		err = errors.New("the official cloud storage does not support pack")
+		return
+	}
+
+	repo, err := newRepository()
+	if nil != err {
+		return
+	}
+
+	util.PushEndlessProgress(Conf.Language(116))
+	defer util.PushClearProgress()
+	ret, err = repo.PackCloud(map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToStatusBarAndProgress})
+	if nil != err {
+		logging.LogErrorf("pack cloud repo failed: %s", err)
+		return
+	}
+
+	Conf.Sync.Pack = true
+	Conf.Save()
+	return
+}
+
+func SetRepoRetention(retention *conf.RepoRetention) (err error) {
+	if 0 > retention.KeepLast || 0 > retention.KeepHourly || 0 > retention.KeepDaily ||
+		0 > retention.KeepWeekly || 0 > retention.KeepMonthly || 0 > retention.KeepYearly {
+		err = errors.New("invalid retention policy")
+		return
+	}
+
+	Conf.Repo.Retention = retention
+	Conf.Save()
+	return
+}
+
+// ForgetRepoSnapshots 按照快照保留策略删除旧的本地快照并清理不再被引用的数据，dryRun 为 true 时仅返回将要删除的快照。
+func ForgetRepoSnapshots(dryRun bool) (ret *dejavu.ForgetResult, err error) {
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+
+	repo, err := newRepository()
+	if nil != err {
+		return
+	}
+
+	if !dryRun {
+		util.PushEndlessProgress(Conf.Language(202))
+		defer util.PushClearProgress()
+	}
+
+	ret, err = repo.Forget(retentionPolicy(), dryRun)
+	if nil != err {
+		logging.LogErrorf("forget repo snapshots failed: %s", err)
+		return
+	}
+
+	if !dryRun && nil != ret.Purge {
+		msg := fmt.Sprintf(Conf.Language(203), ret.Purge.Indexes, ret.Purge.Objects, humanize.Bytes(uint64(ret.Purge.Size)))
+		util.PushMsg(msg, 5000)
+	}
+	return
+}
+
+// AutoForgetRepoJob 按照快照保留策略定时清理本地快照。
+func AutoForgetRepoJob() {
+	if 1 > len(Conf.Repo.Key) || retentionPolicy().IsEmpty() {
+		return
+	}
+
+	repo, err := newRepository()
+	if nil != err {
+		return
+	}
+
+	ret, err := repo.Forget(retentionPolicy(), false)
+	if nil != err {
+		logging.LogErrorf("auto forget repo snapshots failed: %s", err)
+		return
+	}
+	if 0 < len(ret.Removes) {
+		logging.LogInfof("auto forgot [%d] repo snapshots, purged [%d] objects, [%s]", len(ret.Removes), ret.Purge.Objects, humanize.Bytes(uint64(ret.Purge.Size)))
+	}
+}
+
+func retentionPolicy() *dejavu.RetentionPolicy {
+	retention := Conf.Repo.Retention
+	return &dejavu.RetentionPolicy{
+		KeepLast:    retention.KeepLast,
+		KeepHourly:  retention.KeepHourly,
+		KeepDaily:   retention.KeepDaily,
+		KeepWeekly:  retention.KeepWeekly,
+		KeepMonthly: retention.KeepMonthly,
+		KeepYearly:  retention.KeepYearly,
+	}
+}
+
 func InitRepoKeyFromPassphrase(passphrase string) (err error) {
 	passphrase = gulu.Str.RemoveInvisible(passphrase)
 	passphrase = strings.TrimSpace(passphrase)
@@ -463,25 +595,86 @@ func InitRepoKeyFromPassphrase(passphrase string) (err error) {
 		return
 	}
 
-	var key []byte
+	key, err := repoKeyFromPassphrase(passphrase)
+	if nil != err {
+		logging.LogErrorf("init data repo key failed: %s", err)
+		return
+	}
+
+	Conf.Repo.Key = key
+	Conf.Repo.RotatingKey = nil
+	Conf.Save()
+
+	initDataRepo()
+	return
+}
+
+func repoKeyFromPassphrase(passphrase string) (ret []byte, err error) {
 	base64Data, base64Err := base64.StdEncoding.DecodeString(passphrase)
 	if nil == base64Err && 32 == len(base64Data) {
 		// 改进数据仓库 `通过密码生成密钥` https://github.com/siyuan-note/siyuan/issues/6782
 		logging.LogInfof("passphrase is base64 encoded, use it as key directly")
-		key = base64Data
-	} else {
-		salt := fmt.Sprintf("%x", sha256.Sum256([]byte(passphrase)))[:16]
-		key, err = encryption.KDF(passphrase, salt)
-		if nil != err {
-			logging.LogErrorf("init data repo key failed: %s", err)
+		ret = base64Data
+		return
+	}
+
+	salt := fmt.Sprintf("%x", sha256.Sum256([]byte(passphrase)))[:16]
+	ret, err = encryption.KDF(passphrase, salt)
+	return
+}
+
+// RotateRepoKey 使用新密钥重新加密数据仓库中的所有数据，快照保持不变。
+//
+// passphrase 为空时随机生成新密钥；存在未完成的轮换时 passphrase 为空则使用之前的新密钥继续。withCloud 为 true 时同时重新加密云端仓库。
+func RotateRepoKey(passphrase string, withCloud bool) (err error) {
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+
+	passphrase = gulu.Str.RemoveInvisible(passphrase)
+	passphrase = strings.TrimSpace(passphrase)
+	newKey := Conf.Repo.RotatingKey
+	if "" != passphrase {
+		if newKey, err = repoKeyFromPassphrase(passphrase); nil != err {
+			logging.LogErrorf("rotate data repo key failed: %s", err)
+			return
+		}
+		if 0 < len(Conf.Repo.RotatingKey) && !bytes.Equal(newKey, Conf.Repo.RotatingKey) {
+			err = errors.New("there is an unfinished key rotation, please continue it with the same passphrase or leave the passphrase empty")
+			return
+		}
+	} else if 1 > len(newKey) {
+		randomBytes := make([]byte, 32)
+		if _, err = rand.Read(randomBytes); nil != err {
+			return
+		}
+		if newKey, err = encryption.KDF(string(randomBytes[:16]), string(randomBytes[16:])); nil != err {
+			logging.LogErrorf("rotate data repo key failed: %s", err)
 			return
 		}
 	}
 
-	Conf.Repo.Key = key
+	// 先保存新密钥，中断后可以继续轮换
+	Conf.Repo.RotatingKey = newKey
 	Conf.Save()
 
-	initDataRepo()
+	repo, err := newRepository0()
+	if nil != err {
+		return
+	}
+
+	util.PushEndlessProgress(Conf.Language(136))
+	defer util.PushClearProgress()
+	if err = repo.RotateKey(newKey, withCloud, map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToProgress}); nil != err {
+		logging.LogErrorf("rotate data repo key failed: %s", err)
+		return
+	}
+
+	Conf.Repo.Key = newKey
+	Conf.Repo.RotatingKey = nil
+	Conf.Save()
+	logging.LogInfof("rotated data repo key")
 	return
 }
 
@@ -515,6 +708,7 @@ func InitRepoKey() (err error) {
 		return
 	}
 	Conf.Repo.Key = key
+	Conf.Repo.RotatingKey = nil
 	Conf.Save()
 
 	initDataRepo()
@@ -577,6 +771,87 @@ func checkoutRepo(id string) {
 	return
 }
 
+// RestoreSnapshotPaths 从快照 id 中恢复 paths 指定的文档、资源文件或者文件夹，不会改动其他数据。
+//
+// 如果本地没有该快照并且 tag 不为空，则先从云端下载该标签快照。恢复后仅对恢复的文档重建索引。
+func RestoreSnapshotPaths(tag, id string, paths []string) (ret []string, err error) {
+	ret = []string{}
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+
+	repo, err := newRepository()
+	if nil != err {
+		return
+	}
+
+	util.PushEndlessProgress(Conf.Language(63))
+	defer util.PushClearProgress()
+
+	context := map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToStatusBarAndProgress}
+	if _, getErr := repo.GetIndex(id); nil != getErr {
+		if "" == tag {
+			err = getErr
+			return
+		}
+
+		if _, _, _, err = repo.DownloadTagIndex(tag, id, context); nil != err {
+			logging.LogErrorf("download cloud snapshot [%s] failed: %s", id, err)
+			return
+		}
+	}
+
+	// 恢复期间不能同步，避免上传恢复了一半的数据
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	WaitForWritingFiles()
+	CloseWatchAssets()
+	defer WatchAssets()
+
+	// 恢复快照时自动暂停同步，避免刚刚恢复后的数据又被同步覆盖
+	syncEnabled := Conf.Sync.Enabled
+	Conf.Sync.Enabled = false
+	Conf.Save()
+
+	// 恢复前先生成快照，恢复错误时可以从该快照找回数据
+	if _, err = repo.Index("[Restore] Before restoring snapshot paths", context); nil != err {
+		logging.LogErrorf("index data repo before restoring snapshot paths failed: %s", err)
+		return
+	}
+
+	upserts, err := repo.CheckoutPaths(id, paths, context)
+	if nil != err {
+		logging.LogErrorf("checkout repository paths %v failed: %s", paths, err)
+		return
+	}
+	if syncEnabled {
+		util.PushMsg(Conf.Language(134), 0)
+	}
+
+	var needReloadFlashcard bool
+	for _, file := range upserts {
+		ret = append(ret, file.Path)
+		if strings.HasPrefix(file.Path, "/storage/riff/") {
+			needReloadFlashcard = true
+		}
+	}
+	if 1 > len(ret) {
+		return
+	}
+
+	if needReloadFlashcard {
+		LoadFlashcards()
+	}
+
+	cache.ClearDocsIAL()
+	incReindex(ret, nil)
+	ReloadUI()
+	logging.LogInfof("restored [%d] files from snapshot [%s]", len(ret), id)
+	return
+}
+
 func DownloadCloudSnapshot(tag, id string) (err error) {
 	if 1 > len(Conf.Repo.Key) {
 		err = errors.New(Conf.Language(26))
@@ -1179,7 +1454,7 @@ func processSyncMergeResult(exit, byHand bool, start time.Time, mergeResult *dej
 		indexHistoryDir(filepath.Base(historyDir), luteEngine)
 	}
 
-	if 1 > len(mergeResult.Upserts) && 1 > len(mergeResult.Removes) && 1 > len(mergeResult.Conflicts) { // 没有数据变更
+	if 1 > len(mergeResult.Upserts) && 1 > len(mergeResult.Removes) && 1 > len(mergeResult.Conflicts) && 1 > len(mergeResult.Merges) { // 没有数据变更
 		syncSameCount++
 		if 10 < syncSameCount {
 			syncSameCount = 5
@@ -1213,6 +1488,11 @@ func processSyncMergeResult(exit, byHand bool, start time.Time, mergeResult *dej
 			upsertTrees++
 		}
 	}
+	for _, file := range mergeResult.Merges {
+		// 块级三路合并后的文档需要重建索引
+		upserts = append(upserts, file.Path)
+		upsertTrees++
+	}
 	for _, file := range mergeResult.Removes {
 		removes = append(removes, file.Path)
 		if strings.HasPrefix(file.Path, "/storage/riff/") {
@@ -1268,11 +1548,11 @@ func processSyncMergeResult(exit, byHand bool, start time.Time, mergeResult *dej
 }
 
 func logSyncMergeResult(mergeResult *dejavu.MergeResult) {
-	if 1 > len(mergeResult.Conflicts) && 1 > len(mergeResult.Upserts) && 1 > len(mergeResult.Removes) {
+	if 1 > len(mergeResult.Conflicts) && 1 > len(mergeResult.Upserts) && 1 > len(mergeResult.Removes) && 1 > len(mergeResult.Merges) {
 		return
 	}
 
-	logging.LogInfof("sync merge result [conflicts=%d, upserts=%d, removes=%d]", len(mergeResult.Conflicts), len(mergeResult.Upserts), len(mergeResult.Removes))
+	logging.LogInfof("sync merge result [conflicts=%d, upserts=%d, removes=%d, merges=%d]", len(mergeResult.Conflicts), len(mergeResult.Upserts), len(mergeResult.Removes), len(mergeResult.Merges))
 	if 0 < len(mergeResult.Conflicts) {
 		logBuilder := bytes.Buffer{}
 		for i, f := range mergeResult.Conflicts {
@@ -1375,6 +1655,15 @@ func resetRepository(repo *dejavu.Repo) (index *entity.Index, err error) {
 }
 
 func newRepository() (ret *dejavu.Repo, err error) {
+	if 0 < len(Conf.Repo.RotatingKey) {
+		// 数据仓库处于新旧密钥混合加密的状态，需要先完成密钥轮换
+		err = errors.New("data repo key rotation is not finished, please rotate the key again to continue")
+		return
+	}
+	return newRepository0()
+}
+
+func newRepository0() (ret *dejavu.Repo, err error) {
 	cloudConf, err := buildCloudConf()
 	if nil != err {
 		return
@@ -1397,6 +1686,8 @@ func newRepository() (ret *dejavu.Repo, err error) {
 		webdavClient.SetTimeout(time.Duration(cloudConf.WebDAV.Timeout) * time.Second)
 		webdavClient.SetTransport(httpclient.NewTransport(cloudConf.WebDAV.SkipTlsVerify))
 		cloudRepo = cloud.NewWebDAV(&cloud.BaseCloud{Conf: cloudConf}, webdavClient)
+	case conf.ProviderLocal:
+		cloudRepo = cloud.NewLocal(&cloud.BaseCloud{Conf: cloudConf})
 	default:
 		err = fmt.Errorf("unknown cloud provider [%d]", Conf.Sync.Provider)
 		return
@@ -1409,6 +1700,8 @@ func newRepository() (ret *dejavu.Repo, err error) {
 		logging.LogErrorf("init data repo failed: %s", err)
 		return
 	}
+	ret.UsePack = Conf.Sync.Pack && conf.ProviderSiYuan != Conf.Sync.Provider // 官方存储服务端不支持包文件
+	ret.SetTransferLimit(Conf.Sync.UploadLimit*1024, Conf.Sync.DownloadLimit*1024, Conf.Sync.Concurrency)
 	return
 }
 
@@ -1592,6 +1885,47 @@ func subscribeEvents() {
 		util.SetBootDetails(msg)
 		util.ContextPushMsg(context, msg)
 	})
+
+	eventbus.Subscribe(eventbus.EvtCloudBeforeUploadPack, func(context map[string]interface{}, id string) {
+		msg := fmt.Sprintf(Conf.Language(204), id[:7])
+		util.SetBootDetails(msg)
+		util.ContextPushMsg(context, msg)
+	})
+	eventbus.Subscribe(eventbus.EvtCloudBeforeDownloadPack, func(context map[string]interface{}, id string) {
+		msg := fmt.Sprintf(Conf.Language(205), id[:7])
+		util.SetBootDetails(msg)
+		util.ContextPushMsg(context, msg)
+	})
+
+	eventbus.Subscribe(eventbus.EvtRotateKeyObjectsDir, func(context map[string]interface{}, dir string) {
+		msg := fmt.Sprintf(Conf.Language(206), dir)
+		util.ContextPushMsg(context, msg)
+	})
+	eventbus.Subscribe(eventbus.EvtRotateKeyCloudPack, func(context map[string]interface{}, id string) {
+		msg := fmt.Sprintf(Conf.Language(207), id[:7])
+		util.ContextPushMsg(context, msg)
+	})
+
+	eventbus.Subscribe(eventbus.EvtCheckBeforeCheckIndexes, func(context map[string]interface{}, count int) {
+		msg := fmt.Sprintf(Conf.Language(208), count)
+		util.ContextPushMsg(context, msg)
+	})
+	eventbus.Subscribe(eventbus.EvtCheckIndex, func(context map[string]interface{}, id string) {
+		msg := fmt.Sprintf(Conf.Language(209), id[:7])
+		util.ContextPushMsg(context, msg)
+	})
+	checkObjectCount := 0
+	eventbus.Subscribe(eventbus.EvtCheckObject, func(context map[string]interface{}, id string) {
+		msg := fmt.Sprintf(Conf.Language(210), id[:7])
+		if 0 == checkObjectCount%256 {
+			util.ContextPushMsg(context, msg)
+		}
+		checkObjectCount++
+	})
+	eventbus.Subscribe(eventbus.EvtCheckBeforeCheckCloud, func(context map[string]interface{}, count int) {
+		msg := fmt.Sprintf(Conf.Language(211), count)
+		util.ContextPushMsg(context, msg)
+	})
 }
 
 func buildCloudConf() (ret *cloud.Conf, err error) {
@@ -1638,6 +1972,14 @@ func buildCloudConf() (ret *cloud.Conf, err error) {
 			SkipTlsVerify: Conf.Sync.WebDAV.SkipTlsVerify,
 			Timeout:       Conf.Sync.WebDAV.Timeout,
 		}
+	case conf.ProviderLocal:
+		if "" == Conf.Sync.Local.Endpoint {
+			err = errors.New(Conf.Language(215))
+			return
+		}
+		ret.Local = &cloud.ConfLocal{
+			Endpoint: Conf.Sync.Local.Endpoint,
+		}
 	default:
 		err = fmt.Errorf("invalid provider [%d]", Conf.Sync.Provider)
 		return
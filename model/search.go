@@ -421,6 +421,16 @@ func FullTextSearchBlock(query string, boxes, paths []string, types map[string]b
 		boxFilter := buildBoxesFilter(boxes)
 		pathFilter := buildPathsFilter(paths)
 		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByRegexp(query, boxFilter, pathFilter, typeFilter, orderByClause, beforeLen, page)
+	case 4, 5: // 语义、混合
+		typeFilter := buildTypeFilter(types)
+		boxFilter := buildBoxesFilter(boxes)
+		pathFilter := buildPathsFilter(paths)
+		blocks, matchedBlockCount, matchedRootCount = fullTextSearchBySemantic(query, boxFilter, pathFilter, typeFilter, 5 == method, beforeLen, page)
+	case 6: // 模糊
+		typeFilter := buildTypeFilter(types)
+		boxFilter := buildBoxesFilter(boxes)
+		pathFilter := buildPathsFilter(paths)
+		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByFuzzy(query, boxFilter, pathFilter, typeFilter, beforeLen, page)
 	default: // 关键字
 		filter := buildTypeFilter(types)
 		boxFilter := buildBoxesFilter(boxes)
@@ -698,6 +708,27 @@ func fullTextSearchRefBlock(keyword string, beforeLen int, onlyDoc bool) (ret []
 	stmt += orderBy + " LIMIT " + strconv.Itoa(Conf.Search.Limit)
 	blocks := sql.SelectBlocksRawStmtNoParse(stmt, Conf.Search.Limit)
 	ret = fromSQLBlocks(&blocks, "", beforeLen)
+
+	// 结果不足时补充模糊搜索的结果，容忍拼写错误
+	if len(ret) < Conf.Search.Limit {
+		filter := " AND type IN " + Conf.Search.TypeFilter()
+		if onlyDoc {
+			filter = " AND type = 'd'"
+		}
+		hits := map[string]bool{}
+		for _, b := range ret {
+			hits[b.ID] = true
+		}
+		for _, fuzzyBlock := range sql.FuzzySearchBlocks(keyword, filter, Conf.Search.Limit) {
+			if hits[fuzzyBlock.ID] {
+				continue
+			}
+			ret = append(ret, fromSQLBlock(markFuzzyBlock(fuzzyBlock), "", beforeLen))
+			if len(ret) >= Conf.Search.Limit {
+				break
+			}
+		}
+	}
 	if 1 > len(ret) {
 		ret = []*Block{}
 	}
@@ -741,6 +772,151 @@ func fullTextSearchByRegexp(exp, boxFilter, pathFilter, typeFilter, orderBy stri
 	return
 }
 
+const (
+	semanticSearchLimit = 512 // 语义搜索和混合搜索中每种检索方式最多召回的块数
+	rrfK                = 60  // 倒数排名融合（Reciprocal Rank Fusion）的平滑常数
+)
+
+// fullTextSearchBySemantic 按照语义相似度搜索块，hybrid 为 true 时将语义搜索和关键字搜索的结果按照倒数排名融合。
+// 结果总是按照相关度降序排列，未启用语义搜索时回退到关键字搜索。
+func fullTextSearchBySemantic(query, boxFilter, pathFilter, typeFilter string, hybrid bool, beforeLen, page int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	query = gulu.Str.RemoveInvisible(query)
+	if !sql.IsEmbeddingEnabled() || "" == query {
+		return fullTextSearchByKeyword(query, boxFilter, pathFilter, typeFilter, buildOrderBy(0, 0), beforeLen, page)
+	}
+
+	ids, _, err := sql.SearchEmbeddings(query, semanticSearchLimit)
+	if nil != err {
+		logging.LogErrorf("search embeddings failed: %s", err)
+		return fullTextSearchByKeyword(query, boxFilter, pathFilter, typeFilter, buildOrderBy(0, 0), beforeLen, page)
+	}
+
+	scores := map[string]float64{}
+	for i, id := range ids {
+		scores[id] += 1.0 / float64(rrfK+i+1)
+	}
+	if hybrid {
+		table := "blocks_fts" // 大小写敏感
+		if !Conf.Search.CaseSensitive {
+			table = "blocks_fts_case_insensitive"
+		}
+		stmt := "SELECT id FROM " + table + " WHERE (`" + table + "` MATCH '" + columnFilter() + ":(" + stringQuery(query) + ")'"
+		stmt += ") AND type IN " + typeFilter
+		stmt += boxFilter + pathFilter
+		stmt += " ORDER BY rank LIMIT " + strconv.Itoa(semanticSearchLimit)
+		result, _ := sql.Query(stmt)
+		for i, row := range result {
+			scores[row["id"].(string)] += 1.0 / float64(rrfK+i+1)
+		}
+	}
+	if 1 > len(scores) {
+		ret = []*Block{}
+		return
+	}
+
+	var candidates []string
+	for id := range scores {
+		candidates = append(candidates, id)
+	}
+	stmt := "SELECT * FROM `blocks` WHERE id IN ('" + strings.Join(candidates, "','") + "') AND type IN " + typeFilter
+	stmt += boxFilter + pathFilter
+	blocks := sql.SelectBlocksRawStmtNoParse(stmt, len(candidates))
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if scores[blocks[i].ID] == scores[blocks[j].ID] {
+			return blocks[i].ID < blocks[j].ID
+		}
+		return scores[blocks[i].ID] > scores[blocks[j].ID]
+	})
+
+	matchedBlockCount = len(blocks)
+	roots := map[string]bool{}
+	for _, b := range blocks {
+		roots[b.RootID] = true
+	}
+	matchedRootCount = len(roots)
+
+	start := (page - 1) * pageSize
+	if start > len(blocks) {
+		start = len(blocks)
+	}
+	end := start + pageSize
+	if end > len(blocks) {
+		end = len(blocks)
+	}
+	blocks = blocks[start:end]
+	ret = fromSQLBlocks(&blocks, "", beforeLen)
+	if 1 > len(ret) {
+		ret = []*Block{}
+	}
+	return
+}
+
+// fullTextSearchByFuzzy 模糊搜索块，容忍拼写错误和变音符号的差异，结果总是按照相似度降序排列。
+func fullTextSearchByFuzzy(query, boxFilter, pathFilter, typeFilter string, beforeLen, page int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	query = gulu.Str.RemoveInvisible(query)
+	if ast.IsNodeIDPattern(query) {
+		ret, matchedBlockCount, matchedRootCount = searchBySQL("SELECT * FROM `blocks` WHERE `id` = '"+query+"'", beforeLen, page)
+		return
+	}
+
+	// 需要所有命中的块来计算总数和分页，不能使用搜索结果数限制
+	fuzzyBlocks := sql.FuzzySearchBlocks(query, " AND type IN "+typeFilter+boxFilter+pathFilter, 0)
+	matchedBlockCount = len(fuzzyBlocks)
+	roots := map[string]bool{}
+	for _, fuzzyBlock := range fuzzyBlocks {
+		roots[fuzzyBlock.RootID] = true
+	}
+	matchedRootCount = len(roots)
+
+	start := (page - 1) * pageSize
+	if start > len(fuzzyBlocks) {
+		start = len(fuzzyBlocks)
+	}
+	end := start + pageSize
+	if end > len(fuzzyBlocks) {
+		end = len(fuzzyBlocks)
+	}
+	ret = []*Block{}
+	for _, fuzzyBlock := range fuzzyBlocks[start:end] {
+		ret = append(ret, fromSQLBlock(markFuzzyBlock(fuzzyBlock), "", beforeLen))
+	}
+	return
+}
+
+// markFuzzyBlock 使用搜索高亮标记包裹块内容中模糊命中的位置。
+func markFuzzyBlock(fuzzyBlock *sql.FuzzyBlock) (ret *sql.Block) {
+	ret = &sql.Block{}
+	*ret = *fuzzyBlock.Block
+	content := []rune(ret.Content)
+	marks := make([]int, len(content)+1) // 1：开始标记，-1：结束标记
+	for _, span := range fuzzyBlock.Spans {
+		if span[0] >= span[1] || span[1] > len(content) {
+			continue
+		}
+		marks[span[0]]++
+		marks[span[1]]--
+	}
+
+	buf := strings.Builder{}
+	depth := 0
+	for i := 0; i <= len(content); i++ {
+		if 0 != marks[i] {
+			newDepth := depth + marks[i]
+			if 0 == depth && 0 < newDepth {
+				buf.WriteString(search.SearchMarkLeft)
+			} else if 0 < depth && 0 == newDepth {
+				buf.WriteString(search.SearchMarkRight)
+			}
+			depth = newDepth
+		}
+		if i < len(content) {
+			buf.WriteRune(content[i])
+		}
+	}
+	ret.Content = buf.String()
+	return
+}
+
 func fullTextSearchCountByRegexp(exp, boxFilter, pathFilter, typeFilter string) (matchedBlockCount, matchedRootCount int) {
 	fieldFilter := fieldRegexp(exp)
 	stmt := "SELECT COUNT(id) AS `matches`, COUNT(DISTINCT(root_id)) AS `docs` FROM `blocks` WHERE " + fieldFilter + " AND type IN " + typeFilter
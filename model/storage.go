@@ -18,6 +18,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
@@ -27,6 +28,7 @@ import (
 	"github.com/88250/lute/parse"
 	"github.com/wangxu0213/esnote-kernel/filelock"
 	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/sql"
 	"github.com/wangxu0213/esnote-kernel/treenode"
 	"github.com/wangxu0213/esnote-kernel/util"
 )
@@ -287,6 +289,80 @@ func getCriteria() (ret []*Criterion, err error) {
 	return
 }
 
+var attrSchemaLock = sync.Mutex{}
+
+// SetAttrSchema 声明属性值类型 schema（属性名 -> text/number/date/boolean），未声明的属性根据属性值自动推断类型。
+func SetAttrSchema(schema map[string]string) (err error) {
+	for name, valueType := range schema {
+		if !sql.IsValidAttrValueType(valueType) {
+			return errors.New(fmt.Sprintf("invalid value type [%s] of attribute [%s]", valueType, name))
+		}
+	}
+
+	attrSchemaLock.Lock()
+	defer attrSchemaLock.Unlock()
+
+	if err = setAttrSchema(schema); nil != err {
+		return
+	}
+	sql.SetAttributeSchema(schema)
+	return
+}
+
+func GetAttrSchema() (ret map[string]string) {
+	attrSchemaLock.Lock()
+	defer attrSchemaLock.Unlock()
+	ret, _ = getAttrSchema()
+	return
+}
+
+// LoadAttrSchema 加载声明的属性值类型。
+func LoadAttrSchema() {
+	sql.SetAttributeSchema(GetAttrSchema())
+}
+
+func setAttrSchema(schema map[string]string) (err error) {
+	dirPath := filepath.Join(util.DataDir, "storage")
+	if err = os.MkdirAll(dirPath, 0755); nil != err {
+		logging.LogErrorf("create storage [attr-schema] dir failed: %s", err)
+		return
+	}
+
+	data, err := gulu.JSON.MarshalIndentJSON(schema, "", "  ")
+	if nil != err {
+		logging.LogErrorf("marshal storage [attr-schema] failed: %s", err)
+		return
+	}
+
+	lsPath := filepath.Join(dirPath, "attr-schema.json")
+	err = filelock.WriteFile(lsPath, data)
+	if nil != err {
+		logging.LogErrorf("write storage [attr-schema] failed: %s", err)
+		return
+	}
+	return
+}
+
+func getAttrSchema() (ret map[string]string, err error) {
+	ret = map[string]string{}
+	dataPath := filepath.Join(util.DataDir, "storage/attr-schema.json")
+	if !gulu.File.IsExist(dataPath) {
+		return
+	}
+
+	data, err := filelock.ReadFile(dataPath)
+	if nil != err {
+		logging.LogErrorf("read storage [attr-schema] failed: %s", err)
+		return
+	}
+
+	if err = gulu.JSON.UnmarshalJSON(data, &ret); nil != err {
+		logging.LogErrorf("unmarshal storage [attr-schema] failed: %s", err)
+		return
+	}
+	return
+}
+
 var localStorageLock = sync.Mutex{}
 
 func RemoveLocalStorageVals(keys []string) (err error) {
@@ -319,13 +319,19 @@ func incReindex(upserts, removes []string) {
 	}
 }
 
-func SetCloudSyncDir(name string) {
+func SetCloudSyncDir(name string) (err error) {
 	if Conf.Sync.CloudName == name {
 		return
 	}
 
+	if !cloud.IsValidCloudDirName(name) {
+		err = errors.New(Conf.Language(37))
+		return
+	}
+
 	Conf.Sync.CloudName = name
 	Conf.Save()
+	return
 }
 
 func SetSyncGenerateConflictDoc(b bool) {
@@ -334,6 +340,25 @@ func SetSyncGenerateConflictDoc(b bool) {
 	return
 }
 
+func SetSyncPack(b bool) {
+	Conf.Sync.Pack = b
+	Conf.Save()
+	return
+}
+
+func SetSyncTransfer(uploadLimit, downloadLimit int64, concurrency int) (err error) {
+	if 0 > uploadLimit || 0 > downloadLimit || 0 > concurrency || 32 < concurrency {
+		err = errors.New("invalid sync transfer settings")
+		return
+	}
+
+	Conf.Sync.UploadLimit = uploadLimit
+	Conf.Sync.DownloadLimit = downloadLimit
+	Conf.Sync.Concurrency = concurrency
+	Conf.Save()
+	return
+}
+
 func SetSyncEnable(b bool) {
 	Conf.Sync.Enabled = b
 	Conf.Save()
@@ -385,10 +410,31 @@ func SetSyncProviderWebDAV(webdav *conf.WebDAV) (err error) {
 	return
 }
 
+func SetSyncProviderLocal(local *conf.Local) (err error) {
+	local.Endpoint = strings.TrimSpace(local.Endpoint)
+	if "" == local.Endpoint {
+		err = errors.New(Conf.Language(215))
+		return
+	}
+	local.Endpoint = filepath.Clean(local.Endpoint)
+	if !filepath.IsAbs(local.Endpoint) {
+		err = fmt.Errorf(Conf.Language(213), local.Endpoint)
+		return
+	}
+	if util.IsSubPath(util.WorkspaceDir, local.Endpoint) || util.IsSubPath(local.Endpoint, util.WorkspaceDir) {
+		err = fmt.Errorf(Conf.Language(214), local.Endpoint)
+		return
+	}
+
+	Conf.Sync.Local = local
+	Conf.Save()
+	return
+}
+
 var syncLock = sync.Mutex{}
 
 func CreateCloudSyncDir(name string) (err error) {
-	if conf.ProviderSiYuan != Conf.Sync.Provider {
+	if conf.ProviderSiYuan != Conf.Sync.Provider && conf.ProviderLocal != Conf.Sync.Provider {
 		err = errors.New(Conf.Language(131))
 		return
 	}
@@ -413,7 +459,7 @@ func CreateCloudSyncDir(name string) (err error) {
 }
 
 func RemoveCloudSyncDir(name string) (err error) {
-	if conf.ProviderSiYuan != Conf.Sync.Provider {
+	if conf.ProviderSiYuan != Conf.Sync.Provider && conf.ProviderLocal != Conf.Sync.Provider {
 		err = errors.New(Conf.Language(131))
 		return
 	}
@@ -572,6 +618,18 @@ func isProviderOnline(byHand bool) (ret bool) {
 	case conf.ProviderWebDAV:
 		checkURL = Conf.Sync.WebDAV.Endpoint
 		skipTlsVerify = Conf.Sync.WebDAV.SkipTlsVerify
+	case conf.ProviderLocal:
+		// 本地目录不需要检查网络，只需要检查目录是否可用（比如 NAS 未挂载、U 盘未插入）
+		if ret = gulu.File.IsDir(Conf.Sync.Local.Endpoint); !ret {
+			if 1 > autoSyncErrCount || byHand {
+				util.PushErrMsg(fmt.Sprintf(Conf.Language(212), Conf.Sync.Local.Endpoint)+" (Provider: "+conf.ProviderToStr(Conf.Sync.Provider)+")", 5000)
+			}
+			if !byHand {
+				planSyncAfter(fixSyncInterval)
+				autoSyncErrCount++
+			}
+		}
+		return
 	default:
 		logging.LogWarnf("unknown provider: %d", Conf.Sync.Provider)
 		return false
@@ -0,0 +1,93 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/wangxu0213/esnote-kernel/cache"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// doToggleTask 切换任务列表项 operation.ID 的完成状态，operation.Data 为 true 或者 false 时设置为该状态。
+//
+// 切换后 operation.RetData 为任务列表项的块 DOM，并广播包含撤销操作的更新事务。
+func (tx *Transaction) doToggleTask(operation *Operation) (ret *TxErr) {
+	id := operation.ID
+	tree, err := tx.loadTree(id)
+	if nil != err {
+		logging.LogErrorf("load tree [%s] failed: %s", id, err)
+		return &TxErr{code: TxErrCodeBlockNotFound, id: id}
+	}
+
+	node := treenode.GetNodeInTree(tree, id)
+	if nil == node || ast.NodeListItem != node.Type || nil == node.ListData || 3 != node.ListData.Typ {
+		logging.LogErrorf("get task [%s] in tree [%s] failed", id, tree.Root.ID)
+		return &TxErr{code: TxErrCodeBlockNotFound, id: id}
+	}
+
+	checked := !node.ListData.Checked
+	if data, ok := operation.Data.(bool); ok {
+		checked = data
+	}
+	transaction := toggleTask(node, checked, tx.luteEngine)
+
+	if err = tx.writeTree(tree); nil != err {
+		return &TxErr{code: TxErrCodeWriteTree, msg: err.Error(), id: id}
+	}
+	cache.PutBlockIAL(id, parse.IAL2Map(node.KramdownIAL))
+
+	operation.RetData = transaction.DoOperations[0].Data
+	evt := util.NewCmdResult("transactions", 0, util.PushModeBroadcast)
+	evt.Data = []*Transaction{transaction}
+	util.PushEvent(evt)
+	return
+}
+
+// toggleTask 设置任务列表项 node 的完成状态为 checked 并刷新更新时间，子任务不受影响。
+//
+// 返回用于广播的事务，操作和撤销操作分别使用切换后和切换前的块 DOM 更新任务列表项。
+func toggleTask(node *ast.Node, checked bool, luteEngine *lute.Lute) (ret *Transaction) {
+	undoOp := &Operation{Action: "update", ID: node.ID, Data: lute.RenderNodeBlockDOM(node, luteEngine.ParseOptions, luteEngine.RenderOptions)}
+
+	node.ListData.Checked = checked
+	ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.WalkContinue
+		}
+		if n != node && ast.NodeListItem == n.Type {
+			return ast.WalkSkipChildren // 不修改子任务
+		}
+		if ast.NodeTaskListItemMarker == n.Type {
+			n.TaskListItemChecked = checked
+			if checked {
+				n.Tokens = []byte("[X]")
+			} else {
+				n.Tokens = []byte("[ ]")
+			}
+		}
+		return ast.WalkContinue
+	})
+	refreshUpdated(node)
+
+	doOp := &Operation{Action: "update", ID: node.ID, Data: lute.RenderNodeBlockDOM(node, luteEngine.ParseOptions, luteEngine.RenderOptions)}
+	ret = &Transaction{DoOperations: []*Operation{doOp}, UndoOperations: []*Operation{undoOp}}
+	return
+}
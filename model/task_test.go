@@ -0,0 +1,100 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func TestToggleTask(t *testing.T) {
+	luteEngine := util.NewLute()
+	md := "- {: id=\"20230101000000-parent0\" updated=\"20230101000000\"}[ ] parent\n" +
+		"  - {: id=\"20230101000000-child00\" updated=\"20230101000000\"}[X] child\n" +
+		"  {: id=\"20230101000000-sublist\" updated=\"20230101000000\"}\n" +
+		"{: id=\"20230101000000-list000\" updated=\"20230101000000\"}\n"
+	tree := parse.Parse("", []byte(md), luteEngine.ParseOptions)
+
+	cases := []struct {
+		id               string
+		checked          bool
+		expectedParent   bool
+		expectedChild    bool
+		expectedListItem string
+	}{
+		// 切换子任务不影响父任务
+		{"20230101000000-child00", false, false, false, "[ ]"},
+		{"20230101000000-parent0", true, true, false, "[X]"},
+		{"20230101000000-child00", true, true, true, "[X]"},
+		{"20230101000000-parent0", false, false, true, "[ ]"},
+	}
+	for _, c := range cases {
+		node := treenode.GetNodeInTree(tree, c.id)
+		if nil == node {
+			t.Fatalf("task [%s] not found", c.id)
+		}
+		oldUpdated := node.IALAttr("updated")
+
+		transaction := toggleTask(node, c.checked, luteEngine)
+		parent := treenode.GetNodeInTree(tree, "20230101000000-parent0")
+		child := treenode.GetNodeInTree(tree, "20230101000000-child00")
+		if c.expectedParent != parent.ListData.Checked || c.expectedChild != child.ListData.Checked {
+			t.Fatalf("toggle task [%s] to [%v] got parent [%v] child [%v]", c.id, c.checked, parent.ListData.Checked, child.ListData.Checked)
+		}
+		var marker *ast.Node
+		ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
+			if entering && n != node && ast.NodeListItem == n.Type {
+				return ast.WalkSkipChildren
+			}
+			if entering && ast.NodeTaskListItemMarker == n.Type {
+				marker = n
+			}
+			return ast.WalkContinue
+		})
+		if nil == marker || c.checked != marker.TaskListItemChecked || c.expectedListItem != string(marker.Tokens) {
+			t.Fatalf("task marker of [%s] not match", c.id)
+		}
+
+		updated := node.IALAttr("updated")
+		if "" == updated || "20230101000000" == updated || updated < oldUpdated {
+			t.Fatalf("updated [%s] of task [%s] should be refreshed", updated, c.id)
+		}
+		if updated != treenode.GetNodeInTree(tree, "20230101000000-list000").IALAttr("updated") {
+			t.Fatalf("updated of parent blocks should be refreshed")
+		}
+
+		if 1 != len(transaction.DoOperations) || 1 != len(transaction.UndoOperations) {
+			t.Fatalf("transaction of toggling task [%s] not match", c.id)
+		}
+		doOp, undoOp := transaction.DoOperations[0], transaction.UndoOperations[0]
+		doDOM, undoDOM := doOp.Data.(string), undoOp.Data.(string)
+		if "update" != doOp.Action || "update" != undoOp.Action || c.id != doOp.ID || c.id != undoOp.ID {
+			t.Fatalf("operations of toggling task [%s] not match", c.id)
+		}
+		if !strings.Contains(doDOM, "data-node-id=\""+c.id+"\"") || !strings.Contains(doDOM, "updated=\""+updated+"\"") || !strings.Contains(undoDOM, "updated=\""+oldUpdated+"\"") {
+			t.Fatalf("DOM of toggling task [%s] not match:\n%s\n%s", c.id, doDOM, undoDOM)
+		}
+		if c.checked != strings.Contains(strings.SplitN(doDOM, "</div>", 2)[0], "protyle-task--done") {
+			t.Fatalf("checked state of DOM [%s] not match", doDOM)
+		}
+	}
+}
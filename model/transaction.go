@@ -108,6 +108,8 @@ func flushTx() {
 			return
 		case TxErrCodeDataIsSyncing:
 			util.PushErrMsg(Conf.Language(81), 5000)
+		case TxErrWriteAttributeView:
+			util.PushErrMsg(txErr.msg, 5000)
 		default:
 			logging.LogFatalf(logging.ExitCodeFatal, "transaction failed: %s", txErr.msg)
 		}
@@ -212,6 +214,8 @@ func performTx(tx *Transaction) (ret *TxErr) {
 			ret = tx.doUnfoldHeading(op)
 		case "setAttrs":
 			ret = tx.doSetAttrs(op)
+		case "toggleTask":
+			ret = tx.doToggleTask(op)
 		case "addFlashcards":
 			ret = tx.doAddFlashcards(op)
 		case "removeFlashcards":
@@ -224,6 +228,40 @@ func performTx(tx *Transaction) (ret *TxErr) {
 			ret = tx.doAddAttrViewColumn(op)
 		case "removeAttrViewCol":
 			ret = tx.doRemoveAttrViewColumn(op)
+		case "addAttrViewColOption":
+			ret = tx.doAddAttrViewColumnOption(op)
+		case "updateAttrViewColOption":
+			ret = tx.doUpdateAttrViewColumnOption(op)
+		case "removeAttrViewColOption":
+			ret = tx.doRemoveAttrViewColumnOption(op)
+		case "setAttrViewColNumberFormat":
+			ret = tx.doSetAttrViewColumnNumberFormat(op)
+		case "updateAttrViewRelationCell":
+			ret = tx.doUpdateAttrViewRelationCell(op)
+		case "updateAttrViewCell":
+			ret = tx.doUpdateAttrViewCell(op)
+		case "updateAttrViewColName":
+			ret = tx.doUpdateAttrViewColumnName(op)
+		case "updateAttrViewColType":
+			ret = tx.doUpdateAttrViewColumnType(op)
+		case "restoreAttrViewCol":
+			ret = tx.doRestoreAttrViewColumn(op)
+		case "setAttrViewColHidden":
+			ret = tx.doSetAttrViewColumnHidden(op)
+		case "sortAttrViewCol":
+			ret = tx.doSortAttrViewColumn(op)
+		case "sortAttrViewRow":
+			ret = tx.doSortAttrViewRow(op)
+		case "setAttrViewFilters":
+			ret = tx.doSetAttrViewFilters(op)
+		case "setAttrViewSorts":
+			ret = tx.doSetAttrViewSorts(op)
+		case "addAttrViewView":
+			ret = tx.doAddAttrViewView(op)
+		case "updateAttrViewView":
+			ret = tx.doUpdateAttrViewView(op)
+		case "removeAttrViewView":
+			ret = tx.doRemoveAttrViewView(op)
 		}
 
 		if nil != ret {
@@ -925,6 +963,8 @@ func (tx *Transaction) doUpdate(operation *Operation) (ret *TxErr) {
 	if err = tx.writeTree(tree); nil != err {
 		return &TxErr{code: TxErrCodeWriteTree, msg: err.Error(), id: id}
 	}
+
+	syncClozeCards(updatedNode)
 	return
 }
 
@@ -37,6 +37,39 @@ type Card interface {
 
 	// SetImpl 设置具体的闪卡实现。
 	SetImpl(c interface{})
+
+	// IsNew 判断是否是制卡后没有进行过复习的闪卡。
+	IsNew() bool
+
+	// Reps 返回复习次数。
+	Reps() uint64
+
+	// State 返回学习状态。
+	State() State
+
+	// Due 返回到期时间。
+	Due() time.Time
+
+	// Lapses 返回遗忘次数。
+	Lapses() uint64
+
+	// IsSuspended 判断闪卡是否已暂停，暂停的闪卡不会到期。
+	IsSuspended() bool
+
+	// SetSuspended 设置闪卡是否暂停。
+	SetSuspended(suspended bool)
+
+	// IsBuried 判断闪卡在 now 时是否处于搁置中，搁置中的闪卡不会到期。
+	IsBuried(now time.Time) bool
+
+	// SetBuriedUntil 设置闪卡的搁置截止时间，零值表示取消搁置。
+	SetBuriedUntil(until time.Time)
+
+	// ClozeGroup 返回闪卡对应的完形填空分组编号，0 表示隐藏内容块中的所有标记。
+	ClozeGroup() int
+
+	// SetClozeGroup 设置闪卡对应的完形填空分组编号。
+	SetClozeGroup(group int)
 }
 
 // BaseCard 描述了基础的闪卡实现。
@@ -44,6 +77,10 @@ type BaseCard struct {
 	CID   string
 	BID   string
 	NDues map[Rating]time.Time
+
+	Suspended   bool      // 是否暂停
+	BuriedUntil time.Time // 搁置截止时间
+	CGroup      int       // 完形填空分组编号
 }
 
 func (card *BaseCard) NextDues() map[Rating]time.Time {
@@ -61,3 +98,44 @@ func (card *BaseCard) ID() string {
 func (card *BaseCard) BlockID() string {
 	return card.BID
 }
+
+func (card *BaseCard) IsSuspended() bool {
+	return card.Suspended
+}
+
+func (card *BaseCard) SetSuspended(suspended bool) {
+	card.Suspended = suspended
+}
+
+func (card *BaseCard) IsBuried(now time.Time) bool {
+	return now.Before(card.BuriedUntil)
+}
+
+func (card *BaseCard) SetBuriedUntil(until time.Time) {
+	card.BuriedUntil = until
+}
+
+func (card *BaseCard) ClozeGroup() int {
+	return card.CGroup
+}
+
+func (card *BaseCard) SetClozeGroup(group int) {
+	card.CGroup = group
+}
+
+// clone 返回基础闪卡的深拷贝。
+func (card *BaseCard) clone() *BaseCard {
+	ret := *card
+	if nil != card.NDues {
+		ret.NDues = map[Rating]time.Time{}
+		for rating, due := range card.NDues {
+			ret.NDues[rating] = due
+		}
+	}
+	return &ret
+}
+
+// available 判断闪卡在 now 时是否可以参与复习，暂停和搁置中的闪卡不参与复习。
+func (card *BaseCard) available(now time.Time) bool {
+	return !card.Suspended && !card.IsBuried(now)
+}
@@ -0,0 +1,103 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var clozeGroupRegexp = regexp.MustCompile(`^c(\d+)::`)
+
+// ParseClozeGroup 解析标记文本 text 开头的完形填空分组编号，比如 c1::answer 返回分组 1 和去掉编号后的文本 answer。
+//
+// 没有编号时返回分组 0 和原文本。
+func ParseClozeGroup(text string) (group int, content string) {
+	content = text
+	groups := clozeGroupRegexp.FindStringSubmatch(text)
+	if nil == groups {
+		return
+	}
+
+	group, err := strconv.Atoi(groups[1])
+	if nil != err || 1 > group {
+		group = 0
+		return
+	}
+	content = text[len(groups[0]):]
+	return
+}
+
+// SyncClozeCards 使内容块 blockID 的闪卡和完形填空分组 groups 一一对应，groups 为空时内容块只对应一张隐藏所有标记的闪卡。
+//
+// 分组已经不存在的闪卡会优先改为新增的分组以保留复习状态，多余的闪卡会被删除，仍然缺少的分组使用 newCardID 生成闪卡 ID 新建闪卡。
+// 闪卡有变更时返回 true，此时需要调用 Save 保存闪卡包。
+func (deck *Deck) SyncClozeCards(blockID string, groups []int, newCardID func() string) (changed bool) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	wanted := map[int]bool{}
+	for _, group := range groups {
+		if 0 < group {
+			wanted[group] = true
+		}
+	}
+	if 1 > len(wanted) {
+		wanted[0] = true
+	}
+
+	cards := deck.store.GetCardsByBlockID(blockID)
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].ClozeGroup() < cards[j].ClozeGroup() })
+	var stales []Card
+	for _, card := range cards {
+		if wanted[card.ClozeGroup()] {
+			delete(wanted, card.ClozeGroup())
+			continue
+		}
+		stales = append(stales, card)
+	}
+
+	var missing []int
+	for group := range wanted {
+		missing = append(missing, group)
+	}
+	sort.Ints(missing)
+
+	for _, card := range stales {
+		if 0 < len(missing) {
+			card.SetClozeGroup(missing[0])
+			deck.store.SetCard(card)
+			missing = missing[1:]
+			continue
+		}
+		deck.store.RemoveCard(card.ID())
+	}
+
+	for _, group := range missing {
+		card := deck.store.AddCard(newCardID(), blockID)
+		card.SetClozeGroup(group)
+		deck.store.SetCard(card)
+	}
+
+	changed = 0 < len(stales) || 0 < len(missing)
+	if changed {
+		deck.Updated = time.Now().UnixMilli()
+	}
+	return
+}
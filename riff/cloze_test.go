@@ -0,0 +1,127 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseClozeGroup(t *testing.T) {
+	if group, content := ParseClozeGroup("c12::answer"); 12 != group || "answer" != content {
+		t.Fatalf("cloze group [%d, %s] not match", group, content)
+	}
+	if group, content := ParseClozeGroup("answer"); 0 != group || "answer" != content {
+		t.Fatalf("cloze group [%d, %s] not match", group, content)
+	}
+	if group, content := ParseClozeGroup("c0::answer"); 0 != group || "c0::answer" != content {
+		t.Fatalf("cloze group [%d, %s] not match", group, content)
+	}
+}
+
+func TestSyncClozeCards(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	blockID, cardID := newID(), newID()
+	deck.AddCard(cardID, blockID)
+	deck.Review(cardID, Good)
+
+	// 原来的闪卡改为第一个分组并保留复习状态
+	if !deck.SyncClozeCards(blockID, []int{2, 1, 2}, newID) || 2 != len(deck.GetCardsByBlockID(blockID)) {
+		t.Fatalf("sync cloze cards not match")
+	}
+	card := deck.GetCard(cardID)
+	if 1 != card.ClozeGroup() || 1 != card.Reps() {
+		t.Fatalf("existing card should be kept for group 1")
+	}
+	if err = deck.Save(); nil != err {
+		t.Fatal(err)
+	}
+
+	deck, err = LoadDeck(saveDir, deckID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(deck.GetCardsByBlockID(blockID)) || 1 != deck.GetCard(cardID).ClozeGroup() {
+		t.Fatalf("cloze cards should be saved")
+	}
+	if deck.SyncClozeCards(blockID, []int{1, 2}, newID) {
+		t.Fatalf("cloze cards should not be changed")
+	}
+
+	// 取消分组后只保留一张闪卡
+	deck.SyncClozeCards(blockID, nil, newID)
+	if 1 != len(deck.GetCardsByBlockID(blockID)) || 0 != deck.GetCard(cardID).ClozeGroup() {
+		t.Fatalf("sync cloze cards not match")
+	}
+}
+
+func TestConvertClozeCards(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	blockID := newID()
+	deck.SyncClozeCards(blockID, []int{1, 2, 3}, newID)
+	groups := map[string]int{}
+	for _, card := range deck.GetCardsByBlockID(blockID) {
+		groups[card.ID()] = card.ClozeGroup()
+		if 2 == card.ClozeGroup() {
+			deck.Review(card.ID(), Good)
+		}
+	}
+
+	for _, algo := range []Algo{AlgoSM2, AlgoFSRS} {
+		if err = deck.ConvertAlgo(algo); nil != err {
+			t.Fatal(err)
+		}
+		if err = deck.Save(); nil != err {
+			t.Fatal(err)
+		}
+		if deck, err = LoadDeck(saveDir, deckID); nil != err {
+			t.Fatal(err)
+		}
+
+		cards := deck.GetCardsByBlockID(blockID)
+		if 3 != len(cards) {
+			t.Fatalf("converted cloze cards [%d] not match", len(cards))
+		}
+		for _, card := range cards {
+			if groups[card.ID()] != card.ClozeGroup() {
+				t.Fatalf("converted [%s] card [%s] cloze group [%d] not match", algo, card.ID(), card.ClozeGroup())
+			}
+			if reviewed := 2 == card.ClozeGroup(); reviewed == card.IsNew() {
+				t.Fatalf("converted [%s] card [%s] review state not match", algo, card.ID())
+			}
+		}
+		if deck.SyncClozeCards(blockID, []int{1, 2, 3}, newID) {
+			t.Fatalf("converted [%s] cloze cards should not be changed", algo)
+		}
+	}
+}
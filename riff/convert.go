@@ -0,0 +1,135 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs"
+)
+
+const (
+	fsrsMinDifficulty = 1.0
+	fsrsMaxDifficulty = 10.0
+	sm2MaxEase        = 3.0 // 转换时使用的最大难度系数，对应 FSRS 的最小难度
+)
+
+// ConvertAlgo 将闪卡包转换为使用算法 algo，到期时间、复习次数和遗忘次数等复习状态会尽量保留，暂停、搁置和完形填空分组等闪卡状态会原样保留。
+//
+// 转换后需要调用 Save 保存闪卡包。
+func (deck *Deck) ConvertAlgo(algo Algo) (err error) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	if algo == deck.Algo {
+		return
+	}
+
+	store, err := newStore(algo, deck.ID, deck.store.GetSaveDir())
+	if nil != err {
+		return
+	}
+
+	for _, card := range deck.store.GetCardsByBlockIDs(deck.store.GetBlockIDs()) {
+		converted := store.AddCard(card.ID(), card.BlockID())
+		if base, convertedBase := baseCard(card), baseCard(converted); nil != base && nil != convertedBase {
+			*convertedBase = *base
+		}
+		switch c := card.Impl().(type) {
+		case *fsrs.Card:
+			if AlgoSM2 == algo {
+				converted.SetImpl(FSRSToSM2(c))
+			}
+		case *SM2:
+			if AlgoFSRS == algo {
+				converted.SetImpl(SM2ToFSRS(c))
+			}
+		default:
+			err = errors.New("not supported yet")
+			return
+		}
+	}
+
+	deck.Algo = algo
+	deck.store = store
+	deck.applyFSRSParams()
+	deck.Updated = time.Now().UnixMilli()
+	return
+}
+
+// baseCard 返回闪卡的基础实现，用于在不同算法的闪卡之间复制暂停、搁置等状态。
+func baseCard(card Card) *BaseCard {
+	switch c := card.(type) {
+	case *FSRSCard:
+		return c.BaseCard
+	case *SM2Card:
+		return c.BaseCard
+	}
+	return nil
+}
+
+// FSRSToSM2 将 FSRS 复习状态转换为 SM-2 复习状态，FSRS 难度线性映射为 SM-2 难度系数。
+func FSRSToSM2(c *fsrs.Card) (ret *SM2) {
+	ret = NewSM2()
+	if fsrs.New == c.State {
+		return
+	}
+
+	ret.Due = c.Due
+	ret.Interval = c.ScheduledDays
+	ret.Reps = c.Reps
+	ret.Lapses = c.Lapses
+	ret.LastReview = c.LastReview
+	if fsrs.Review == c.State {
+		// FSRS 不记录连续记住的次数，这里按照间隔推算：间隔超过 1 天的卡片至少已经连续记住了 2 次
+		ret.Repetition = 1
+		if 1 < ret.Interval {
+			ret.Repetition = 2
+		}
+	}
+
+	difficulty := math.Min(math.Max(c.Difficulty, fsrsMinDifficulty), fsrsMaxDifficulty)
+	ret.Ease = sm2MaxEase - (difficulty-fsrsMinDifficulty)*(sm2MaxEase-sm2MinEase)/(fsrsMaxDifficulty-fsrsMinDifficulty)
+	return
+}
+
+// SM2ToFSRS 将 SM-2 复习状态转换为 FSRS 复习状态，SM-2 间隔作为 FSRS 稳定性的近似值。
+func SM2ToFSRS(c *SM2) (ret *fsrs.Card) {
+	card := fsrs.NewCard()
+	ret = &card
+	if c.IsNew() {
+		return
+	}
+
+	ret.Due = c.Due
+	ret.ScheduledDays = c.Interval
+	ret.Reps = c.Reps
+	ret.Lapses = c.Lapses
+	ret.LastReview = c.LastReview
+	ret.Stability = math.Max(float64(c.Interval), 1)
+	if !c.LastReview.IsZero() {
+		ret.ElapsedDays = uint64(math.Round(float64(time.Since(c.LastReview) / time.Hour / 24)))
+	}
+
+	ease := math.Min(math.Max(c.Ease, sm2MinEase), sm2MaxEase)
+	ret.Difficulty = fsrsMinDifficulty + (sm2MaxEase-ease)*(fsrsMaxDifficulty-fsrsMinDifficulty)/(sm2MaxEase-sm2MinEase)
+
+	ret.State = fsrs.State(c.State())
+	return
+}
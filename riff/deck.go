@@ -37,7 +37,12 @@ type Deck struct {
 	Created int64  // 创建时间
 	Updated int64  // 更新时间
 
-	store Store // 底层存储
+	FSRSParams   *FSRSParams // FSRS 算法参数，为空时使用默认参数
+	BurySiblings bool        // 复习后是否搁置同一内容块的其他闪卡直到第二天
+	LeechLapses  int         // 遗忘次数达到该值时闪卡被认为是难记卡并自动暂停，0 表示不检测
+
+	store Store        // 底层存储
+	logs  []*ReviewLog // 复习记录
 	lock  *sync.Mutex
 }
 
@@ -45,12 +50,14 @@ type Deck struct {
 func LoadDeck(saveDir, id string) (deck *Deck, err error) {
 	created := time.Now().UnixMilli()
 	deck = &Deck{
-		ID:      id,
-		Name:    id,
-		Algo:    AlgoFSRS,
-		Created: created,
-		Updated: created,
-		lock:    &sync.Mutex{},
+		ID:           id,
+		Name:         id,
+		Algo:         AlgoFSRS,
+		Created:      created,
+		Updated:      created,
+		BurySiblings: true,
+		LeechLapses:  DefaultLeechLapses,
+		lock:         &sync.Mutex{},
 	}
 
 	dataPath := getDeckMsgpackPath(saveDir, id)
@@ -69,19 +76,60 @@ func LoadDeck(saveDir, id string) (deck *Deck, err error) {
 		}
 	}
 
-	var store Store
-	switch deck.Algo {
-	case AlgoFSRS:
-		store = NewFSRSStore(deck.ID, saveDir)
-		err = store.Load()
-	default:
-		err = errors.New("not supported yet")
+	store, err := newStore(deck.Algo, deck.ID, saveDir)
+	if nil != err {
 		return
 	}
-	if nil != err {
+	if err = store.Load(); nil != err {
 		return
 	}
 	deck.store = store
+	deck.applyFSRSParams()
+	deck.logs, err = loadReviewLogs(saveDir, deck.ID)
+	return
+}
+
+// CreateDeck 在文件夹 saveDir 中新建使用算法 algo 的 id 闪卡包，algo 为空时使用 FSRS。
+//
+// 如果闪卡包已经存在则直接加载，此时 algo 不起作用。
+func CreateDeck(saveDir, id string, algo Algo) (deck *Deck, err error) {
+	if gulu.File.IsExist(getDeckMsgpackPath(saveDir, id)) {
+		return LoadDeck(saveDir, id)
+	}
+	if "" == algo {
+		algo = AlgoFSRS
+	}
+
+	store, err := newStore(algo, id, saveDir)
+	if nil != err {
+		return
+	}
+
+	created := time.Now().UnixMilli()
+	deck = &Deck{
+		ID:           id,
+		Name:         id,
+		Algo:         algo,
+		Created:      created,
+		Updated:      created,
+		BurySiblings: true,
+		LeechLapses:  DefaultLeechLapses,
+		store:        store,
+		logs:         []*ReviewLog{},
+		lock:         &sync.Mutex{},
+	}
+	return
+}
+
+func newStore(algo Algo, id, saveDir string) (ret Store, err error) {
+	switch algo {
+	case AlgoFSRS:
+		ret = NewFSRSStore(id, saveDir)
+	case AlgoSM2:
+		ret = NewSM2Store(id, saveDir)
+	default:
+		err = errors.New("not supported yet")
+	}
 	return
 }
 
@@ -191,16 +239,58 @@ func (deck *Deck) Save() (err error) {
 		logging.LogErrorf("save deck failed: %s", err)
 		return
 	}
+	err = saveReviewLogs(saveDir, deck.ID, deck.logs)
 	return
 }
 
-// Review 复习一张闪卡，rating 为复习评分结果。
-func (deck *Deck) Review(cardID string, rating Rating) {
+// Review 复习一张闪卡，rating 为复习评分结果，闪卡因为遗忘次数过多被自动暂停时返回 leech 为 true。
+func (deck *Deck) Review(cardID string, rating Rating) (leech bool) {
 	deck.lock.Lock()
 	defer deck.lock.Unlock()
 
-	deck.store.Review(cardID, rating)
+	log := deck.store.Review(cardID, rating)
+	if nil == log {
+		return
+	}
+	deck.logs = append(deck.logs, log)
+	leech = deck.afterReview(cardID, rating, time.UnixMilli(log.Review))
 	deck.Updated = time.Now().UnixMilli()
+	return
+}
+
+// RemoveLastReviewLog 移除闪卡 cardID 最近的一条复习记录，用于撤销复习。
+func (deck *Deck) RemoveLastReviewLog(cardID string) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	for i := len(deck.logs) - 1; 0 <= i; i-- {
+		if cardID == deck.logs[i].CardID {
+			deck.logs = append(deck.logs[:i], deck.logs[i+1:]...)
+			return
+		}
+	}
+}
+
+// GetReviewLogs 返回复习记录，cardID 不为空时仅返回该闪卡的复习记录。
+func (deck *Deck) GetReviewLogs(cardID string) (ret []*ReviewLog) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	ret = []*ReviewLog{}
+	for _, log := range deck.logs {
+		if "" == cardID || cardID == log.CardID {
+			ret = append(ret, log)
+		}
+	}
+	return
+}
+
+// GetCards 返回所有闪卡。
+func (deck *Deck) GetCards() (ret []Card) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	return deck.store.GetCardsByBlockIDs(deck.store.GetBlockIDs())
 }
 
 // Dues 返回所有到期的闪卡。
@@ -19,6 +19,7 @@ package riff
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/open-spaced-repetition/go-fsrs"
 )
@@ -81,3 +82,72 @@ func TestDeck(t *testing.T) {
 		t.Fatalf("card count [%d] != [1]", count)
 	}
 }
+
+func TestConvertDeck(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoSM2)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cardID, newCardID, suspendedCardID, buriedCardID := newID(), newID(), newID(), newID()
+	deck.AddCard(cardID, newID())
+	deck.AddCard(newCardID, newID())
+	deck.AddCard(suspendedCardID, newID())
+	deck.AddCard(buriedCardID, newID())
+	deck.Review(cardID, Good)
+	deck.Review(cardID, Good)
+	due := deck.GetCard(cardID).Impl().(*SM2).Due
+	deck.SuspendCards([]string{suspendedCardID}, true)
+	buriedUntil := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	buried := deck.GetCard(buriedCardID)
+	buried.SetBuriedUntil(buriedUntil)
+	deck.SetCard(buried)
+
+	if err = deck.ConvertAlgo(AlgoFSRS); nil != err {
+		t.Fatal(err)
+	}
+	if err = deck.Save(); nil != err {
+		t.Fatal(err)
+	}
+
+	deck, err = LoadDeck(saveDir, deckID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if AlgoFSRS != deck.Algo || 4 != deck.CountCards() {
+		t.Fatalf("deck algo [%s], count [%d]", deck.Algo, deck.CountCards())
+	}
+	c := deck.GetCard(cardID).Impl().(*fsrs.Card)
+	if fsrs.Review != c.State || 2 != c.Reps || !due.Equal(c.Due) || 6 != c.Stability {
+		t.Fatalf("converted fsrs card not match: %+v", c)
+	}
+	if !deck.GetCard(newCardID).IsNew() {
+		t.Fatalf("new card should be kept new")
+	}
+	if !deck.GetCard(suspendedCardID).IsSuspended() {
+		t.Fatalf("suspended card should be kept suspended")
+	}
+	if !deck.GetCard(buriedCardID).IsBuried(time.Now()) || !deck.GetCard(buriedCardID).IsBuried(buriedUntil.Add(-time.Second)) || deck.GetCard(buriedCardID).IsBuried(buriedUntil) {
+		t.Fatalf("buried card should be kept buried")
+	}
+
+	if err = deck.ConvertAlgo(AlgoSM2); nil != err {
+		t.Fatal(err)
+	}
+	sm2 := deck.GetCard(cardID).Impl().(*SM2)
+	if 6 != sm2.Interval || 2 != sm2.Repetition || 2 != sm2.Reps || !due.Equal(sm2.Due) {
+		t.Fatalf("converted sm2 card not match: %+v", sm2)
+	}
+	if !deck.GetCard(suspendedCardID).IsSuspended() || !deck.GetCard(buriedCardID).IsBuried(time.Now()) {
+		t.Fatalf("suspended and buried cards should be kept after converting back")
+	}
+	for _, card := range deck.Dues() {
+		if suspendedCardID == card.ID() || buriedCardID == card.ID() {
+			t.Fatalf("suspended or buried card [%s] should not be due", card.ID())
+		}
+	}
+}
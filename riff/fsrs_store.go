@@ -47,7 +47,7 @@ func (store *FSRSStore) AddCard(id, blockID string) Card {
 	defer store.lock.Unlock()
 
 	c := fsrs.NewCard()
-	card := &FSRSCard{BaseCard: &BaseCard{id, blockID, nil}, C: &c}
+	card := &FSRSCard{BaseCard: &BaseCard{CID: id, BID: blockID}, C: &c}
 	store.cards[id] = card
 	return card
 }
@@ -133,7 +133,7 @@ func (store *FSRSStore) GetDueCardsByBlockIDs(blockIDs []string) (ret []Card) {
 	now := time.Now()
 	for _, card := range store.cards {
 		c := card.Impl().(*fsrs.Card)
-		if now.Before(c.Due) {
+		if now.Before(c.Due) || !card.available(now) {
 			continue
 		}
 
@@ -164,7 +164,7 @@ func (store *FSRSStore) CountCards() int {
 	return len(store.cards)
 }
 
-func (store *FSRSStore) Review(cardId string, rating Rating) {
+func (store *FSRSStore) Review(cardId string, rating Rating) (ret *ReviewLog) {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
@@ -175,10 +175,20 @@ func (store *FSRSStore) Review(cardId string, rating Rating) {
 		return
 	}
 
-	schedulingInfo := store.params.Repeat(*card.C, now)
-	updated := schedulingInfo[fsrs.Rating(rating)].Card
+	schedulingInfo := store.params.Repeat(*card.C, now)[fsrs.Rating(rating)]
+	updated := schedulingInfo.Card
 	card.SetImpl(&updated)
 	store.cards[cardId] = card
+
+	log := schedulingInfo.ReviewLog
+	ret = &ReviewLog{
+		CardID:        cardId,
+		Rating:        rating,
+		ElapsedDays:   log.ElapsedDays,
+		ScheduledDays: log.ScheduledDays,
+		State:         State(log.State),
+		Review:        log.Review.UnixMilli(),
+	}
 	return
 }
 
@@ -189,7 +199,7 @@ func (store *FSRSStore) Dues() (ret []Card) {
 	now := time.Now()
 	for _, card := range store.cards {
 		c := card.Impl().(*fsrs.Card)
-		if now.Before(c.Due) {
+		if now.Before(c.Due) || !card.available(now) {
 			continue
 		}
 
@@ -261,3 +271,23 @@ func (card *FSRSCard) Impl() interface{} {
 func (card *FSRSCard) SetImpl(c interface{}) {
 	card.C = c.(*fsrs.Card)
 }
+
+func (card *FSRSCard) IsNew() bool {
+	return fsrs.New == card.C.State
+}
+
+func (card *FSRSCard) Reps() uint64 {
+	return card.C.Reps
+}
+
+func (card *FSRSCard) State() State {
+	return State(card.C.State)
+}
+
+func (card *FSRSCard) Due() time.Time {
+	return card.C.Due
+}
+
+func (card *FSRSCard) Lapses() uint64 {
+	return card.C.Lapses
+}
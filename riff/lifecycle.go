@@ -0,0 +1,182 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultLeechLapses 为默认的难记卡遗忘次数阈值。
+const DefaultLeechLapses = 8
+
+// SetLifecycle 设置复习后是否搁置同一内容块的其他闪卡 burySiblings 和难记卡遗忘次数阈值 leechLapses（0 表示不检测）。
+//
+// 设置后需要调用 Save 保存闪卡包。
+func (deck *Deck) SetLifecycle(burySiblings bool, leechLapses int) (err error) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	if 0 > leechLapses {
+		err = errors.New("leech lapses must not be negative")
+		return
+	}
+
+	deck.BurySiblings = burySiblings
+	deck.LeechLapses = leechLapses
+	deck.Updated = time.Now().UnixMilli()
+	return
+}
+
+// SuspendCards 暂停或者恢复闪卡 cardIDs，暂停的闪卡在恢复前不会到期。
+func (deck *Deck) SuspendCards(cardIDs []string, suspend bool) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	for _, cardID := range cardIDs {
+		if card := deck.store.GetCard(cardID); nil != card {
+			card.SetSuspended(suspend)
+			deck.store.SetCard(card)
+		}
+	}
+	deck.Updated = time.Now().UnixMilli()
+}
+
+// BuryCards 搁置或者取消搁置闪卡 cardIDs，搁置的闪卡在第二天之前不会到期。
+func (deck *Deck) BuryCards(cardIDs []string, bury bool) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	var until time.Time
+	if bury {
+		until = tomorrow(time.Now())
+	}
+	for _, cardID := range cardIDs {
+		if card := deck.store.GetCard(cardID); nil != card {
+			card.SetBuriedUntil(until)
+			deck.store.SetCard(card)
+		}
+	}
+	deck.Updated = time.Now().UnixMilli()
+}
+
+// GetLeechCards 返回遗忘次数达到难记卡阈值的闪卡，未开启难记卡检测时返回空。
+func (deck *Deck) GetLeechCards() (ret []Card) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	if 1 > deck.LeechLapses {
+		return
+	}
+	for _, card := range deck.store.GetCardsByBlockIDs(deck.store.GetBlockIDs()) {
+		if uint64(deck.LeechLapses) <= card.Lapses() {
+			ret = append(ret, card)
+		}
+	}
+	return
+}
+
+// afterReview 在闪卡 cardID 于 now 复习后搁置同一内容块的其他闪卡，并在遗忘次数达到阈值时暂停闪卡，闪卡被暂停时返回 true。
+func (deck *Deck) afterReview(cardID string, rating Rating, now time.Time) (leech bool) {
+	card := deck.store.GetCard(cardID)
+	if nil == card {
+		return
+	}
+
+	if deck.BurySiblings {
+		for _, sibling := range deck.store.GetCardsByBlockID(card.BlockID()) {
+			if cardID != sibling.ID() {
+				sibling.SetBuriedUntil(tomorrow(now))
+				deck.store.SetCard(sibling)
+			}
+		}
+	}
+
+	// 仅在本次复习遗忘时检测，避免手动恢复的难记卡在下次记住时再次被暂停
+	if Again == rating && 0 < deck.LeechLapses && uint64(deck.LeechLapses) <= card.Lapses() {
+		card.SetSuspended(true)
+		deck.store.SetCard(card)
+		leech = true
+	}
+	return
+}
+
+// ReviewUndo 记录了复习一张闪卡前的状态，用于撤销复习。
+type ReviewUndo struct {
+	card     Card                 // 复习前闪卡的副本
+	siblings map[string]time.Time // 同一内容块的其他闪卡复习前的搁置截止时间
+}
+
+// PrepareReviewUndo 在复习闪卡 cardID 前调用，返回用于撤销本次复习的状态，闪卡不存在时返回 nil。
+func (deck *Deck) PrepareReviewUndo(cardID string) (ret *ReviewUndo) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	card := deck.store.GetCard(cardID)
+	if nil == card {
+		return
+	}
+
+	// 复习、搁置和暂停都会直接修改卡包中的闪卡，所以需要缓存副本
+	ret = &ReviewUndo{card: cloneCard(card), siblings: map[string]time.Time{}}
+	for _, sibling := range deck.store.GetCardsByBlockID(card.BlockID()) {
+		if base := baseCard(sibling); cardID != sibling.ID() && nil != base {
+			ret.siblings[sibling.ID()] = base.BuriedUntil
+		}
+	}
+	return
+}
+
+// UndoReview 将闪卡恢复为 undo 记录的复习前状态，包括复习后被自动暂停的难记卡，并恢复同一内容块的其他闪卡的搁置截止时间。
+//
+// 复习记录需要另外调用 RemoveLastReviewLog 移除。
+func (deck *Deck) UndoReview(undo *ReviewUndo) {
+	if nil == undo {
+		return
+	}
+
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	deck.store.SetCard(cloneCard(undo.card))
+	for siblingID, until := range undo.siblings {
+		if sibling := deck.store.GetCard(siblingID); nil != sibling {
+			sibling.SetBuriedUntil(until)
+			deck.store.SetCard(sibling)
+		}
+	}
+	deck.Updated = time.Now().UnixMilli()
+}
+
+// cloneCard 返回闪卡 card 的深拷贝。
+func cloneCard(card Card) Card {
+	switch c := card.(type) {
+	case *FSRSCard:
+		impl := *c.C
+		return &FSRSCard{BaseCard: c.BaseCard.clone(), C: &impl}
+	case *SM2Card:
+		impl := *c.C
+		return &SM2Card{BaseCard: c.BaseCard.clone(), C: &impl}
+	}
+	return card
+}
+
+// tomorrow 返回 now 第二天的零点。
+func tomorrow(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,132 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoSM2)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	blockID := newID()
+	cardID, siblingID, otherID := newID(), newID(), newID()
+	deck.AddCard(cardID, blockID)
+	deck.AddCard(siblingID, blockID)
+	deck.AddCard(otherID, newID())
+	if 3 != len(deck.Dues()) {
+		t.Fatalf("new cards should be due")
+	}
+
+	// 复习后同一内容块的其他闪卡被搁置到第二天
+	deck.Review(cardID, Good)
+	if dues := deck.Dues(); 1 != len(dues) || otherID != dues[0].ID() {
+		t.Fatalf("sibling card should be buried")
+	}
+	deck.BuryCards([]string{siblingID}, false)
+	deck.SuspendCards([]string{otherID}, true)
+	if err = deck.Save(); nil != err {
+		t.Fatal(err)
+	}
+
+	deck, err = LoadDeck(saveDir, deckID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if dues := deck.Dues(); 1 != len(dues) || siblingID != dues[0].ID() {
+		t.Fatalf("suspended card should not be due")
+	}
+
+	// 遗忘次数达到阈值后自动暂停
+	if err = deck.SetLifecycle(false, 2); nil != err {
+		t.Fatal(err)
+	}
+	deck.SuspendCards([]string{otherID}, false)
+	deck.Review(otherID, Good)
+	if deck.Review(otherID, Again) {
+		t.Fatalf("card should not be a leech after one lapse")
+	}
+	deck.Review(otherID, Good)
+	if !deck.Review(otherID, Again) || !deck.GetCard(otherID).IsSuspended() {
+		t.Fatalf("card should be suspended as a leech")
+	}
+	if leeches := deck.GetLeechCards(); 1 != len(leeches) || otherID != leeches[0].ID() {
+		t.Fatalf("leech cards not match")
+	}
+	if nil == deck.SetLifecycle(false, -1) {
+		t.Fatalf("negative leech lapses should be rejected")
+	}
+}
+
+func TestUndoReview(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+
+	for _, algo := range []Algo{AlgoSM2, AlgoFSRS} {
+		deck, err := CreateDeck(saveDir, newID(), algo)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err = deck.SetLifecycle(true, 1); nil != err {
+			t.Fatal(err)
+		}
+
+		blockID := newID()
+		cardID, siblingID := newID(), newID()
+		deck.AddCard(cardID, blockID)
+		deck.AddCard(siblingID, blockID)
+		deck.Review(cardID, Easy)
+		deck.BuryCards([]string{siblingID}, false)
+		reps := deck.GetCard(cardID).Reps()
+
+		// 遗忘后闪卡被暂停，同一内容块的其他闪卡被搁置，撤销后都需要恢复
+		undo := deck.PrepareReviewUndo(cardID)
+		if !deck.Review(cardID, Again) {
+			t.Fatalf("[%s] card should be suspended as a leech", algo)
+		}
+		deck.UndoReview(undo)
+		deck.RemoveLastReviewLog(cardID)
+
+		card := deck.GetCard(cardID)
+		if card.IsSuspended() || 0 != card.Lapses() || reps != card.Reps() {
+			t.Fatalf("[%s] card should be restored", algo)
+		}
+		if deck.GetCard(siblingID).IsBuried(time.Now()) {
+			t.Fatalf("[%s] sibling card should not be buried", algo)
+		}
+		if logs := deck.GetReviewLogs(cardID); 1 != len(logs) {
+			t.Fatalf("[%s] review logs not match", algo)
+		}
+
+		// 撤销后再次复习不影响缓存的复习前状态
+		deck.Review(cardID, Again)
+		deck.UndoReview(undo)
+		if deck.GetCard(cardID).IsSuspended() {
+			t.Fatalf("[%s] card should be restored again", algo)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/open-spaced-repetition/go-fsrs"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// State 描述了闪卡的学习状态。
+type State int8
+
+const (
+	StateNew        State = iota // 新卡，制卡后没有进行过复习
+	StateLearning                // 学习中
+	StateReview                  // 复习中
+	StateRelearning              // 遗忘后重新学习中
+)
+
+// ReviewLog 描述了一次闪卡复习记录。
+type ReviewLog struct {
+	CardID        string `json:"cardID"`        // 闪卡 ID
+	Rating        Rating `json:"rating"`        // 复习评分
+	ElapsedDays   uint64 `json:"elapsedDays"`   // 距离上次复习的天数
+	ScheduledDays uint64 `json:"scheduledDays"` // 复习后安排的间隔天数
+	State         State  `json:"state"`         // 复习前的学习状态
+	Review        int64  `json:"review"`        // 复习时间
+}
+
+// ImportReviewLogs 导入闪卡 cardID 在其他软件中的复习记录 logs，并按照闪卡包的算法重放复习记录得到闪卡的复习状态。
+//
+// logs 仅需要包含评分和复习时间，其他字段会在重放时计算。导入后需要调用 Save 保存闪卡包。
+func (deck *Deck) ImportReviewLogs(cardID string, logs []*ReviewLog) (err error) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	card := deck.store.GetCard(cardID)
+	if nil == card {
+		err = errors.New("card not found")
+		return
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Review < logs[j].Review })
+	switch c := card.Impl().(type) {
+	case *fsrs.Card:
+		p := deck.FSRSParams.toFSRS()
+		replayed := *c
+		for _, log := range logs {
+			info := p.Repeat(replayed, time.UnixMilli(log.Review))[fsrs.Rating(log.Rating)]
+			log.CardID, log.State = cardID, State(info.ReviewLog.State)
+			log.ElapsedDays, log.ScheduledDays = info.ReviewLog.ElapsedDays, info.ReviewLog.ScheduledDays
+			replayed = info.Card
+		}
+		card.SetImpl(&replayed)
+	case *SM2:
+		replayed := c
+		for _, log := range logs {
+			now := time.UnixMilli(log.Review)
+			log.CardID, log.State = cardID, replayed.State()
+			if !replayed.IsNew() {
+				log.ElapsedDays = uint64(math.Round(float64(now.Sub(replayed.LastReview) / time.Hour / 24)))
+			}
+			replayed = replayed.Repeat(log.Rating, now)
+			log.ScheduledDays = replayed.Interval
+		}
+		card.SetImpl(replayed)
+	default:
+		err = errors.New("not supported yet")
+		return
+	}
+
+	deck.store.SetCard(card)
+	deck.logs = append(deck.logs, logs...)
+	sort.SliceStable(deck.logs, func(i, j int) bool { return deck.logs[i].Review < deck.logs[j].Review })
+	deck.Updated = time.Now().UnixMilli()
+	return
+}
+
+// loadReviewLogs 从文件夹 saveDir 路径上加载 id 闪卡包的复习记录。
+func loadReviewLogs(saveDir, id string) (ret []*ReviewLog, err error) {
+	ret = []*ReviewLog{}
+	p := getReviewLogsMsgpackPath(saveDir, id)
+	if !gulu.File.IsExist(p) {
+		return
+	}
+
+	data, err := os.ReadFile(p)
+	if nil != err {
+		logging.LogErrorf("load review logs failed: %s", err)
+		return
+	}
+	if err = msgpack.Unmarshal(data, &ret); nil != err {
+		logging.LogErrorf("load review logs failed: %s", err)
+		return
+	}
+	return
+}
+
+func saveReviewLogs(saveDir, id string, logs []*ReviewLog) (err error) {
+	data, err := msgpack.Marshal(logs)
+	if nil != err {
+		logging.LogErrorf("save review logs failed: %s", err)
+		return
+	}
+	if err = gulu.File.WriteFileSafer(getReviewLogsMsgpackPath(saveDir, id), data, 0644); nil != err {
+		logging.LogErrorf("save review logs failed: %s", err)
+		return
+	}
+	return
+}
+
+func getReviewLogsMsgpackPath(saveDir, id string) string {
+	return filepath.Join(saveDir, id+".logs")
+}
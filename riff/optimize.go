@@ -0,0 +1,161 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs"
+)
+
+var ErrNotEnoughReviewLogs = errors.New("not enough review logs to optimize")
+
+const (
+	optimizeMinReviews = 32   // 优化至少需要的复习记录数（复习中状态的闪卡）
+	optimizeMaxIters   = 64   // 优化的最大迭代次数
+	optimizeMinStep    = 1e-3 // 优化的最小步长
+)
+
+// OptimizeResult 描述了 FSRS 参数优化结果。
+type OptimizeResult struct {
+	Before *FSRSParams `json:"before"` // 优化前的参数
+	After  *FSRSParams `json:"after"`  // 优化后的参数
+
+	Reviews         int     `json:"reviews"`         // 参与优化的复习记录数
+	ActualRetention float64 `json:"actualRetention"` // 复习记录中实际的记忆保持率
+	RetentionBefore float64 `json:"retentionBefore"` // 优化前参数预测的记忆保持率
+	RetentionAfter  float64 `json:"retentionAfter"`  // 优化后参数预测的记忆保持率
+	LossBefore      float64 `json:"lossBefore"`      // 优化前的对数损失
+	LossAfter       float64 `json:"lossAfter"`       // 优化后的对数损失
+}
+
+// OptimizeFSRSParams 根据闪卡包的复习记录拟合 FSRS 权重，其他参数保持不变，不会修改闪卡包。
+//
+// 按照时间顺序重放每张闪卡的复习记录，计算每次复习（复习中状态）前的记忆可提取性，然后使用模式搜索最小化其与实际结果（是否选择 Again）之间的对数损失。
+func (deck *Deck) OptimizeFSRSParams() (ret *OptimizeResult, err error) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	if AlgoFSRS != deck.Algo {
+		err = errors.New("only fsrs deck can be optimized")
+		return
+	}
+
+	before := deck.FSRSParams
+	if nil == before {
+		before = DefaultFSRSParams()
+	}
+	histories := groupReviewLogs(deck.logs)
+	ret, err = optimizeFSRSParams(before, histories)
+	return
+}
+
+func optimizeFSRSParams(before *FSRSParams, histories [][]*ReviewLog) (ret *OptimizeResult, err error) {
+	p := before.toFSRS()
+	lossBefore, retentionBefore, actualRetention, reviews := evalFSRSParams(p, histories)
+	if optimizeMinReviews > reviews {
+		err = ErrNotEnoughReviewLogs
+		return
+	}
+
+	best, bestLoss := p, lossBefore
+	step := 0.1
+	for i := 0; i < optimizeMaxIters && optimizeMinStep <= step; i++ {
+		improved := false
+		for w := 0; w < fsrsWeightsLen; w++ {
+			for _, sign := range []float64{1, -1} {
+				candidate := best
+				delta := step * math.Max(math.Abs(best.W[w]), 0.1)
+				candidate.W[w] += sign * delta
+				if loss, _, _, _ := evalFSRSParams(candidate, histories); loss < bestLoss {
+					best, bestLoss = candidate, loss
+					improved = true
+					break
+				}
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+
+	_, retentionAfter, _, _ := evalFSRSParams(best, histories)
+	ret = &OptimizeResult{
+		Before:          before,
+		After:           newFSRSParams(best),
+		Reviews:         reviews,
+		ActualRetention: actualRetention,
+		RetentionBefore: retentionBefore,
+		RetentionAfter:  retentionAfter,
+		LossBefore:      lossBefore,
+		LossAfter:       bestLoss,
+	}
+	return
+}
+
+// groupReviewLogs 将复习记录按照闪卡分组，每组按照复习时间升序排列。
+func groupReviewLogs(logs []*ReviewLog) (ret [][]*ReviewLog) {
+	groups := map[string][]*ReviewLog{}
+	var cardIDs []string
+	for _, log := range logs {
+		if _, ok := groups[log.CardID]; !ok {
+			cardIDs = append(cardIDs, log.CardID)
+		}
+		groups[log.CardID] = append(groups[log.CardID], log)
+	}
+
+	for _, cardID := range cardIDs {
+		group := groups[cardID]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Review < group[j].Review })
+		ret = append(ret, group)
+	}
+	return
+}
+
+// evalFSRSParams 使用参数 p 重放复习记录，返回平均对数损失、预测的平均记忆保持率、实际的记忆保持率和参与计算的复习记录数。
+func evalFSRSParams(p fsrs.Parameters, histories [][]*ReviewLog) (loss, predicted, actual float64, reviews int) {
+	for _, history := range histories {
+		card := fsrs.NewCard()
+		for _, log := range history {
+			now := time.UnixMilli(log.Review)
+			if fsrs.Review == card.State {
+				elapsed := float64(now.Sub(card.LastReview) / time.Hour / 24)
+				r := math.Exp(math.Log(0.9) * elapsed / math.Max(card.Stability, 0.1))
+				r = math.Min(math.Max(r, 1e-4), 1-1e-4)
+
+				y := 0.0
+				if Again != log.Rating {
+					y = 1
+				}
+				loss -= y*math.Log(r) + (1-y)*math.Log(1-r)
+				predicted += r
+				actual += y
+				reviews++
+			}
+			card = p.Repeat(card, now)[fsrs.Rating(log.Rating)].Card
+		}
+	}
+	if 0 < reviews {
+		loss /= float64(reviews)
+		predicted /= float64(reviews)
+		actual /= float64(reviews)
+	}
+	return
+}
@@ -0,0 +1,98 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOptimizeFSRSParams(t *testing.T) {
+	// 构造记忆保持率远低于默认参数预期的复习记录：每张卡片首次选择 Good 后，按时复习时 70% 的卡片被遗忘
+	start := time.Date(2023, 5, 1, 8, 0, 0, 0, time.Local)
+	var histories [][]*ReviewLog
+	for i := 0; i < 100; i++ {
+		cardID := newID()
+		var history []*ReviewLog
+		review := start
+		for j, rating := range []Rating{Good, Good, Good} {
+			if 2 == j && 7 > i%10 {
+				rating = Again
+			}
+			history = append(history, &ReviewLog{CardID: cardID, Rating: rating, Review: review.UnixMilli()})
+			review = review.AddDate(0, 0, 3)
+		}
+		histories = append(histories, history)
+	}
+
+	result, err := optimizeFSRSParams(DefaultFSRSParams(), histories)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if result.LossAfter >= result.LossBefore {
+		t.Fatalf("loss [%f] -> [%f] not decreased", result.LossBefore, result.LossAfter)
+	}
+	if math.Abs(result.RetentionAfter-result.ActualRetention) >= math.Abs(result.RetentionBefore-result.ActualRetention) {
+		t.Fatalf("retention [%f] -> [%f] not closer to actual [%f]", result.RetentionBefore, result.RetentionAfter, result.ActualRetention)
+	}
+	if err = result.After.Validate(); nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err = optimizeFSRSParams(DefaultFSRSParams(), histories[:1]); ErrNotEnoughReviewLogs != err {
+		t.Fatalf("optimize with few reviews should fail")
+	}
+}
+
+func TestDeckFSRSParams(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	params := DefaultFSRSParams()
+	params.RequestRetention = 1.2
+	if err = deck.SetFSRSParams(params); nil == err {
+		t.Fatalf("invalid params should be rejected")
+	}
+
+	params.RequestRetention = 0.95
+	params.MaximumInterval = 180
+	if err = deck.SetFSRSParams(params); nil != err {
+		t.Fatal(err)
+	}
+	if err = deck.Save(); nil != err {
+		t.Fatal(err)
+	}
+
+	deck, err = LoadDeck(saveDir, deckID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil == deck.FSRSParams || 0.95 != deck.FSRSParams.RequestRetention {
+		t.Fatalf("deck params not saved")
+	}
+	if 180 != deck.store.(*FSRSStore).params.MaximumInterval {
+		t.Fatalf("deck params not applied to store")
+	}
+}
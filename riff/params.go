@@ -0,0 +1,114 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"errors"
+
+	"github.com/open-spaced-repetition/go-fsrs"
+)
+
+// fsrsWeightsLen 为 FSRS 权重个数。
+const fsrsWeightsLen = 13
+
+// FSRSParams 描述了 FSRS 算法参数。
+type FSRSParams struct {
+	RequestRetention float64   `json:"requestRetention"` // 期望的记忆保持率，取值范围 (0, 1)
+	MaximumInterval  float64   `json:"maximumInterval"`  // 最大间隔天数
+	EasyBonus        float64   `json:"easyBonus"`        // 选择 Easy 时的间隔奖励系数
+	HardFactor       float64   `json:"hardFactor"`       // 选择 Hard 时的间隔系数
+	Weights          []float64 `json:"weights"`          // 权重，共 13 个
+}
+
+// DefaultFSRSParams 返回默认的 FSRS 算法参数。
+func DefaultFSRSParams() *FSRSParams {
+	return newFSRSParams(fsrs.DefaultParam())
+}
+
+func newFSRSParams(p fsrs.Parameters) *FSRSParams {
+	return &FSRSParams{
+		RequestRetention: p.RequestRetention,
+		MaximumInterval:  p.MaximumInterval,
+		EasyBonus:        p.EasyBonus,
+		HardFactor:       p.HardFactor,
+		Weights:          append([]float64{}, p.W[:]...),
+	}
+}
+
+// Validate 校验参数是否合法。
+func (params *FSRSParams) Validate() error {
+	if 0 >= params.RequestRetention || 1 <= params.RequestRetention {
+		return errors.New("request retention must be between 0 and 1")
+	}
+	if 1 > params.MaximumInterval {
+		return errors.New("maximum interval must be at least 1 day")
+	}
+	if 0 >= params.EasyBonus || 0 >= params.HardFactor {
+		return errors.New("easy bonus and hard factor must be positive")
+	}
+	if fsrsWeightsLen != len(params.Weights) {
+		return errors.New("invalid weights")
+	}
+	return nil
+}
+
+func (params *FSRSParams) toFSRS() (ret fsrs.Parameters) {
+	ret = fsrs.DefaultParam()
+	if nil == params {
+		return
+	}
+
+	ret.RequestRetention = params.RequestRetention
+	ret.MaximumInterval = params.MaximumInterval
+	ret.EasyBonus = params.EasyBonus
+	ret.HardFactor = params.HardFactor
+	copy(ret.W[:], params.Weights)
+	return
+}
+
+// SetParams 设置 FSRS 算法参数，params 为 nil 时使用默认参数。
+func (store *FSRSStore) SetParams(params *FSRSParams) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.params = params.toFSRS()
+}
+
+// SetFSRSParams 设置闪卡包的 FSRS 算法参数，params 为 nil 时使用默认参数。
+//
+// 设置后需要调用 Save 保存闪卡包。
+func (deck *Deck) SetFSRSParams(params *FSRSParams) (err error) {
+	deck.lock.Lock()
+	defer deck.lock.Unlock()
+
+	if nil != params {
+		if err = params.Validate(); nil != err {
+			return
+		}
+	}
+
+	deck.FSRSParams = params
+	deck.applyFSRSParams()
+	return
+}
+
+// applyFSRSParams 将闪卡包的 FSRS 算法参数应用到底层存储。
+func (deck *Deck) applyFSRSParams() {
+	if store, ok := deck.store.(*FSRSStore); ok {
+		store.SetParams(deck.FSRSParams)
+	}
+}
@@ -0,0 +1,377 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+const (
+	sm2InitialEase   = 2.5              // 初始难度系数
+	sm2MinEase       = 1.3              // 最小难度系数
+	sm2MaxInterval   = 36500            // 最大间隔天数
+	sm2AgainInterval = 10 * time.Minute // 遗忘后重新学习的间隔
+)
+
+type SM2Store struct {
+	*BaseStore
+
+	cards map[string]*SM2Card
+}
+
+func NewSM2Store(id, saveDir string) *SM2Store {
+	return &SM2Store{
+		BaseStore: NewBaseStore(id, AlgoSM2, saveDir),
+		cards:     map[string]*SM2Card{},
+	}
+}
+
+func (store *SM2Store) AddCard(id, blockID string) Card {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	card := &SM2Card{BaseCard: &BaseCard{CID: id, BID: blockID}, C: NewSM2()}
+	store.cards[id] = card
+	return card
+}
+
+func (store *SM2Store) GetCard(id string) Card {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	ret := store.cards[id]
+	if nil == ret {
+		return nil
+	}
+	return ret
+}
+
+func (store *SM2Store) SetCard(card Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.cards[card.ID()] = card.(*SM2Card)
+}
+
+func (store *SM2Store) RemoveCard(id string) Card {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	card := store.cards[id]
+	if nil == card {
+		return nil
+	}
+	delete(store.cards, id)
+	return card
+}
+
+func (store *SM2Store) GetCardsByBlockID(blockID string) (ret []Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, card := range store.cards {
+		if card.BlockID() == blockID {
+			ret = append(ret, card)
+		}
+	}
+	return
+}
+
+func (store *SM2Store) GetCardsByBlockIDs(blockIDs []string) (ret []Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	blockIDs = gulu.Str.RemoveDuplicatedElem(blockIDs)
+	for _, card := range store.cards {
+		if gulu.Str.Contains(card.BlockID(), blockIDs) {
+			ret = append(ret, card)
+		}
+	}
+	return
+}
+
+func (store *SM2Store) GetNewCardsByBlockIDs(blockIDs []string) (ret []Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	blockIDs = gulu.Str.RemoveDuplicatedElem(blockIDs)
+	for _, card := range store.cards {
+		if !card.IsNew() {
+			continue
+		}
+
+		if gulu.Str.Contains(card.BlockID(), blockIDs) {
+			ret = append(ret, card)
+		}
+	}
+	return
+}
+
+func (store *SM2Store) GetDueCardsByBlockIDs(blockIDs []string) (ret []Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	blockIDs = gulu.Str.RemoveDuplicatedElem(blockIDs)
+	now := time.Now()
+	for _, card := range store.cards {
+		if now.Before(card.C.Due) || !card.available(now) {
+			continue
+		}
+
+		if gulu.Str.Contains(card.BlockID(), blockIDs) {
+			ret = append(ret, card)
+		}
+	}
+	return
+}
+
+func (store *SM2Store) GetBlockIDs() (ret []string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	ret = []string{}
+	for _, card := range store.cards {
+		ret = append(ret, card.BlockID())
+	}
+	ret = gulu.Str.RemoveDuplicatedElem(ret)
+	sort.Strings(ret)
+	return
+}
+
+func (store *SM2Store) CountCards() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return len(store.cards)
+}
+
+func (store *SM2Store) Review(cardId string, rating Rating) (ret *ReviewLog) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	now := time.Now()
+	card := store.cards[cardId]
+	if nil == card {
+		logging.LogWarnf("not found card [id=%s] to review", cardId)
+		return
+	}
+
+	ret = &ReviewLog{CardID: cardId, Rating: rating, State: card.State(), Review: now.UnixMilli()}
+	if !card.IsNew() {
+		ret.ElapsedDays = uint64(math.Round(float64(now.Sub(card.C.LastReview) / time.Hour / 24)))
+	}
+
+	updated := card.C.Repeat(rating, now)
+	card.SetImpl(updated)
+	store.cards[cardId] = card
+	ret.ScheduledDays = updated.Interval
+	return
+}
+
+func (store *SM2Store) Dues() (ret []Card) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	now := time.Now()
+	for _, card := range store.cards {
+		if now.Before(card.C.Due) || !card.available(now) {
+			continue
+		}
+
+		nextDues := map[Rating]time.Time{}
+		for _, rating := range []Rating{Again, Hard, Good, Easy} {
+			nextDues[rating] = card.C.Repeat(rating, now).Due
+		}
+		card.SetNextDues(nextDues)
+		ret = append(ret, card)
+	}
+	return
+}
+
+func (store *SM2Store) Load() (err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.cards = map[string]*SM2Card{}
+	p := store.getMsgPackPath()
+	if !gulu.File.IsExist(p) {
+		return
+	}
+
+	data, err := os.ReadFile(p)
+	if nil != err {
+		logging.LogErrorf("load cards failed: %s", err)
+	}
+	if err = msgpack.Unmarshal(data, &store.cards); nil != err {
+		logging.LogErrorf("load cards failed: %s", err)
+		return
+	}
+	return
+}
+
+func (store *SM2Store) Save() (err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	saveDir := store.GetSaveDir()
+	if !gulu.File.IsDir(saveDir) {
+		if err = os.MkdirAll(saveDir, 0755); nil != err {
+			return
+		}
+	}
+
+	p := store.getMsgPackPath()
+	data, err := msgpack.Marshal(store.cards)
+	if nil != err {
+		logging.LogErrorf("save cards failed: %s", err)
+		return
+	}
+	if err = gulu.File.WriteFileSafer(p, data, 0644); nil != err {
+		logging.LogErrorf("save cards failed: %s", err)
+		return
+	}
+	return
+}
+
+// SM2 描述了 SM-2 算法的复习状态。
+type SM2 struct {
+	Due        time.Time // 到期时间
+	Interval   uint64    // 当前间隔天数，遗忘后重新学习时为 0
+	Ease       float64   // 难度系数，初始为 2.5，最小为 1.3
+	Repetition uint64    // 连续记住的次数，遗忘后重置为 0
+	Reps       uint64    // 总复习次数
+	Lapses     uint64    // 遗忘次数
+	LastReview time.Time // 最近复习时间
+}
+
+func NewSM2() *SM2 {
+	return &SM2{Ease: sm2InitialEase}
+}
+
+// Repeat 返回使用评分 rating 在 now 复习后的状态，不会修改 c。
+//
+// 评分对应 SM-2 的回答质量：Again 为 1，Hard 为 3，Good 为 4，Easy 为 5。
+func (c *SM2) Repeat(rating Rating, now time.Time) (ret *SM2) {
+	r := *c
+	ret = &r
+	ret.Reps++
+	ret.LastReview = now
+
+	if Again == rating {
+		// 遗忘后从头开始，难度系数保持不变
+		if !c.IsNew() {
+			ret.Lapses++
+		}
+		ret.Repetition = 0
+		ret.Interval = 0
+		ret.Due = now.Add(sm2AgainInterval)
+		return
+	}
+
+	switch ret.Repetition {
+	case 0:
+		ret.Interval = 1
+	case 1:
+		ret.Interval = 6
+	default:
+		ret.Interval = uint64(math.Round(float64(ret.Interval) * ret.Ease))
+	}
+	if sm2MaxInterval < ret.Interval {
+		ret.Interval = sm2MaxInterval
+	}
+	ret.Repetition++
+
+	q := float64(sm2Quality(rating))
+	ret.Ease += 0.1 - (5-q)*(0.08+(5-q)*0.02)
+	if sm2MinEase > ret.Ease {
+		ret.Ease = sm2MinEase
+	}
+	ret.Due = now.Add(time.Duration(ret.Interval) * 24 * time.Hour)
+	return
+}
+
+// IsNew 判断是否是制卡后没有进行过复习的卡片。
+func (c *SM2) IsNew() bool {
+	return 0 == c.Reps
+}
+
+// State 返回学习状态，SM-2 没有学习阶段，连续记住过的卡片都处于复习中。
+func (c *SM2) State() State {
+	switch {
+	case c.IsNew():
+		return StateNew
+	case 0 < c.Repetition:
+		return StateReview
+	case 0 < c.Lapses:
+		return StateRelearning
+	default:
+		return StateLearning
+	}
+}
+
+func sm2Quality(rating Rating) int {
+	switch rating {
+	case Again:
+		return 1
+	case Hard:
+		return 3
+	case Good:
+		return 4
+	default:
+		return 5
+	}
+}
+
+type SM2Card struct {
+	*BaseCard
+	C *SM2
+}
+
+func (card *SM2Card) Impl() interface{} {
+	return card.C
+}
+
+func (card *SM2Card) SetImpl(c interface{}) {
+	card.C = c.(*SM2)
+}
+
+func (card *SM2Card) IsNew() bool {
+	return card.C.IsNew()
+}
+
+func (card *SM2Card) Reps() uint64 {
+	return card.C.Reps
+}
+
+func (card *SM2Card) State() State {
+	return card.C.State()
+}
+
+func (card *SM2Card) Due() time.Time {
+	return card.C.Due
+}
+
+func (card *SM2Card) Lapses() uint64 {
+	return card.C.Lapses
+}
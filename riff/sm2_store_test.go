@@ -0,0 +1,84 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSM2Repeat(t *testing.T) {
+	now := time.Now()
+	c := NewSM2()
+
+	// Good 的间隔依次为 1、6、6*2.5 天，难度系数保持不变
+	for _, interval := range []uint64{1, 6, 15} {
+		c = c.Repeat(Good, now)
+		if interval != c.Interval {
+			t.Fatalf("interval [%d] != [%d]", c.Interval, interval)
+		}
+		now = c.Due
+	}
+	if sm2InitialEase != c.Ease {
+		t.Fatalf("ease [%f] != [%f]", c.Ease, sm2InitialEase)
+	}
+
+	c = c.Repeat(Again, now)
+	if 0 != c.Repetition || 0 != c.Interval || 1 != c.Lapses || sm2AgainInterval != c.Due.Sub(now) {
+		t.Fatalf("again not reset card")
+	}
+
+	c = c.Repeat(Hard, c.Due)
+	if 1 != c.Interval || sm2InitialEase <= c.Ease {
+		t.Fatalf("hard interval [%d], ease [%f]", c.Interval, c.Ease)
+	}
+}
+
+func TestSM2Store(t *testing.T) {
+	const storePath = "testdata"
+	os.MkdirAll(storePath, 0755)
+	defer os.RemoveAll(storePath)
+
+	store := NewSM2Store("test-sm2-store", storePath)
+	cardID, blockID := newID(), newID()
+	store.AddCard(cardID, blockID)
+	if 1 != len(store.GetNewCardsByBlockIDs([]string{blockID})) {
+		t.Fatalf("new cards not match")
+	}
+
+	dues := store.Dues()
+	if 1 != len(dues) || 4 != len(dues[0].NextDues()) {
+		t.Fatalf("dues not match")
+	}
+
+	store.Review(cardID, Good)
+	if 0 != len(store.Dues()) {
+		t.Fatalf("reviewed card should not be due")
+	}
+
+	if err := store.Save(); nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Load(); nil != err {
+		t.Fatal(err)
+	}
+	card := store.GetCard(cardID)
+	if nil == card || 1 != card.Reps() || 1 != card.Impl().(*SM2).Interval {
+		t.Fatalf("loaded card not match")
+	}
+}
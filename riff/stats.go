@@ -0,0 +1,108 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"time"
+)
+
+// Stats 描述了闪卡学习统计。
+type Stats struct {
+	Reviews   []*DailyReviews `json:"reviews"`   // 最近每天的复习次数
+	Retention float64         `json:"retention"` // 记忆保持率，即统计时间段内非新卡复习中没有选择 Again 的比例，没有复习时为 0
+	Forecast  []*DailyDues    `json:"forecast"`  // 未来每天到期的闪卡数，当天包括已经过期的闪卡
+}
+
+// DailyReviews 描述了一天的复习次数。
+type DailyReviews struct {
+	Date  string `json:"date"`  // 日期，如：2023-05-10
+	Count int    `json:"count"` // 复习次数
+	Again int    `json:"again"` // 其中选择 Again 的次数
+}
+
+// DailyDues 描述了一天到期的闪卡数。
+type DailyDues struct {
+	Date  string `json:"date"`  // 日期，如：2023-05-10
+	Count int    `json:"count"` // 到期闪卡数
+}
+
+// forecastDays 为到期预测的天数。
+const forecastDays = 30
+
+// ComputeStats 根据复习记录 logs 和闪卡 cards 计算最近 days 天（包括今天）的学习统计以及未来 30 天的到期预测，暂停和搁置中的闪卡不计入到期预测。
+func ComputeStats(logs []*ReviewLog, cards []Card, days int, now time.Time) (ret *Stats) {
+	ret = &Stats{Reviews: []*DailyReviews{}, Forecast: []*DailyDues{}}
+	if 1 > days {
+		days = 1
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := today.AddDate(0, 0, -days+1)
+	reviews := map[string]*DailyReviews{}
+	for i := 0; i < days; i++ {
+		date := start.AddDate(0, 0, i).Format("2006-01-02")
+		daily := &DailyReviews{Date: date}
+		reviews[date] = daily
+		ret.Reviews = append(ret.Reviews, daily)
+	}
+
+	var matured, remembered int
+	for _, log := range logs {
+		reviewed := time.UnixMilli(log.Review)
+		if reviewed.Before(start) {
+			continue
+		}
+
+		daily := reviews[reviewed.Format("2006-01-02")]
+		if nil == daily {
+			continue
+		}
+		daily.Count++
+		if Again == log.Rating {
+			daily.Again++
+		}
+
+		if StateNew != log.State {
+			matured++
+			if Again != log.Rating {
+				remembered++
+			}
+		}
+	}
+	if 0 < matured {
+		ret.Retention = float64(remembered) / float64(matured)
+	}
+
+	for i := 0; i < forecastDays; i++ {
+		ret.Forecast = append(ret.Forecast, &DailyDues{Date: today.AddDate(0, 0, i).Format("2006-01-02")})
+	}
+	for _, card := range cards {
+		if card.IsNew() || card.IsSuspended() || card.IsBuried(now) {
+			continue // 暂停和搁置中的闪卡不会按照到期时间参与复习
+		}
+
+		i := int(card.Due().Sub(today) / (24 * time.Hour))
+		if 0 > i {
+			i = 0 // 已经过期的闪卡算在当天
+		}
+		if forecastDays <= i {
+			continue
+		}
+		ret.Forecast[i].Count++
+	}
+	return
+}
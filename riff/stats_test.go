@@ -0,0 +1,122 @@
+// Riff - Spaced repetition.
+// Copyright (c) 2022-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package riff
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReviewLogs(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deckID := newID()
+	deck, err := CreateDeck(saveDir, deckID, AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cardID := newID()
+	deck.AddCard(cardID, newID())
+	deck.Review(cardID, Again)
+	deck.Review(cardID, Good)
+	deck.RemoveLastReviewLog(cardID)
+	deck.Review(cardID, Easy)
+	if err = deck.Save(); nil != err {
+		t.Fatal(err)
+	}
+
+	deck, err = LoadDeck(saveDir, deckID)
+	if nil != err {
+		t.Fatal(err)
+	}
+	logs := deck.GetReviewLogs(cardID)
+	if 2 != len(logs) || Again != logs[0].Rating || Easy != logs[1].Rating {
+		t.Fatalf("review logs not match")
+	}
+	if StateNew != logs[0].State || StateNew == logs[1].State {
+		t.Fatalf("review log states [%d, %d] not match", logs[0].State, logs[1].State)
+	}
+
+	stats := ComputeStats(deck.GetReviewLogs(""), deck.GetCards(), 7, time.Now())
+	if 7 != len(stats.Reviews) || 2 != stats.Reviews[6].Count || 1 != stats.Reviews[6].Again {
+		t.Fatalf("daily reviews not match")
+	}
+	if 1 != stats.Retention {
+		t.Fatalf("retention [%f] not match", stats.Retention)
+	}
+	forecast := 0
+	for _, daily := range stats.Forecast {
+		forecast += daily.Count
+	}
+	if forecastDays != len(stats.Forecast) || 1 != forecast {
+		t.Fatalf("forecast not match")
+	}
+
+	// 暂停和搁置中的闪卡不计入到期预测
+	deck.SuspendCards([]string{cardID}, true)
+	if 0 != countForecast(deck) {
+		t.Fatalf("suspended card should not be forecast")
+	}
+	deck.SuspendCards([]string{cardID}, false)
+	deck.BuryCards([]string{cardID}, true)
+	if 0 != countForecast(deck) {
+		t.Fatalf("buried card should not be forecast")
+	}
+}
+
+func countForecast(deck *Deck) (ret int) {
+	for _, daily := range ComputeStats(nil, deck.GetCards(), 1, time.Now()).Forecast {
+		ret += daily.Count
+	}
+	return
+}
+
+func TestImportReviewLogs(t *testing.T) {
+	const saveDir = "testdata"
+	os.MkdirAll(saveDir, 0755)
+	defer os.RemoveAll(saveDir)
+	deck, err := CreateDeck(saveDir, newID(), AlgoFSRS)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cardID := newID()
+	deck.AddCard(cardID, newID())
+	now := time.Now()
+	logs := []*ReviewLog{
+		{Rating: Good, Review: now.AddDate(0, 0, -5).UnixMilli()},
+		{Rating: Again, Review: now.AddDate(0, 0, -10).UnixMilli()},
+	}
+	if err = deck.ImportReviewLogs(cardID, logs); nil != err {
+		t.Fatal(err)
+	}
+
+	logs = deck.GetReviewLogs(cardID)
+	if 2 != len(logs) || Again != logs[0].Rating || StateNew != logs[0].State || cardID != logs[1].CardID {
+		t.Fatalf("imported review logs not match")
+	}
+	card := deck.GetCard(cardID)
+	if 2 != card.Reps() || card.IsNew() {
+		t.Fatalf("imported card state not match")
+	}
+	if err = deck.ImportReviewLogs(newID(), logs); nil == err {
+		t.Fatalf("import review logs for not found card should fail")
+	}
+}
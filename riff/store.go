@@ -56,8 +56,8 @@ type Store interface {
 	// CountCards 获取卡包中的闪卡数量。
 	CountCards() int
 
-	// Review 闪卡复习。
-	Review(id string, rating Rating)
+	// Review 闪卡复习，返回复习记录，闪卡不存在时返回 nil。
+	Review(id string, rating Rating) *ReviewLog
 
 	// Dues 获取所有到期的闪卡列表。
 	Dues() []Card
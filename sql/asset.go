@@ -127,6 +127,25 @@ func QueryRootBlockAssets(rootID string) (ret []*Asset) {
 	return
 }
 
+func QueryBlockAssets(blockIDs []string) (ret []*Asset) {
+	if 1 > len(blockIDs) {
+		return
+	}
+
+	sqlStmt := "SELECT * FROM assets WHERE block_id IN ('" + strings.Join(blockIDs, "','") + "')"
+	rows, err := query(sqlStmt)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", sqlStmt, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		asset := scanAssetRows(rows)
+		ret = append(ret, asset)
+	}
+	return
+}
+
 func scanAssetRows(rows *sql.Rows) (ret *Asset) {
 	var asset Asset
 	if err := rows.Scan(&asset.ID, &asset.BlockID, &asset.RootID, &asset.Box, &asset.DocPath, &asset.Path, &asset.Name, &asset.Title, &asset.Hash); nil != err {
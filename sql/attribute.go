@@ -16,6 +16,19 @@
 
 package sql
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
 type Attribute struct {
 	ID      string
 	Name    string
@@ -26,3 +39,283 @@ type Attribute struct {
 	Box     string
 	Path    string
 }
+
+// AttrValueType 描述了属性值的类型，数字、日期和布尔类型的属性值会被转换为数值保存在 num 字段中用于比较。
+const (
+	AttrValueTypeText    = "text"    // 文本
+	AttrValueTypeNumber  = "number"  // 数字
+	AttrValueTypeDate    = "date"    // 日期，num 为毫秒时间戳
+	AttrValueTypeBoolean = "boolean" // 布尔，num 为 1 或者 0
+)
+
+// attributeSchema 保存了声明的属性值类型，属性名 -> 类型，未声明的属性根据属性值自动推断。
+var (
+	attributeSchema     = map[string]string{}
+	attributeSchemaLock = sync.RWMutex{}
+)
+
+// IsValidAttrValueType 判断 valueType 是否为支持的属性值类型。
+func IsValidAttrValueType(valueType string) bool {
+	switch valueType {
+	case AttrValueTypeText, AttrValueTypeNumber, AttrValueTypeDate, AttrValueTypeBoolean:
+		return true
+	}
+	return false
+}
+
+// SetAttributeSchema 设置声明的属性值类型 schema，并重新计算类型发生变化的属性的值类型。
+func SetAttributeSchema(schema map[string]string) {
+	attributeSchemaLock.Lock()
+	var changed []string
+	for name, valueType := range schema {
+		if attributeSchema[name] != valueType {
+			changed = append(changed, name)
+		}
+	}
+	for name := range attributeSchema {
+		if _, ok := schema[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	attributeSchema = map[string]string{}
+	for name, valueType := range schema {
+		attributeSchema[name] = valueType
+	}
+	attributeSchemaLock.Unlock()
+
+	if 0 < len(changed) {
+		RetypeAttributesQueue(changed)
+	}
+}
+
+// AttributeValueType 返回属性 name 的值 value 的类型和用于比较的数值，值无法转换为声明的类型时作为文本。
+func AttributeValueType(name, value string) (valueType string, num sql.NullFloat64) {
+	attributeSchemaLock.RLock()
+	declared := attributeSchema[name]
+	attributeSchemaLock.RUnlock()
+
+	if "" != declared {
+		if AttrValueTypeText == declared {
+			return AttrValueTypeText, num
+		}
+		if f, ok := ParseAttrValue(declared, value); ok {
+			return declared, sql.NullFloat64{Float64: f, Valid: true}
+		}
+		return AttrValueTypeText, num
+	}
+
+	for _, valueType = range []string{AttrValueTypeNumber, AttrValueTypeBoolean, AttrValueTypeDate} {
+		if f, ok := ParseAttrValue(valueType, value); ok {
+			return valueType, sql.NullFloat64{Float64: f, Valid: true}
+		}
+	}
+	return AttrValueTypeText, num
+}
+
+var attrDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006/01/02",
+	"2006/01/02 15:04",
+	"2006/01/02 15:04:05",
+}
+
+// ParseAttrValue 将属性值 value 按照类型 valueType 转换为用于比较的数值。
+func ParseAttrValue(valueType, value string) (ret float64, ok bool) {
+	value = strings.TrimSpace(value)
+	if "" == value {
+		return
+	}
+
+	switch valueType {
+	case AttrValueTypeNumber:
+		var err error
+		if ret, err = strconv.ParseFloat(value, 64); nil == err && !math.IsNaN(ret) && !math.IsInf(ret, 0) {
+			ok = true
+		}
+	case AttrValueTypeDate:
+		for _, layout := range attrDateLayouts {
+			if t, err := time.ParseInLocation(layout, value, time.Local); nil == err {
+				return float64(t.UnixMilli()), true
+			}
+		}
+	case AttrValueTypeBoolean:
+		switch strings.ToLower(value) {
+		case "true":
+			return 1, true
+		case "false":
+			return 0, true
+		}
+	}
+	return
+}
+
+// AttrCondition 描述了按照属性查询块的条件。
+type AttrCondition struct {
+	Name     string   `json:"name"`     // 属性名
+	Operator string   `json:"operator"` // =, !=, >, >=, <, <=, between, like, exists
+	Value    string   `json:"value"`    // 比较值，范围比较时按照 ValueType 转换为数值
+	Value2   string   `json:"value2"`   // between 的上界
+	Values   []string `json:"values"`   // in 的候选值
+
+	// ValueType 为范围比较时比较值的类型，为空时使用声明的类型，没有声明时根据比较值推断
+	ValueType string `json:"valueType"`
+}
+
+// QueryBlocksByAttrs 查询满足所有属性条件 conds 的块，返回第 page 页（从 1 开始）的块和总数。
+func QueryBlocksByAttrs(conds []*AttrCondition, page, pageSize int) (ret []*Block, total int, err error) {
+	if 1 > len(conds) {
+		err = errors.New("conditions are empty")
+		return
+	}
+
+	var wheres []string
+	var args []interface{}
+	for _, cond := range conds {
+		where, condArgs, condErr := attrConditionSQL(cond)
+		if nil != condErr {
+			err = condErr
+			return
+		}
+		wheres = append(wheres, "id IN (SELECT block_id FROM attributes WHERE "+where+")")
+		args = append(args, condArgs...)
+	}
+	where := strings.Join(wheres, " AND ")
+
+	if err = db.QueryRow("SELECT COUNT(*) FROM blocks WHERE "+where, args...).Scan(&total); nil != err {
+		logging.LogErrorf("sql query attributes failed: %s", err)
+		return
+	}
+
+	if 1 > page {
+		page = 1
+	}
+	stmt := "SELECT * FROM blocks WHERE " + where + " ORDER BY sort, id LIMIT ? OFFSET ?"
+	rows, err := query(stmt, append(args, pageSize, (page-1)*pageSize)...)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", stmt, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if block := scanBlockRows(rows); nil != block {
+			ret = append(ret, block)
+		}
+	}
+	return
+}
+
+func attrConditionSQL(cond *AttrCondition) (where string, args []interface{}, err error) {
+	if "" == cond.Name {
+		err = errors.New("attribute name is empty")
+		return
+	}
+
+	args = append(args, cond.Name)
+	switch cond.Operator {
+	case "exists":
+		where = "name = ?"
+	case "", "=":
+		where = "name = ? AND value = ?"
+		args = append(args, cond.Value)
+	case "!=":
+		where = "name = ? AND value != ?"
+		args = append(args, cond.Value)
+	case "in":
+		if 1 > len(cond.Values) {
+			err = errors.New("values of operator [in] are empty")
+			return
+		}
+		where = "name = ? AND value IN (?" + strings.Repeat(", ?", len(cond.Values)-1) + ")"
+		for _, value := range cond.Values {
+			args = append(args, value)
+		}
+	case "like":
+		where = "name = ? AND value LIKE ?"
+		args = append(args, cond.Value)
+	case ">", ">=", "<", "<=":
+		var valueType string
+		var num float64
+		if valueType, num, err = attrConditionNum(cond.Name, cond.ValueType, cond.Value); nil != err {
+			return
+		}
+		where = "name = ? AND value_type = ? AND num " + cond.Operator + " ?"
+		args = append(args, valueType, num)
+	case "between":
+		var valueType string
+		var low, high float64
+		if valueType, low, err = attrConditionNum(cond.Name, cond.ValueType, cond.Value); nil != err {
+			return
+		}
+		// 上界和下界使用相同的值类型
+		if _, high, err = attrConditionNum(cond.Name, valueType, cond.Value2); nil != err {
+			return
+		}
+		where = "name = ? AND value_type = ? AND num BETWEEN ? AND ?"
+		args = append(args, valueType, low, high)
+	default:
+		err = errors.New(fmt.Sprintf("invalid operator [%s]", cond.Operator))
+	}
+	return
+}
+
+// attrConditionNum 返回属性 name 的范围比较值 value 的值类型和转换后的数值，比较值只和相同值类型的属性值比较。
+//
+// valueType 为空时使用声明的类型，没有声明时根据比较值推断。
+func attrConditionNum(name, valueType, value string) (retValueType string, ret float64, err error) {
+	retValueType = valueType
+	if "" == retValueType {
+		attributeSchemaLock.RLock()
+		retValueType = attributeSchema[name]
+		attributeSchemaLock.RUnlock()
+	}
+	if "" == retValueType || AttrValueTypeText == retValueType {
+		retValueType, _ = AttributeValueType("", value)
+	}
+
+	ret, ok := ParseAttrValue(retValueType, value)
+	if !ok {
+		err = errors.New(fmt.Sprintf("invalid range value [%s] of attribute [%s]", value, name))
+	}
+	return
+}
+
+// retypeAttributes 按照当前的属性值类型声明重新计算属性 names 的值类型。
+func retypeAttributes(tx *sql.Tx, names []string) (err error) {
+	if 1 > len(names) {
+		return
+	}
+
+	var args []interface{}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	stmt := "SELECT id, name, value FROM attributes WHERE name IN (?" + strings.Repeat(", ?", len(names)-1) + ")"
+	rows, err := tx.Query(stmt, args...)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", stmt, err)
+		return
+	}
+	var attrs []*Attribute
+	for rows.Next() {
+		attr := &Attribute{}
+		if err = rows.Scan(&attr.ID, &attr.Name, &attr.Value); nil != err {
+			rows.Close()
+			return
+		}
+		attrs = append(attrs, attr)
+	}
+	rows.Close()
+
+	stmt = "UPDATE attributes SET value_type = ?, num = ? WHERE id = ?"
+	for _, attr := range attrs {
+		valueType, num := AttributeValueType(attr.Name, attr.Value)
+		if err = execStmtTx(tx, stmt, valueType, num, attr.ID); nil != err {
+			return
+		}
+	}
+	return
+}
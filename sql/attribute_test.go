@@ -0,0 +1,220 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestAttributeSchema 直接设置声明的属性值类型，不重新计算已有属性，测试结束后恢复。
+func setTestAttributeSchema(t *testing.T, schema map[string]string) {
+	attributeSchemaLock.Lock()
+	old := attributeSchema
+	attributeSchema = schema
+	attributeSchemaLock.Unlock()
+	t.Cleanup(func() {
+		attributeSchemaLock.Lock()
+		attributeSchema = old
+		attributeSchemaLock.Unlock()
+	})
+}
+
+func localMs(value string) float64 {
+	t, _ := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+	return float64(t.UnixMilli())
+}
+
+func TestParseAttrValue(t *testing.T) {
+	cases := []struct {
+		valueType, value string
+		expected         float64
+		ok               bool
+	}{
+		{AttrValueTypeNumber, "12", 12, true},
+		{AttrValueTypeNumber, " -1.5e2 ", -150, true},
+		{AttrValueTypeNumber, "NaN", 0, false},
+		{AttrValueTypeNumber, "Inf", 0, false},
+		{AttrValueTypeNumber, "12px", 0, false},
+		{AttrValueTypeNumber, "", 0, false},
+		{AttrValueTypeDate, "2023-01-02", localMs("2023-01-02 00:00"), true},
+		{AttrValueTypeDate, "2023/01/02 08:30", localMs("2023-01-02 08:30"), true},
+		{AttrValueTypeDate, "2023-01-02T08:30:00", localMs("2023-01-02 08:30"), true},
+		{AttrValueTypeDate, "2023-01-02T08:30:00Z", float64(time.Date(2023, 1, 2, 8, 30, 0, 0, time.UTC).UnixMilli()), true},
+		{AttrValueTypeDate, "2023-13-01", 0, false},
+		{AttrValueTypeDate, "20230102", 0, false},
+		{AttrValueTypeBoolean, "TRUE", 1, true},
+		{AttrValueTypeBoolean, "false", 0, true},
+		{AttrValueTypeBoolean, "yes", 0, false},
+		{AttrValueTypeText, "12", 0, false},
+		{"unknown", "12", 0, false},
+	}
+
+	for _, c := range cases {
+		got, ok := ParseAttrValue(c.valueType, c.value)
+		if c.ok != ok || (ok && c.expected != got) {
+			t.Fatalf("parse [%s] as [%s] expected [%v, %v], got [%v, %v]", c.value, c.valueType, c.expected, c.ok, got, ok)
+		}
+	}
+}
+
+func TestAttributeValueType(t *testing.T) {
+	setTestAttributeSchema(t, map[string]string{
+		"custom-price":  AttrValueTypeNumber,
+		"custom-due":    AttrValueTypeDate,
+		"custom-done":   AttrValueTypeBoolean,
+		"custom-serial": AttrValueTypeText,
+	})
+
+	cases := []struct {
+		name, value string
+		expected    string
+		num         float64
+	}{
+		// 未声明类型时根据值推断
+		{"custom-x", "12", AttrValueTypeNumber, 12},
+		{"custom-x", "True", AttrValueTypeBoolean, 1},
+		{"custom-x", "2023-01-02", AttrValueTypeDate, localMs("2023-01-02 00:00")},
+		{"custom-x", "abc", AttrValueTypeText, 0},
+		{"custom-x", "", AttrValueTypeText, 0},
+		// 声明类型时按照声明转换，无法转换时作为文本
+		{"custom-price", "9.5", AttrValueTypeNumber, 9.5},
+		{"custom-price", "cheap", AttrValueTypeText, 0},
+		{"custom-price", "true", AttrValueTypeText, 0},
+		{"custom-due", "2023-01-02 08:30", AttrValueTypeDate, localMs("2023-01-02 08:30")},
+		{"custom-due", "12", AttrValueTypeText, 0},
+		{"custom-done", "false", AttrValueTypeBoolean, 0},
+		{"custom-done", "1", AttrValueTypeText, 0},
+		{"custom-serial", "0012", AttrValueTypeText, 0},
+	}
+
+	for _, c := range cases {
+		valueType, num := AttributeValueType(c.name, c.value)
+		if c.expected != valueType || (AttrValueTypeText == c.expected) == num.Valid || c.num != num.Float64 {
+			t.Fatalf("value type of [%s=%s] expected [%s, %v], got [%s, %v]", c.name, c.value, c.expected, c.num, valueType, num)
+		}
+	}
+}
+
+func TestAttrConditionSQL(t *testing.T) {
+	setTestAttributeSchema(t, map[string]string{"custom-due": AttrValueTypeDate, "custom-serial": AttrValueTypeText})
+
+	cases := []struct {
+		cond     *AttrCondition
+		where    string
+		args     []interface{}
+		expected string // 出错时为空
+	}{
+		{&AttrCondition{Name: "custom-a", Operator: "exists"}, "name = ?", []interface{}{"custom-a"}, "ok"},
+		{&AttrCondition{Name: "custom-a", Value: "x"}, "name = ? AND value = ?", []interface{}{"custom-a", "x"}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "!=", Value: "x"}, "name = ? AND value != ?", []interface{}{"custom-a", "x"}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "in", Values: []string{"x", "y"}}, "name = ? AND value IN (?, ?)", []interface{}{"custom-a", "x", "y"}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "like", Value: "%x%"}, "name = ? AND value LIKE ?", []interface{}{"custom-a", "%x%"}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: ">=", Value: "10"}, "name = ? AND value_type = ? AND num >= ?", []interface{}{"custom-a", AttrValueTypeNumber, 10.0}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "<", Value: "true"}, "name = ? AND value_type = ? AND num < ?", []interface{}{"custom-a", AttrValueTypeBoolean, 1.0}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: ">", Value: "20", ValueType: AttrValueTypeText}, "name = ? AND value_type = ? AND num > ?", []interface{}{"custom-a", AttrValueTypeNumber, 20.0}, "ok"},
+		{&AttrCondition{Name: "custom-due", Operator: "<=", Value: "2023-01-02"}, "name = ? AND value_type = ? AND num <= ?", []interface{}{"custom-due", AttrValueTypeDate, localMs("2023-01-02 00:00")}, "ok"},
+		{&AttrCondition{Name: "custom-serial", Operator: ">", Value: "7"}, "name = ? AND value_type = ? AND num > ?", []interface{}{"custom-serial", AttrValueTypeNumber, 7.0}, "ok"},
+		// 范围比较的上界使用下界的值类型
+		{&AttrCondition{Name: "custom-a", Operator: "between", Value: "1", Value2: "5"}, "name = ? AND value_type = ? AND num BETWEEN ? AND ?", []interface{}{"custom-a", AttrValueTypeNumber, 1.0, 5.0}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "between", Value: "2023-01-01", Value2: "2023-01-31 12:00"}, "name = ? AND value_type = ? AND num BETWEEN ? AND ?", []interface{}{"custom-a", AttrValueTypeDate, localMs("2023-01-01 00:00"), localMs("2023-01-31 12:00")}, "ok"},
+		{&AttrCondition{Name: "custom-due", Operator: "between", Value: "2023-01-01", Value2: "2023-02-01"}, "name = ? AND value_type = ? AND num BETWEEN ? AND ?", []interface{}{"custom-due", AttrValueTypeDate, localMs("2023-01-01 00:00"), localMs("2023-02-01 00:00")}, "ok"},
+		{&AttrCondition{Name: "custom-a", Operator: "between", Value: "2023-01-01", Value2: "5"}, "", nil, ""},
+		{&AttrCondition{Name: "custom-a", Operator: "between", Value: "1", Value2: ""}, "", nil, ""},
+		{&AttrCondition{Name: "custom-due", Operator: ">", Value: "12"}, "", nil, ""},
+		{&AttrCondition{Name: "custom-a", Operator: ">", Value: "abc"}, "", nil, ""},
+		{&AttrCondition{Name: "custom-a", Operator: "in"}, "", nil, ""},
+		{&AttrCondition{Name: "custom-a", Operator: "~", Value: "x"}, "", nil, ""},
+		{&AttrCondition{Operator: "exists"}, "", nil, ""},
+	}
+
+	for _, c := range cases {
+		valueType := c.cond.ValueType
+		where, args, err := attrConditionSQL(c.cond)
+		if "" == c.expected {
+			if nil == err {
+				t.Fatalf("condition [%s %s %s] should be rejected", c.cond.Name, c.cond.Operator, c.cond.Value)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.where != where || len(c.args) != len(args) {
+			t.Fatalf("condition [%s %s %s] expected [%s] %v, got [%s] %v", c.cond.Name, c.cond.Operator, c.cond.Value, c.where, c.args, where, args)
+		}
+		for i, arg := range args {
+			if c.args[i] != arg {
+				t.Fatalf("condition [%s %s %s] expected args %v, got %v", c.cond.Name, c.cond.Operator, c.cond.Value, c.args, args)
+			}
+		}
+		if valueType != c.cond.ValueType {
+			t.Fatalf("condition [%s %s %s] should not be modified", c.cond.Name, c.cond.Operator, c.cond.Value)
+		}
+	}
+}
+
+func TestQueryBlocksByAttrs(t *testing.T) {
+	openTestDB(t)
+	setTestAttributeSchema(t, map[string]string{})
+
+	var blocks []*Block
+	var attrs []*Attribute
+	for i, value := range []string{"2023-01-01", "2023-01-15", "2023-02-01", "soon", "12"} {
+		id := "20230101000000-" + strings.Repeat(string(rune('a'+i)), 7)
+		blocks = append(blocks, &Block{ID: id, RootID: id, Box: "box", Path: "/" + id + ".sy", Type: "d", Content: id, Sort: i})
+		attrs = append(attrs, &Attribute{ID: id + "-due", Name: "custom-due", Value: value, Type: "b", BlockID: id, RootID: id, Box: "box", Path: "/" + id + ".sy"})
+	}
+	attrs = append(attrs, &Attribute{ID: "tag", Name: "custom-tag", Value: "x", Type: "b", BlockID: blocks[1].ID, RootID: blocks[1].ID, Box: "box", Path: blocks[1].Path})
+	insertTestBlocks(t, blocks)
+	tx, err := db.Begin()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = insertAttributes(tx, attrs); nil != err {
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	cases := []struct {
+		conds          []*AttrCondition
+		page, pageSize int
+		expected       string
+		total          int
+	}{
+		{[]*AttrCondition{{Name: "custom-due", Operator: "between", Value: "2023-01-01", Value2: "2023-01-31"}}, 1, 10, "a,b", 2},
+		{[]*AttrCondition{{Name: "custom-due", Operator: ">", Value: "2023-01-01"}}, 1, 10, "b,c", 2},
+		{[]*AttrCondition{{Name: "custom-due", Operator: ">", Value: "2023-01-01"}}, 2, 1, "c", 2},
+		{[]*AttrCondition{{Name: "custom-due", Operator: ">=", Value: "10"}}, 1, 10, "e", 1},
+		{[]*AttrCondition{{Name: "custom-due", Operator: "exists"}, {Name: "custom-tag", Value: "x"}}, 1, 10, "b", 1},
+		{[]*AttrCondition{{Name: "custom-due", Operator: "like", Value: "s%"}}, 1, 10, "d", 1},
+	}
+	for _, c := range cases {
+		ret, total, err := QueryBlocksByAttrs(c.conds, c.page, c.pageSize)
+		if nil != err {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, block := range ret {
+			ids = append(ids, block.ID[len(block.ID)-1:])
+		}
+		if got := strings.Join(ids, ","); c.expected != got || c.total != total {
+			t.Fatalf("query [%s %s %s] expected [%s] of [%d], got [%s] of [%d]", c.conds[0].Name, c.conds[0].Operator, c.conds[0].Value, c.expected, c.total, got, total)
+		}
+	}
+}
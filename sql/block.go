@@ -61,6 +61,10 @@ func updateRootContent(tx *sql.Tx, content, updated, id string) (err error) {
 			return
 		}
 	}
+	stmt = "UPDATE blocks_trigram SET content = ? WHERE id = ?"
+	if err = execStmtTx(tx, stmt, FoldText(content), id); nil != err {
+		return
+	}
 	removeBlockCache(id)
 	cache.RemoveBlockIAL(id)
 	return
@@ -84,6 +88,11 @@ func updateBlockContent(tx *sql.Tx, block *Block) (err error) {
 			return
 		}
 	}
+	stmt = "UPDATE blocks_trigram SET content = ? WHERE id = ?"
+	if err = execStmtTx(tx, stmt, FoldText(block.Content), block.ID); nil != err {
+		tx.Rollback()
+		return
+	}
 
 	putBlockCache(block)
 	return
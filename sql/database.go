@@ -147,6 +147,15 @@ func initDBTables() {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [blocks_fts_case_insensitive] failed: %s", err)
 	}
 
+	_, err = db.Exec("DROP TABLE IF EXISTS blocks_trigram")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [blocks_trigram] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE VIRTUAL TABLE blocks_trigram USING fts5(id UNINDEXED, root_id UNINDEXED, box UNINDEXED, path UNINDEXED, type UNINDEXED, content, tokenize=\"trigram\")")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [blocks_trigram] failed: %s", err)
+	}
+
 	_, err = db.Exec("DROP TABLE IF EXISTS spans")
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [spans] failed: %s", err)
@@ -169,7 +178,7 @@ func initDBTables() {
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [attributes] failed: %s", err)
 	}
-	_, err = db.Exec("CREATE TABLE attributes (id, name, value, type, block_id, root_id, box, path)")
+	_, err = db.Exec("CREATE TABLE attributes (id, name, value, type, value_type, num REAL, block_id, root_id, box, path)")
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [attributes] failed: %s", err)
 	}
@@ -191,6 +200,47 @@ func initDBTables() {
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [refs] failed: %s", err)
 	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS tasks")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [tasks] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE TABLE tasks (id, parent_id, root_id, box, path, content, checked INTEGER, due INTEGER, priority INTEGER, tag, created, updated)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [tasks] failed: %s", err)
+	}
+
+	initDBIndexes()
+}
+
+// initDBIndexes 创建常用查询条件上的索引。
+func initDBIndexes() {
+	indexes := []string{
+		"CREATE INDEX idx_blocks_id ON blocks(id)",
+		"CREATE INDEX idx_blocks_parent_id ON blocks(parent_id)",
+		"CREATE INDEX idx_blocks_root_id ON blocks(root_id)",
+		"CREATE INDEX idx_blocks_box_path ON blocks(box, path)",
+		"CREATE INDEX idx_spans_block_id ON spans(block_id)",
+		"CREATE INDEX idx_spans_root_id ON spans(root_id)",
+		"CREATE INDEX idx_assets_block_id ON assets(block_id)",
+		"CREATE INDEX idx_assets_root_id ON assets(root_id)",
+		"CREATE INDEX idx_attributes_name_value ON attributes(name, value)",
+		"CREATE INDEX idx_attributes_name_num ON attributes(name, value_type, num)",
+		"CREATE INDEX idx_attributes_block_id ON attributes(block_id)",
+		"CREATE INDEX idx_attributes_root_id ON attributes(root_id)",
+		"CREATE INDEX idx_refs_def_block_id ON refs(def_block_id)",
+		"CREATE INDEX idx_refs_def_block_root_id ON refs(def_block_root_id)",
+		"CREATE INDEX idx_refs_block_id ON refs(block_id)",
+		"CREATE INDEX idx_refs_root_id ON refs(root_id)",
+		"CREATE INDEX idx_file_annotation_refs_block_id ON file_annotation_refs(block_id)",
+		"CREATE INDEX idx_tasks_root_id ON tasks(root_id)",
+		"CREATE INDEX idx_tasks_checked_due ON tasks(checked, due)",
+	}
+	for _, index := range indexes {
+		if _, err := db.Exec(index); nil != err {
+			logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create index [%s] failed: %s", index, err)
+		}
+	}
 }
 
 func InitHistoryDatabase(forceRebuild bool) {
@@ -840,6 +890,9 @@ func deleteByBoxTx(tx *sql.Tx, box string) (err error) {
 	if err = deleteFileAnnotationRefsByBoxTx(tx, box); nil != err {
 		return
 	}
+	if err = deleteTasksByBoxTx(tx, box); nil != err {
+		return
+	}
 	return
 }
 
@@ -872,6 +925,11 @@ func deleteBlocksByIDs(tx *sql.Tx, ids []string) (err error) {
 			return
 		}
 	}
+	stmt = "DELETE FROM blocks_trigram WHERE id IN " + in.String()
+	if err = execStmtTx(tx, stmt); nil != err {
+		return
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_ids", ids: ids})
 	return
 }
 
@@ -890,6 +948,11 @@ func deleteBlocksByBoxTx(tx *sql.Tx, box string) (err error) {
 			return
 		}
 	}
+	stmt = "DELETE FROM blocks_trigram WHERE box = ?"
+	if err = execStmtTx(tx, stmt, box); nil != err {
+		return
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_box", box: box})
 	ClearCache()
 	return
 }
@@ -1000,6 +1063,10 @@ func deleteByRootID(tx *sql.Tx, rootID string, context map[string]interface{}) (
 			return
 		}
 	}
+	stmt = "DELETE FROM blocks_trigram WHERE root_id = ?"
+	if err = execStmtTx(tx, stmt, rootID); nil != err {
+		return
+	}
 	stmt = "DELETE FROM spans WHERE root_id = ?"
 	if err = execStmtTx(tx, stmt, rootID); nil != err {
 		return
@@ -1016,6 +1083,11 @@ func deleteByRootID(tx *sql.Tx, rootID string, context map[string]interface{}) (
 	if err = execStmtTx(tx, stmt, rootID); nil != err {
 		return
 	}
+	stmt = "DELETE FROM tasks WHERE root_id = ?"
+	if err = execStmtTx(tx, stmt, rootID); nil != err {
+		return
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_roots", ids: []string{rootID}})
 	ClearCache()
 	eventbus.Publish(eventbus.EvtSQLDeleteBlocks, context, rootID)
 	return
@@ -1038,6 +1110,10 @@ func batchDeleteByRootIDs(tx *sql.Tx, rootIDs []string, context map[string]inter
 			return
 		}
 	}
+	stmt = "DELETE FROM blocks_trigram WHERE root_id IN " + ids
+	if err = execStmtTx(tx, stmt); nil != err {
+		return
+	}
 	stmt = "DELETE FROM spans WHERE root_id IN " + ids
 	if err = execStmtTx(tx, stmt); nil != err {
 		return
@@ -1054,6 +1130,11 @@ func batchDeleteByRootIDs(tx *sql.Tx, rootIDs []string, context map[string]inter
 	if err = execStmtTx(tx, stmt); nil != err {
 		return
 	}
+	stmt = "DELETE FROM tasks WHERE root_id IN " + ids
+	if err = execStmtTx(tx, stmt); nil != err {
+		return
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_roots", ids: rootIDs})
 	ClearCache()
 	eventbus.Publish(eventbus.EvtSQLDeleteBlocks, context, fmt.Sprintf("%d", len(rootIDs)))
 	return
@@ -1074,6 +1155,10 @@ func batchDeleteByPathPrefix(tx *sql.Tx, boxID, pathPrefix string) (err error) {
 			return
 		}
 	}
+	stmt = "DELETE FROM blocks_trigram WHERE box = ? AND path LIKE ?"
+	if err = execStmtTx(tx, stmt, boxID, pathPrefix+"%"); nil != err {
+		return
+	}
 	stmt = "DELETE FROM spans WHERE box = ? AND path LIKE ?"
 	if err = execStmtTx(tx, stmt, boxID, pathPrefix+"%"); nil != err {
 		return
@@ -1090,6 +1175,11 @@ func batchDeleteByPathPrefix(tx *sql.Tx, boxID, pathPrefix string) (err error) {
 	if err = execStmtTx(tx, stmt, boxID, pathPrefix+"%"); nil != err {
 		return
 	}
+	stmt = "DELETE FROM tasks WHERE box = ? AND path LIKE ?"
+	if err = execStmtTx(tx, stmt, boxID, pathPrefix+"%"); nil != err {
+		return
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_path", box: boxID, prefix: pathPrefix})
 	ClearCache()
 	return
 }
@@ -1124,6 +1214,10 @@ func CloseDatabase() {
 		logging.LogErrorf("close history database failed: %s", err)
 		return
 	}
+	if err := embeddingDB.Close(); nil != err {
+		logging.LogErrorf("close embedding database failed: %s", err)
+		return
+	}
 	logging.LogInfof("closed database")
 }
 
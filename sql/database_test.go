@@ -0,0 +1,60 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// openTestDB 使用内存数据库初始化所有表，未使用 fts5 标签编译时跳过测试。
+func openTestDB(t *testing.T) {
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", time.Now().UnixNano())
+	testDB, err := sql.Open("sqlite3_extended", dsn)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = testDB.Exec("CREATE VIRTUAL TABLE fts5_check USING fts5(content, tokenize=\"siyuan\")"); nil != err {
+		testDB.Close()
+		t.Skipf("fts5 is not available, test with -tags fts5: %s", err)
+	}
+	testDB.Exec("DROP TABLE fts5_check")
+
+	db = testDB
+	ClearCache()
+	initDBTables()
+	t.Cleanup(func() {
+		testDB.Close()
+		db = nil
+	})
+}
+
+func insertTestBlocks(t *testing.T, blocks []*Block) {
+	tx, err := db.Begin()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = insertBlocks(tx, blocks, nil); nil != err {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); nil != err {
+		t.Fatal(err)
+	}
+}
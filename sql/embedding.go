@@ -0,0 +1,542 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// Embedder 用于获取文本的向量嵌入，返回的向量与 texts 一一对应。
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+var (
+	embeddingDB *sql.DB
+
+	embedder     Embedder
+	embedderLock = sync.RWMutex{}
+
+	embeddingQueue     []*embeddingOperation
+	embeddingQueueLock = sync.Mutex{}
+
+	// embeddingSyncCursor 为补齐已有块的向量嵌入时 blocks 表的 rowid 游标，-1 表示已经补齐
+	embeddingSyncCursor int64
+)
+
+const (
+	embeddingBatchSize   = 64   // 每次请求嵌入的文本数
+	embeddingMaxTextLen  = 2048 // 嵌入文本的最大长度（字符数）
+	embeddingSyncPageLen = 512  // 每次补齐的块数
+)
+
+// embeddingModelKey 为 stat 表中记录已有向量嵌入所用模型的键。
+const embeddingModelKey = "embedding_model"
+
+// embeddingBlockTypes 描述了需要嵌入的块类型，列表、列表项、引述和超级块等容器块的内容与子块重复，不需要嵌入。
+var embeddingBlockTypes = []string{"d", "h", "p", "c", "m", "t", "html"}
+
+type embeddingOperation struct {
+	action      string   // upsert/delete_ids/delete_roots/delete_path/delete_box
+	blocks      []*Block // upsert
+	ids         []string // delete_ids/delete_roots
+	box, prefix string   // delete_path/delete_box
+}
+
+// SetEmbedder 设置向量嵌入实现，为 nil 时关闭语义搜索。设置后会在后台补齐已有块的向量嵌入。
+//
+// model 标识嵌入使用的模型，和已有向量嵌入的模型不同时会清空已有的向量嵌入，因为不同模型的向量之间无法比较。
+func SetEmbedder(e Embedder, model string) {
+	embedderLock.Lock()
+	if nil != e && nil != embeddingDB {
+		resetEmbeddingModel(model)
+	}
+	embedder = e
+	embedderLock.Unlock()
+
+	embeddingQueueLock.Lock()
+	embeddingQueue = nil
+	embeddingSyncCursor = 0
+	embeddingQueueLock.Unlock()
+}
+
+func IsEmbeddingEnabled() bool {
+	embedderLock.RLock()
+	defer embedderLock.RUnlock()
+	return nil != embedder && nil != embeddingDB
+}
+
+func InitEmbeddingDatabase(forceRebuild bool) {
+	initEmbeddingDBConnection()
+
+	if !forceRebuild && gulu.File.IsExist(util.EmbeddingDBPath) {
+		_, err := embeddingDB.Exec("SELECT 1 FROM embeddings LIMIT 1")
+		if nil == err {
+			_, err = embeddingDB.Exec("SELECT 1 FROM stat LIMIT 1")
+		}
+		if nil == err {
+			return
+		}
+	}
+
+	embeddingDB.Close()
+	if err := os.RemoveAll(util.EmbeddingDBPath); nil != err {
+		logging.LogErrorf("remove embedding database file [%s] failed: %s", util.EmbeddingDBPath, err)
+		return
+	}
+
+	initEmbeddingDBConnection()
+	initEmbeddingDBTables()
+}
+
+func initEmbeddingDBConnection() {
+	if nil != embeddingDB {
+		embeddingDB.Close()
+	}
+
+	dsn := util.EmbeddingDBPath + "?_journal_mode=WAL" +
+		"&_synchronous=OFF" +
+		"&_secure_delete=OFF" +
+		"&_cache_size=-20480" +
+		"&_page_size=32768" +
+		"&_busy_timeout=7000" +
+		"&_temp_store=MEMORY"
+	var err error
+	embeddingDB, err = sql.Open("sqlite3_extended", dsn)
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create database failed: %s", err)
+	}
+	embeddingDB.SetMaxIdleConns(3)
+	embeddingDB.SetMaxOpenConns(3)
+	embeddingDB.SetConnMaxLifetime(365 * 24 * time.Hour)
+}
+
+func initEmbeddingDBTables() {
+	stmts := []string{
+		"CREATE TABLE embeddings (id PRIMARY KEY, root_id, box, path, hash, vector BLOB)",
+		"CREATE INDEX idx_embeddings_root_id ON embeddings(root_id)",
+		"CREATE INDEX idx_embeddings_box_path ON embeddings(box, path)",
+		"CREATE TABLE stat (key, value)",
+	}
+	for _, stmt := range stmts {
+		if _, err := embeddingDB.Exec(stmt); nil != err {
+			logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [embeddings] failed: %s", err)
+		}
+	}
+}
+
+// resetEmbeddingModel 在嵌入模型变化时清空已有的向量嵌入并记录新的模型。
+func resetEmbeddingModel(model string) {
+	var current string
+	embeddingDB.QueryRow("SELECT value FROM stat WHERE `key` = ?", embeddingModelKey).Scan(&current)
+	if current == model {
+		return
+	}
+
+	tx, err := embeddingDB.Begin()
+	if nil != err {
+		logging.LogErrorf("begin tx failed: %s", err)
+		return
+	}
+	if _, err = tx.Exec("DELETE FROM embeddings"); nil == err {
+		if _, err = tx.Exec("DELETE FROM stat WHERE `key` = ?", embeddingModelKey); nil == err {
+			_, err = tx.Exec("INSERT INTO stat VALUES (?, ?)", embeddingModelKey, model)
+		}
+	}
+	if nil != err {
+		logging.LogErrorf("reset embedding model failed: %s", err)
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); nil != err {
+		logging.LogErrorf("commit tx failed: %s", err)
+		return
+	}
+	logging.LogInfof("embedding model changed from [%s] to [%s], cleared embeddings", current, model)
+}
+
+func upsertEmbeddingsQueue(blocks []*Block) {
+	if !IsEmbeddingEnabled() {
+		return
+	}
+
+	var toEmbeds []*Block
+	for _, block := range blocks {
+		if gulu.Str.Contains(block.Type, embeddingBlockTypes) {
+			// 只保留嵌入需要的字段，避免队列占用过多内存
+			toEmbeds = append(toEmbeds, &Block{ID: block.ID, RootID: block.RootID, Box: block.Box, Path: block.Path, Type: block.Type, Content: block.Content})
+		}
+	}
+	if 1 > len(toEmbeds) {
+		return
+	}
+	appendEmbeddingOperation(&embeddingOperation{action: "upsert", blocks: toEmbeds})
+}
+
+func removeEmbeddingsQueue(op *embeddingOperation) {
+	if !IsEmbeddingEnabled() {
+		return
+	}
+	appendEmbeddingOperation(op)
+}
+
+func appendEmbeddingOperation(op *embeddingOperation) {
+	embeddingQueueLock.Lock()
+	defer embeddingQueueLock.Unlock()
+	embeddingQueue = append(embeddingQueue, op)
+}
+
+// FlushEmbeddingJob 将队列中块的变化同步到向量嵌入索引中，并分批补齐已有块的向量嵌入。
+func FlushEmbeddingJob() {
+	if !IsEmbeddingEnabled() {
+		return
+	}
+
+	embeddingQueueLock.Lock()
+	ops := embeddingQueue
+	embeddingQueue = nil
+	embeddingQueueLock.Unlock()
+
+	for i, op := range ops {
+		if err := execEmbeddingOp(op); nil != err {
+			logging.LogErrorf("flush embeddings failed: %s", err)
+
+			// 保留未完成的操作，下次重试
+			embeddingQueueLock.Lock()
+			embeddingQueue = append(ops[i:], embeddingQueue...)
+			embeddingQueueLock.Unlock()
+			return
+		}
+	}
+
+	syncEmbeddings()
+}
+
+func execEmbeddingOp(op *embeddingOperation) (err error) {
+	switch op.action {
+	case "upsert":
+		err = upsertEmbeddings(op.blocks)
+	case "delete_ids":
+		_, err = embeddingDB.Exec("DELETE FROM embeddings WHERE id IN ('" + strings.Join(op.ids, "','") + "')")
+	case "delete_roots":
+		_, err = embeddingDB.Exec("DELETE FROM embeddings WHERE root_id IN ('" + strings.Join(op.ids, "','") + "')")
+	case "delete_path":
+		_, err = embeddingDB.Exec("DELETE FROM embeddings WHERE box = ? AND path LIKE ?", op.box, op.prefix+"%")
+	case "delete_box":
+		_, err = embeddingDB.Exec("DELETE FROM embeddings WHERE box = ?", op.box)
+	default:
+		err = errors.New(fmt.Sprintf("unknown embedding operation [%s]", op.action))
+	}
+	return
+}
+
+// syncEmbeddings 补齐已有块的向量嵌入，每次只处理一页，内容没有变化的块不会重新嵌入。
+func syncEmbeddings() {
+	embeddingQueueLock.Lock()
+	cursor := embeddingSyncCursor
+	embeddingQueueLock.Unlock()
+	if 0 > cursor {
+		return
+	}
+
+	stmt := "SELECT rowid, id, root_id, box, path, type, content FROM blocks WHERE rowid > ? AND type IN ('" + strings.Join(embeddingBlockTypes, "','") + "') ORDER BY rowid LIMIT ?"
+	rows, err := query(stmt, cursor, embeddingSyncPageLen)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", stmt, err)
+		return
+	}
+	var blocks []*Block
+	for rows.Next() {
+		block := &Block{}
+		if err = rows.Scan(&cursor, &block.ID, &block.RootID, &block.Box, &block.Path, &block.Type, &block.Content); nil != err {
+			logging.LogErrorf("query scan field failed: %s", err)
+			rows.Close()
+			return
+		}
+		blocks = append(blocks, block)
+	}
+	rows.Close()
+
+	if err = upsertEmbeddings(blocks); nil != err {
+		logging.LogErrorf("sync embeddings failed: %s", err)
+		return
+	}
+
+	if 1 > len(blocks) {
+		// 关闭语义搜索期间删除的块不会进入队列，补齐完成时清理
+		if err = pruneEmbeddings(); nil != err {
+			logging.LogErrorf("prune embeddings failed: %s", err)
+			return
+		}
+		cursor = -1
+		logging.LogInfof("synced embeddings")
+	}
+	embeddingQueueLock.Lock()
+	if 0 <= embeddingSyncCursor { // 同步期间可能重新设置了嵌入实现
+		embeddingSyncCursor = cursor
+	}
+	embeddingQueueLock.Unlock()
+}
+
+// pruneEmbeddings 删除 blocks 表中已经不存在的块的向量嵌入。
+func pruneEmbeddings() (err error) {
+	rows, err := embeddingDB.Query("SELECT id FROM embeddings")
+	if nil != err {
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); nil != err {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var removes []string
+	for start := 0; start < len(ids); start += embeddingSyncPageLen {
+		end := start + embeddingSyncPageLen
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		page := ids[start:end]
+		if rows, err = query("SELECT id FROM blocks WHERE id IN ('" + strings.Join(page, "','") + "')"); nil != err {
+			return
+		}
+		existing := map[string]bool{}
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); nil != err {
+				rows.Close()
+				return
+			}
+			existing[id] = true
+		}
+		rows.Close()
+
+		for _, id := range page {
+			if !existing[id] {
+				removes = append(removes, id)
+			}
+		}
+	}
+	if 1 > len(removes) {
+		return
+	}
+
+	if err = execEmbeddingOp(&embeddingOperation{action: "delete_ids", ids: removes}); nil != err {
+		return
+	}
+	logging.LogInfof("pruned [%d] embeddings", len(removes))
+	return
+}
+
+// upsertEmbeddings 嵌入内容发生变化的块 blocks 并写入向量嵌入索引。
+func upsertEmbeddings(blocks []*Block) (err error) {
+	if 1 > len(blocks) {
+		return
+	}
+
+	ids := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	hashes := map[string]string{}
+	rows, err := embeddingDB.Query("SELECT id, hash FROM embeddings WHERE id IN ('" + strings.Join(ids, "','") + "')")
+	if nil != err {
+		return
+	}
+	for rows.Next() {
+		var id, hash string
+		if err = rows.Scan(&id, &hash); nil != err {
+			rows.Close()
+			return
+		}
+		hashes[id] = hash
+	}
+	rows.Close()
+
+	var toEmbeds []*Block
+	var texts, textHashes []string
+	for _, block := range blocks {
+		text := embeddingText(block)
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(text)))[:16]
+		if "" == text || hashes[block.ID] == hash {
+			continue
+		}
+		toEmbeds = append(toEmbeds, block)
+		texts = append(texts, text)
+		textHashes = append(textHashes, hash)
+	}
+
+	for start := 0; start < len(toEmbeds); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(toEmbeds) {
+			end = len(toEmbeds)
+		}
+
+		embedderLock.RLock()
+		e := embedder
+		embedderLock.RUnlock()
+		if nil == e {
+			return
+		}
+		var vectors [][]float32
+		if vectors, err = e.Embed(texts[start:end]); nil != err {
+			return
+		}
+		if len(vectors) != end-start {
+			return errors.New(fmt.Sprintf("embeddings count [%d] mismatch input count [%d]", len(vectors), end-start))
+		}
+
+		var tx *sql.Tx
+		if tx, err = embeddingDB.Begin(); nil != err {
+			return
+		}
+		for i, vector := range vectors {
+			block := toEmbeds[start+i]
+			if _, err = tx.Exec("INSERT OR REPLACE INTO embeddings (id, root_id, box, path, hash, vector) VALUES (?, ?, ?, ?, ?, ?)",
+				block.ID, block.RootID, block.Box, block.Path, textHashes[start+i], encodeVector(vector)); nil != err {
+				tx.Rollback()
+				return
+			}
+		}
+		if err = tx.Commit(); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func embeddingText(block *Block) (ret string) {
+	ret = strings.TrimSpace(block.Content)
+	if runes := []rune(ret); embeddingMaxTextLen < len(runes) {
+		ret = string(runes[:embeddingMaxTextLen])
+	}
+	return
+}
+
+// SearchEmbeddings 返回与 query 语义最接近的最多 limit 个块 ID 和余弦相似度，按照相似度降序排列。
+func SearchEmbeddings(query string, limit int) (ids []string, scores []float64, err error) {
+	embedderLock.RLock()
+	e := embedder
+	embedderLock.RUnlock()
+	if nil == e || nil == embeddingDB {
+		err = errors.New("semantic search is disabled")
+		return
+	}
+
+	vectors, err := e.Embed([]string{query})
+	if nil != err {
+		return
+	}
+	if 1 != len(vectors) {
+		err = errors.New("embed query failed")
+		return
+	}
+	queryVector := normalizeVector(vectors[0])
+
+	type scored struct {
+		id    string
+		score float64
+	}
+	var results []*scored
+	rows, err := embeddingDB.Query("SELECT id, vector FROM embeddings")
+	if nil != err {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err = rows.Scan(&id, &data); nil != err {
+			return
+		}
+
+		vector := decodeVector(data)
+		if len(vector) != len(queryVector) {
+			continue // 更换嵌入模型后维度可能不同
+		}
+		var score float64
+		for i, v := range vector {
+			score += float64(v) * float64(queryVector[i])
+		}
+		results = append(results, &scored{id: id, score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	for _, result := range results {
+		ids = append(ids, result.id)
+		scores = append(scores, result.score)
+	}
+	return
+}
+
+// encodeVector 将向量归一化后编码，归一化后余弦相似度等于点积。
+func encodeVector(vector []float32) []byte {
+	vector = normalizeVector(vector)
+	ret := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(ret[4*i:], math.Float32bits(v))
+	}
+	return ret
+}
+
+func decodeVector(data []byte) []float32 {
+	ret := make([]float32, len(data)/4)
+	for i := range ret {
+		ret[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return ret
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if 0 == norm {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	ret := make([]float32, len(vector))
+	for i, v := range vector {
+		ret[i] = float32(float64(v) / norm)
+	}
+	return ret
+}
@@ -0,0 +1,252 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// letterEmbedder 使用字母频次作为向量嵌入，相同字母越多越相似。
+type letterEmbedder struct {
+	texts []string // 请求嵌入过的文本
+}
+
+func (embedder *letterEmbedder) Embed(texts []string) (ret [][]float32, err error) {
+	embedder.texts = append(embedder.texts, texts...)
+	for _, text := range texts {
+		ret = append(ret, letterVector(text))
+	}
+	return
+}
+
+func letterVector(text string) []float32 {
+	ret := make([]float32, 26)
+	for _, r := range strings.ToLower(text) {
+		if 'a' <= r && 'z' >= r {
+			ret[r-'a']++
+		}
+	}
+	return ret
+}
+
+func initTestEmbedding(t *testing.T, e Embedder) {
+	util.EmbeddingDBPath = filepath.Join(t.TempDir(), "embedding.db")
+	InitEmbeddingDatabase(false)
+	SetEmbedder(e, "letter")
+	embeddingSyncCursor = -1 // 不补齐 blocks 表中的块
+	t.Cleanup(func() {
+		SetEmbedder(nil, "")
+		embeddingDB.Close()
+		embeddingDB = nil
+	})
+}
+
+func TestSearchEmbeddings(t *testing.T) {
+	initTestEmbedding(t, &letterEmbedder{})
+
+	blocks := []*Block{
+		{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/a.sy", Type: "p", Content: "zzzz yyyy"},
+		{ID: "20230101000000-bbbbbbb", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/a.sy", Type: "p", Content: "apple"},
+		{ID: "20230101000000-ccccccc", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/a.sy", Type: "p", Content: "apple banana"},
+		{ID: "20230101000000-ddddddd", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/a.sy", Type: "l", Content: "apple"},
+	}
+	upsertEmbeddingsQueue(blocks)
+	FlushEmbeddingJob()
+
+	ids, scores, err := SearchEmbeddings("apple", 10)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 列表块不嵌入
+	expected := []string{"20230101000000-bbbbbbb", "20230101000000-ccccccc", "20230101000000-aaaaaaa"}
+	if strings.Join(expected, ",") != strings.Join(ids, ",") {
+		t.Fatalf("search embeddings %v not match", ids)
+	}
+	if 0.999 > scores[0] || scores[0] <= scores[1] || scores[1] <= scores[2] {
+		t.Fatalf("scores %v not match", scores)
+	}
+
+	ids, _, err = SearchEmbeddings("apple", 1)
+	if nil != err || 1 != len(ids) || expected[0] != ids[0] {
+		t.Fatalf("search embeddings with limit %v not match", ids)
+	}
+}
+
+func TestUpsertEmbeddingsSkipUnchanged(t *testing.T) {
+	embedder := &letterEmbedder{}
+	initTestEmbedding(t, embedder)
+
+	block := &Block{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/a.sy", Type: "p", Content: "apple"}
+	upsertEmbeddingsQueue([]*Block{block})
+	FlushEmbeddingJob()
+	upsertEmbeddingsQueue([]*Block{block})
+	FlushEmbeddingJob()
+	if 1 != len(embedder.texts) {
+		t.Fatalf("unchanged block should not be embedded again, embedded %v", embedder.texts)
+	}
+
+	changed := *block
+	changed.Content = "banana"
+	upsertEmbeddingsQueue([]*Block{&changed})
+	FlushEmbeddingJob()
+	if 2 != len(embedder.texts) || "banana" != embedder.texts[1] {
+		t.Fatalf("changed block should be embedded again, embedded %v", embedder.texts)
+	}
+	ids, _, _ := SearchEmbeddings("banana", 10)
+	if 1 != len(ids) {
+		t.Fatalf("search embeddings %v not match", ids)
+	}
+}
+
+func TestRemoveEmbeddings(t *testing.T) {
+	initTestEmbedding(t, &letterEmbedder{})
+
+	upsertEmbeddingsQueue([]*Block{
+		{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "apple"},
+		{ID: "20230101000000-bbbbbbb", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "banana"},
+		{ID: "20230101000000-ccccccc", RootID: "20230101000000-sssssss", Box: "box", Path: "/r/s.sy", Type: "p", Content: "cherry"},
+		{ID: "20230101000000-ddddddd", RootID: "20230101000000-ttttttt", Box: "other", Path: "/t.sy", Type: "p", Content: "durian"},
+	})
+	FlushEmbeddingJob()
+
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_ids", ids: []string{"20230101000000-aaaaaaa"}})
+	FlushEmbeddingJob()
+	if ids, _, _ := SearchEmbeddings("apple", 10); 3 != len(ids) {
+		t.Fatalf("delete ids failed: %v", ids)
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_path", box: "box", prefix: "/r/"})
+	FlushEmbeddingJob()
+	if ids, _, _ := SearchEmbeddings("apple", 10); 2 != len(ids) {
+		t.Fatalf("delete path failed: %v", ids)
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_roots", ids: []string{"20230101000000-rrrrrrr"}})
+	FlushEmbeddingJob()
+	if ids, _, _ := SearchEmbeddings("apple", 10); 1 != len(ids) {
+		t.Fatalf("delete roots failed: %v", ids)
+	}
+	removeEmbeddingsQueue(&embeddingOperation{action: "delete_box", box: "other"})
+	FlushEmbeddingJob()
+	if ids, _, _ := SearchEmbeddings("apple", 10); 0 != len(ids) {
+		t.Fatalf("delete box failed: %v", ids)
+	}
+}
+
+func TestDeleteBlocksRemoveEmbeddings(t *testing.T) {
+	openTestDB(t)
+	initTestEmbedding(t, &letterEmbedder{})
+
+	blocks := []*Block{
+		{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "apple"},
+		{ID: "20230101000000-bbbbbbb", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "banana"},
+	}
+	insertTestBlocks(t, blocks)
+	upsertEmbeddingsQueue(blocks)
+	FlushEmbeddingJob()
+
+	tx, err := db.Begin()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = deleteBlocksByIDs(tx, []string{"20230101000000-aaaaaaa"}); nil != err {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	FlushEmbeddingJob()
+
+	ids, _, _ := SearchEmbeddings("apple", 10)
+	if 1 != len(ids) || "20230101000000-bbbbbbb" != ids[0] {
+		t.Fatalf("deleted block should be removed from embeddings: %v", ids)
+	}
+}
+
+func TestSetEmbedderModelChanged(t *testing.T) {
+	embedder := &letterEmbedder{}
+	initTestEmbedding(t, embedder)
+
+	upsertEmbeddingsQueue([]*Block{{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "apple"}})
+	FlushEmbeddingJob()
+
+	SetEmbedder(embedder, "letter")
+	embeddingSyncCursor = -1
+	if ids, _, _ := SearchEmbeddings("apple", 10); 1 != len(ids) {
+		t.Fatalf("embeddings of the same model should be kept: %v", ids)
+	}
+
+	// 不同模型的向量无法比较，需要清空后重新嵌入
+	SetEmbedder(embedder, "other")
+	embeddingSyncCursor = -1
+	if ids, _, _ := SearchEmbeddings("apple", 10); 0 != len(ids) {
+		t.Fatalf("embeddings of the previous model should be cleared: %v", ids)
+	}
+}
+
+func TestSyncEmbeddingsPrune(t *testing.T) {
+	openTestDB(t)
+	initTestEmbedding(t, &letterEmbedder{})
+
+	block := &Block{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "apple"}
+	insertTestBlocks(t, []*Block{block})
+	// 关闭语义搜索期间删除的块仍然留在向量嵌入中
+	upsertEmbeddingsQueue([]*Block{block, {ID: "20230101000000-bbbbbbb", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "apricot"}})
+	FlushEmbeddingJob()
+
+	embeddingSyncCursor = 0
+	for i := 0; i < 3 && 0 <= embeddingSyncCursor; i++ {
+		FlushEmbeddingJob()
+	}
+	ids, _, _ := SearchEmbeddings("apple", 10)
+	if 1 != len(ids) || block.ID != ids[0] {
+		t.Fatalf("embeddings of deleted blocks should be pruned: %v", ids)
+	}
+}
+
+func TestSearchEmbeddingsWithStubServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var data []map[string]interface{}
+		for i, input := range req.Input {
+			data = append(data, map[string]interface{}{"index": i, "embedding": letterVector(input)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+	initTestEmbedding(t, util.NewOpenAIEmbedder("", "", server.URL, "model", 5))
+
+	upsertEmbeddingsQueue([]*Block{
+		{ID: "20230101000000-aaaaaaa", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "h", Content: "kiwi"},
+		{ID: "20230101000000-bbbbbbb", RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "melon"},
+	})
+	FlushEmbeddingJob()
+
+	ids, _, err := SearchEmbeddings("lemon", 1)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(ids) || "20230101000000-bbbbbbb" != ids[0] {
+		t.Fatalf("search embeddings %v not match", ids)
+	}
+}
@@ -0,0 +1,195 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/vitess-sqlparser/sqlparser"
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// QueryResult 描述了分页查询的结果。
+type QueryResult struct {
+	Rows      []map[string]interface{} `json:"rows"`
+	Total     int                      `json:"total"`     // 满足条件的总行数
+	Page      int                      `json:"page"`      // 当前页，从 1 开始
+	PageSize  int                      `json:"pageSize"`  // 每页行数
+	PageCount int                      `json:"pageCount"` // 总页数
+}
+
+// QueryReadonly 使用绑定参数 args 只读执行查询语句 stmt，返回第 page 页（从 1 开始）的结果和总行数。
+//
+// stmt 只能是 SELECT 或者 WITH 语句，参数使用 ? 或者 :name 占位，args 中的 sql.NamedArg 按照名称绑定。
+// 查询在开启了 query_only 的独立连接上执行，超过 timeout 时中断查询。
+func QueryReadonly(stmt string, args []interface{}, page, pageSize int, timeout time.Duration) (ret *QueryResult, err error) {
+	if stmt, err = checkReadonlyStmt(stmt); nil != err {
+		return
+	}
+	if 1 > page {
+		page = 1
+	}
+	if 1 > pageSize {
+		err = errors.New("page size must be greater than 0")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := db.Conn(ctx)
+	if nil != err {
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "PRAGMA query_only = ON"); nil != err {
+		return
+	}
+	defer func() {
+		// 连接会放回连接池，需要恢复为可写
+		if _, resetErr := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); nil != resetErr {
+			logging.LogErrorf("reset query only failed: %s", resetErr)
+			conn.Raw(func(driverConn interface{}) error { return driver.ErrBadConn }) // 使连接池丢弃该连接
+		}
+	}()
+
+	ret = &QueryResult{Rows: []map[string]interface{}{}, Page: page, PageSize: pageSize}
+	if err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+stmt+"\n)", args...).Scan(&ret.Total); nil != err {
+		err = queryErr(ctx, stmt, err)
+		return
+	}
+	ret.PageCount = (ret.Total + pageSize - 1) / pageSize
+
+	// 分页参数直接拼接整数，避免和 args 中的参数占位混用，语句末尾可能是单行注释，所以括号需要换行
+	pageStmt := "SELECT * FROM (" + stmt + "\n) LIMIT " + strconv.Itoa(pageSize) + " OFFSET " + strconv.Itoa((page-1)*pageSize)
+	rows, err := conn.QueryContext(ctx, pageStmt, args...)
+	if nil != err {
+		err = queryErr(ctx, stmt, err)
+		return
+	}
+	defer rows.Close()
+	if ret.Rows, err = scanMapRows(rows); nil != err {
+		err = queryErr(ctx, stmt, err)
+	}
+	return
+}
+
+// checkReadonlyStmt 检查 stmt 是否为 SELECT 或者 WITH 查询语句，返回去掉末尾分号后的语句。
+func checkReadonlyStmt(stmt string) (ret string, err error) {
+	ret = strings.TrimSpace(stmt)
+	for strings.HasSuffix(ret, ";") {
+		ret = strings.TrimSpace(strings.TrimSuffix(ret, ";"))
+	}
+	if "" == ret {
+		err = errors.New("statement is empty")
+		return
+	}
+
+	if hasMultipleStmts(ret) {
+		err = errors.New("only one statement is allowed")
+		return
+	}
+
+	keyword := strings.ToUpper(strings.Fields(ret)[0])
+	if !strings.HasPrefix(keyword, "SELECT") && !strings.HasPrefix(keyword, "WITH") && !strings.HasPrefix(keyword, "(") {
+		err = errors.New("only SELECT or WITH statement is allowed")
+		return
+	}
+
+	// vitess 不支持部分 SQLite 语法（比如 WITH），解析失败时由 query_only 保证只读
+	if parsedStmt, parseErr := sqlparser.Parse(ret); nil == parseErr {
+		switch parsedStmt.(type) {
+		case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+		default:
+			err = errors.New("only SELECT or WITH statement is allowed")
+		}
+	}
+	return
+}
+
+// hasMultipleStmts 判断 stmt 中是否有字符串、标识符和注释以外的分号，即是否包含多条语句。
+func hasMultipleStmts(stmt string) bool {
+	for i := 0; i < len(stmt); i++ {
+		switch c := stmt[i]; c {
+		case ';':
+			return true
+		case '\'', '"', '`', '[':
+			end := c
+			if '[' == c {
+				end = ']'
+			}
+			// 引号内连续两个引号表示转义，跳过后继续查找结束引号即可
+			for i++; i < len(stmt) && end != stmt[i]; i++ {
+			}
+		case '-':
+			if i+1 < len(stmt) && '-' == stmt[i+1] {
+				for ; i < len(stmt) && '\n' != stmt[i]; i++ {
+				}
+			}
+		case '/':
+			if i+1 < len(stmt) && '*' == stmt[i+1] {
+				if end := strings.Index(stmt[i+2:], "*/"); 0 <= end {
+					i += end + 3
+				} else {
+					i = len(stmt)
+				}
+			}
+		}
+	}
+	return false
+}
+
+func queryErr(ctx context.Context, stmt string, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.New("query timeout")
+	}
+	logging.LogWarnf("sql query [%s] failed: %s", stmt, err)
+	return err
+}
+
+func scanMapRows(rows *sql.Rows) (ret []map[string]interface{}, err error) {
+	ret = []map[string]interface{}{}
+	cols, err := rows.Columns()
+	if nil != err {
+		return
+	}
+
+	for rows.Next() {
+		columns := make([]interface{}, len(cols))
+		columnPointers := make([]interface{}, len(cols))
+		for i := range columns {
+			columnPointers[i] = &columns[i]
+		}
+
+		if err = rows.Scan(columnPointers...); nil != err {
+			return
+		}
+
+		m := make(map[string]interface{})
+		for i, colName := range cols {
+			m[colName] = columns[i]
+		}
+		ret = append(ret, m)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,151 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReadonlyStmt(t *testing.T) {
+	cases := []struct {
+		stmt     string
+		expected string // 为空表示应该拒绝
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{" select * from blocks;; ", "select * from blocks"},
+		{"WITH t AS (SELECT 1) SELECT * FROM t;", "WITH t AS (SELECT 1) SELECT * FROM t"},
+		{"(SELECT 1) UNION (SELECT 2)", "(SELECT 1) UNION (SELECT 2)"},
+		{"SELECT ';' AS s, \"a;b\", [c;d] FROM blocks", "SELECT ';' AS s, \"a;b\", [c;d] FROM blocks"},
+		{"SELECT 'it''s;' FROM blocks", "SELECT 'it''s;' FROM blocks"},
+		{"SELECT 1 -- ; comment", "SELECT 1 -- ; comment"},
+		{"SELECT 1 /* ; */ FROM blocks", "SELECT 1 /* ; */ FROM blocks"},
+		// 写入语句
+		{"", ""},
+		{" ; ", ""},
+		{"DELETE FROM blocks", ""},
+		{"UPDATE blocks SET content = ''", ""},
+		{"INSERT INTO blocks (id) VALUES ('x')", ""},
+		{"REPLACE INTO blocks (id) VALUES ('x')", ""},
+		{"DROP TABLE blocks", ""},
+		{"CREATE TABLE t (id)", ""},
+		{"VACUUM", ""},
+		{"ATTACH DATABASE 'other.db' AS other", ""},
+		{"DETACH DATABASE other", ""},
+		{"PRAGMA query_only = OFF", ""},
+		{"PRAGMA writable_schema = 1", ""},
+		// 多条语句
+		{"SELECT 1; DELETE FROM blocks", ""},
+		{"SELECT 1;DELETE FROM blocks;", ""},
+		{"SELECT 1; PRAGMA query_only = OFF", ""},
+		{"SELECT 'a'';'; ATTACH DATABASE 'other.db' AS other", ""},
+		{"WITH t AS (SELECT 1) SELECT * FROM t; DROP TABLE blocks", ""},
+		// 使用注释隐藏的语句
+		{"-- SELECT\nDELETE FROM blocks", ""},
+		{"/* SELECT */ DELETE FROM blocks", ""},
+		{"SELECT 1 /* */; DROP TABLE blocks", ""},
+		{"SELECT 1 --\n; DELETE FROM blocks", ""},
+		{"SELECT 1 /* unclosed ; DELETE FROM blocks", "SELECT 1 /* unclosed ; DELETE FROM blocks"},
+	}
+
+	for _, c := range cases {
+		got, err := checkReadonlyStmt(c.stmt)
+		if "" == c.expected {
+			if nil == err {
+				t.Fatalf("statement [%s] should be rejected", c.stmt)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatalf("statement [%s] should be allowed: %s", c.stmt, err)
+		}
+		if c.expected != got {
+			t.Fatalf("statement [%s] expected [%s], got [%s]", c.stmt, c.expected, got)
+		}
+	}
+}
+
+func TestQueryReadonly(t *testing.T) {
+	openTestDB(t)
+	var blocks []*Block
+	for _, id := range []string{"20230101000000-aaaaaaa", "20230101000000-bbbbbbb", "20230101000000-ccccccc", "20230101000000-ddddddd", "20230101000000-eeeeeee"} {
+		blocks = append(blocks, &Block{ID: id, RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: "content " + id})
+	}
+	blocks[4].Type = "h"
+	insertTestBlocks(t, blocks)
+
+	cases := []struct {
+		stmt           string
+		args           []interface{}
+		page, pageSize int
+		expected       string
+		total          int
+		pageCount      int
+	}{
+		{"SELECT id FROM blocks WHERE type = ? ORDER BY id", []interface{}{"p"}, 1, 3, "aaaaaaa,bbbbbbb,ccccccc", 4, 2},
+		{"SELECT id FROM blocks WHERE type = ? ORDER BY id", []interface{}{"p"}, 2, 3, "ddddddd", 4, 2},
+		{"SELECT id FROM blocks WHERE type = ? ORDER BY id", []interface{}{"p"}, 3, 3, "", 4, 2},
+		{"SELECT id FROM blocks WHERE type = ? ORDER BY id", []interface{}{"h"}, 0, 3, "eeeeeee", 1, 1},
+		{"SELECT id FROM blocks WHERE type = :type AND id > :id ORDER BY id DESC", []interface{}{sql.Named("id", "20230101000000-bbbbbbb"), sql.Named("type", "p")}, 1, 10, "ddddddd,ccccccc", 2, 1},
+		{"SELECT id FROM blocks WHERE content = ?", []interface{}{"content ' OR 1 = 1 --"}, 1, 10, "", 0, 0},
+		{"SELECT id FROM blocks ORDER BY id DESC -- trailing comment", nil, 2, 2, "ccccccc,bbbbbbb", 5, 3},
+		{"WITH t AS (SELECT id FROM blocks WHERE type = 'h') SELECT * FROM t", nil, 1, 10, "eeeeeee", 1, 1},
+	}
+
+	for _, c := range cases {
+		result, err := QueryReadonly(c.stmt, c.args, c.page, c.pageSize, 10*time.Second)
+		if nil != err {
+			t.Fatalf("query [%s] failed: %s", c.stmt, err)
+		}
+
+		var ids []string
+		for _, row := range result.Rows {
+			ids = append(ids, strings.TrimPrefix(row["id"].(string), "20230101000000-"))
+		}
+		if got := strings.Join(ids, ","); c.expected != got {
+			t.Fatalf("query [%s] page [%d] expected [%s], got [%s]", c.stmt, c.page, c.expected, got)
+		}
+		if c.total != result.Total || c.pageCount != result.PageCount || c.pageSize != result.PageSize {
+			t.Fatalf("query [%s] got total [%d], page count [%d], page size [%d]", c.stmt, result.Total, result.PageCount, result.PageSize)
+		}
+	}
+
+	for _, stmt := range []string{"DELETE FROM blocks", "SELECT 1; DELETE FROM blocks", "SELECT * FROM blocks /* */; DROP TABLE blocks"} {
+		if _, err := QueryReadonly(stmt, nil, 1, 10, 10*time.Second); nil == err {
+			t.Fatalf("write statement [%s] should be rejected", stmt)
+		}
+	}
+	if _, err := QueryReadonly("SELECT id FROM blocks", nil, 1, 0, 10*time.Second); nil == err {
+		t.Fatalf("page size 0 should be rejected")
+	}
+	if _, err := QueryReadonly("SELECT id FROM missing", nil, 1, 10, 10*time.Second); nil == err {
+		t.Fatalf("query missing table should fail")
+	}
+
+	// 查询结束后连接恢复为可写
+	for i := 0; i < 4; i++ {
+		if _, err := db.Exec("UPDATE blocks SET content = ? WHERE id = ?", "updated", blocks[0].ID); nil != err {
+			t.Fatalf("connection should be writable after readonly query: %s", err)
+		}
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM blocks").Scan(&count); nil != err || 5 != count {
+		t.Fatalf("blocks should not be changed by rejected statements")
+	}
+}
@@ -42,7 +42,7 @@ var (
 
 type dbQueueOperation struct {
 	inQueueTime                   time.Time
-	action                        string            // upsert/delete/delete_id/rename/rename_sub_tree/delete_box/delete_box_refs/insert_refs/index/delete_ids/update_block_content/delete_assets/av_rebuild
+	action                        string            // upsert/delete/delete_id/rename/rename_sub_tree/delete_box/delete_box_refs/insert_refs/index/delete_ids/update_block_content/delete_assets/av_rebuild/retype_attrs
 	indexPath                     string            // index
 	upsertTree                    *parse.Tree       // upsert/insert_refs/update_refs/delete_refs
 	removeTreeBox, removeTreePath string            // delete
@@ -53,6 +53,7 @@ type dbQueueOperation struct {
 	block                         *Block            // update_block_content
 	removeAssetHashes             []string          // delete_assets
 	av                            *av.AttributeView // av_rebuild
+	attrNames                     []string          // retype_attrs
 }
 
 func FlushTxJob() {
@@ -173,6 +174,9 @@ func execOp(op *dbQueueOperation, tx *sql.Tx, context map[string]interface{}) (e
 			break
 		}
 		err = updateRootContent(tx, path.Base(op.renameTree.HPath), op.renameTree.Root.IALAttr("updated"), op.renameTree.ID)
+		if nil == err {
+			upsertEmbeddingsQueue([]*Block{{ID: op.renameTree.ID, RootID: op.renameTree.ID, Box: op.renameTree.Box, Path: op.renameTree.Path, Type: "d", Content: path.Base(op.renameTree.HPath)}})
+		}
 	case "rename_sub_tree":
 		err = batchUpdateHPath(tx, op.renameTree.Box, op.renameTree.ID, op.renameTree.HPath, context)
 	case "delete_box":
@@ -191,6 +195,8 @@ func execOp(op *dbQueueOperation, tx *sql.Tx, context map[string]interface{}) (e
 		err = deleteAssetsByHashes(tx, op.removeAssetHashes)
 	case "av_rebuild":
 		err = av.RebuildAttributeViewTable(tx, op.av)
+	case "retype_attrs":
+		err = retypeAttributes(tx, op.attrNames)
 	default:
 		msg := fmt.Sprintf("unknown operation [%s]", op.action)
 		logging.LogErrorf(msg)
@@ -213,6 +219,14 @@ func RebuildAttributeViewQueue(av *av.AttributeView) {
 	operationQueue = append(operationQueue, newOp)
 }
 
+func RetypeAttributesQueue(names []string) {
+	dbQueueLock.Lock()
+	defer dbQueueLock.Unlock()
+
+	newOp := &dbQueueOperation{attrNames: names, inQueueTime: time.Now(), action: "retype_attrs"}
+	operationQueue = append(operationQueue, newOp)
+}
+
 func BatchRemoveAssetsQueue(hashes []string) {
 	if 1 > len(hashes) {
 		return
@@ -0,0 +1,287 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+// Task 描述了任务列表项。
+type Task struct {
+	ID       string `json:"id"`       // 任务列表项块 ID
+	ParentID string `json:"parentID"` // 父块 ID
+	RootID   string `json:"rootID"`   // 所在文档 ID
+	Box      string `json:"box"`
+	Path     string `json:"path"`
+	HPath    string `json:"hPath"`    // 所在文档的可读路径，查询时填充
+	Content  string `json:"content"`  // 任务内容
+	Checked  bool   `json:"checked"`  // 是否已完成
+	Due      int64  `json:"due"`      // 截止时间，毫秒时间戳，0 表示没有截止时间
+	Priority int    `json:"priority"` // 优先级，数值越大越优先，0 表示没有优先级
+	Tag      string `json:"tag"`      // 标签，格式与块的标签相同：#a# #b#
+	Created  string `json:"created"`
+	Updated  string `json:"updated"`
+}
+
+const (
+	TaskDueAttr      = "custom-due"      // 任务截止时间属性
+	TaskPriorityAttr = "custom-priority" // 任务优先级属性
+)
+
+// taskDueRegexp 匹配任务内容中的截止日期，比如 📅 2023-05-01、due:2023-05-01 或者 @2023-05-01 18:00
+var taskDueRegexp = regexp.MustCompile(`(?:📅|due:|@)\s*(\d{4}-\d{2}-\d{2}(?: \d{2}:\d{2})?)`)
+
+// taskPriorities 描述了任务内容中的优先级标记。
+var taskPriorities = map[string]int{"!high": 3, "!medium": 2, "!low": 1}
+
+// tasksFromTree 返回文档树 tree 中的所有任务列表项。
+func tasksFromTree(tree *parse.Tree) (ret []*Task) {
+	ast.Walk(tree.Root, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if !entering || ast.NodeListItem != n.Type || nil == n.ListData || 3 != n.ListData.Typ || "" == n.ID {
+			return ast.WalkContinue
+		}
+
+		if task := taskFromNode(n, tree); nil != task {
+			ret = append(ret, task)
+		}
+		return ast.WalkContinue
+	})
+	return
+}
+
+func taskFromNode(n *ast.Node, tree *parse.Tree) (ret *Task) {
+	var p *ast.Node
+	checked := n.ListData.Checked
+	for c := n.FirstChild; nil != c; c = c.Next {
+		if ast.NodeTaskListItemMarker == c.Type {
+			checked = c.TaskListItemChecked
+			continue
+		}
+		if ast.NodeParagraph == c.Type {
+			p = c
+			break
+		}
+	}
+	if nil == p {
+		return
+	}
+	for c := p.FirstChild; nil != c; c = c.Next {
+		if ast.NodeTaskListItemMarker == c.Type {
+			checked = c.TaskListItemChecked
+		}
+	}
+
+	parentID := ""
+	if nil != n.Parent {
+		parentID = n.Parent.ID
+	}
+	content := treenode.NodeStaticContent(p, nil, false)
+	ret = &Task{
+		ID:       n.ID,
+		ParentID: parentID,
+		RootID:   tree.ID,
+		Box:      tree.Box,
+		Path:     tree.Path,
+		Content:  content,
+		Checked:  checked,
+		Tag:      tagFromNode(p),
+		Created:  util.TimeFromID(n.ID),
+		Updated:  n.IALAttr("updated"),
+	}
+	if "" == ret.Updated {
+		ret.Updated = ret.Created
+	}
+
+	if due, ok := ParseAttrValue(AttrValueTypeDate, n.IALAttr(TaskDueAttr)); ok {
+		ret.Due = int64(due)
+	} else if m := taskDueRegexp.FindStringSubmatch(content); nil != m {
+		if due, ok = ParseAttrValue(AttrValueTypeDate, m[1]); ok {
+			ret.Due = int64(due)
+		}
+	}
+
+	if priority, err := strconv.Atoi(strings.TrimSpace(n.IALAttr(TaskPriorityAttr))); nil == err {
+		ret.Priority = priority
+	} else {
+		lowerContent := strings.ToLower(content)
+		for marker, priority := range taskPriorities {
+			if strings.Contains(lowerContent, marker) && priority > ret.Priority {
+				ret.Priority = priority
+			}
+		}
+	}
+	return
+}
+
+func insertTasks(tx *sql.Tx, tasks []*Task) (err error) {
+	if 1 > len(tasks) {
+		return
+	}
+
+	stmt := "INSERT INTO tasks (id, parent_id, root_id, box, path, content, checked, due, priority, tag, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	for _, task := range tasks {
+		checked := 0
+		if task.Checked {
+			checked = 1
+		}
+		var due sql.NullInt64
+		if 0 != task.Due {
+			due = sql.NullInt64{Int64: task.Due, Valid: true}
+		}
+		if err = execStmtTx(tx, stmt, task.ID, task.ParentID, task.RootID, task.Box, task.Path, task.Content, checked, due, task.Priority, task.Tag, task.Created, task.Updated); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func deleteTasksByPathTx(tx *sql.Tx, box, path string) (err error) {
+	stmt := "DELETE FROM tasks WHERE box = ? AND path = ?"
+	err = execStmtTx(tx, stmt, box, path)
+	return
+}
+
+func deleteTasksByBoxTx(tx *sql.Tx, box string) (err error) {
+	stmt := "DELETE FROM tasks WHERE box = ?"
+	err = execStmtTx(tx, stmt, box)
+	return
+}
+
+// TaskQuery 描述了任务查询条件，字段为空时不限制。
+type TaskQuery struct {
+	Checked   *bool  `json:"checked"`   // 是否已完成
+	Box       string `json:"box"`       // 笔记本 ID
+	RootID    string `json:"rootID"`    // 文档 ID
+	Keyword   string `json:"keyword"`   // 内容包含的关键字
+	Tag       string `json:"tag"`       // 包含的标签，不带 #
+	DueAfter  int64  `json:"dueAfter"`  // 截止时间不早于，毫秒时间戳
+	DueBefore int64  `json:"dueBefore"` // 截止时间不晚于，毫秒时间戳
+	NoDue     bool   `json:"noDue"`     // 只查询没有截止时间的任务
+	Priority  int    `json:"priority"`  // 优先级不低于
+
+	Sort  string `json:"sort"`  // 排序字段：due、priority、created、updated，默认为 due
+	Order string `json:"order"` // 排序方式：asc、desc，默认为 asc
+}
+
+// QueryTasks 按照条件 q 查询第 page 页（从 1 开始）的任务和满足条件的任务总数，没有截止时间的任务排在最后。
+func QueryTasks(q *TaskQuery, page, pageSize int) (ret []*Task, total int, err error) {
+	var wheres []string
+	var args []interface{}
+	if nil != q.Checked {
+		wheres = append(wheres, "t.checked = ?")
+		if *q.Checked {
+			args = append(args, 1)
+		} else {
+			args = append(args, 0)
+		}
+	}
+	if "" != q.Box {
+		wheres = append(wheres, "t.box = ?")
+		args = append(args, q.Box)
+	}
+	if "" != q.RootID {
+		wheres = append(wheres, "t.root_id = ?")
+		args = append(args, q.RootID)
+	}
+	if "" != q.Keyword {
+		wheres = append(wheres, "t.content LIKE ?")
+		args = append(args, "%"+q.Keyword+"%")
+	}
+	if "" != q.Tag {
+		wheres = append(wheres, "t.tag LIKE ?")
+		args = append(args, "%#"+q.Tag+"#%")
+	}
+	if q.NoDue {
+		wheres = append(wheres, "t.due IS NULL")
+	}
+	if 0 != q.DueAfter {
+		wheres = append(wheres, "t.due >= ?")
+		args = append(args, q.DueAfter)
+	}
+	if 0 != q.DueBefore {
+		wheres = append(wheres, "t.due <= ?")
+		args = append(args, q.DueBefore)
+	}
+	if 0 < q.Priority {
+		wheres = append(wheres, "t.priority >= ?")
+		args = append(args, q.Priority)
+	}
+	where := ""
+	if 0 < len(wheres) {
+		where = " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	var orderBy string
+	order := "ASC"
+	switch strings.ToLower(q.Order) {
+	case "", "asc":
+	case "desc":
+		order = "DESC"
+	default:
+		err = errors.New(fmt.Sprintf("invalid order [%s]", q.Order))
+		return
+	}
+	switch q.Sort {
+	case "", "due":
+		orderBy = "t.due IS NULL, t.due " + order + ", t.priority DESC"
+	case "priority":
+		orderBy = "t.priority " + order + ", t.due IS NULL, t.due"
+	case "created", "updated":
+		orderBy = "t." + q.Sort + " " + order
+	default:
+		err = errors.New(fmt.Sprintf("invalid sort [%s]", q.Sort))
+		return
+	}
+
+	if err = db.QueryRow("SELECT COUNT(*) FROM tasks AS t"+where, args...).Scan(&total); nil != err {
+		logging.LogErrorf("sql query tasks failed: %s", err)
+		return
+	}
+
+	if 1 > page {
+		page = 1
+	}
+	stmt := "SELECT t.id, t.parent_id, t.root_id, t.box, t.path, IFNULL(b.hpath, ''), t.content, t.checked, IFNULL(t.due, 0), t.priority, t.tag, t.created, t.updated " +
+		"FROM tasks AS t LEFT JOIN blocks AS b ON b.id = t.root_id" + where + " ORDER BY " + orderBy + ", t.id LIMIT ? OFFSET ?"
+	rows, err := query(stmt, append(args, pageSize, (page-1)*pageSize)...)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", stmt, err)
+		return
+	}
+	defer rows.Close()
+	ret = []*Task{}
+	for rows.Next() {
+		task := &Task{}
+		if err = rows.Scan(&task.ID, &task.ParentID, &task.RootID, &task.Box, &task.Path, &task.HPath, &task.Content, &task.Checked, &task.Due, &task.Priority, &task.Tag, &task.Created, &task.Updated); nil != err {
+			logging.LogErrorf("query scan field failed: %s", err)
+			return
+		}
+		ret = append(ret, task)
+	}
+	return
+}
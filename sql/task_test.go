@@ -0,0 +1,80 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/88250/lute/parse"
+	"github.com/wangxu0213/esnote-kernel/treenode"
+	"github.com/wangxu0213/esnote-kernel/util"
+)
+
+func TestTaskFromNode(t *testing.T) {
+	md := "- {: id=\"20230101000000-task001\" updated=\"20230102000000\"}[ ] plain task\n" +
+		"- {: id=\"20230101000000-task002\" custom-due=\"2023-05-01 18:00\" custom-priority=\"5\"}[X] done task 📅 2023-06-01 !low\n" +
+		"  - {: id=\"20230101000000-task003\"}[ ] nested due:2023-07-01 !low !high\n" +
+		"  - {: id=\"20230101000000-task004\" custom-priority=\"high\"}[x] @2023-08-01 09:30 !medium\n" +
+		"- {: id=\"20230101000000-task005\" custom-due=\"someday\"}[ ] bad due 📅 2023-13-01\n" +
+		"{: id=\"20230101000000-list001\"}\n"
+	tree := parse.Parse("", []byte(md), util.NewLute().ParseOptions)
+	tree.ID, tree.Box, tree.Path = "20230101000000-doc0001", "box", "/20230101000000-doc0001.sy"
+
+	dueMs := func(value string) int64 {
+		ret, _ := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		return ret.UnixMilli()
+	}
+	expected := []*Task{
+		{ID: "20230101000000-task001", Content: "plain task", Updated: "20230102000000"},
+		// 属性优先于内容中的截止时间和优先级
+		{ID: "20230101000000-task002", Content: "done task 📅 2023-06-01 !low", Checked: true, Due: dueMs("2023-05-01 18:00"), Priority: 5},
+		// 多个优先级标记取最高的
+		{ID: "20230101000000-task003", Content: "nested due:2023-07-01 !low !high", Due: dueMs("2023-07-01 00:00"), Priority: 3},
+		{ID: "20230101000000-task004", Content: "@2023-08-01 09:30 !medium", Checked: true, Due: dueMs("2023-08-01 09:30"), Priority: 2},
+		{ID: "20230101000000-task005", Content: "bad due 📅 2023-13-01"},
+	}
+
+	tasks := tasksFromTree(tree)
+	if len(expected) != len(tasks) {
+		t.Fatalf("tasks count [%d] not match", len(tasks))
+	}
+	for i, task := range tasks {
+		e := expected[i]
+		if "" == e.Updated {
+			e.Updated = "20230101000000"
+		}
+		if e.ID != task.ID || e.Content != task.Content || e.Checked != task.Checked || e.Due != task.Due || e.Priority != task.Priority || e.Tag != task.Tag || e.Updated != task.Updated {
+			t.Fatalf("task %d expected %+v, got %+v", i, e, task)
+		}
+		if "20230101000000" != task.Created || tree.ID != task.RootID || "box" != task.Box || tree.Path != task.Path {
+			t.Fatalf("task %d location %+v not match", i, task)
+		}
+	}
+
+	// 子任务的父块为所在的子列表
+	subList := treenode.GetNodeInTree(tree, "20230101000000-task003").Parent
+	for i, task := range tasks {
+		parentID := "20230101000000-list001"
+		if 2 == i || 3 == i {
+			parentID = subList.ID
+		}
+		if parentID != task.ParentID {
+			t.Fatalf("parent [%s] of task [%s] not match", task.ParentID, task.ID)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wangxu0213/esnote-kernel/logging"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	fuzzyCandidateLimit = 1024 // 模糊搜索通过三元组召回的最大候选块数
+	fuzzyMaxTextLen     = 4096 // 计算编辑距离时块内容的最大长度（字符数）
+)
+
+// FuzzyBlock 描述了模糊搜索命中的块。
+type FuzzyBlock struct {
+	*Block
+	Distance int      // 所有关键词与块内容的编辑距离之和，越小越相似
+	Spans    [][2]int // 块内容中命中关键词的位置，单位为字符，左闭右开
+}
+
+// FoldText 将文本 text 转换为小写并去掉变音符号（比如 é -> e），每个字符只会转换为一个字符，所以转换前后的字符位置一一对应。
+func FoldText(text string) string {
+	buf := strings.Builder{}
+	buf.Grow(len(text))
+	for _, r := range text {
+		buf.WriteRune(foldRune(r))
+	}
+	return buf.String()
+}
+
+func foldRune(r rune) rune {
+	if utf8.RuneSelf > r {
+		return unicode.ToLower(r)
+	}
+
+	// 仅当分解后基本字符之后都是变音符号时才去掉变音符号，韩文音节等其他分解需要保留原字符
+	decomposed := norm.NFD.String(string(r))
+	base, size := utf8.DecodeRuneInString(decomposed)
+	if size == len(decomposed) {
+		return unicode.ToLower(r)
+	}
+	for _, mark := range decomposed[size:] {
+		if !unicode.Is(unicode.Mn, mark) {
+			return unicode.ToLower(r)
+		}
+	}
+	return unicode.ToLower(base)
+}
+
+// insertTrigrams 插入块的三元组索引，bulk 为 insertBlocks0 中的一批块。
+//
+// 内容为空的块也需要插入，否则后续更新块内容时无法更新索引。
+func insertTrigrams(tx *sql.Tx, bulk []*Block) (err error) {
+	if 1 > len(bulk) {
+		return
+	}
+
+	valueStrings := make([]string, 0, len(bulk))
+	valueArgs := make([]interface{}, 0, len(bulk)*strings.Count(BlocksTrigramPlaceholder, "?"))
+	for _, b := range bulk {
+		valueStrings = append(valueStrings, BlocksTrigramPlaceholder)
+		valueArgs = append(valueArgs, b.ID)
+		valueArgs = append(valueArgs, b.RootID)
+		valueArgs = append(valueArgs, b.Box)
+		valueArgs = append(valueArgs, b.Path)
+		valueArgs = append(valueArgs, b.Type)
+		valueArgs = append(valueArgs, FoldText(b.Content))
+	}
+	stmt := fmt.Sprintf(BlocksTrigramInsert, strings.Join(valueStrings, ","))
+	err = prepareExecInsertTx(tx, stmt, valueArgs)
+	return
+}
+
+// FuzzySearchBlocks 模糊搜索块，关键词 keyword 以空白分隔，每个关键词都需要在块内容中近似出现（允许的编辑距离随关键词长度增加）。
+// filter 为附加的查询条件，比如 " AND type = 'd'"，可以使用的字段有 id、root_id、box、path 和 type。
+// 结果按照编辑距离升序排列，最多返回 limit 个块，limit 小于 1 时返回所有候选块中命中的块。
+func FuzzySearchBlocks(keyword, filter string, limit int) (ret []*FuzzyBlock) {
+	terms := strings.Fields(FoldText(keyword))
+	if 1 > len(terms) {
+		return
+	}
+
+	var trigrams []string
+	seen := map[string]bool{}
+	for _, term := range terms {
+		runes := []rune(term)
+		if 3 > len(runes) {
+			continue
+		}
+		for i := 0; i+3 <= len(runes); i++ {
+			trigram := string(runes[i : i+3])
+			if !seen[trigram] {
+				seen[trigram] = true
+				trigrams = append(trigrams, "\""+strings.ReplaceAll(trigram, "\"", "\"\"")+"\"")
+			}
+		}
+	}
+
+	var stmt string
+	var args []interface{}
+	if 0 < len(trigrams) {
+		stmt = "SELECT id FROM blocks_trigram WHERE blocks_trigram MATCH ?" + filter + " ORDER BY rank LIMIT ?"
+		args = []interface{}{strings.Join(trigrams, " OR "), fuzzyCandidateLimit}
+	} else {
+		// 关键词太短时无法使用三元组，只能精确匹配
+		// 三元组分词器按字节判断 LIKE 是否可以使用索引，两个中日韩字符的关键词会走索引且匹配不到，所以使用 +content 逐行匹配
+		stmt = "SELECT id FROM blocks_trigram WHERE +content LIKE ?" + filter + " LIMIT ?"
+		args = []interface{}{"%" + strings.Join(terms, "%") + "%", fuzzyCandidateLimit}
+	}
+	rows, err := query(stmt, args...)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", stmt, err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); nil != err {
+			logging.LogErrorf("query scan field failed: %s", err)
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if 1 > len(ids) {
+		return
+	}
+
+	ranks := map[string]int{}
+	for i, id := range ids {
+		ranks[id] = i
+	}
+	for _, block := range GetBlocks(ids) {
+		if nil == block {
+			continue
+		}
+
+		content := []rune(FoldText(block.Content))
+		if fuzzyMaxTextLen < len(content) {
+			content = content[:fuzzyMaxTextLen]
+		}
+		match := &FuzzyBlock{Block: block}
+		for _, term := range terms {
+			pattern := []rune(term)
+			distance, start, end := substringDistance(pattern, content)
+			if distance > fuzzyMaxDistance(len(pattern)) {
+				match = nil
+				break
+			}
+			match.Distance += distance
+			match.Spans = append(match.Spans, [2]int{start, end})
+		}
+		if nil != match {
+			ret = append(ret, match)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Distance != ret[j].Distance {
+			return ret[i].Distance < ret[j].Distance
+		}
+		return ranks[ret[i].ID] < ranks[ret[j].ID]
+	})
+	if 0 < limit && limit < len(ret) {
+		ret = ret[:limit]
+	}
+	return
+}
+
+// fuzzyMaxDistance 返回长度为 n 的关键词允许的最大编辑距离。
+func fuzzyMaxDistance(n int) int {
+	if 3 > n {
+		return 0
+	}
+	return 1 + (n-3)/4
+}
+
+// substringDistance 返回 pattern 与 text 中最相似子串的编辑距离，以及该子串在 text 中的起止位置（左闭右开）。
+func substringDistance(pattern, text []rune) (distance, start, end int) {
+	distance, end = substringDistanceEnd(pattern, text, false)
+	if 0 == end {
+		return
+	}
+
+	// 反转后再计算一次，得到最相似子串的起始位置，距离相同时取最长的子串
+	_, reversedEnd := substringDistanceEnd(reverseRunes(pattern), reverseRunes(text[:end]), true)
+	start = end - reversedEnd
+	return
+}
+
+// substringDistanceEnd 计算 pattern 与 text 中任意子串的最小编辑距离，返回距离和最相似子串的结束位置，longest 为 true 时距离相同取最后的结束位置。
+// 编辑距离使用 Sellers 算法在最优字符串对齐距离（相邻字符交换计为一次编辑）上计算。
+func substringDistanceEnd(pattern, text []rune, longest bool) (distance, end int) {
+	prev := make([]int, len(pattern)+1) // 上上一列，用于计算相邻字符交换
+	last := make([]int, len(pattern)+1)
+	column := make([]int, len(pattern)+1)
+	for i := range column {
+		column[i] = i
+	}
+	distance = len(pattern)
+	for j, r := range text {
+		prev, last, column = last, column, prev
+		column[0] = 0 // 子串可以从任意位置开始，所以第一行总是 0
+		for i := 1; i <= len(pattern); i++ {
+			cost := 1
+			if pattern[i-1] == r {
+				cost = 0
+			}
+			value := last[i-1] + cost
+			if last[i]+1 < value {
+				value = last[i] + 1
+			}
+			if column[i-1]+1 < value {
+				value = column[i-1] + 1
+			}
+			if 1 < i && 0 < j && pattern[i-1] == text[j-1] && pattern[i-2] == r && prev[i-2]+1 < value {
+				value = prev[i-2] + 1
+			}
+			column[i] = value
+		}
+		if column[len(pattern)] < distance || (longest && column[len(pattern)] == distance) {
+			distance, end = column[len(pattern)], j+1
+		}
+	}
+	return
+}
+
+func reverseRunes(runes []rune) []rune {
+	ret := make([]rune, len(runes))
+	for i, r := range runes {
+		ret[len(runes)-1-i] = r
+	}
+	return ret
+}
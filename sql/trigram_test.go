@@ -0,0 +1,154 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	if got := FoldText("Café ÉCOLE Straße 中文"); "cafe ecole straße 中文" != got {
+		t.Fatalf("fold text [%s] not match", got)
+	}
+	if got := FoldText("한국어 공부 Ἄθηνα"); "한국어 공부 αθηνα" != got {
+		t.Fatalf("fold text [%s] not match", got)
+	}
+	if text := "Ǆemal Ångström"; len([]rune(text)) != len([]rune(FoldText(text))) {
+		t.Fatalf("fold text should keep rune positions")
+	}
+}
+
+func TestFuzzyMaxDistance(t *testing.T) {
+	cases := []struct{ n, expected int }{{1, 0}, {2, 0}, {3, 1}, {6, 1}, {7, 2}, {11, 3}}
+	for _, c := range cases {
+		if got := fuzzyMaxDistance(c.n); c.expected != got {
+			t.Fatalf("max distance of [%d] expected [%d], got [%d]", c.n, c.expected, got)
+		}
+	}
+}
+
+func TestSubstringDistance(t *testing.T) {
+	cases := []struct {
+		pattern, text        string
+		distance, start, end int
+	}{
+		{"abc", "xxabcxx", 0, 2, 5},
+		{"bac", "xxabcxx", 1, 2, 5},    // 相邻字符交换
+		{"abxc", "zabcz", 1, 1, 4},     // 多一个字符
+		{"abc", "zaxbcz", 1, 1, 5},     // 少一个字符
+		{"xbc", "zabcz", 1, 1, 4},      // 替换
+		{"abcd", "abce abcd", 0, 5, 9}, // 精确匹配优先于前面的近似匹配
+		{"hello", "helo world", 1, 0, 4},
+		{"abd", "zabcz", 1, 1, 3}, // 距离相同时取最先结束的子串
+		{"搜索", "中文的搜索引擎", 0, 3, 5},
+		{"abc", "zzz", 3, 0, 0},
+		{"abc", "", 3, 0, 0},
+	}
+
+	for _, c := range cases {
+		distance, start, end := substringDistance([]rune(c.pattern), []rune(c.text))
+		if c.distance != distance || c.start != start || c.end != end {
+			t.Fatalf("distance of [%s] in [%s] expected [%d, %d, %d], got [%d, %d, %d]", c.pattern, c.text, c.distance, c.start, c.end, distance, start, end)
+		}
+	}
+}
+
+func fuzzyResult(blocks []*FuzzyBlock) string {
+	var ret []string
+	for _, b := range blocks {
+		ret = append(ret, fmt.Sprintf("%s:%d", b.ID[len(b.ID)-1:], b.Distance))
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestFuzzySearchBlocks(t *testing.T) {
+	openTestDB(t)
+
+	var blocks []*Block
+	for i, content := range []string{"The quick brown fox", "quikc brown", "qick brwn", "", "unrelated text", "QUICK", "한국어 공부", "가방"} {
+		id := "20230101000000-block0" + string(rune('a'+i))
+		blocks = append(blocks, &Block{ID: id, RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: content})
+	}
+	blocks[5].Type = "h"
+	insertTestBlocks(t, blocks)
+
+	cases := []struct {
+		keyword, filter string
+		limit           int
+		expected        string
+	}{
+		{"quick brown", "", 10, "a:0,b:1,c:2"},
+		{"QUÍCK  Brown", "", 10, "a:0,b:1,c:2"},
+		{"quick brown", "", 1, "a:0"},
+		{"quick brown", "", 0, "a:0,b:1,c:2"},
+		{"quick", " AND type = 'h'", 10, "f:0"},
+		{"ox", "", 10, "a:0"}, // 关键词太短时精确匹配
+		{"browm fox", "", 10, "a:1"},
+		{"brwon", "", 10, "c:1"}, // 和 brown 没有相同的三元组，无法召回
+		{"zebra", "", 10, ""},
+		{"공부", "", 10, "g:0"}, // 韩文音节不能只保留初声
+		{"가방", "", 10, "h:0"},
+		{"한국어 공부", "", 10, "g:0"},
+		{" ", "", 10, ""},
+	}
+	for _, c := range cases {
+		if got := fuzzyResult(FuzzySearchBlocks(c.keyword, c.filter, c.limit)); c.expected != got {
+			t.Fatalf("fuzzy search [%s%s] expected [%s], got [%s]", c.keyword, c.filter, c.expected, got)
+		}
+	}
+
+	ret := FuzzySearchBlocks("quick brown", "", 1)
+	if 1 != len(ret) || "[[4 9] [10 15]]" != fmt.Sprint(ret[0].Spans) {
+		t.Fatalf("spans %v not match", ret[0].Spans)
+	}
+
+	// 内容为空的块更新内容后可以被搜索到
+	tx, err := db.Begin()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = updateBlockContent(tx, &Block{ID: blocks[3].ID, RootID: blocks[3].RootID, Box: "box", Path: "/r.sy", Type: "p", Content: "Quick Brown"}); nil != err {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if got := fuzzyResult(FuzzySearchBlocks("quick brown", "", 2)); "a:0,d:0" != got && "d:0,a:0" != got {
+		t.Fatalf("updated empty block should be searchable, got [%s]", got)
+	}
+}
+
+func TestInsertTrigramsBatch(t *testing.T) {
+	openTestDB(t)
+
+	var blocks []*Block
+	for i := 0; i < 1100; i++ {
+		blocks = append(blocks, &Block{ID: fmt.Sprintf("20230101000000-%07d", i), RootID: "20230101000000-rrrrrrr", Box: "box", Path: "/r.sy", Type: "p", Content: []string{"alpha", "beta", "gamma"}[i%3]})
+	}
+	insertTestBlocks(t, blocks)
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM blocks_trigram").Scan(&count); nil != err {
+		t.Fatal(err)
+	}
+	if len(blocks) != count {
+		t.Fatalf("trigram rows [%d] not match", count)
+	}
+	if ret := FuzzySearchBlocks("gamam", "", 0); 366 != len(ret) {
+		t.Fatalf("fuzzy search count [%d] not match", len(ret))
+	}
+}
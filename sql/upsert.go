@@ -41,12 +41,14 @@ const (
 	BlocksFTSInsert                = "INSERT INTO blocks_fts (id, parent_id, root_id, hash, box, path, hpath, name, alias, memo, tag, content, fcontent, markdown, length, type, subtype, ial, sort, created, updated) VALUES %s"
 	BlocksFTSCaseInsensitiveInsert = "INSERT INTO blocks_fts_case_insensitive (id, parent_id, root_id, hash, box, path, hpath, name, alias, memo, tag, content, fcontent, markdown, length, type, subtype, ial, sort, created, updated) VALUES %s"
 	BlocksPlaceholder              = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	BlocksTrigramInsert            = "INSERT INTO blocks_trigram (id, root_id, box, path, type, content) VALUES %s"
+	BlocksTrigramPlaceholder       = "(?, ?, ?, ?, ?, ?)"
 
 	SpansInsert      = "INSERT INTO spans (id, block_id, root_id, box, path, content, markdown, type, ial) VALUES %s"
 	SpansPlaceholder = "(?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
 	AssetsPlaceholder             = "(?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	AttributesPlaceholder         = "(?, ?, ?, ?, ?, ?, ?, ?)"
+	AttributesPlaceholder         = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	RefsPlaceholder               = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	FileAnnotationRefsPlaceholder = "(?, ?, ?, ?, ?, ?, ?, ?, ?)"
 )
@@ -127,6 +129,9 @@ func insertBlocks0(tx *sql.Tx, bulk []*Block, context map[string]interface{}) (e
 			return
 		}
 	}
+	if err = insertTrigrams(tx, bulk); nil != err {
+		return
+	}
 	hashBuf.WriteString("fts")
 	evtHash = fmt.Sprintf("%x", sha256.Sum256(hashBuf.Bytes()))[:7]
 	eventbus.Publish(eventbus.EvtSQLInsertBlocksFTS, context, len(bulk), evtHash)
@@ -171,12 +176,15 @@ func insertAttribute0(tx *sql.Tx, bulk []*Attribute) (err error) {
 		valueArgs = append(valueArgs, attr.Name)
 		valueArgs = append(valueArgs, attr.Value)
 		valueArgs = append(valueArgs, attr.Type)
+		valueType, num := AttributeValueType(attr.Name, attr.Value)
+		valueArgs = append(valueArgs, valueType)
+		valueArgs = append(valueArgs, num)
 		valueArgs = append(valueArgs, attr.BlockID)
 		valueArgs = append(valueArgs, attr.RootID)
 		valueArgs = append(valueArgs, attr.Box)
 		valueArgs = append(valueArgs, attr.Path)
 	}
-	stmt := fmt.Sprintf("INSERT INTO attributes (id, name, value, type, block_id, root_id, box, path) VALUES %s", strings.Join(valueStrings, ","))
+	stmt := fmt.Sprintf("INSERT INTO attributes (id, name, value, type, value_type, num, block_id, root_id, box, path) VALUES %s", strings.Join(valueStrings, ","))
 	err = prepareExecInsertTx(tx, stmt, valueArgs)
 	return
 }
@@ -458,6 +466,9 @@ func upsertTree(tx *sql.Tx, tree *parse.Tree, context map[string]interface{}) (e
 	if err = deleteFileAnnotationRefsByPathTx(tx, tree.Box, tree.Path); nil != err {
 		return
 	}
+	if err = deleteTasksByPathTx(tx, tree.Box, tree.Path); nil != err {
+		return
+	}
 
 	refs, fileAnnotationRefs := refsFromTree(tree)
 	if err = insertTree0(tx, tree, context, blocks, spans, assets, attributes, refs, fileAnnotationRefs); nil != err {
@@ -495,5 +506,9 @@ func insertTree0(tx *sql.Tx, tree *parse.Tree, context map[string]interface{},
 	if err = insertAttributes(tx, attributes); nil != err {
 		return
 	}
+	if err = insertTasks(tx, tasksFromTree(tree)); nil != err {
+		return
+	}
+	upsertEmbeddingsQueue(blocks)
 	return
 }
@@ -0,0 +1,113 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wangxu0213/esnote-kernel/logging"
+)
+
+// OpenAIEmbedder 通过兼容 OpenAI 的 /embeddings 接口获取文本的向量嵌入。
+type OpenAIEmbedder struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+func NewOpenAIEmbedder(apiKey, apiProxy, apiBaseURL, model string, timeout int) *OpenAIEmbedder {
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	if "" != apiProxy {
+		proxyUrl, err := url.Parse(apiProxy)
+		if nil != err {
+			logging.LogErrorf("OpenAI API proxy failed: %v", err)
+		} else {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
+		}
+	}
+
+	return &OpenAIEmbedder{
+		client:  client,
+		baseURL: strings.TrimSuffix(apiBaseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+	}
+}
+
+// Embed 返回文本 texts 的向量嵌入，返回的向量与 texts 一一对应。
+func (embedder *OpenAIEmbedder) Embed(texts []string) (ret [][]float32, err error) {
+	reqBody, err := json.Marshal(map[string]interface{}{"model": embedder.model, "input": texts})
+	if nil != err {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, embedder.baseURL+"/embeddings", bytes.NewReader(reqBody))
+	if nil != err {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if "" != embedder.apiKey {
+		req.Header.Set("Authorization", "Bearer "+embedder.apiKey)
+	}
+
+	resp, err := embedder.client.Do(req)
+	if nil != err {
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if nil != err {
+		return
+	}
+	if http.StatusOK != resp.StatusCode {
+		err = errors.New(fmt.Sprintf("request embeddings failed [%d]: %s", resp.StatusCode, respBody))
+		return
+	}
+
+	result := struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+			Index     int       `json:"index"`
+		} `json:"data"`
+	}{}
+	if err = json.Unmarshal(respBody, &result); nil != err {
+		return
+	}
+	if len(result.Data) != len(texts) {
+		err = errors.New(fmt.Sprintf("embeddings count [%d] mismatch input count [%d]", len(result.Data), len(texts)))
+		return
+	}
+
+	ret = make([][]float32, len(texts))
+	for _, data := range result.Data {
+		if 0 > data.Index || data.Index >= len(texts) {
+			err = errors.New(fmt.Sprintf("invalid embedding index [%d]", data.Index))
+			return
+		}
+		ret[data.Index] = data.Embedding
+	}
+	return
+}
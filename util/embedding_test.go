@@ -0,0 +1,76 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIEmbedderEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "/v1/embeddings" != r.URL.Path || "Bearer key" != r.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); nil != err || "model" != req.Model {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// 倒序返回，检查是否按照 index 对应输入
+		var data []map[string]interface{}
+		for i := len(req.Input) - 1; 0 <= i; i-- {
+			data = append(data, map[string]interface{}{"index": i, "embedding": []float32{float32(len(req.Input[i])), 1}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("key", "", server.URL+"/v1/", "model", 5)
+	vectors, err := embedder.Embed([]string{"a", "abc"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(vectors) || 1 != vectors[0][0] || 3 != vectors[1][0] {
+		t.Fatalf("embeddings %v not match", vectors)
+	}
+
+	embedder = NewOpenAIEmbedder("wrong", "", server.URL+"/v1", "model", 5)
+	if _, err = embedder.Embed([]string{"a"}); nil == err {
+		t.Fatalf("unauthorized request should fail")
+	}
+}
+
+func TestOpenAIEmbedderCountMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1]}]}`))
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("", "", server.URL, "model", 5)
+	if _, err := embedder.Embed([]string{"a", "b"}); nil == err {
+		t.Fatalf("mismatched embeddings count should fail")
+	}
+}
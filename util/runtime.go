@@ -38,7 +38,7 @@ import (
 	"github.com/wangxu0213/esnote-kernel/logging"
 )
 
-const DatabaseVer = "20220501" // 修改表结构的话需要修改这里
+const DatabaseVer = "20261017" // 修改表结构的话需要修改这里
 
 // IsExiting 是否正在退出程序。
 var IsExiting = false
@@ -179,6 +179,8 @@ var (
 	IconsPath      string        // 配置目录下的外观目录下的 icons/ 路径
 	SnippetsPath   string        // 数据目录下的 snippets/ 路径
 
+	EmbeddingDBPath string // SQLite 向量嵌入数据库文件路径
+
 	UIProcessIDs = sync.Map{} // UI 进程 ID
 )
 
@@ -255,6 +257,7 @@ func initWorkspaceDir(workspaceArg string) {
 	os.Setenv("TMP", osTmpDir)
 	DBPath = filepath.Join(TempDir, DBName)
 	HistoryDBPath = filepath.Join(TempDir, "history.db")
+	EmbeddingDBPath = filepath.Join(TempDir, "embedding.db")
 	BlockTreePath = filepath.Join(TempDir, "blocktree")
 	SnippetsPath = filepath.Join(DataDir, "snippets")
 }